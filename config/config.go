@@ -1,22 +1,315 @@
 package config
 
 import (
+	"log"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
 type Config struct {
-	ServerPort      string
-	MatcherInterval time.Duration
+	ServerPort                string
+	MatcherInterval           time.Duration
+	MatcherStallFactor        int
+	MaxNotesLength            int
+	MaxIDLength               int
+	MaxNameLength             int
+	MaxBatchIDs               int
+	GenerateOrderIDs          bool
+	GenerateDriverIDs         bool
+	PickupDropoffEpsilonM     float64
+	RejectDuplicateLocations  string
+	DuplicateLocationEpsilonM float64
+	MatchAgingWeight          float64
+	MatchMaxAttempts          int
+	MatcherWorkers            int
+	MatcherMode               string
+	MatcherBalanceToleranceKm float64
+	MatcherBalanceWindow      time.Duration
+	WeightDistance            float64
+	WeightRating              float64
+	WeightAge                 float64
+	WeightHeading             float64
+	OfferDrivers              int
+	OfferTTL                  time.Duration
+	OfferLapseHalfLife        time.Duration
+	OfferSweepInterval        time.Duration
+	AuditLogPath              string
+	Zones                     string
+	CancelReasons             []string
+	ZoneOverflow              bool
+	OrderAdmissionControl     string
+	OrderAdmissionMaxRatio    float64
+	OrderAdmissionSustain     time.Duration
+	OrderAdmissionTripTime    time.Duration
+	AuditLogSize              int
+	AuditFlushInterval        time.Duration
+	WebhookURL                string
+	WebhookSecret             string
+	WebhookEvents             []string
+	WebhookMaxAttempts        int
+	WebhookRetryBackoff       time.Duration
+	WebhookTimeout            time.Duration
+	MatcherBreakerThreshold   int
+	MatcherBreakerCooldown    time.Duration
+	MaxMatchDistanceKm        float64
+	IdempotencyTTL            time.Duration
+	IdempotencyMaxKeys        int
+	ReadTimeout               time.Duration
+	WriteTimeout              time.Duration
+	IdleTimeout               time.Duration
+	RequestTimeout            time.Duration
+	MaxConcurrentRequests     int
+	MaxConcurrentReads        int
+	MaxConcurrentWrites       int
+	ListCacheTTL              time.Duration
+	ShutdownTimeout           time.Duration
+	DriverSpeedKmh            float64
+	BaseFare                  float64
+	PerKmRate                 float64
+	MinOrderValue             float64
+	MaxClockSkew              time.Duration
+	DriverCooldown            time.Duration
+	StuckAssignedThreshold    time.Duration
+	StuckPickedUpThreshold    time.Duration
+	CancelRequiresCustomer    bool
+	StoreBackend              string
+	StoreFilePath             string
+	StoreCompactAfter         int
+	GeoIndexEnabled           bool
+	MaxDrivers                int
+	MaxOrders                 int
+	MaxOrdersPerCustomer      int
+	DriverCapacity            int
+	LocationHistorySize       int
+	DefaultPageSize           int
+	MaxPageSize               int
+	GinMode                   string
+	LogLevel                  string
+	APINaming                 string
+	APIErrorFormat            string
+	APIVersionPrefix          string
+	APIUnversionedRoutes      bool
+	FeatureFlags              string
+	StrictStatus              bool
+	OmitZeroLocation          bool
+	DistanceUnit              string
+	DebugResetEnabled         bool
+	DebugRestoreEnabled       bool
+	DebugMatchEnabled         bool
+	DebugSeedEnabled          bool
+	DebugSimulateEnabled      bool
+	SimulationTick            time.Duration
+	DebugStateMaxWait         time.Duration
+	DebugStateMaxBytes        int
+	PprofEnabled              bool
+	LockMetricsEnabled        bool
+	DebugToken                string
 }
 
 func LoadConfig() *Config {
 	serverPort := getEnv("SERVER_PORT", ":8080")
-	matcherInterval := getDurationEnv("MATCHER_INTERVAL", 3*time.Second)
+	matcherInterval := getDurationEnv("MATCHER_INTERVAL", 3*time.Second, 10*time.Millisecond)
+	matcherStallFactor := getIntEnv("MATCHER_STALL_FACTOR", 3)
+	maxNotesLength := getIntEnv("MAX_NOTES_LENGTH", 500)
+	maxIDLength := getIntEnv("MAX_ID_LENGTH", 128)
+	maxNameLength := getIntEnv("MAX_NAME_LENGTH", 200)
+	maxBatchIDs := getIntEnv("MAX_BATCH_IDS", 100)
+	generateOrderIDs := getBoolEnv("GENERATE_ORDER_IDS", false)
+	generateDriverIDs := getBoolEnv("GENERATE_DRIVER_IDS", false)
+	pickupDropoffEpsilonM := getFloatEnv("PICKUP_DROPOFF_EPSILON_M", 10)
+	rejectDuplicateLocations := getEnv("REJECT_DUPLICATE_LOCATIONS", "off")
+	duplicateLocationEpsilonM := getFloatEnv("DUPLICATE_LOCATION_EPSILON_M", 1)
+	matchAgingWeight := getFloatEnv("MATCH_AGING_WEIGHT", 0.5)
+	matchMaxAttempts := getIntEnv("MATCH_MAX_ATTEMPTS", 100)
+	matcherWorkers := getIntEnv("MATCHER_WORKERS", 1)
+	matcherMode := getEnv("MATCHER_MODE", "nearest")
+	matcherBalanceToleranceKm := getFloatEnv("MATCHER_BALANCE_TOLERANCE_KM", 2)
+	matcherBalanceWindow := getDurationEnv("MATCHER_BALANCE_WINDOW", time.Hour, time.Second)
+	weightDistance := getFloatEnv("WEIGHT_DISTANCE", 1)
+	weightRating := getFloatEnv("WEIGHT_RATING", 0)
+	weightAge := getFloatEnv("WEIGHT_AGE", 0)
+	weightHeading := getFloatEnv("WEIGHT_HEADING", 0)
+	offerDrivers := getIntEnv("OFFER_DRIVERS", 3)
+	// OFFER_TTL is the older name of OFFER_TIMEOUT
+	offerTTL := getDurationEnv("OFFER_TIMEOUT", getDurationEnv("OFFER_TTL", 30*time.Second, time.Second), time.Second)
+	offerLapseHalfLife := getDurationEnv("OFFER_LAPSE_HALF_LIFE", time.Hour, 0)
+	offerSweepInterval := getDurationEnv("OFFER_SWEEP_INTERVAL", time.Second, 10*time.Millisecond)
+	auditLogPath := getEnv("AUDIT_LOG_PATH", "")
+	zones := getEnv("ZONES", "")
+	cancelReasons := getListEnv("CANCEL_REASONS")
+	zoneOverflow := getBoolEnv("ZONE_OVERFLOW", false)
+	orderAdmissionControl := getEnv("ORDER_ADMISSION_CONTROL", "off")
+	orderAdmissionMaxRatio := getFloatEnv("ORDER_ADMISSION_MAX_RATIO", 10)
+	orderAdmissionSustain := getDurationEnv("ORDER_ADMISSION_SUSTAIN", 30*time.Second, 0)
+	orderAdmissionTripTime := getDurationEnv("ORDER_ADMISSION_TRIP_TIME", 15*time.Minute, time.Second)
+	auditLogSize := getIntEnv("AUDIT_LOG_SIZE", 1000)
+	auditFlushInterval := getDurationEnv("AUDIT_FLUSH_INTERVAL", 0, 0)
+	webhookURL := getEnv("WEBHOOK_URL", "")
+	webhookSecret := getEnv("WEBHOOK_SECRET", "")
+	webhookEvents := getListEnv("WEBHOOK_EVENTS")
+	webhookMaxAttempts := getIntEnv("WEBHOOK_MAX_ATTEMPTS", 5)
+	webhookRetryBackoff := getDurationEnv("WEBHOOK_RETRY_BACKOFF", time.Second, 10*time.Millisecond)
+	webhookTimeout := getDurationEnv("WEBHOOK_TIMEOUT", 5*time.Second, 100*time.Millisecond)
+	matcherBreakerThreshold := getIntEnv("MATCHER_BREAKER_THRESHOLD", 5)
+	matcherBreakerCooldown := getDurationEnv("MATCHER_BREAKER_COOLDOWN", 30*time.Second, 0)
+	maxMatchDistanceKm := getFloatEnv("MAX_MATCH_DISTANCE_KM", 0)
+	idempotencyTTL := getDurationEnv("IDEMPOTENCY_TTL", 24*time.Hour, time.Second)
+	idempotencyMaxKeys := getIntEnv("IDEMPOTENCY_MAX_KEYS", 10000)
+	readTimeout := getDurationEnv("READ_TIMEOUT", 10*time.Second, 0)
+	writeTimeout := getDurationEnv("WRITE_TIMEOUT", 10*time.Second, 0)
+	idleTimeout := getDurationEnv("IDLE_TIMEOUT", 60*time.Second, 0)
+	requestTimeout := getDurationEnv("REQUEST_TIMEOUT", 5*time.Second, 0)
+	maxConcurrentRequests := getIntEnv("MAX_CONCURRENT_REQUESTS", 0)
+	maxConcurrentReads := getIntEnv("MAX_CONCURRENT_READS", 0)
+	maxConcurrentWrites := getIntEnv("MAX_CONCURRENT_WRITES", 0)
+	listCacheTTL := getDurationEnv("LIST_CACHE_TTL", 0, 0)
+	shutdownTimeout := getDurationEnv("SHUTDOWN_TIMEOUT", 15*time.Second, 0)
+	driverSpeedKmh := getFloatEnv("DRIVER_SPEED_KMH", 30)
+	baseFare := getFloatEnv("BASE_FARE", 2.5)
+	perKmRate := getFloatEnv("PER_KM_RATE", 1.2)
+	minOrderValue := getFloatEnv("MIN_ORDER_VALUE", 0)
+	maxClockSkew := getDurationEnv("MAX_CLOCK_SKEW", 0, 0)
+	driverCooldown := getDurationEnv("DRIVER_COOLDOWN", 0, 0)
+	stuckAssignedThreshold := getDurationEnv("STUCK_ASSIGNED_THRESHOLD", 30*time.Minute, 0)
+	stuckPickedUpThreshold := getDurationEnv("STUCK_PICKEDUP_THRESHOLD", 2*time.Hour, 0)
+	cancelRequiresCustomer := getBoolEnv("CANCEL_REQUIRES_CUSTOMER", true)
+	storeBackend := getEnv("STORE_BACKEND", "memory")
+	storeFilePath := getEnv("STORE_FILE_PATH", "state.json")
+	storeCompactAfter := getIntEnv("STORE_COMPACT_AFTER", 1000)
+	geoIndexEnabled := getBoolEnv("GEO_INDEX_ENABLED", true)
+	maxDrivers := getIntEnv("MAX_DRIVERS", 0)
+	maxOrders := getIntEnv("MAX_ORDERS", 0)
+	maxOrdersPerCustomer := getIntEnv("MAX_ORDERS_PER_CUSTOMER", 0)
+	driverCapacity := getIntEnv("DRIVER_CAPACITY", 1)
+	locationHistorySize := getIntEnv("LOCATION_HISTORY_SIZE", 50)
+	defaultPageSize := getIntEnv("DEFAULT_PAGE_SIZE", 50)
+	maxPageSize := getIntEnv("MAX_PAGE_SIZE", 500)
+	ginMode := getEnv("GIN_MODE", "debug")
+	// Default to debug logs only when gin itself runs in debug mode
+	defaultLogLevel := "info"
+	if ginMode == "debug" {
+		defaultLogLevel = "debug"
+	}
+	logLevel := getEnv("LOG_LEVEL", defaultLogLevel)
+	apiNaming := getEnv("API_NAMING", "snake")
+	distanceUnit := getEnv("DISTANCE_UNIT", "km")
+	apiErrorFormat := getEnv("API_ERROR_FORMAT", "structured")
+	apiVersionPrefix := getEnv("API_VERSION_PREFIX", "/v1")
+	apiUnversionedRoutes := getBoolEnv("API_UNVERSIONED_ROUTES", true)
+	featureFlags := getEnv("FEATURE_FLAGS", "")
+	strictStatus := getBoolEnv("STRICT_STATUS", true)
+	omitZeroLocation := getBoolEnv("API_OMIT_ZERO_LOCATION", false)
+	debugResetEnabled := getBoolEnv("DEBUG_RESET_ENABLED", false)
+	debugRestoreEnabled := getBoolEnv("DEBUG_RESTORE_ENABLED", false)
+	debugMatchEnabled := getBoolEnv("DEBUG_MATCH_ENABLED", false)
+	debugSeedEnabled := getBoolEnv("DEBUG_SEED_ENABLED", false)
+	debugSimulateEnabled := getBoolEnv("DEBUG_SIMULATE_ENABLED", false)
+	simulationTick := getDurationEnv("SIMULATION_TICK", time.Second, 10*time.Millisecond)
+	debugStateMaxWait := getDurationEnv("DEBUG_STATE_MAX_WAIT", 30*time.Second, 0)
+	debugStateMaxBytes := getIntEnv("DEBUG_STATE_MAX_BYTES", 0)
+	pprofEnabled := getBoolEnv("PPROF_ENABLED", false)
+	lockMetricsEnabled := getBoolEnv("LOCK_METRICS_ENABLED", false)
+	debugToken := getEnv("DEBUG_TOKEN", "")
 	return &Config{
-		ServerPort:      serverPort,
-		MatcherInterval: matcherInterval,
+		ServerPort:                serverPort,
+		MatcherInterval:           matcherInterval,
+		MatcherStallFactor:        matcherStallFactor,
+		MaxNotesLength:            maxNotesLength,
+		MaxIDLength:               maxIDLength,
+		MaxNameLength:             maxNameLength,
+		MaxBatchIDs:               maxBatchIDs,
+		GenerateOrderIDs:          generateOrderIDs,
+		GenerateDriverIDs:         generateDriverIDs,
+		PickupDropoffEpsilonM:     pickupDropoffEpsilonM,
+		RejectDuplicateLocations:  rejectDuplicateLocations,
+		DuplicateLocationEpsilonM: duplicateLocationEpsilonM,
+		MatchAgingWeight:          matchAgingWeight,
+		MatchMaxAttempts:          matchMaxAttempts,
+		MatcherWorkers:            matcherWorkers,
+		MatcherMode:               matcherMode,
+		MatcherBalanceToleranceKm: matcherBalanceToleranceKm,
+		MatcherBalanceWindow:      matcherBalanceWindow,
+		WeightDistance:            weightDistance,
+		WeightRating:              weightRating,
+		WeightAge:                 weightAge,
+		WeightHeading:             weightHeading,
+		OfferDrivers:              offerDrivers,
+		OfferTTL:                  offerTTL,
+		OfferLapseHalfLife:        offerLapseHalfLife,
+		OfferSweepInterval:        offerSweepInterval,
+		AuditLogPath:              auditLogPath,
+		Zones:                     zones,
+		CancelReasons:             cancelReasons,
+		ZoneOverflow:              zoneOverflow,
+		OrderAdmissionControl:     orderAdmissionControl,
+		OrderAdmissionMaxRatio:    orderAdmissionMaxRatio,
+		OrderAdmissionSustain:     orderAdmissionSustain,
+		OrderAdmissionTripTime:    orderAdmissionTripTime,
+		AuditLogSize:              auditLogSize,
+		AuditFlushInterval:        auditFlushInterval,
+		WebhookURL:                webhookURL,
+		WebhookSecret:             webhookSecret,
+		WebhookEvents:             webhookEvents,
+		WebhookMaxAttempts:        webhookMaxAttempts,
+		WebhookRetryBackoff:       webhookRetryBackoff,
+		WebhookTimeout:            webhookTimeout,
+		MatcherBreakerThreshold:   matcherBreakerThreshold,
+		MatcherBreakerCooldown:    matcherBreakerCooldown,
+		MaxMatchDistanceKm:        maxMatchDistanceKm,
+		IdempotencyTTL:            idempotencyTTL,
+		IdempotencyMaxKeys:        idempotencyMaxKeys,
+		ReadTimeout:               readTimeout,
+		WriteTimeout:              writeTimeout,
+		IdleTimeout:               idleTimeout,
+		RequestTimeout:            requestTimeout,
+		MaxConcurrentRequests:     maxConcurrentRequests,
+		MaxConcurrentReads:        maxConcurrentReads,
+		MaxConcurrentWrites:       maxConcurrentWrites,
+		ListCacheTTL:              listCacheTTL,
+		ShutdownTimeout:           shutdownTimeout,
+		DriverSpeedKmh:            driverSpeedKmh,
+		BaseFare:                  baseFare,
+		PerKmRate:                 perKmRate,
+		MinOrderValue:             minOrderValue,
+		MaxClockSkew:              maxClockSkew,
+		DriverCooldown:            driverCooldown,
+		StuckAssignedThreshold:    stuckAssignedThreshold,
+		StuckPickedUpThreshold:    stuckPickedUpThreshold,
+		CancelRequiresCustomer:    cancelRequiresCustomer,
+		StoreBackend:              storeBackend,
+		StoreFilePath:             storeFilePath,
+		StoreCompactAfter:         storeCompactAfter,
+		GeoIndexEnabled:           geoIndexEnabled,
+		MaxDrivers:                maxDrivers,
+		MaxOrders:                 maxOrders,
+		MaxOrdersPerCustomer:      maxOrdersPerCustomer,
+		DriverCapacity:            driverCapacity,
+		LocationHistorySize:       locationHistorySize,
+		DefaultPageSize:           defaultPageSize,
+		MaxPageSize:               maxPageSize,
+		GinMode:                   ginMode,
+		LogLevel:                  logLevel,
+		APINaming:                 apiNaming,
+		APIErrorFormat:            apiErrorFormat,
+		APIVersionPrefix:          apiVersionPrefix,
+		APIUnversionedRoutes:      apiUnversionedRoutes,
+		FeatureFlags:              featureFlags,
+		StrictStatus:              strictStatus,
+		OmitZeroLocation:          omitZeroLocation,
+		DistanceUnit:              distanceUnit,
+		DebugResetEnabled:         debugResetEnabled,
+		DebugRestoreEnabled:       debugRestoreEnabled,
+		DebugMatchEnabled:         debugMatchEnabled,
+		DebugSeedEnabled:          debugSeedEnabled,
+		DebugSimulateEnabled:      debugSimulateEnabled,
+		SimulationTick:            simulationTick,
+		DebugStateMaxWait:         debugStateMaxWait,
+		DebugStateMaxBytes:        debugStateMaxBytes,
+		PprofEnabled:              pprofEnabled,
+		LockMetricsEnabled:        lockMetricsEnabled,
+		DebugToken:                debugToken,
 	}
 }
 
@@ -28,10 +321,67 @@ func getEnv(key string, defaultValue string) string {
 	return value
 }
 
-func getDurationEnv(key string, defaultValue time.Duration) time.Duration {
+// getDurationEnv parses a Go duration such as "500ms" or "2m". Bare integers
+// are still read as seconds but are deprecated. Values below floor are
+// raised to it; invalid values fall back to the default.
+func getDurationEnv(key string, defaultValue, floor time.Duration) time.Duration {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return defaultValue
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		intVal, intErr := strconv.Atoi(value)
+		if intErr != nil {
+			log.Printf("Invalid duration %q for %s, using default %v", value, key, defaultValue)
+			return defaultValue
+		}
+		log.Printf("%s=%s is read as seconds; bare integers are deprecated, use a unit such as %ds", key, value, intVal)
+		duration = time.Duration(intVal) * time.Second
+	}
+
+	if duration < floor {
+		log.Printf("%s=%s is below the minimum of %v, using %v", key, value, floor, floor)
+		return floor
+	}
+	return duration
+}
+
+func getIntEnv(key string, defaultValue int) int {
 	if value, exists := os.LookupEnv(key); exists {
 		if intVal, err := strconv.Atoi(value); err == nil {
-			return time.Duration(intVal) * time.Second
+			return intVal
+		}
+	}
+	return defaultValue
+}
+
+func getFloatEnv(key string, defaultValue float64) float64 {
+	if value, exists := os.LookupEnv(key); exists {
+		if floatVal, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatVal
+		}
+	}
+	return defaultValue
+}
+
+// getListEnv splits a comma-separated value into its trimmed, non-empty
+// items. Unset or empty values yield nil.
+func getListEnv(key string) []string {
+	var items []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func getBoolEnv(key string, defaultValue bool) bool {
+	if value, exists := os.LookupEnv(key); exists {
+		if boolVal, err := strconv.ParseBool(value); err == nil {
+			return boolVal
 		}
 	}
 	return defaultValue
@@ -0,0 +1,75 @@
+package config
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestServerTimeouts(t *testing.T) {
+	t.Setenv("READ_TIMEOUT", "2s")
+	t.Setenv("WRITE_TIMEOUT", "30")
+	t.Setenv("IDLE_TIMEOUT", "soon")
+
+	cfg := LoadConfig()
+	if cfg.ReadTimeout != 2*time.Second {
+		t.Errorf("ReadTimeout = %v, want 2s", cfg.ReadTimeout)
+	}
+	// Bare integers are still read as seconds
+	if cfg.WriteTimeout != 30*time.Second {
+		t.Errorf("WriteTimeout = %v, want 30s", cfg.WriteTimeout)
+	}
+	// Unparseable values fall back to the default
+	if cfg.IdleTimeout != 60*time.Second {
+		t.Errorf("IdleTimeout = %v, want the 60s default", cfg.IdleTimeout)
+	}
+}
+
+func TestLogLevelFollowsGinMode(t *testing.T) {
+	for _, tc := range []struct {
+		ginMode, logLevel string
+		want              string
+	}{
+		{"", "", "debug"},
+		{"release", "", "info"},
+		{"release", "debug", "debug"},
+	} {
+		t.Setenv("GIN_MODE", tc.ginMode)
+		t.Setenv("LOG_LEVEL", tc.logLevel)
+		if tc.ginMode == "" {
+			os.Unsetenv("GIN_MODE")
+		}
+		if tc.logLevel == "" {
+			os.Unsetenv("LOG_LEVEL")
+		}
+
+		if cfg := LoadConfig(); cfg.LogLevel != tc.want {
+			t.Errorf("GIN_MODE=%q LOG_LEVEL=%q: LogLevel = %q, want %q", tc.ginMode, tc.logLevel, cfg.LogLevel, tc.want)
+		}
+	}
+}
+
+func TestGetDurationEnv(t *testing.T) {
+	for _, tc := range []struct {
+		value string
+		want  time.Duration
+	}{
+		{"500ms", 500 * time.Millisecond},
+		{"2m", 2 * time.Minute},
+		{"3", 3 * time.Second},
+		{"soon", 10 * time.Second},
+		{"1ms", 100 * time.Millisecond},
+		{"-5s", 100 * time.Millisecond},
+		{"0", 100 * time.Millisecond},
+	} {
+		t.Setenv("TEST_DURATION", tc.value)
+		if got := getDurationEnv("TEST_DURATION", 10*time.Second, 100*time.Millisecond); got != tc.want {
+			t.Errorf("TEST_DURATION=%q: got %v, want %v", tc.value, got, tc.want)
+		}
+	}
+
+	os.Unsetenv("TEST_DURATION")
+	if got := getDurationEnv("TEST_DURATION", 10*time.Second, 100*time.Millisecond); got != 10*time.Second {
+		t.Errorf("unset: got %v, want the 10s default", got)
+	}
+}
@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"delivery-state-manager/internal/models"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// auditReasonKey is the context key under which a handler leaves the reason
+// code of a request for its audit event
+const auditReasonKey = "audit_reason"
+
+// auditNotesKey and auditContactlessKey are the context keys under which
+// order handlers leave the delivery instructions of a request
+const (
+	auditNotesKey       = "audit_notes"
+	auditContactlessKey = "audit_contactless"
+)
+
+// auditRequests records every state-changing request that matched a route,
+// successful or not, in the audit log once it has been answered
+func (h *Handler) auditRequests() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		if isReadMethod(c.Request.Method) || c.FullPath() == "" {
+			return
+		}
+		h.debugUC.RecordAudit(models.AuditEvent{
+			Timestamp:   h.clk.Now().Unix(),
+			Method:      c.Request.Method,
+			Route:       c.FullPath(),
+			Path:        c.Request.URL.Path,
+			Status:      c.Writer.Status(),
+			ClientIP:    c.ClientIP(),
+			Reason:      strings.TrimSpace(c.GetString(auditReasonKey)),
+			Notes:       c.GetString(auditNotesKey),
+			Contactless: c.GetBool(auditContactlessKey),
+		})
+	}
+}
+
+// getAuditLogHandler handles GET /debug/audit
+func (h *Handler) getAuditLogHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit := 0
+		if value, ok := c.GetQuery("limit"); ok {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 0 {
+				h.fail(c, http.StatusBadRequest, errInvalidLimit)
+				return
+			}
+			limit = parsed
+		}
+
+		c.JSON(http.StatusOK, models.AuditLog{Events: h.debugUC.GetAuditLog(limit)})
+	}
+}
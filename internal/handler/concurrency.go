@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// overloadRetryAfter is the Retry-After value, in seconds, sent with a 503
+// when the server is at its concurrency limit
+const overloadRetryAfter = "1"
+
+// semaphore bounds how many requests are in flight. A nil semaphore has no
+// limit.
+type semaphore chan struct{}
+
+// newSemaphore creates a semaphore with room for size requests, or nil when
+// size is not positive
+func newSemaphore(size int) semaphore {
+	if size <= 0 {
+		return nil
+	}
+	return make(semaphore, size)
+}
+
+// tryAcquire takes a slot without waiting, reporting whether one was free
+func (s semaphore) tryAcquire() bool {
+	if s == nil {
+		return true
+	}
+	select {
+	case s <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// release frees a slot taken by tryAcquire
+func (s semaphore) release() {
+	if s != nil {
+		<-s
+	}
+}
+
+// limitConcurrency rejects requests with 503 and Retry-After while
+// MaxConcurrentRequests requests are in flight, or MaxConcurrentReads reads
+// or MaxConcurrentWrites writes. Requests are shed rather than queued so a
+// burst cannot pile up goroutines behind the repository lock.
+func (h *Handler) limitConcurrency() gin.HandlerFunc {
+	all := newSemaphore(h.cfg.MaxConcurrentRequests)
+	reads := newSemaphore(h.cfg.MaxConcurrentReads)
+	writes := newSemaphore(h.cfg.MaxConcurrentWrites)
+
+	return func(c *gin.Context) {
+		class := writes
+		if isReadMethod(c.Request.Method) {
+			class = reads
+		}
+
+		if !class.tryAcquire() {
+			h.failOverloaded(c)
+			return
+		}
+		defer class.release()
+
+		if !all.tryAcquire() {
+			h.failOverloaded(c)
+			return
+		}
+		defer all.release()
+
+		c.Next()
+	}
+}
+
+// failOverloaded writes a 503 asking the client to retry shortly
+func (h *Handler) failOverloaded(c *gin.Context) {
+	c.Header("Retry-After", overloadRetryAfter)
+	h.fail(c, http.StatusServiceUnavailable, errOverloaded)
+	c.Abort()
+}
+
+// isReadMethod reports whether method does not change state
+func isReadMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
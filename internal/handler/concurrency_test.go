@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"delivery-state-manager/pkg/clock"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newLimitedRouter serves GET and POST /slow under cfg's concurrency
+// limits, holding each request until release is closed. entered receives
+// once per request that gets past the limits.
+func newLimitedRouter(cfg Config, entered chan<- struct{}, release <-chan struct{}) *gin.Engine {
+	h := NewHandler(nil, nil, nil, clock.New(), cfg)
+	r := gin.New()
+	r.Use(h.limitConcurrency())
+	hold := func(c *gin.Context) {
+		entered <- struct{}{}
+		<-release
+		c.Status(http.StatusOK)
+	}
+	r.GET("/slow", hold)
+	r.POST("/slow", hold)
+	return r
+}
+
+// saturate starts n requests with method and waits until all of them are
+// being served, returning a WaitGroup that finishes with them
+func saturate(t *testing.T, r *gin.Engine, method string, n int, entered <-chan struct{}) *sync.WaitGroup {
+	t.Helper()
+	var wg sync.WaitGroup
+	for range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(method, "/slow", nil))
+			if w.Code != http.StatusOK {
+				t.Errorf("request within the limit: status = %d, want 200", w.Code)
+			}
+		}()
+	}
+	for range n {
+		<-entered
+	}
+	return &wg
+}
+
+// serve sends one request with method and returns the response
+func serve(r *gin.Engine, method string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(method, "/slow", nil))
+	return w
+}
+
+func TestConcurrencyLimitShedsExcessRequests(t *testing.T) {
+	entered, release := make(chan struct{}, 8), make(chan struct{})
+	r := newLimitedRouter(Config{MaxConcurrentRequests: 2}, entered, release)
+	inFlight := saturate(t, r, http.MethodGet, 2, entered)
+
+	w := serve(r, http.MethodPost)
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != overloadRetryAfter {
+		t.Errorf("excess request: status = %d, Retry-After = %q; want 503 with %q", w.Code, w.Header().Get("Retry-After"), overloadRetryAfter)
+	}
+	if code := errorCodeOf(t, w); code != "OVERLOADED" {
+		t.Errorf("code = %s, want OVERLOADED", code)
+	}
+
+	close(release)
+	inFlight.Wait()
+	go func() { <-entered }()
+	if w := serve(r, http.MethodGet); w.Code != http.StatusOK {
+		t.Errorf("request after the burst: status = %d, want 200", w.Code)
+	}
+}
+
+func TestConcurrencyLimitsReadsAndWritesSeparately(t *testing.T) {
+	entered, release := make(chan struct{}, 8), make(chan struct{})
+	r := newLimitedRouter(Config{MaxConcurrentReads: 1, MaxConcurrentWrites: 1}, entered, release)
+	inFlight := saturate(t, r, http.MethodGet, 1, entered)
+
+	if w := serve(r, http.MethodGet); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("second read: status = %d, want 503", w.Code)
+	}
+
+	// A write still has a slot of its own
+	done := make(chan int)
+	go func() { done <- serve(r, http.MethodPost).Code }()
+	<-entered
+	close(release)
+	if code := <-done; code != http.StatusOK {
+		t.Errorf("write while reads are saturated: status = %d, want 200", code)
+	}
+	inFlight.Wait()
+}
@@ -0,0 +1,253 @@
+package handler
+
+import (
+	"context"
+	"delivery-state-manager/internal/models"
+	"delivery-state-manager/pkg/clock"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRunMatcherOnDemand(t *testing.T) {
+	s := newTestStack(t, func(cfg *stackConfig) { cfg.handler.MatchEnabled = true })
+	s.mustDo(http.StatusOK, http.MethodPost, "/drivers", driverJSON("d1", 37.77, -122.42))
+	s.mustDo(http.StatusCreated, http.MethodPost, "/orders", orderJSON("o1", 37.77, -122.42))
+
+	var result struct {
+		Assigned int `json:"assigned"`
+	}
+	decode(t, s.mustDo(http.StatusOK, http.MethodPost, "/debug/match", ""), &result)
+	if result.Assigned != 1 {
+		t.Errorf("assigned = %d, want 1", result.Assigned)
+	}
+	if order, _ := s.repo.GetOrder("o1"); order.Status != "assigned" || order.DriverID != "d1" {
+		t.Errorf("order is %s with %q, want assigned to d1", order.Status, order.DriverID)
+	}
+}
+
+func TestRunMatcherConcurrently(t *testing.T) {
+	s := newTestStack(t, func(cfg *stackConfig) { cfg.handler.MatchEnabled = true })
+	for i := range 20 {
+		s.mustDo(http.StatusOK, http.MethodPost, "/drivers", driverJSON(fmt.Sprintf("d%02d", i), 37.77, -122.42))
+		s.mustDo(http.StatusCreated, http.MethodPost, "/orders", orderJSON(fmt.Sprintf("o%02d", i), 37.77, -122.42))
+	}
+
+	// Overlapping runs, as alongside the background ticker, assign every
+	// order exactly once between them
+	var mu sync.Mutex
+	total := 0
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := s.do(http.MethodPost, "/debug/match", "")
+			var result struct {
+				Assigned int `json:"assigned"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &result); w.Code != http.StatusOK || err != nil {
+				t.Errorf("POST /debug/match: %d %s", w.Code, w.Body.String())
+			}
+			mu.Lock()
+			total += result.Assigned
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	if total != 20 || s.repo.CountOrders("assigned") != 20 {
+		t.Errorf("runs reported %d assignments with %d orders assigned, want 20 of each", total, s.repo.CountOrders("assigned"))
+	}
+}
+
+func TestRunMatcherDisabledIsNotFound(t *testing.T) {
+	s := newTestStack(t)
+	s.mustDo(http.StatusNotFound, http.MethodPost, "/debug/match", "")
+}
+
+func TestSeedAssignedOrder(t *testing.T) {
+	s := newTestStack(t, func(cfg *stackConfig) { cfg.handler.SeedEnabled = true })
+	seed := `{
+		"drivers": [{"id":"d1","name":"D1","status":"busy","location":{"lat":37.77,"lon":-122.42}}],
+		"orders": [{"id":"o1","customer":"c1","status":"assigned","driver_id":"d1",
+			"pickup":{"lat":37.77,"lon":-122.42},"dropoff":{"lat":37.78,"lon":-122.42}}]
+	}`
+
+	var result struct {
+		Drivers int `json:"drivers_seeded"`
+		Orders  int `json:"orders_seeded"`
+	}
+	decode(t, s.mustDo(http.StatusCreated, http.MethodPost, "/debug/seed", seed), &result)
+	if result.Drivers != 1 || result.Orders != 1 {
+		t.Errorf("seeded %+v, want 1 driver and 1 order", result)
+	}
+	order, _ := s.repo.GetOrder("o1")
+	driver, _ := s.repo.GetDriver("d1")
+	if order.Status != "assigned" || order.DriverID != "d1" || driver.Status != "busy" {
+		t.Errorf("seeded order %s with %q and driver %s, want assigned to a busy d1", order.Status, order.DriverID, driver.Status)
+	}
+}
+
+func TestSeedRejectsInconsistentState(t *testing.T) {
+	s := newTestStack(t, func(cfg *stackConfig) { cfg.handler.SeedEnabled = true })
+	s.mustDo(http.StatusOK, http.MethodPost, "/drivers", driverJSON("free", 37.77, -122.42))
+	order := func(id, status, driverID string) string {
+		return fmt.Sprintf(`{"id":%q,"customer":"c1","status":%q,"driver_id":%q,"pickup":{"lat":37.77,"lon":-122.42},"dropoff":{"lat":37.78,"lon":-122.42}}`, id, status, driverID)
+	}
+	seed := `{"orders": [` + strings.Join([]string{
+		order("o1", "assigned", "nobody"),
+		order("o2", "picked_up", "free"),
+		order("o3", "pending", "free"),
+		order("o4", "teleported", ""),
+	}, ",") + `]}`
+
+	fields := fieldErrorsOf(t, s.mustDo(http.StatusBadRequest, http.MethodPost, "/debug/seed", seed))
+	if _, ok := fields["orders[3].status"]; !ok {
+		t.Errorf("fields = %v, want orders[3].status reported", fields)
+	}
+
+	// With the statuses valid, the consistency checks report the rest
+	seed = strings.Replace(seed, "teleported", "pending", 1)
+	fields = fieldErrorsOf(t, s.mustDo(http.StatusBadRequest, http.MethodPost, "/debug/seed", seed))
+	for _, field := range []string{"orders[0].driver_id", "orders[1].driver_id", "orders[2].driver_id"} {
+		if _, ok := fields[field]; !ok {
+			t.Errorf("fields = %v, want %s reported", fields, field)
+		}
+	}
+	if orders := s.repo.GetAllOrders(); len(orders) != 0 {
+		t.Errorf("%d orders stored after a rejected seed, want none", len(orders))
+	}
+}
+
+func TestSeedDisabledIsNotFound(t *testing.T) {
+	s := newTestStack(t)
+	s.mustDo(http.StatusNotFound, http.MethodPost, "/debug/seed", `{}`)
+}
+
+func TestSummaryCountsStuckOrders(t *testing.T) {
+	clk := clock.NewFake(time.Unix(1700000000, 0))
+	s := newTestStack(t, func(cfg *stackConfig) {
+		cfg.clock = clk
+		cfg.debug.StuckAssignedThreshold = 10 * time.Minute
+		cfg.debug.StuckPickedUpThreshold = 30 * time.Minute
+	})
+	stuck := func() (assigned, pickedUp int) {
+		var summary struct {
+			Stuck struct {
+				Assigned int `json:"assigned"`
+				PickedUp int `json:"picked_up"`
+			} `json:"stuck_orders"`
+		}
+		decode(t, s.mustDo(http.StatusOK, http.MethodGet, "/debug/summary", ""), &summary)
+		return summary.Stuck.Assigned, summary.Stuck.PickedUp
+	}
+	for _, id := range []string{"d1", "d2"} {
+		s.mustDo(http.StatusOK, http.MethodPost, "/drivers", driverJSON(id, 37.77, -122.42))
+	}
+	for _, id := range []string{"o1", "o2"} {
+		s.mustDo(http.StatusCreated, http.MethodPost, "/orders", orderJSON(id, 37.77, -122.42))
+	}
+	s.repo.AssignOrderToDriver("o1", "d1")
+	s.repo.AssignOrderToDriver("o2", "d2")
+	s.repo.UpdateOrderStatus("o2", "picked_up")
+
+	clk.Advance(10 * time.Minute)
+	if assigned, pickedUp := stuck(); assigned != 0 || pickedUp != 0 {
+		t.Errorf("stuck at 10m = %d assigned, %d picked up; want none", assigned, pickedUp)
+	}
+	clk.Advance(time.Second)
+	if assigned, pickedUp := stuck(); assigned != 1 || pickedUp != 0 {
+		t.Errorf("stuck just past 10m = %d assigned, %d picked up; want 1 assigned", assigned, pickedUp)
+	}
+	clk.Advance(20 * time.Minute)
+	if assigned, pickedUp := stuck(); assigned != 1 || pickedUp != 1 {
+		t.Errorf("stuck past 30m = %d assigned, %d picked up; want 1 of each", assigned, pickedUp)
+	}
+
+	// Picking up the stuck order starts its clock again
+	s.repo.UpdateOrderStatus("o1", "picked_up")
+	if assigned, pickedUp := stuck(); assigned != 0 || pickedUp != 1 {
+		t.Errorf("stuck after pickup = %d assigned, %d picked up; want 1 picked up", assigned, pickedUp)
+	}
+}
+
+func TestSimulatedEntitiesLeftOutAndPurged(t *testing.T) {
+	s := newTestStack(t, func(cfg *stackConfig) { cfg.handler.ResetEnabled = true })
+	simulated := map[string]any{"simulated": true}
+	s.mustDo(http.StatusOK, http.MethodPost, "/drivers", driverJSON("real", 37.77, -122.42))
+	s.mustDo(http.StatusOK, http.MethodPost, "/drivers", withJSON(driverJSON("fake", 37.77, -122.42), simulated))
+	s.mustDo(http.StatusCreated, http.MethodPost, "/orders", orderJSON("o-real", 37.77, -122.42))
+	s.mustDo(http.StatusCreated, http.MethodPost, "/orders", withJSON(orderJSON("o-fake1", 37.77, -122.42), simulated))
+	s.mustDo(http.StatusCreated, http.MethodPost, "/orders", withJSON(orderJSON("o-fake2", 37.77, -122.42), simulated))
+
+	counts := func(path string) (drivers, orders int) {
+		var summary models.DebugSummary
+		decode(t, s.mustDo(http.StatusOK, http.MethodGet, path, ""), &summary)
+		return summary.DriversByStatus[models.DriverAvailable], summary.OrdersByStatus[models.OrderPending]
+	}
+	if drivers, orders := counts("/debug/summary"); drivers != 2 || orders != 3 {
+		t.Errorf("summary counts %d drivers and %d orders, want 2 and 3", drivers, orders)
+	}
+	if drivers, orders := counts("/debug/summary?real_only=true"); drivers != 1 || orders != 1 {
+		t.Errorf("real-only summary counts %d drivers and %d orders, want 1 and 1", drivers, orders)
+	}
+	s.mustDo(http.StatusBadRequest, http.MethodGet, "/debug/summary?real_only=maybe", "")
+
+	var result models.ResetResult
+	decode(t, s.mustDo(http.StatusOK, http.MethodPost, "/debug/purge-simulated", ""), &result)
+	if result.DriversCleared != 1 || result.OrdersCleared != 2 {
+		t.Errorf("purge removed %d drivers and %d orders, want 1 and 2", result.DriversCleared, result.OrdersCleared)
+	}
+	s.mustDo(http.StatusOK, http.MethodGet, "/drivers/real", "")
+	s.mustDo(http.StatusOK, http.MethodGet, "/orders/o-real", "")
+	s.mustDo(http.StatusNotFound, http.MethodGet, "/drivers/fake", "")
+	s.mustDo(http.StatusNotFound, http.MethodGet, "/orders/o-fake1", "")
+}
+
+func TestMatcherHealthReportsStall(t *testing.T) {
+	clk := clock.NewFake(time.Unix(1700000000, 0))
+	s := newTestStack(t, func(cfg *stackConfig) { cfg.clock = clk })
+	health := func(want int) models.MatcherHealth {
+		t.Helper()
+		var health models.MatcherHealth
+		decode(t, s.mustDo(want, http.MethodGet, "/healthz/matcher", ""), &health)
+		return health
+	}
+
+	// A matcher that never started is degraded
+	if got := health(http.StatusServiceUnavailable); got.Status != models.HealthDegraded || got.LastHeartbeat != 0 {
+		t.Errorf("before start: %+v, want degraded without a heartbeat", got)
+	}
+
+	// The hour-long interval keeps the real ticker from firing, so the fake
+	// clock alone decides how long the loop has gone without a beat
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		s.matcher.StartMatcher(ctx, time.Hour)
+		close(stopped)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-stopped
+	})
+	for beat, _ := s.matcher.Heartbeat(); beat.IsZero(); beat, _ = s.matcher.Heartbeat() {
+		time.Sleep(time.Millisecond)
+	}
+
+	want := models.MatcherHealth{Status: models.HealthOK, LastHeartbeat: 1700000000, Interval: "1h0m0s", StaleAfter: "3h0m0s"}
+	clk.Advance(3 * time.Hour)
+	if got := health(http.StatusOK); got != want {
+		t.Errorf("at the stall limit: %+v, want %+v", got, want)
+	}
+	clk.Advance(time.Second)
+	want.Status = models.HealthDegraded
+	if got := health(http.StatusServiceUnavailable); got != want {
+		t.Errorf("stalled past the limit: %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,259 @@
+package handler
+
+import (
+	"delivery-state-manager/internal/models"
+	"net/http"
+	"slices"
+	"testing"
+)
+
+func TestGoOfflineRejectedMidDelivery(t *testing.T) {
+	s := newTestStack(t)
+	s.mustDo(http.StatusOK, http.MethodPost, "/drivers", driverJSON("d1", 37.77, -122.42))
+	s.mustDo(http.StatusCreated, http.MethodPost, "/orders", orderJSON("o1", 37.77, -122.42))
+	if err := s.repo.AssignOrderToDriver("o1", "d1"); err != nil {
+		t.Fatalf("AssignOrderToDriver: %v", err)
+	}
+
+	w := s.mustDo(http.StatusConflict, http.MethodPost, "/drivers/d1/go-offline", "")
+	var body errorEnvelope
+	decode(t, w, &body)
+	if body.Error.Code != "DRIVER_HAS_ACTIVE_ORDER" || !slices.Equal(body.Error.ActiveOrderIDs, []string{"o1"}) {
+		t.Errorf("error = %+v, want DRIVER_HAS_ACTIVE_ORDER listing o1", body.Error)
+	}
+
+	s.repo.UpdateOrderStatus("o1", "picked_up")
+	s.repo.UpdateOrderStatus("o1", "delivered")
+	var driver struct {
+		Status string `json:"status"`
+	}
+	decode(t, s.mustDo(http.StatusOK, http.MethodPost, "/drivers/d1/go-offline", ""), &driver)
+	if driver.Status != "offline" {
+		t.Errorf("status = %s, want offline", driver.Status)
+	}
+	decode(t, s.mustDo(http.StatusOK, http.MethodPost, "/drivers/d1/go-available", ""), &driver)
+	if driver.Status != "available" {
+		t.Errorf("status = %s, want available", driver.Status)
+	}
+	s.mustDo(http.StatusNotFound, http.MethodPost, "/drivers/nobody/go-available", "")
+}
+
+func TestUpdateDriverStatusWithExpectedStatus(t *testing.T) {
+	s := newTestStack(t)
+	s.mustDo(http.StatusOK, http.MethodPost, "/drivers", driverJSON("d1", 37.77, -122.42))
+
+	w := s.mustDo(http.StatusConflict, http.MethodPatch, "/drivers/d1/status", `{"status":"offline","expected_status":"busy"}`)
+	if code := errorCodeOf(t, w); code != "DRIVER_STATUS_CONFLICT" {
+		t.Errorf("code = %s, want DRIVER_STATUS_CONFLICT", code)
+	}
+
+	var driver struct {
+		Status string `json:"status"`
+	}
+	decode(t, s.mustDo(http.StatusOK, http.MethodPatch, "/drivers/d1/status", `{"status":"offline","expected_status":"available"}`), &driver)
+	if driver.Status != "offline" {
+		t.Errorf("status = %s, want offline", driver.Status)
+	}
+}
+
+func TestDriverStats(t *testing.T) {
+	s := newTestStack(t)
+	// The driver starts a hundredth of a degree south of every pickup
+	s.mustDo(http.StatusOK, http.MethodPost, "/drivers", driverJSON("d1", 37.76, -122.42))
+	for _, id := range []string{"o1", "o2", "o3"} {
+		s.mustDo(http.StatusCreated, http.MethodPost, "/orders", orderJSON(id, 37.77, -122.42))
+	}
+	deliver := func(id string) {
+		s.repo.UpdateOrderStatus(id, "picked_up")
+		s.repo.UpdateOrderStatus(id, "delivered")
+	}
+	for _, step := range []func(){
+		func() { s.repo.AssignOrderToDriver("o1", "d1"); deliver("o1") },
+		func() { s.repo.AssignOrderToDriver("o2", "d1"); deliver("o2") },
+		func() { s.repo.AssignOrderToDriver("o3", "d1"); s.repo.UpdateOrderStatus("o3", "canceled") },
+	} {
+		s.repo.UpdateDriverStatus("d1", "available")
+		step()
+	}
+
+	var stats struct {
+		Delivered  int     `json:"deliveries_completed"`
+		Canceled   int     `json:"canceled_after_assignment"`
+		DistanceKm float64 `json:"total_assigned_distance_km"`
+	}
+	decode(t, s.mustDo(http.StatusOK, http.MethodGet, "/drivers/d1/stats", ""), &stats)
+	if stats.Delivered != 2 || stats.Canceled != 1 {
+		t.Errorf("stats = %+v, want 2 delivered and 1 canceled", stats)
+	}
+	// Three assignments of about 1.11km each
+	if stats.DistanceKm < 3.3 || stats.DistanceKm > 3.4 {
+		t.Errorf("total assigned distance = %.3fkm, want about 3.34km", stats.DistanceKm)
+	}
+
+	s.mustDo(http.StatusNotFound, http.MethodGet, "/drivers/nobody/stats", "")
+}
+
+func TestHeadDriver(t *testing.T) {
+	s := newTestStack(t)
+	s.mustDo(http.StatusOK, http.MethodPost, "/drivers", driverJSON("d1", 37.77, -122.42))
+
+	for path, want := range map[string]int{
+		"/drivers/d1":     http.StatusOK,
+		"/v1/drivers/d1":  http.StatusOK,
+		"/drivers/nobody": http.StatusNotFound,
+	} {
+		w := s.mustDo(want, http.MethodHead, path, "")
+		if w.Body.Len() != 0 {
+			t.Errorf("HEAD %s has a body: %s", path, w.Body.String())
+		}
+	}
+
+	s.mustDo(http.StatusOK, http.MethodDelete, "/drivers/d1", "")
+	s.mustDo(http.StatusNotFound, http.MethodHead, "/drivers/d1", "")
+	s.mustDo(http.StatusOK, http.MethodHead, "/drivers/d1?include_deleted=true", "")
+}
+
+func TestPatchDriverKeepsAbsentFields(t *testing.T) {
+	s := newTestStack(t)
+	s.mustDo(http.StatusOK, http.MethodPost, "/drivers", driverJSON("d1", 37.77, -122.42))
+
+	type driverBody struct {
+		Name     string          `json:"name"`
+		Status   string          `json:"status"`
+		Location models.Location `json:"location"`
+	}
+	var driver driverBody
+	decode(t, s.mustDo(http.StatusOK, http.MethodPatch, "/drivers/d1", `{"name":"Renamed"}`), &driver)
+	if want := (driverBody{"Renamed", "available", models.Location{Lat: 37.77, Lon: -122.42}}); driver != want {
+		t.Errorf("after renaming: %+v, want %+v", driver, want)
+	}
+
+	decode(t, s.mustDo(http.StatusOK, http.MethodPatch, "/drivers/d1", `{"location":{"lat":37.8,"lon":-122.4}}`), &driver)
+	if want := (driverBody{"Renamed", "available", models.Location{Lat: 37.8, Lon: -122.4}}); driver != want {
+		t.Errorf("after moving: %+v, want %+v", driver, want)
+	}
+
+	s.mustDo(http.StatusBadRequest, http.MethodPatch, "/drivers/d1", `{"status":"flying"}`)
+	s.mustDo(http.StatusNotFound, http.MethodPatch, "/drivers/nobody", `{"name":"Nobody"}`)
+}
+
+func TestDriverTrack(t *testing.T) {
+	s := newTestStack(t, func(cfg *stackConfig) { cfg.store.LocationHistorySize = 2 })
+	s.mustDo(http.StatusOK, http.MethodPost, "/drivers", driverJSON("d1", 37.77, -122.42))
+	s.mustDo(http.StatusOK, http.MethodPatch, "/drivers/d1", `{"location":{"lat":37.78,"lon":-122.42}}`)
+	s.mustDo(http.StatusOK, http.MethodPatch, "/drivers/d1", `{"location":{"lat":37.79,"lon":-122.42}}`)
+
+	var track models.DriverTrack
+	decode(t, s.mustDo(http.StatusOK, http.MethodGet, "/drivers/d1/track", ""), &track)
+	if len(track.Locations) != 2 || track.Locations[0].Lat != 37.78 || track.Locations[1].Lat != 37.79 {
+		t.Errorf("track = %+v, want the last two locations oldest first", track)
+	}
+	s.mustDo(http.StatusNotFound, http.MethodGet, "/drivers/nobody/track", "")
+}
+
+func TestAvailableDrivers(t *testing.T) {
+	s := newTestStack(t)
+	s.mustDo(http.StatusOK, http.MethodPost, "/drivers", driverJSON("d3", 37.77, -122.42))
+	s.mustDo(http.StatusOK, http.MethodPost, "/drivers", driverJSON("d1", 37.80, -122.42))
+	s.mustDo(http.StatusOK, http.MethodPost, "/drivers", driverJSON("d2", 37.78, -122.42))
+	s.mustDo(http.StatusOK, http.MethodPost, "/drivers", driverJSON("d4", 37.77, -122.42))
+	s.mustDo(http.StatusOK, http.MethodPatch, "/drivers/d4/status", `{"status":"offline"}`)
+
+	if ids := idsOf(t, s.mustDo(http.StatusOK, http.MethodGet, "/drivers/available", "")); ids != "[d1 d2 d3]" {
+		t.Errorf("available drivers = %s, want [d1 d2 d3] by ID", ids)
+	}
+	// d1 is about 3.3km away, outside the radius
+	if ids := idsOf(t, s.mustDo(http.StatusOK, http.MethodGet, "/drivers/available?lat=37.77&lon=-122.42&radius_km=2", "")); ids != "[d3 d2]" {
+		t.Errorf("available drivers nearby = %s, want [d3 d2] nearest first", ids)
+	}
+	s.mustDo(http.StatusBadRequest, http.MethodGet, "/drivers/available?lat=37.77&lon=-122.42", "")
+}
+
+func TestDeletedDriverLeavesListsButResolves(t *testing.T) {
+	s := newTestStack(t)
+	s.mustDo(http.StatusOK, http.MethodPost, "/drivers", driverJSON("d1", 37.77, -122.42))
+	s.mustDo(http.StatusOK, http.MethodPost, "/drivers", driverJSON("d2", 37.90, -122.42))
+
+	var deleted struct {
+		Deleted   bool  `json:"deleted"`
+		DeletedAt int64 `json:"deleted_at"`
+	}
+	decode(t, s.mustDo(http.StatusOK, http.MethodDelete, "/drivers/d1", ""), &deleted)
+	if !deleted.Deleted || deleted.DeletedAt == 0 {
+		t.Errorf("deleted driver = %+v, want deleted with a time", deleted)
+	}
+
+	for _, path := range []string{"/drivers", "/drivers/available", "/drivers/nearby?lat=37.77&lon=-122.42&radius_km=50"} {
+		if ids := idsOf(t, s.mustDo(http.StatusOK, http.MethodGet, path, "")); ids != "[d2]" {
+			t.Errorf("GET %s = %s, want only d2", path, ids)
+		}
+	}
+	s.mustDo(http.StatusNotFound, http.MethodGet, "/drivers/d1", "")
+	decode(t, s.mustDo(http.StatusOK, http.MethodGet, "/drivers/d1?include_deleted=true", ""), &deleted)
+	if !deleted.Deleted {
+		t.Error("driver resolved with include_deleted is not marked deleted")
+	}
+
+	// The far driver takes the order although d1 sits on the pickup
+	s.mustDo(http.StatusCreated, http.MethodPost, "/orders", orderJSON("o1", 37.77, -122.42))
+	s.matcher.MatchOrders()
+	if order, _ := s.repo.GetOrder("o1"); order.DriverID != "d2" {
+		t.Errorf("order went to %q, want d2", order.DriverID)
+	}
+}
+
+func TestCreateDriverGeneratesMissingID(t *testing.T) {
+	s := newTestStack(t, func(cfg *stackConfig) { cfg.driver.GenerateIDs = true })
+
+	var first, second struct {
+		ID string `json:"id"`
+	}
+	decode(t, s.mustDo(http.StatusOK, http.MethodPost, "/drivers", driverJSON("", 37.77, -122.42)), &first)
+	decode(t, s.mustDo(http.StatusOK, http.MethodPost, "/drivers", driverJSON("", 37.77, -122.42)), &second)
+	if first.ID == "" || first.ID == second.ID {
+		t.Errorf("generated IDs %q and %q, want two distinct IDs", first.ID, second.ID)
+	}
+	if len(s.repo.GetAllDrivers()) != 2 {
+		t.Errorf("store holds %d drivers, want 2", len(s.repo.GetAllDrivers()))
+	}
+}
+
+func TestBatchGetDrivers(t *testing.T) {
+	s := newTestStack(t, func(cfg *stackConfig) { cfg.driver.MaxBatchIDs = 3 })
+	s.mustDo(http.StatusOK, http.MethodPost, "/drivers", driverJSON("d1", 37.77, -122.42))
+	s.mustDo(http.StatusOK, http.MethodPost, "/drivers", driverJSON("d2", 37.78, -122.42))
+	s.mustDo(http.StatusOK, http.MethodDelete, "/drivers/d2", "")
+
+	type lookup struct {
+		ID     string `json:"id"`
+		Found  bool   `json:"found"`
+		Driver *struct {
+			ID string `json:"id"`
+		} `json:"driver"`
+	}
+	batch := func(query string, ids ...string) []lookup {
+		var body struct {
+			Drivers []lookup `json:"drivers"`
+		}
+		decode(t, s.mustDo(http.StatusOK, http.MethodPost, "/drivers/batch"+query, withJSON("{}", map[string]any{"ids": ids})), &body)
+		return body.Drivers
+	}
+
+	got := batch("", "ghost", "d1", "d2")
+	if len(got) != 3 || got[0].Found || !got[1].Found || got[1].Driver == nil || got[1].Driver.ID != "d1" || got[2].Found {
+		t.Errorf("lookups = %+v, want ghost and deleted d2 missing around d1", got)
+	}
+	if got := batch("?include_deleted=true", "d2"); len(got) != 1 || !got[0].Found {
+		t.Errorf("lookups with include_deleted = %+v, want d2 found", got)
+	}
+
+	for _, body := range []map[string]any{
+		{"ids": []string{"d1", "d1", "d1", "d1"}},
+		{"ids": []string{}},
+	} {
+		w := s.mustDo(http.StatusBadRequest, http.MethodPost, "/drivers/batch", withJSON("{}", body))
+		if fields := fieldErrorsOf(t, w); fields["ids"] == "" {
+			t.Errorf("ids %v: fields = %v, want ids rejected", body["ids"], fields)
+		}
+	}
+}
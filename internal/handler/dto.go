@@ -0,0 +1,420 @@
+package handler
+
+import (
+	"bytes"
+	"cmp"
+	"delivery-state-manager/internal/models"
+	"delivery-state-manager/pkg/clock"
+	"encoding/json"
+	"io"
+	"slices"
+	"strings"
+)
+
+// Supported values for the API_NAMING setting
+const (
+	NamingSnake = "snake"
+	NamingCamel = "camel"
+)
+
+// jsonField is a single key/value pair of a jsonObject
+type jsonField struct {
+	key   string
+	value any
+}
+
+// jsonObject is a JSON object that keeps its fields in insertion order
+type jsonObject []jsonField
+
+// MarshalJSON encodes the fields in order
+func (o jsonObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, field := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(field.key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(field.value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// dtoMapper maps domain models to response DTOs using the configured field
+// naming. Keys are written in snake_case and converted when camelCase is set.
+type dtoMapper struct {
+	camel            bool
+	omitZeroLocation bool
+	// unit is the unit distance fields are reported in; their keys end in
+	// it, as in "distance_km" or "distance_mi"
+	unit string
+	// clock decides the day that drivers' daily order counts are reported for
+	clock clock.Clock
+}
+
+// newDTOMapper creates a dtoMapper for the given naming, location policy
+// and distance unit
+func newDTOMapper(naming string, omitZeroLocation bool, unit string, clk clock.Clock) *dtoMapper {
+	return &dtoMapper{
+		camel:            naming == NamingCamel,
+		omitZeroLocation: omitZeroLocation,
+		unit:             unit,
+		clock:            clk,
+	}
+}
+
+// OrderEncoder returns a function encoding an order the way the API returns
+// it with the given naming, location policy and distance unit, for bodies
+// sent outside a response such as webhooks
+func OrderEncoder(naming string, omitZeroLocation bool, unit string, clk clock.Clock) func(order *models.Order) ([]byte, error) {
+	m := newDTOMapper(naming, omitZeroLocation, unit, clk)
+	return func(order *models.Order) ([]byte, error) {
+		return json.Marshal(m.order(order))
+	}
+}
+
+// key converts a snake_case key to the configured naming
+func (m *dtoMapper) key(snake string) string {
+	if !m.camel {
+		return snake
+	}
+	parts := strings.Split(snake, "_")
+	for i := 1; i < len(parts); i++ {
+		if parts[i] != "" {
+			parts[i] = strings.ToUpper(parts[i][:1]) + parts[i][1:]
+		}
+	}
+	return strings.Join(parts, "")
+}
+
+// field appends a field to obj under the configured naming
+func (m *dtoMapper) field(obj jsonObject, snake string, value any) jsonObject {
+	return append(obj, jsonField{key: m.key(snake), value: value})
+}
+
+// distance appends a distance given in kilometers under name, suffixed with
+// the configured unit, converted to that unit
+func (m *dtoMapper) distance(obj jsonObject, name string, km float64) jsonObject {
+	return m.field(obj, name+"_"+m.unit, models.KmTo(km, m.unit))
+}
+
+// location maps a Location, dropping zero coordinates if configured
+func (m *dtoMapper) location(loc models.Location) jsonObject {
+	obj := make(jsonObject, 0, 2)
+	if !m.omitZeroLocation || loc.Lat != 0 {
+		obj = m.field(obj, "lat", loc.Lat)
+	}
+	if !m.omitZeroLocation || loc.Lon != 0 {
+		obj = m.field(obj, "lon", loc.Lon)
+	}
+	return obj
+}
+
+// locationHistory maps timestamped locations, each a location with its
+// timestamp alongside
+func (m *dtoMapper) locationHistory(history []models.TimestampedLocation) []jsonObject {
+	out := make([]jsonObject, 0, len(history))
+	for _, entry := range history {
+		out = append(out, m.field(m.location(entry.Location), "timestamp", entry.Timestamp))
+	}
+	return out
+}
+
+// driver maps a Driver
+func (m *dtoMapper) driver(d *models.Driver) jsonObject {
+	obj := make(jsonObject, 0, 17)
+	obj = m.field(obj, "id", d.ID)
+	obj = m.field(obj, "name", d.Name)
+	obj = m.field(obj, "status", d.Status)
+	obj = m.field(obj, "location", m.location(d.Location))
+	if d.Zone != "" {
+		obj = m.field(obj, "zone", d.Zone)
+	}
+	if d.CooldownUntil != 0 {
+		obj = m.field(obj, "cooldown_until", d.CooldownUntil)
+	}
+	if d.Deleted {
+		obj = m.field(obj, "deleted", d.Deleted)
+		obj = m.field(obj, "deleted_at", d.DeletedAt)
+	}
+	if d.Simulated {
+		obj = m.field(obj, "simulated", d.Simulated)
+	}
+	if d.Rating > 0 {
+		obj = m.field(obj, "rating", d.Rating)
+	}
+	if d.LastAssignedAt != 0 {
+		obj = m.field(obj, "last_assigned_at", d.LastAssignedAt)
+	}
+	if d.Capacity > 0 {
+		obj = m.field(obj, "capacity", d.Capacity)
+	}
+	today := models.Day(m.clock.Now())
+	obj = m.field(obj, "daily_orders", d.OrdersOn(today))
+	if d.MaxDailyOrders > 0 {
+		obj = m.field(obj, "max_daily_orders", d.MaxDailyOrders)
+		obj = m.field(obj, "remaining_daily_orders", d.RemainingDailyOrders(today))
+	}
+	obj = m.field(obj, "created_at", d.CreatedAt)
+	obj = m.field(obj, "updated_at", d.UpdatedAt)
+	return obj
+}
+
+// drivers maps a list of drivers
+func (m *dtoMapper) drivers(drivers []*models.Driver) []jsonObject {
+	out := make([]jsonObject, 0, len(drivers))
+	for _, d := range drivers {
+		out = append(out, m.driver(d))
+	}
+	return out
+}
+
+// driverLookups maps the results of a batch fetch, keeping missing IDs
+func (m *dtoMapper) driverLookups(lookups []models.DriverLookup) jsonObject {
+	out := make([]jsonObject, 0, len(lookups))
+	for _, lookup := range lookups {
+		obj := make(jsonObject, 0, 3)
+		obj = m.field(obj, "id", lookup.ID)
+		obj = m.field(obj, "found", lookup.Found)
+		if lookup.Found {
+			obj = m.field(obj, "driver", m.driver(lookup.Driver))
+		}
+		out = append(out, obj)
+	}
+	return m.field(nil, "drivers", out)
+}
+
+// driverPage maps a cursor-paginated page of drivers
+func (m *dtoMapper) driverPage(page models.DriverPage) jsonObject {
+	obj := make(jsonObject, 0, 2)
+	obj = m.field(obj, "drivers", m.drivers(page.Drivers))
+	if page.NextCursor != "" {
+		obj = m.field(obj, "next_cursor", page.NextCursor)
+	}
+	return obj
+}
+
+// order maps an Order, omitting empty optional fields
+func (m *dtoMapper) order(o *models.Order) jsonObject {
+	obj := make(jsonObject, 0, 24)
+	obj = m.field(obj, "id", o.ID)
+	obj = m.field(obj, "customer", o.Customer)
+	obj = m.field(obj, "pickup", m.location(o.Pickup))
+	obj = m.field(obj, "dropoff", m.location(o.Dropoff))
+	if o.Zone != "" {
+		obj = m.field(obj, "zone", o.Zone)
+	}
+	if len(o.PickupHistory) > 0 {
+		obj = m.field(obj, "pickup_history", m.locationHistory(o.PickupHistory))
+	}
+	if len(o.DropoffHistory) > 0 {
+		obj = m.field(obj, "dropoff_history", m.locationHistory(o.DropoffHistory))
+	}
+	if len(o.Waypoints) > 0 {
+		waypoints := make([]jsonObject, 0, len(o.Waypoints))
+		for _, waypoint := range o.Waypoints {
+			waypoints = append(waypoints, m.location(waypoint))
+		}
+		obj = m.field(obj, "waypoints", waypoints)
+	}
+	obj = m.field(obj, "status", o.Status)
+	if o.DriverID != "" {
+		obj = m.field(obj, "driver_id", o.DriverID)
+	}
+	if o.BundleID != "" {
+		obj = m.field(obj, "bundle_id", o.BundleID)
+	}
+	if len(o.AssignmentHistory) > 0 {
+		history := make([]jsonObject, 0, len(o.AssignmentHistory))
+		for _, record := range o.AssignmentHistory {
+			entry := make(jsonObject, 0, 4)
+			entry = m.field(entry, "driver_id", record.DriverID)
+			entry = m.field(entry, "assigned_at", record.AssignedAt)
+			if record.ReleasedAt != 0 {
+				entry = m.field(entry, "released_at", record.ReleasedAt)
+				entry = m.field(entry, "reason", record.Reason)
+			}
+			history = append(history, entry)
+		}
+		obj = m.field(obj, "assignment_history", history)
+	}
+	if o.AssignmentDistanceKm != 0 {
+		obj = m.distance(obj, "assignment_distance", o.AssignmentDistanceKm)
+	}
+	if o.Notes != "" {
+		obj = m.field(obj, "notes", o.Notes)
+	}
+	obj = m.field(obj, "contactless", o.Contactless)
+	obj = m.field(obj, "price", o.Price)
+	if len(o.Tags) > 0 {
+		obj = m.field(obj, "tags", o.Tags)
+	}
+	if len(o.OfferedTo) > 0 {
+		obj = m.field(obj, "offered_to", o.OfferedTo)
+		obj = m.field(obj, "offer_expires_at", o.OfferExpiresAt)
+	}
+	if o.MatchAttempts != 0 {
+		obj = m.field(obj, "match_attempts", o.MatchAttempts)
+	}
+	if o.ScheduledFor != 0 {
+		obj = m.field(obj, "scheduled_for", o.ScheduledFor)
+	}
+	if o.CancelReason != "" {
+		obj = m.field(obj, "cancel_reason", o.CancelReason)
+	}
+	if o.StatusChangedAt != 0 {
+		obj = m.field(obj, "status_changed_at", o.StatusChangedAt)
+	}
+	if o.Simulated {
+		obj = m.field(obj, "simulated", o.Simulated)
+	}
+	obj = m.field(obj, "created_at", o.CreatedAt)
+	obj = m.field(obj, "updated_at", o.UpdatedAt)
+	return obj
+}
+
+// orders maps a list of orders
+func (m *dtoMapper) orders(orders []*models.Order) []jsonObject {
+	out := make([]jsonObject, 0, len(orders))
+	for _, o := range orders {
+		out = append(out, m.order(o))
+	}
+	return out
+}
+
+// driverStats maps a driver's DriverStats
+func (m *dtoMapper) driverStats(stats *models.DriverStats) jsonObject {
+	obj := make(jsonObject, 0, 5)
+	obj = m.field(obj, "driver_id", stats.DriverID)
+	obj = m.field(obj, "deliveries_completed", stats.DeliveriesCompleted)
+	obj = m.field(obj, "canceled_after_assignment", stats.CanceledAfterAssignment)
+	obj = m.distance(obj, "total_assigned_distance", stats.TotalAssignedDistanceKm)
+	obj = m.field(obj, "offer_lapses", stats.OfferLapses)
+	return obj
+}
+
+// eta maps an order's ETA
+func (m *dtoMapper) eta(eta *models.ETA) jsonObject {
+	obj := make(jsonObject, 0, 6)
+	obj = m.field(obj, "order_id", eta.OrderID)
+	obj = m.field(obj, "driver_id", eta.DriverID)
+	obj = m.field(obj, "status", eta.Status)
+	obj = m.distance(obj, "distance", eta.DistanceKm)
+	obj = m.field(obj, "remaining_minutes", eta.RemainingMinutes)
+	obj = m.field(obj, "computed_at", eta.ComputedAt)
+	return obj
+}
+
+// orderPage maps an offset-paginated page of orders
+func (m *dtoMapper) orderPage(page models.OrderPage) jsonObject {
+	obj := make(jsonObject, 0, 3)
+	obj = m.field(obj, "orders", m.orders(page.Orders))
+	obj = m.field(obj, "offset", page.Offset)
+	obj = m.field(obj, "total", page.Total)
+	return obj
+}
+
+// writeSnapshot writes the state in view to w as drivers and orders keyed
+// by ID, encoding one at a time instead of building the whole response
+// first. Entities are written in their stored form, with every persisted
+// field under the models' own keys and distances in kilometers, whatever the
+// response settings, so the snapshot can be restored as it is.
+func writeSnapshot(w io.Writer, view models.ReadView) error {
+	var drivers []*models.Driver
+	view.EachDriver(func(driver *models.Driver) {
+		drivers = append(drivers, driver)
+	})
+	slices.SortFunc(drivers, func(a, b *models.Driver) int { return cmp.Compare(a.ID, b.ID) })
+	var orders []*models.Order
+	view.EachOrder(func(order *models.Order) {
+		orders = append(orders, order)
+	})
+	slices.SortFunc(orders, func(a, b *models.Order) int { return cmp.Compare(a.ID, b.ID) })
+
+	// After the first error every further write is skipped. The encoder
+	// ends each value with a newline, which leaves one entity per line.
+	sw := &stickyWriter{w: w}
+	enc := json.NewEncoder(sw)
+	encode := func(v any) {
+		if sw.err == nil {
+			if err := enc.Encode(v); err != nil {
+				sw.err = err
+			}
+		}
+	}
+	key := func(i int, key string) {
+		if i > 0 {
+			io.WriteString(sw, ",")
+		}
+		quoted, _ := json.Marshal(key)
+		sw.Write(quoted)
+		io.WriteString(sw, ":")
+	}
+
+	io.WriteString(sw, "{")
+	key(0, "drivers")
+	io.WriteString(sw, "{")
+	for i, driver := range drivers {
+		key(i, driver.ID)
+		encode(driver)
+	}
+	io.WriteString(sw, "}")
+	key(1, "orders")
+	io.WriteString(sw, "{")
+	for i, order := range orders {
+		key(i, order.ID)
+		encode(order)
+	}
+	io.WriteString(sw, "}")
+	key(2, "version")
+	encode(view.Version())
+	key(3, "timestamp")
+	encode(models.GetCurrentTimestamp())
+	io.WriteString(sw, "}")
+	return sw.err
+}
+
+// stickyWriter remembers the first write error and fails every later write
+// with it
+type stickyWriter struct {
+	w   io.Writer
+	err error
+}
+
+// Write writes p unless an earlier write failed
+func (s *stickyWriter) Write(p []byte) (int, error) {
+	if s.err != nil {
+		return 0, s.err
+	}
+	n, err := s.w.Write(p)
+	s.err = err
+	return n, err
+}
+
+// cappedWriter fails with errStateTooLarge rather than write more than max
+// bytes in all. A max of zero means no cap.
+type cappedWriter struct {
+	w       io.Writer
+	max     int
+	written int
+}
+
+// Write writes p if it fits under the cap
+func (c *cappedWriter) Write(p []byte) (int, error) {
+	if c.max > 0 && c.written+len(p) > c.max {
+		return 0, errStateTooLarge
+	}
+	n, err := c.w.Write(p)
+	c.written += n
+	return n, err
+}
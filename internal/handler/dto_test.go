@@ -0,0 +1,99 @@
+package handler
+
+import (
+	"delivery-state-manager/internal/models"
+	"delivery-state-manager/pkg/clock"
+	"encoding/json"
+	"maps"
+	"slices"
+	"testing"
+)
+
+func TestOrderEncoderUsesResponseShape(t *testing.T) {
+	encode := OrderEncoder(NamingCamel, false, models.UnitMiles, clock.New())
+	body, err := encode(&models.Order{
+		ID:                   "o1",
+		Status:               models.OrderOffered,
+		DriverID:             "d1",
+		AssignmentDistanceKm: 1.609344,
+		OfferQueue:           []string{"d2"},
+	})
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+
+	var got map[string]any
+	if err := json.Unmarshal(body, &got); err != nil {
+		t.Fatalf("decoding %s: %v", body, err)
+	}
+	if got["driverId"] != "d1" {
+		t.Errorf("driverId = %v, want d1 under camel naming: %s", got["driverId"], body)
+	}
+	if d, ok := got["assignmentDistanceMi"].(float64); !ok || d < 0.999 || d > 1.001 {
+		t.Errorf("assignmentDistanceMi = %v, want 1 in the configured unit: %s", got["assignmentDistanceMi"], body)
+	}
+	if _, ok := got["driver_id"]; ok {
+		t.Errorf("body has snake_case keys: %s", body)
+	}
+	if _, ok := got["offerQueue"]; ok {
+		t.Errorf("body leaks the internal offer queue: %s", body)
+	}
+	if _, ok := got["offer_queue"]; ok {
+		t.Errorf("body leaks the internal offer queue: %s", body)
+	}
+}
+
+// encodedKeys encodes obj and returns its top-level keys, sorted
+func encodedKeys(t *testing.T, obj jsonObject) []string {
+	t.Helper()
+	body, err := json.Marshal(obj)
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	var decoded map[string]json.RawMessage
+	if err := json.Unmarshal(body, &decoded); err != nil {
+		t.Fatalf("decoding %s: %v", body, err)
+	}
+	return slices.Sorted(maps.Keys(decoded))
+}
+
+func TestDriverKeysFollowNaming(t *testing.T) {
+	driver := &models.Driver{
+		ID:             "d1",
+		Name:           "Ada",
+		Status:         models.DriverAvailable,
+		Location:       models.Location{Lat: 37.77, Lon: -122.42},
+		CooldownUntil:  1700000100,
+		LastAssignedAt: 1700000000,
+		MaxDailyOrders: 10,
+		CreatedAt:      1699990000,
+		UpdatedAt:      1700000000,
+	}
+	for naming, want := range map[string][]string{
+		NamingSnake: {"cooldown_until", "created_at", "daily_orders", "id", "last_assigned_at", "location", "max_daily_orders", "name", "remaining_daily_orders", "status", "updated_at"},
+		NamingCamel: {"cooldownUntil", "createdAt", "dailyOrders", "id", "lastAssignedAt", "location", "maxDailyOrders", "name", "remainingDailyOrders", "status", "updatedAt"},
+	} {
+		m := newDTOMapper(naming, false, models.UnitKilometers, clock.New())
+		if got := encodedKeys(t, m.driver(driver)); !slices.Equal(got, want) {
+			t.Errorf("%s keys = %v, want %v", naming, got, want)
+		}
+	}
+}
+
+func TestOmitZeroLocation(t *testing.T) {
+	for _, tc := range []struct {
+		omit bool
+		loc  models.Location
+		want []string
+	}{
+		{false, models.Location{}, []string{"lat", "lon"}},
+		{true, models.Location{}, []string{}},
+		{true, models.Location{Lat: 37.77}, []string{"lat"}},
+		{true, models.Location{Lat: 37.77, Lon: -122.42}, []string{"lat", "lon"}},
+	} {
+		m := newDTOMapper(NamingSnake, tc.omit, models.UnitKilometers, clock.New())
+		if got := encodedKeys(t, m.location(tc.loc)); !slices.Equal(got, tc.want) {
+			t.Errorf("omit %v, location %+v: keys = %v, want %v", tc.omit, tc.loc, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"context"
+	"delivery-state-manager/pkg/errs"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Supported values for the API_ERROR_FORMAT setting
+const (
+	// ErrorFormatStructured wraps errors as {"error": {"code", "message"}}
+	ErrorFormatStructured = "structured"
+	// ErrorFormatLegacy keeps the original {"error": "message"} shape
+	ErrorFormatLegacy = "legacy"
+)
+
+// Errors raised by the HTTP layer itself
+var (
+	errInvalidBody            = errs.New("INVALID_REQUEST_BODY", "Invalid request body")
+	errInvalidLimit           = errs.New("INVALID_LIMIT", "limit must be an integer")
+	errInvalidOffset          = errs.New("INVALID_OFFSET", "offset must be a non-negative integer")
+	errCursorSortOnly         = errs.New("INVALID_SORT_FIELD", "cursor pagination only supports sort=id")
+	errCursorNoOffset         = errs.New("INVALID_OFFSET", "drivers are paginated by cursor; pass after instead of offset")
+	errInvalidProximity       = errs.New("INVALID_PROXIMITY", "lat, lon and radius_km are required numbers")
+	errInvalidBounds          = errs.New("INVALID_BOUNDS", "min_lat, min_lon, max_lat and max_lon are required numbers")
+	errInvalidDeliveredWindow = errs.New("INVALID_DELIVERED_WINDOW", "delivered_after and delivered_before must be Unix timestamps")
+	errInvalidIncludeDeleted  = errs.New("INVALID_INCLUDE_DELETED", "include_deleted must be a boolean")
+	errInvalidRealOnly        = errs.New("INVALID_REAL_ONLY", "real_only must be a boolean")
+	errInvalidWait            = errs.New("INVALID_WAIT", "wait must be a positive duration such as 10s")
+	errInvalidSince           = errs.New("INVALID_SINCE", "since must be a state version")
+	errInvalidDebugToken      = errs.New("INVALID_DEBUG_TOKEN", "invalid debug token")
+	errOverloaded             = errs.New("OVERLOADED", "too many requests in flight, retry shortly")
+	errBacklogOverloaded      = errs.New("BACKLOG_OVERLOADED", "too many orders are waiting for a driver, retry later")
+	errRequestTimeout         = errs.New("REQUEST_TIMEOUT", "request timed out")
+	errStateTooLarge          = errs.New("STATE_TOO_LARGE", "state snapshot exceeds DEBUG_STATE_MAX_BYTES")
+)
+
+// errorDetail is the body of a structured error
+type errorDetail struct {
+	Code           string            `json:"code"`
+	Message        string            `json:"message"`
+	Fields         map[string]string `json:"fields,omitempty"`
+	ActiveOrderIDs []string          `json:"active_order_ids,omitempty"`
+}
+
+// errorEnvelope represents a structured error response
+type errorEnvelope struct {
+	Error errorDetail `json:"error"`
+}
+
+// errorCode returns the stable code of err, falling back to one derived
+// from the HTTP status for errors that carry none
+func errorCode(status int, err error) string {
+	if code := errs.Code(err); code != "" {
+		return code
+	}
+	return strings.ToUpper(strings.ReplaceAll(http.StatusText(status), " ", "_"))
+}
+
+// fail writes err as an error response with the given status, in the
+// configured error format
+func (h *Handler) fail(c *gin.Context, status int, err error) {
+	// A use case that gave up at the request deadline times out the request,
+	// whatever its handler would report for other errors
+	if errors.Is(err, context.DeadlineExceeded) {
+		status, err = http.StatusServiceUnavailable, errRequestTimeout
+	}
+	detail := errorDetail{Code: errorCode(status, err), Message: err.Error()}
+	var validationErr *errs.ValidationError
+	if errors.As(err, &validationErr) {
+		detail.Fields = validationErr.Fields
+	}
+	h.writeError(c, status, detail)
+}
+
+// failActiveOrders writes a 409 listing the orders that block a driver change
+func (h *Handler) failActiveOrders(c *gin.Context, err error, activeOrderIDs []string) {
+	h.writeError(c, http.StatusConflict, errorDetail{
+		Code:           errorCode(http.StatusConflict, err),
+		Message:        err.Error(),
+		ActiveOrderIDs: activeOrderIDs,
+	})
+}
+
+// writeError encodes detail in the configured error format
+func (h *Handler) writeError(c *gin.Context, status int, detail errorDetail) {
+	if h.cfg.ErrorFormat != ErrorFormatLegacy {
+		c.JSON(status, errorEnvelope{Error: detail})
+		return
+	}
+
+	switch {
+	case detail.Fields != nil:
+		c.JSON(status, validationErrorResponse{Error: "validation_failed", Fields: detail.Fields})
+	case detail.ActiveOrderIDs != nil:
+		c.JSON(status, activeOrdersErrorResponse{Error: detail.Message, ActiveOrderIDs: detail.ActiveOrderIDs})
+	default:
+		c.JSON(status, errorResponse{Error: detail.Message})
+	}
+}
@@ -0,0 +1,36 @@
+package handler
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestStructuredErrorEnvelope(t *testing.T) {
+	s := newTestStack(t)
+	w := s.mustDo(http.StatusNotFound, http.MethodGet, "/drivers/nobody", "")
+	var body errorEnvelope
+	decode(t, w, &body)
+	if body.Error.Code != "DRIVER_NOT_FOUND" || body.Error.Message != "driver not found" {
+		t.Errorf("error = %+v, want DRIVER_NOT_FOUND with its message", body.Error)
+	}
+}
+
+func TestLegacyErrorFormat(t *testing.T) {
+	s := newTestStack(t, func(cfg *stackConfig) { cfg.handler.ErrorFormat = ErrorFormatLegacy })
+
+	var plain map[string]any
+	decode(t, s.mustDo(http.StatusNotFound, http.MethodGet, "/drivers/nobody", ""), &plain)
+	if want := map[string]any{"error": "driver not found"}; !reflect.DeepEqual(plain, want) {
+		t.Errorf("body = %v, want %v", plain, want)
+	}
+
+	var validation struct {
+		Error  string            `json:"error"`
+		Fields map[string]string `json:"fields"`
+	}
+	decode(t, s.mustDo(http.StatusBadRequest, http.MethodPost, "/drivers", `{"id":"d1","location":{"lat":0,"lon":0}}`), &validation)
+	if validation.Error != "validation_failed" || validation.Fields["name"] != "required" {
+		t.Errorf("body = %+v, want validation_failed with name required", validation)
+	}
+}
@@ -0,0 +1,135 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// FeatureFlags switches routes on or off by pattern. A pattern is a route
+// path such as "/orders/:id/handoff", optionally preceded by a method, as in
+// "POST /bundles". A path ending in "/*" also covers every route below it.
+// Routes no pattern matches stay enabled.
+type FeatureFlags map[string]bool
+
+// ParseFeatureFlags parses a comma-separated list of pattern=bool pairs,
+// such as "/debug/*=false,GET /debug/state=true"
+func ParseFeatureFlags(spec string) (FeatureFlags, error) {
+	flags := make(FeatureFlags)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		pattern, value, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("flag %q: expected pattern=true or pattern=false", entry)
+		}
+		enabled, err := strconv.ParseBool(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("flag %q: %q is not a boolean", entry, value)
+		}
+		pattern = strings.Join(strings.Fields(pattern), " ")
+		path := pattern
+		if method, rest, ok := strings.Cut(pattern, " "); ok {
+			if strings.ToUpper(method) != method {
+				return nil, fmt.Errorf("flag %q: method must be upper case", entry)
+			}
+			path = rest
+		}
+		if !strings.HasPrefix(path, "/") {
+			return nil, fmt.Errorf("flag %q: path must start with /", entry)
+		}
+		flags[pattern] = enabled
+	}
+	return flags, nil
+}
+
+// Enabled reports whether the route is on. When several patterns match, the
+// most specific wins: an exact path over a wildcard, a longer wildcard over
+// a shorter one, and a pattern with a method over one without.
+func (f FeatureFlags) Enabled(method, path string) bool {
+	enabled, best := true, -1
+	for pattern, on := range f {
+		rank := 0
+		if m, rest, ok := strings.Cut(pattern, " "); ok {
+			if m != method {
+				continue
+			}
+			pattern, rank = rest, 1
+		}
+		if base, ok := strings.CutSuffix(pattern, "/*"); ok {
+			if path != base && !strings.HasPrefix(path, base+"/") {
+				continue
+			}
+			rank += 2 * len(base)
+		} else {
+			if path != pattern {
+				continue
+			}
+			// An exact path outranks any wildcard
+			rank += 2 * (len(path) + 1)
+		}
+		if rank > best {
+			enabled, best = on, rank
+		}
+	}
+	return enabled
+}
+
+// flaggedRoutes registers routes on group unless the feature flags turn
+// them off, so disabled routes answer 404 like any unknown path. base is
+// prepended to paths before they are checked, so flags name routes the same
+// way under every API version. Every route runs under the request timeout
+// except the requests exempt reports true for.
+type flaggedRoutes struct {
+	h      *Handler
+	group  *gin.RouterGroup
+	base   string
+	exempt func(c *gin.Context) bool
+}
+
+// handle registers a route if it is enabled
+func (r flaggedRoutes) handle(method, path string, handlers ...gin.HandlerFunc) {
+	if !r.h.cfg.FeatureFlags.Enabled(method, r.base+path) {
+		return
+	}
+	chain := append([]gin.HandlerFunc{r.h.requestTimeout(r.exempt)}, handlers...)
+	r.group.Handle(method, path, chain...)
+}
+
+// untimed returns routes whose requests run without the request timeout
+// when exempt reports true for them, for work such as profiles and long
+// polls that is meant to outlast it
+func (r flaggedRoutes) untimed(exempt func(c *gin.Context) bool) flaggedRoutes {
+	r.exempt = exempt
+	return r
+}
+
+// GET registers a GET route if it is enabled
+func (r flaggedRoutes) GET(path string, handlers ...gin.HandlerFunc) {
+	r.handle(http.MethodGet, path, handlers...)
+}
+
+// HEAD registers a HEAD route if it is enabled
+func (r flaggedRoutes) HEAD(path string, handlers ...gin.HandlerFunc) {
+	r.handle(http.MethodHead, path, handlers...)
+}
+
+// POST registers a POST route if it is enabled
+func (r flaggedRoutes) POST(path string, handlers ...gin.HandlerFunc) {
+	r.handle(http.MethodPost, path, handlers...)
+}
+
+// PATCH registers a PATCH route if it is enabled
+func (r flaggedRoutes) PATCH(path string, handlers ...gin.HandlerFunc) {
+	r.handle(http.MethodPatch, path, handlers...)
+}
+
+// DELETE registers a DELETE route if it is enabled
+func (r flaggedRoutes) DELETE(path string, handlers ...gin.HandlerFunc) {
+	r.handle(http.MethodDelete, path, handlers...)
+}
@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestParseFeatureFlags(t *testing.T) {
+	flags, err := ParseFeatureFlags(" /debug/* = false,GET  /debug/state=true,, POST /bundles=0")
+	if err != nil {
+		t.Fatalf("ParseFeatureFlags: %v", err)
+	}
+	want := FeatureFlags{"/debug/*": false, "GET /debug/state": true, "POST /bundles": false}
+	if !reflect.DeepEqual(flags, want) {
+		t.Errorf("flags = %v, want %v", flags, want)
+	}
+
+	for _, bad := range []string{
+		"/debug/*",
+		"/debug/*=maybe",
+		"get /debug/state=true",
+		"debug=false",
+	} {
+		if _, err := ParseFeatureFlags(bad); err == nil {
+			t.Errorf("ParseFeatureFlags(%q) accepted a malformed flag", bad)
+		}
+	}
+}
+
+func TestFeatureFlagsMostSpecificWins(t *testing.T) {
+	flags := FeatureFlags{
+		"/debug/*":             false,
+		"/debug/simulate/*":    true,
+		"GET /debug/state":     true,
+		"/debug/state":         false,
+		"DELETE /drivers/:id":  false,
+		"/orders/:id/handoff":  false,
+		"POST /orders/:id/*":   true,
+		"PATCH /orders/:id/*":  false,
+		"/orders/:id/status/*": true,
+	}
+	for _, tc := range []struct {
+		method, path string
+		want         bool
+	}{
+		{http.MethodGet, "/drivers", true},
+		{http.MethodGet, "/debug/summary", false},
+		{http.MethodPost, "/debug/simulate/movement", true},
+		{http.MethodGet, "/debug/state", true},
+		{http.MethodPost, "/debug/state", false},
+		{http.MethodDelete, "/drivers/:id", false},
+		{http.MethodGet, "/drivers/:id", true},
+		// An exact path beats a wildcard even when the wildcard names a method
+		{http.MethodPost, "/orders/:id/handoff", false},
+		{http.MethodPost, "/orders/:id/assign", true},
+		{http.MethodPatch, "/orders/:id/status", true},
+	} {
+		if got := flags.Enabled(tc.method, tc.path); got != tc.want {
+			t.Errorf("Enabled(%s %s) = %v, want %v", tc.method, tc.path, got, tc.want)
+		}
+	}
+}
+
+func TestDisabledRoutesAnswerNotFound(t *testing.T) {
+	s := newTestStack(t, func(cfg *stackConfig) {
+		cfg.handler.FeatureFlags = FeatureFlags{"/debug/*": false, "POST /drivers": false}
+	})
+
+	for _, path := range []string{"/debug/summary", "/v1/debug/summary", "/debug/matcher"} {
+		s.mustDo(http.StatusNotFound, http.MethodGet, path, "")
+	}
+	s.mustDo(http.StatusNotFound, http.MethodPost, "/drivers", driverJSON("d1", 37.77, -122.42))
+	s.mustDo(http.StatusOK, http.MethodGet, "/drivers", "")
+	s.mustDo(http.StatusCreated, http.MethodPost, "/orders", orderJSON("o1", 37.77, -122.42))
+}
@@ -1,102 +1,537 @@
 package handler
 
 import (
+	"bytes"
+	"context"
+	"crypto/subtle"
 	"delivery-state-manager/internal/models"
 	"delivery-state-manager/internal/usecase"
+	"delivery-state-manager/pkg/clock"
 	"delivery-state-manager/pkg/errs"
+	"delivery-state-manager/pkg/logger"
+	"errors"
 	"log"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
+// Config holds HTTP layer settings
+type Config struct {
+	DefaultPageSize int
+	MaxPageSize     int
+	GinMode         string
+	// Naming selects snake_case or camelCase keys for driver and order responses
+	Naming string
+	// OmitZeroLocation drops zero-valued coordinates from responses
+	OmitZeroLocation bool
+	// VersionPrefix, such as "/v1", is the path the API is served under.
+	// UnversionedRoutes also serves it without the prefix.
+	VersionPrefix     string
+	UnversionedRoutes bool
+	// FeatureFlags turns individual routes off; see FeatureFlags
+	FeatureFlags FeatureFlags
+	// StrictStatus accepts only statuses spelled exactly as documented. When
+	// it is off, statuses in request bodies are normalized first; see
+	// normalizeStatus.
+	StrictStatus bool
+	// DistanceUnit is models.UnitKilometers or models.UnitMiles, the unit of
+	// distances in driver and order responses
+	DistanceUnit string
+	// ResetEnabled registers POST /debug/reset and RestoreEnabled registers
+	// POST /debug/restore. When DebugToken is set both require it as a
+	// bearer token.
+	ResetEnabled   bool
+	RestoreEnabled bool
+	// MatchEnabled registers POST /debug/match and SeedEnabled registers
+	// POST /debug/seed, both also guarded by DebugToken
+	MatchEnabled bool
+	SeedEnabled  bool
+	DebugToken   string
+	// SimulateEnabled registers the /debug/simulate/movement routes; starting
+	// and stopping are guarded by DebugToken
+	SimulateEnabled bool
+	// MetricsEnabled registers GET /metrics
+	MetricsEnabled bool
+	// PprofEnabled registers the runtime profiles under /debug/pprof and
+	// GET /debug/goroutines, also guarded by DebugToken
+	PprofEnabled bool
+	// ErrorFormat is ErrorFormatStructured or ErrorFormatLegacy
+	ErrorFormat string
+	// MaxConcurrentRequests caps requests in flight, and MaxConcurrentReads
+	// and MaxConcurrentWrites cap reads and writes separately. Excess
+	// requests get 503. Zero means unlimited.
+	MaxConcurrentRequests int
+	MaxConcurrentReads    int
+	MaxConcurrentWrites   int
+	// RequestTimeout is the deadline each request's context gets; slower
+	// requests are answered with 503. Zero disables it.
+	RequestTimeout time.Duration
+	// WriteTimeout is the server's write timeout, which long polls push back
+	// by the time they wait
+	WriteTimeout time.Duration
+	// ListCacheTTL is how long GET /drivers and GET /orders responses are
+	// cached; zero disables the cache
+	ListCacheTTL time.Duration
+	// MaxStateBytes caps the encoded size of a GET /debug/state snapshot.
+	// Larger snapshots get 503 instead. Zero means unlimited.
+	MaxStateBytes int
+}
+
 // errorResponse represents an error response
 type errorResponse struct {
 	Error string `json:"error"`
 }
 
+// activeOrdersErrorResponse represents an error caused by a driver's active orders
+type activeOrdersErrorResponse struct {
+	Error          string   `json:"error"`
+	ActiveOrderIDs []string `json:"active_order_ids"`
+}
+
+// patchDriverRequest is the body of PATCH /drivers/:id
+type patchDriverRequest struct {
+	Name     *string              `json:"name"`
+	Status   *models.DriverStatus `json:"status"`
+	Location *models.Location     `json:"location"`
+}
+
+// driverStatusRequest is the body of PATCH /drivers/:id/status
+type driverStatusRequest struct {
+	Status         models.DriverStatus `json:"status"`
+	ExpectedStatus models.DriverStatus `json:"expected_status"`
+}
+
+// orderStatusRequest is the body of PATCH /orders/:id/status
+type orderStatusRequest struct {
+	Status models.OrderStatus `json:"status"`
+	// Customer identifies the caller when canceling; the
+	// X-Customer-ID header may be used instead
+	Customer string `json:"customer"`
+	// Reason is an optional reason code recorded when canceling
+	Reason string `json:"reason"`
+}
+
+// patchOrderRequest is the body of PATCH /orders/:id
+type patchOrderRequest struct {
+	Pickup  *models.Location `json:"pickup"`
+	Dropoff *models.Location `json:"dropoff"`
+	Notes   *string          `json:"notes"`
+}
+
+// assignOrderRequest is the body of POST /orders/:id/assign
+type assignOrderRequest struct {
+	DriverID string `json:"driver_id"`
+}
+
+// handoffOrderRequest is the body of POST /orders/:id/handoff
+type handoffOrderRequest struct {
+	ToDriverID string `json:"to_driver_id"`
+}
+
 // Handler holds all use cases
 type Handler struct {
 	driverUC *usecase.DriverUseCase
 	orderUC  *usecase.OrderUseCase
 	debugUC  *usecase.DebugUseCase
+	cfg      Config
+	dto      *dtoMapper
+	clk      clock.Clock
+	lists    *listCache
 }
 
 // NewHandler creates a new Handler instance
-func NewHandler(driverUC *usecase.DriverUseCase, orderUC *usecase.OrderUseCase, debugUC *usecase.DebugUseCase) *Handler {
+func NewHandler(driverUC *usecase.DriverUseCase, orderUC *usecase.OrderUseCase, debugUC *usecase.DebugUseCase, clk clock.Clock, cfg Config) *Handler {
 	return &Handler{
 		driverUC: driverUC,
 		orderUC:  orderUC,
 		debugUC:  debugUC,
+		cfg:      cfg,
+		dto:      newDTOMapper(cfg.Naming, cfg.OmitZeroLocation, cfg.DistanceUnit, clk),
+		clk:      clk,
+		lists:    newListCache(cfg.ListCacheTTL),
 	}
 }
 
 // SetupRouter sets up the HTTP router with all handlers
 func (h *Handler) SetupRouter() *gin.Engine {
-	r := gin.Default()
+	gin.SetMode(h.cfg.GinMode)
+
+	r := gin.New()
+	r.Use(gin.Recovery())
+	// Per-request access logs are only useful when debugging
+	if logger.DebugEnabled() {
+		r.Use(gin.Logger())
+	}
 
 	// Health check
-	r.GET("/health", func(c *gin.Context) {
+	root := h.routes(r.Group(""), "")
+	root.GET("/health", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"status": "ok"})
 	})
+	root.GET("/healthz/matcher", h.matcherHealthHandler())
+	if h.cfg.MetricsEnabled {
+		root.GET("/metrics", h.metricsHandler())
+	}
+
+	// Profiles can take longer than any API call, so they bypass the limiter.
+	// Left unregistered when disabled so they answer 404.
+	if h.cfg.PprofEnabled {
+		h.registerPprof(r)
+	}
+
+	// Added after /health so health checks still answer under load
+	r.Use(h.limitConcurrency())
+	r.Use(h.auditRequests())
+
+	// Every API version shares the same use cases. The original unprefixed
+	// routes stay available to older clients unless disabled.
+	h.registerV1(h.routes(r.Group(h.cfg.VersionPrefix), ""))
+	if h.cfg.UnversionedRoutes && h.cfg.VersionPrefix != "" {
+		h.registerV1(h.routes(r.Group(""), ""))
+	}
 
+	// API description, generated from the routes registered above
+	registerOpenAPI(r, h.cfg.VersionPrefix, h.cfg.ErrorFormat)
+
+	return r
+}
+
+// routes registers on g the routes FeatureFlags leaves enabled, checking
+// them as if g were at base
+func (h *Handler) routes(g *gin.RouterGroup, base string) flaggedRoutes {
+	return flaggedRoutes{h: h, group: g, base: base}
+}
+
+// registerV1 registers the version 1 API on g
+func (h *Handler) registerV1(g flaggedRoutes) {
 	// Driver endpoints
-	r.POST("/drivers", h.createOrUpdateDriverHandler())
-	r.GET("/drivers", h.getAllDriversHandler())
-	r.GET("/drivers/:id", h.getDriverHandler())
-	r.PATCH("/drivers/:id/status", h.updateDriverStatusHandler())
+	g.POST("/drivers", h.createOrUpdateDriverHandler())
+	g.GET("/drivers", h.cacheList(), h.getAllDriversHandler())
+	g.GET("/drivers/nearby", h.getNearbyDriversHandler())
+	g.GET("/drivers/available", h.getAvailableDriversHandler())
+	g.POST("/drivers/batch", h.batchGetDriversHandler())
+	g.GET("/drivers/:id", h.getDriverHandler())
+	g.HEAD("/drivers/:id", h.headDriverHandler())
+	g.GET("/drivers/:id/stats", h.getDriverStatsHandler())
+	g.GET("/drivers/:id/track", h.getDriverTrackHandler())
+	g.PATCH("/drivers/:id", h.patchDriverHandler())
+	g.DELETE("/drivers/:id", h.deleteDriverHandler())
+	g.PATCH("/drivers/:id/status", h.updateDriverStatusHandler())
+	g.POST("/drivers/:id/go-available", h.driverAvailabilityHandler(h.driverUC.GoAvailable))
+	g.POST("/drivers/:id/go-offline", h.driverAvailabilityHandler(h.driverUC.GoOffline))
 
 	// Order endpoints
-	r.POST("/orders", h.createOrderHandler())
-	r.GET("/orders", h.getAllOrdersHandler())
-	r.GET("/orders/:id", h.getOrderHandler())
-	r.PATCH("/orders/:id/status", h.updateOrderStatusHandler())
+	g.POST("/orders", h.createOrderHandler())
+	g.GET("/orders", h.cacheList(), h.getAllOrdersHandler())
+	g.GET("/orders/unmatchable", h.getUnmatchableOrdersHandler())
+	g.GET("/orders/within", h.getOrdersWithinHandler())
+	g.GET("/orders/:id", h.getOrderHandler())
+	g.HEAD("/orders/:id", h.headOrderHandler())
+	g.PATCH("/orders/:id", h.patchOrderHandler())
+	g.PATCH("/orders/:id/status", h.updateOrderStatusHandler())
+	g.GET("/orders/:id/eta", h.getOrderETAHandler())
+	g.GET("/orders/:id/driver", h.getOrderDriverHandler())
+	g.POST("/orders/:id/requeue", h.requeueOrderHandler())
+	g.POST("/orders/:id/assign", h.assignOrderHandler())
+	g.POST("/orders/:id/auto-assign", h.autoAssignOrderHandler())
+	g.POST("/orders/:id/offer", h.offerOrderHandler())
+	g.POST("/orders/:id/accept", h.acceptOfferHandler())
+	g.POST("/orders/:id/handoff", h.handoffOrderHandler())
+	g.POST("/bundles", h.createBundleHandler())
 
 	// Debug endpoints
-	r.GET("/debug/state", h.getStateHandler())
-
-	return r
+	g.untimed(isLongPoll).GET("/debug/state", h.getStateHandler())
+	g.GET("/debug/summary", h.getSummaryHandler())
+	g.GET("/debug/matcher", h.getMatcherStatusHandler())
+	g.GET("/debug/audit", h.getAuditLogHandler())
+	// Left unregistered when disabled so they answer 404 like any unknown route
+	if h.cfg.ResetEnabled {
+		g.POST("/debug/reset", h.requireDebugToken(), h.resetStateHandler())
+		g.POST("/debug/purge-simulated", h.requireDebugToken(), h.purgeSimulatedHandler())
+	}
+	if h.cfg.RestoreEnabled {
+		g.POST("/debug/restore", h.requireDebugToken(), h.restoreStateHandler())
+	}
+	if h.cfg.MatchEnabled {
+		g.POST("/debug/match", h.requireDebugToken(), h.runMatcherHandler())
+	}
+	if h.cfg.SeedEnabled {
+		g.POST("/debug/seed", h.requireDebugToken(), h.seedStateHandler())
+	}
+	if h.cfg.SimulateEnabled {
+		g.GET("/debug/simulate/movement", h.getMovementHandler())
+		g.POST("/debug/simulate/movement", h.requireDebugToken(), h.startMovementHandler())
+		g.DELETE("/debug/simulate/movement", h.requireDebugToken(), h.stopMovementHandler())
+	}
 }
 
 // createOrUpdateDriverHandler handles POST /drivers
 func (h *Handler) createOrUpdateDriverHandler() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var driver models.Driver
-		if err := c.ShouldBindJSON(&driver); err != nil {
-			c.JSON(http.StatusBadRequest, errorResponse{Error: "Invalid request body"})
+		if !h.bindJSON(c, &driver) {
 			return
 		}
+		driver.Status = normalizeStatus(h.cfg.StrictStatus, driver.Status)
 
-		if err := h.driverUC.CreateOrUpdateDriver(&driver); err != nil {
-			c.JSON(http.StatusBadRequest, errorResponse{Error: err.Error()})
+		if err := h.driverUC.CreateOrUpdateDriver(c.Request.Context(), &driver); err != nil {
+			if err == errs.ErrCapacityExceeded {
+				h.fail(c, http.StatusServiceUnavailable, err)
+			} else if err == errs.ErrDriverDeleted || err == errs.ErrDuplicateLocation {
+				h.fail(c, http.StatusConflict, err)
+			} else {
+				h.badRequest(c, err)
+			}
 			return
 		}
 
 		log.Printf("Driver created/updated: %s (%s)", driver.ID, driver.Name)
-		c.JSON(http.StatusOK, driver)
+		c.JSON(http.StatusOK, h.dto.driver(&driver))
 	}
 }
 
-// getAllDriversHandler handles GET /drivers
+// getAllDriversHandler handles GET /drivers.
+// Passing after or limit switches to a cursor-paginated response ordered by
+// ID. Offsets are rejected rather than ignored.
 func (h *Handler) getAllDriversHandler() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		drivers := h.driverUC.GetAllDrivers()
-		c.JSON(http.StatusOK, drivers)
+		page, err := h.parsePagination(c)
+		if err != nil {
+			h.fail(c, http.StatusBadRequest, err)
+			return
+		}
+		if _, ok := c.GetQuery("offset"); ok {
+			h.fail(c, http.StatusBadRequest, errCursorNoOffset)
+			return
+		}
+
+		sortBy := c.Query("sort")
+
+		if !page.Requested {
+			drivers, err := h.driverUC.GetAllDrivers(sortBy)
+			if err != nil {
+				h.fail(c, http.StatusBadRequest, err)
+				return
+			}
+			c.JSON(http.StatusOK, h.dto.drivers(drivers))
+			return
+		}
+
+		if sortBy != "" && sortBy != usecase.SortByID {
+			h.fail(c, http.StatusBadRequest, errCursorSortOnly)
+			return
+		}
+
+		c.JSON(http.StatusOK, h.dto.driverPage(h.driverUC.ListDrivers(page.After, page.Limit)))
+	}
+}
+
+// getNearbyDriversHandler handles GET /drivers/nearby
+func (h *Handler) getNearbyDriversHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		center, radiusKm, ok := h.parseProximity(c)
+		if !ok {
+			return
+		}
+
+		status := models.DriverStatus(c.Query("status"))
+		drivers, err := h.driverUC.GetNearbyDrivers(center, radiusKm, status)
+		if err != nil {
+			h.badRequest(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, h.dto.drivers(drivers))
+	}
+}
+
+// getAvailableDriversHandler handles GET /drivers/available.
+// Drivers are sorted by ID, or by distance when lat, lon and radius_km are given.
+func (h *Handler) getAvailableDriversHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Query("lat") == "" && c.Query("lon") == "" && c.Query("radius_km") == "" {
+			c.JSON(http.StatusOK, h.dto.drivers(h.driverUC.GetAvailableDrivers()))
+			return
+		}
+
+		center, radiusKm, ok := h.parseProximity(c)
+		if !ok {
+			return
+		}
+
+		drivers, err := h.driverUC.GetNearbyDrivers(center, radiusKm, models.DriverAvailable)
+		if err != nil {
+			h.badRequest(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, h.dto.drivers(drivers))
+	}
+}
+
+// parseProximity reads the lat, lon and radius_km query parameters,
+// writing a 400 response and returning false if any is missing or invalid
+func (h *Handler) parseProximity(c *gin.Context) (models.Location, float64, bool) {
+	lat, latErr := strconv.ParseFloat(c.Query("lat"), 64)
+	lon, lonErr := strconv.ParseFloat(c.Query("lon"), 64)
+	radiusKm, radiusErr := strconv.ParseFloat(c.Query("radius_km"), 64)
+	if latErr != nil || lonErr != nil || radiusErr != nil {
+		h.fail(c, http.StatusBadRequest, errInvalidProximity)
+		return models.Location{}, 0, false
 	}
+	return models.Location{Lat: lat, Lon: lon}, radiusKm, true
 }
 
-// getDriverHandler handles GET /drivers/:id
+// getDriverHandler handles GET /drivers/:id.
+// Deleted drivers are only returned with include_deleted=true.
 func (h *Handler) getDriverHandler() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		id := c.Param("id")
 
-		driver, err := h.driverUC.GetDriver(id)
+		includeDeleted, ok := h.parseIncludeDeleted(c)
+		if !ok {
+			return
+		}
+
+		driver, err := h.driverUC.GetDriver(id, includeDeleted)
+		if err != nil {
+			h.fail(c, http.StatusNotFound, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, h.dto.driver(driver))
+	}
+}
+
+// batchGetDriversHandler handles POST /drivers/batch
+func (h *Handler) batchGetDriversHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		includeDeleted, ok := h.parseIncludeDeleted(c)
+		if !ok {
+			return
+		}
+
+		var req models.DriverBatchRequest
+		if !h.bindJSON(c, &req) {
+			return
+		}
+
+		lookups, err := h.driverUC.GetDriversByIDs(req.IDs, includeDeleted)
+		if err != nil {
+			h.badRequest(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, h.dto.driverLookups(lookups))
+	}
+}
+
+// parseIncludeDeleted reads the include_deleted query flag, writing a 400
+// response and returning false if it is not a boolean
+func (h *Handler) parseIncludeDeleted(c *gin.Context) (bool, bool) {
+	return h.parseBoolQuery(c, "include_deleted", errInvalidIncludeDeleted)
+}
+
+// parseBoolQuery reads an optional boolean query parameter, defaulting to
+// false. On a malformed value it writes invalid as a 400 and returns false
+// as its second result.
+func (h *Handler) parseBoolQuery(c *gin.Context, name string, invalid error) (bool, bool) {
+	value := c.Query(name)
+	if value == "" {
+		return false, true
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		h.fail(c, http.StatusBadRequest, invalid)
+		return false, false
+	}
+	return parsed, true
+}
+
+// headDriverHandler handles HEAD /drivers/:id
+func (h *Handler) headDriverHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		includeDeleted, ok := h.parseIncludeDeleted(c)
+		if !ok {
+			return
+		}
+		if _, err := h.driverUC.GetDriver(c.Param("id"), includeDeleted); err != nil {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		c.Status(http.StatusOK)
+	}
+}
+
+// getDriverTrackHandler handles GET /drivers/:id/track
+func (h *Handler) getDriverTrackHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+
+		track, err := h.driverUC.GetDriverTrack(id)
+		if err != nil {
+			h.fail(c, http.StatusNotFound, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, track)
+	}
+}
+
+// getDriverStatsHandler handles GET /drivers/:id/stats
+func (h *Handler) getDriverStatsHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+
+		stats, err := h.driverUC.GetDriverStats(id)
+		if err != nil {
+			h.fail(c, http.StatusNotFound, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, h.dto.driverStats(stats))
+	}
+}
+
+// patchDriverHandler handles PATCH /drivers/:id.
+// Only fields present in the body are updated.
+func (h *Handler) patchDriverHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+
+		var req patchDriverRequest
+		if !h.bindJSON(c, &req) {
+			return
+		}
+
+		patch := models.DriverPatch{
+			Name:     req.Name,
+			Status:   req.Status,
+			Location: req.Location,
+		}
+		if patch.Status != nil {
+			status := normalizeStatus(h.cfg.StrictStatus, *patch.Status)
+			patch.Status = &status
+		}
+		driver, err := h.driverUC.PatchDriver(c.Request.Context(), id, patch)
 		if err != nil {
-			c.JSON(http.StatusNotFound, errorResponse{Error: err.Error()})
+			if err == errs.ErrDriverNotFound {
+				h.fail(c, http.StatusNotFound, err)
+			} else if err == errs.ErrDuplicateLocation {
+				h.fail(c, http.StatusConflict, err)
+			} else {
+				h.badRequest(c, err)
+			}
 			return
 		}
 
-		c.JSON(http.StatusOK, driver)
+		log.Printf("Driver patched: %s", id)
+		c.JSON(http.StatusOK, h.dto.driver(driver))
 	}
 }
 
@@ -105,33 +540,103 @@ func (h *Handler) updateDriverStatusHandler() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		id := c.Param("id")
 
-		var req struct {
-			Status models.DriverStatus `json:"status"`
-		}
+		var req driverStatusRequest
 
-		if err := c.ShouldBindJSON(&req); err != nil {
-			c.JSON(http.StatusBadRequest, errorResponse{Error: "Invalid request body"})
+		if !h.bindJSON(c, &req) {
 			return
 		}
+		req.Status = normalizeStatus(h.cfg.StrictStatus, req.Status)
+		req.ExpectedStatus = normalizeStatus(h.cfg.StrictStatus, req.ExpectedStatus)
+
+		var err error
+		if req.ExpectedStatus != "" {
+			err = h.driverUC.CompareAndSetDriverStatus(c.Request.Context(), id, req.ExpectedStatus, req.Status)
+		} else {
+			err = h.driverUC.UpdateDriverStatus(c.Request.Context(), id, req.Status)
+		}
 
-		if err := h.driverUC.UpdateDriverStatus(id, req.Status); err != nil {
+		if err != nil {
 			if err == errs.ErrDriverNotFound {
-				c.JSON(http.StatusNotFound, errorResponse{Error: err.Error()})
+				h.fail(c, http.StatusNotFound, err)
+			} else if err == errs.ErrDriverStatusConflict {
+				h.fail(c, http.StatusConflict, err)
 			} else {
-				c.JSON(http.StatusBadRequest, errorResponse{Error: err.Error()})
+				h.fail(c, http.StatusBadRequest, err)
 			}
 			return
 		}
 
-		driver, err := h.driverUC.GetDriver(id)
+		driver, err := h.driverUC.GetDriver(id, false)
 		if err != nil {
 			log.Printf("Failed to retrieve updated driver %s: %v", id, err)
-			c.JSON(http.StatusInternalServerError, errorResponse{Error: "Failed to retrieve updated driver"})
+			h.fail(c, http.StatusInternalServerError, errors.New("Failed to retrieve updated driver"))
 			return
 		}
 
 		log.Printf("Driver status updated: %s -> %s", id, req.Status)
-		c.JSON(http.StatusOK, driver)
+		c.JSON(http.StatusOK, h.dto.driver(driver))
+	}
+}
+
+// driverAvailabilityHandler handles POST /drivers/:id/go-available and
+// POST /drivers/:id/go-offline using the given toggle
+func (h *Handler) driverAvailabilityHandler(toggle func(ctx context.Context, id string) ([]string, error)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+
+		activeOrderIDs, err := toggle(c.Request.Context(), id)
+		if err != nil {
+			switch err {
+			case errs.ErrDriverNotFound:
+				h.fail(c, http.StatusNotFound, err)
+			case errs.ErrDriverHasActiveOrder:
+				h.failActiveOrders(c, err, activeOrderIDs)
+			default:
+				h.fail(c, http.StatusBadRequest, err)
+			}
+			return
+		}
+
+		driver, err := h.driverUC.GetDriver(id, false)
+		if err != nil {
+			log.Printf("Failed to retrieve updated driver %s: %v", id, err)
+			h.fail(c, http.StatusInternalServerError, errors.New("Failed to retrieve updated driver"))
+			return
+		}
+
+		log.Printf("Driver availability updated: %s -> %s", id, driver.Status)
+		c.JSON(http.StatusOK, h.dto.driver(driver))
+	}
+}
+
+// deleteDriverHandler handles DELETE /drivers/:id. The driver is only marked
+// deleted so orders that reference it can still resolve it.
+func (h *Handler) deleteDriverHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+
+		activeOrderIDs, err := h.driverUC.DeleteDriver(c.Request.Context(), id)
+		if err != nil {
+			switch err {
+			case errs.ErrDriverNotFound:
+				h.fail(c, http.StatusNotFound, err)
+			case errs.ErrDriverHasActiveOrder:
+				h.failActiveOrders(c, err, activeOrderIDs)
+			default:
+				h.fail(c, http.StatusBadRequest, err)
+			}
+			return
+		}
+
+		driver, err := h.driverUC.GetDriver(id, true)
+		if err != nil {
+			log.Printf("Failed to retrieve deleted driver %s: %v", id, err)
+			h.fail(c, http.StatusInternalServerError, errors.New("Failed to retrieve deleted driver"))
+			return
+		}
+
+		log.Printf("Driver deleted: %s", id)
+		c.JSON(http.StatusOK, h.dto.driver(driver))
 	}
 }
 
@@ -139,27 +644,171 @@ func (h *Handler) updateDriverStatusHandler() gin.HandlerFunc {
 func (h *Handler) createOrderHandler() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var order models.Order
-		if err := c.ShouldBindJSON(&order); err != nil {
-			c.JSON(http.StatusBadRequest, errorResponse{Error: "Invalid request body"})
+		if !h.bindJSON(c, &order) {
+			return
+		}
+		c.Set(auditNotesKey, order.Notes)
+		c.Set(auditContactlessKey, order.Contactless)
+
+		// A retry of an order already created is replayed even when the
+		// backlog would turn a new order away
+		key := c.GetHeader("Idempotency-Key")
+		if key != "" {
+			original, ok, err := h.orderUC.ReplayIdempotent(key, &order)
+			if err != nil {
+				h.failCreateOrder(c, err)
+				return
+			}
+			if ok {
+				log.Printf("Order replayed for idempotency key %s: %s", key, original.ID)
+				c.JSON(http.StatusOK, h.pendingOrder(c, original))
+				return
+			}
+		}
+
+		if !h.admitOrder(c) {
 			return
 		}
 
-		if err := h.orderUC.CreateOrder(&order); err != nil {
-			c.JSON(http.StatusBadRequest, errorResponse{Error: err.Error()})
+		if key != "" {
+			created, isNew, err := h.orderUC.CreateOrderIdempotent(c.Request.Context(), key, &order)
+			if err != nil {
+				h.failCreateOrder(c, err)
+				return
+			}
+
+			if !isNew {
+				log.Printf("Order replayed for idempotency key %s: %s", key, created.ID)
+				c.JSON(http.StatusOK, h.pendingOrder(c, created))
+				return
+			}
+
+			log.Printf("Order created: %s for customer %s", created.ID, created.Customer)
+			c.JSON(http.StatusCreated, h.pendingOrder(c, created))
+			return
+		}
+
+		if err := h.orderUC.CreateOrder(c.Request.Context(), &order); err != nil {
+			h.failCreateOrder(c, err)
 			return
 		}
 
 		log.Printf("Order created: %s for customer %s", order.ID, order.Customer)
-		c.JSON(http.StatusCreated, order)
+		c.JSON(http.StatusCreated, h.pendingOrder(c, &order))
+	}
+}
+
+// pendingOrder maps an order for a create or get response. While the order
+// is pending, the estimated wait for a driver is added as
+// estimated_wait_seconds and in the Retry-After header, so clients know
+// when to poll again.
+func (h *Handler) pendingOrder(c *gin.Context, order *models.Order) jsonObject {
+	obj := h.dto.order(order)
+	wait, ok := h.orderUC.EstimateWait(order)
+	if !ok {
+		return obj
+	}
+
+	seconds := max(int(math.Ceil(wait.Seconds())), 1)
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	return h.dto.field(obj, "estimated_wait_seconds", seconds)
+}
+
+// admitOrder applies order admission control. An overloaded backlog is
+// reported in the X-Backlog-Ratio and X-Estimated-Wait headers, and when
+// enforcing the request is answered with 503 and Retry-After.
+func (h *Handler) admitOrder(c *gin.Context) bool {
+	admission := h.orderUC.CheckAdmission()
+	if !admission.Overloaded {
+		return true
+	}
+
+	wait := strconv.Itoa(int(math.Ceil(admission.EstimatedWait.Seconds())))
+	c.Header("X-Backlog-Ratio", strconv.FormatFloat(admission.BacklogRatio, 'f', 2, 64))
+	c.Header("X-Estimated-Wait", wait)
+	if !admission.Reject {
+		return true
+	}
+
+	log.Printf("Order rejected by admission control: %.2f pending orders per driver", admission.BacklogRatio)
+	c.Header("Retry-After", wait)
+	h.fail(c, http.StatusServiceUnavailable, errBacklogOverloaded)
+	return false
+}
+
+// failCreateOrder writes the response for a failed order creation
+func (h *Handler) failCreateOrder(c *gin.Context, err error) {
+	if err == errs.ErrIdempotencyKeyConflict || err == errs.ErrOrderExists {
+		h.fail(c, http.StatusConflict, err)
+	} else if err == errs.ErrCapacityExceeded {
+		h.fail(c, http.StatusServiceUnavailable, err)
+	} else if err == errs.ErrCustomerOrderLimit {
+		h.fail(c, http.StatusTooManyRequests, err)
+	} else {
+		h.badRequest(c, err)
 	}
 }
 
-// getAllOrdersHandler handles GET /orders
+// getAllOrdersHandler handles GET /orders.
+// Passing limit or offset switches to a paginated response. Repeating tag
+// keeps only orders carrying all of the given tags.
 func (h *Handler) getAllOrdersHandler() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		orders := h.orderUC.GetAllOrders()
-		c.JSON(http.StatusOK, orders)
+		page, err := h.parsePagination(c)
+		if err != nil {
+			h.fail(c, http.StatusBadRequest, err)
+			return
+		}
+
+		filter, ok := h.parseOrderFilter(c)
+		if !ok {
+			return
+		}
+		sortBy := c.Query("sort")
+
+		if !page.Requested {
+			orders, err := h.orderUC.GetAllOrders(sortBy, filter)
+			if err != nil {
+				h.fail(c, http.StatusBadRequest, err)
+				return
+			}
+			c.JSON(http.StatusOK, h.dto.orders(orders))
+			return
+		}
+
+		orderPage, err := h.orderUC.ListOrders(page.Offset, page.Limit, sortBy, filter)
+		if err != nil {
+			h.fail(c, http.StatusBadRequest, err)
+			return
+		}
+		c.JSON(http.StatusOK, h.dto.orderPage(orderPage))
+	}
+}
+
+// parseOrderFilter reads the tag, delivered_after and delivered_before query
+// parameters, writing a 400 and returning false if a timestamp is not an
+// integer
+func (h *Handler) parseOrderFilter(c *gin.Context) (models.OrderFilter, bool) {
+	filter := models.OrderFilter{Tags: c.QueryArray("tag")}
+	for _, param := range []struct {
+		name   string
+		target *int64
+	}{
+		{"delivered_after", &filter.DeliveredAfter},
+		{"delivered_before", &filter.DeliveredBefore},
+	} {
+		value := c.Query(param.name)
+		if value == "" {
+			continue
+		}
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			h.fail(c, http.StatusBadRequest, errInvalidDeliveredWindow)
+			return models.OrderFilter{}, false
+		}
+		*param.target = parsed
 	}
+	return filter, true
 }
 
 // getOrderHandler handles GET /orders/:id
@@ -169,11 +818,22 @@ func (h *Handler) getOrderHandler() gin.HandlerFunc {
 
 		order, err := h.orderUC.GetOrder(id)
 		if err != nil {
-			c.JSON(http.StatusNotFound, errorResponse{Error: err.Error()})
+			h.fail(c, http.StatusNotFound, err)
 			return
 		}
 
-		c.JSON(http.StatusOK, order)
+		c.JSON(http.StatusOK, h.pendingOrder(c, order))
+	}
+}
+
+// headOrderHandler handles HEAD /orders/:id
+func (h *Handler) headOrderHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, err := h.orderUC.GetOrder(c.Param("id")); err != nil {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		c.Status(http.StatusOK)
 	}
 }
 
@@ -182,20 +842,33 @@ func (h *Handler) updateOrderStatusHandler() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		id := c.Param("id")
 
-		var req struct {
-			Status models.OrderStatus `json:"status"`
-		}
+		var req orderStatusRequest
 
-		if err := c.ShouldBindJSON(&req); err != nil {
-			c.JSON(http.StatusBadRequest, errorResponse{Error: "Invalid request body"})
+		if !h.bindJSON(c, &req) {
 			return
 		}
 
-		if err := h.orderUC.UpdateOrderStatus(id, req.Status); err != nil {
+		req.Status = normalizeStatus(h.cfg.StrictStatus, req.Status)
+
+		var err error
+		if req.Status == models.OrderCanceled {
+			customer := req.Customer
+			if customer == "" {
+				customer = c.GetHeader("X-Customer-ID")
+			}
+			c.Set(auditReasonKey, req.Reason)
+			err = h.orderUC.CancelOrder(c.Request.Context(), id, customer, req.Reason)
+		} else {
+			err = h.orderUC.UpdateOrderStatus(c.Request.Context(), id, req.Status)
+		}
+
+		if err != nil {
 			if err == errs.ErrOrderNotFound {
-				c.JSON(http.StatusNotFound, errorResponse{Error: err.Error()})
+				h.fail(c, http.StatusNotFound, err)
+			} else if err == errs.ErrNotOrderOwner {
+				h.fail(c, http.StatusForbidden, err)
 			} else {
-				c.JSON(http.StatusBadRequest, errorResponse{Error: err.Error()})
+				h.fail(c, http.StatusBadRequest, err)
 			}
 			return
 		}
@@ -203,19 +876,574 @@ func (h *Handler) updateOrderStatusHandler() gin.HandlerFunc {
 		order, err := h.orderUC.GetOrder(id)
 		if err != nil {
 			log.Printf("Failed to retrieve updated order %s: %v", id, err)
-			c.JSON(http.StatusInternalServerError, errorResponse{Error: "Failed to retrieve updated order"})
+			h.fail(c, http.StatusInternalServerError, errors.New("Failed to retrieve updated order"))
 			return
 		}
 
 		log.Printf("Order status updated: %s -> %s", id, req.Status)
-		c.JSON(http.StatusOK, order)
+		c.JSON(http.StatusOK, h.dto.order(order))
 	}
 }
 
-// getStateHandler handles GET /debug/state
-func (h *Handler) getStateHandler() gin.HandlerFunc {
+// patchOrderHandler handles PATCH /orders/:id.
+// Only the dropoff and notes can change, and only before pickup; the pickup
+// itself can only change while the order is pending.
+func (h *Handler) patchOrderHandler() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		snapshot := h.debugUC.GetSnapshot()
-		c.JSON(http.StatusOK, snapshot)
+		id := c.Param("id")
+
+		var req patchOrderRequest
+		if !h.bindJSON(c, &req) {
+			return
+		}
+		if req.Notes != nil {
+			c.Set(auditNotesKey, *req.Notes)
+		}
+
+		patch := models.OrderPatch{
+			Pickup:  req.Pickup,
+			Dropoff: req.Dropoff,
+			Notes:   req.Notes,
+		}
+		order, err := h.orderUC.PatchOrder(c.Request.Context(), id, patch)
+		if err != nil {
+			switch err {
+			case errs.ErrOrderNotFound:
+				h.fail(c, http.StatusNotFound, err)
+			case errs.ErrInvalidTransition:
+				h.fail(c, http.StatusConflict, err)
+			default:
+				h.badRequest(c, err)
+			}
+			return
+		}
+
+		log.Printf("Order patched: %s", id)
+		c.JSON(http.StatusOK, h.dto.order(order))
+	}
+}
+
+// getOrdersWithinHandler handles GET /orders/within
+func (h *Handler) getOrdersWithinHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		bounds, ok := h.parseBounds(c)
+		if !ok {
+			return
+		}
+
+		status := models.OrderStatus(c.Query("status"))
+		orders, err := h.orderUC.GetOrdersWithin(bounds, status)
+		if err != nil {
+			h.badRequest(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, h.dto.orders(orders))
+	}
+}
+
+// parseBounds reads the min_lat, min_lon, max_lat and max_lon query
+// parameters, writing a 400 and returning false if any is missing or not a
+// number
+func (h *Handler) parseBounds(c *gin.Context) (models.Bounds, bool) {
+	minLat, minLatErr := strconv.ParseFloat(c.Query("min_lat"), 64)
+	minLon, minLonErr := strconv.ParseFloat(c.Query("min_lon"), 64)
+	maxLat, maxLatErr := strconv.ParseFloat(c.Query("max_lat"), 64)
+	maxLon, maxLonErr := strconv.ParseFloat(c.Query("max_lon"), 64)
+	if minLatErr != nil || minLonErr != nil || maxLatErr != nil || maxLonErr != nil {
+		h.fail(c, http.StatusBadRequest, errInvalidBounds)
+		return models.Bounds{}, false
+	}
+	return models.Bounds{MinLat: minLat, MinLon: minLon, MaxLat: maxLat, MaxLon: maxLon}, true
+}
+
+// getUnmatchableOrdersHandler handles GET /orders/unmatchable
+func (h *Handler) getUnmatchableOrdersHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		orders := h.orderUC.GetUnmatchableOrders()
+		c.JSON(http.StatusOK, h.dto.orders(orders))
+	}
+}
+
+// requeueOrderHandler handles POST /orders/:id/requeue
+func (h *Handler) requeueOrderHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+
+		if err := h.orderUC.RequeueOrder(c.Request.Context(), id); err != nil {
+			if err == errs.ErrOrderNotFound {
+				h.fail(c, http.StatusNotFound, err)
+			} else {
+				h.fail(c, http.StatusBadRequest, err)
+			}
+			return
+		}
+
+		order, err := h.orderUC.GetOrder(id)
+		if err != nil {
+			log.Printf("Failed to retrieve requeued order %s: %v", id, err)
+			h.fail(c, http.StatusInternalServerError, errors.New("Failed to retrieve requeued order"))
+			return
+		}
+
+		log.Printf("Order requeued: %s", id)
+		c.JSON(http.StatusOK, h.dto.order(order))
+	}
+}
+
+// assignOrderHandler handles POST /orders/:id/assign
+func (h *Handler) assignOrderHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+
+		var req assignOrderRequest
+
+		if !h.bindJSON(c, &req) {
+			return
+		}
+
+		order, err := h.orderUC.AssignOrder(c.Request.Context(), id, req.DriverID)
+		if err != nil {
+			if err == errs.ErrOrderNotFound || err == errs.ErrDriverNotFound {
+				h.fail(c, http.StatusNotFound, err)
+			} else if err == errs.ErrOrderAlreadyAssigned || err == errs.ErrDriverNotAvailable || err == errs.ErrDriverDailyLimit || err == errs.ErrBundleExceedsCapacity {
+				h.fail(c, http.StatusConflict, err)
+			} else {
+				h.badRequest(c, err)
+			}
+			return
+		}
+
+		log.Printf("Order manually assigned: %s -> driver %s", id, req.DriverID)
+		c.JSON(http.StatusOK, h.dto.order(order))
+	}
+}
+
+// createBundleHandler handles POST /bundles
+func (h *Handler) createBundleHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req models.BundleRequest
+		if !h.bindJSON(c, &req) {
+			return
+		}
+
+		bundle, err := h.orderUC.BundleOrders(c.Request.Context(), req.OrderIDs)
+		if err != nil {
+			if err == errs.ErrOrderNotFound {
+				h.fail(c, http.StatusNotFound, err)
+			} else if err == errs.ErrOrderAlreadyAssigned || err == errs.ErrOrderBundled {
+				h.fail(c, http.StatusConflict, err)
+			} else {
+				h.badRequest(c, err)
+			}
+			return
+		}
+
+		log.Printf("Bundle created: %s with orders %v", bundle.ID, bundle.OrderIDs)
+		c.JSON(http.StatusCreated, bundle)
+	}
+}
+
+// handoffOrderHandler handles POST /orders/:id/handoff
+func (h *Handler) handoffOrderHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+
+		var req handoffOrderRequest
+
+		if !h.bindJSON(c, &req) {
+			return
+		}
+
+		order, err := h.orderUC.HandoffOrder(c.Request.Context(), id, req.ToDriverID)
+		if err != nil {
+			if err == errs.ErrOrderNotFound || err == errs.ErrDriverNotFound {
+				h.fail(c, http.StatusNotFound, err)
+			} else if err == errs.ErrInvalidTransition || err == errs.ErrDriverNotAvailable || err == errs.ErrDriverDailyLimit {
+				h.fail(c, http.StatusConflict, err)
+			} else {
+				h.badRequest(c, err)
+			}
+			return
+		}
+
+		c.JSON(http.StatusOK, h.dto.order(order))
+	}
+}
+
+// autoAssignOrderHandler handles POST /orders/:id/auto-assign
+func (h *Handler) autoAssignOrderHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+
+		driver, err := h.orderUC.AutoAssignOrder(c.Request.Context(), id)
+		if err != nil {
+			if err == errs.ErrOrderNotFound {
+				h.fail(c, http.StatusNotFound, err)
+			} else if err == errs.ErrOrderAlreadyAssigned || err == errs.ErrNoEligibleDriver || err == errs.ErrPickupChanged {
+				h.fail(c, http.StatusConflict, err)
+			} else {
+				h.fail(c, http.StatusServiceUnavailable, err)
+			}
+			return
+		}
+
+		log.Printf("Order auto-assigned: %s -> driver %s", id, driver.ID)
+		c.JSON(http.StatusOK, h.dto.driver(driver))
+	}
+}
+
+// offerOrderHandler handles POST /orders/:id/offer
+func (h *Handler) offerOrderHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+
+		order, err := h.orderUC.OfferOrder(c.Request.Context(), id)
+		if err != nil {
+			if err == errs.ErrOrderNotFound {
+				h.fail(c, http.StatusNotFound, err)
+			} else if err == errs.ErrOrderAlreadyAssigned || err == errs.ErrNoEligibleDriver || err == errs.ErrOrderBundled {
+				h.fail(c, http.StatusConflict, err)
+			} else {
+				h.fail(c, http.StatusServiceUnavailable, err)
+			}
+			return
+		}
+
+		log.Printf("Order offered: %s -> drivers %v", id, order.OfferedTo)
+		c.JSON(http.StatusOK, h.dto.order(order))
+	}
+}
+
+// acceptOfferHandler handles POST /orders/:id/accept
+func (h *Handler) acceptOfferHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+
+		var req assignOrderRequest
+
+		if !h.bindJSON(c, &req) {
+			return
+		}
+
+		order, err := h.orderUC.AcceptOffer(c.Request.Context(), id, req.DriverID)
+		if err != nil {
+			if err == errs.ErrOrderNotFound || err == errs.ErrDriverNotFound {
+				h.fail(c, http.StatusNotFound, err)
+			} else if err == errs.ErrOfferNotOpen || err == errs.ErrDriverNotAvailable || err == errs.ErrDriverDailyLimit {
+				h.fail(c, http.StatusConflict, err)
+			} else {
+				h.badRequest(c, err)
+			}
+			return
+		}
+
+		log.Printf("Order offer accepted: %s -> driver %s", id, order.DriverID)
+		c.JSON(http.StatusOK, h.dto.order(order))
+	}
+}
+
+// getOrderETAHandler handles GET /orders/:id/eta
+func (h *Handler) getOrderETAHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+
+		eta, err := h.orderUC.GetOrderETA(id)
+		if err != nil {
+			if err == errs.ErrOrderNotFound {
+				h.fail(c, http.StatusNotFound, err)
+			} else if err == errs.ErrOrderNotInTransit {
+				h.fail(c, http.StatusBadRequest, err)
+			} else {
+				log.Printf("Failed to compute ETA for order %s: %v", id, err)
+				h.fail(c, http.StatusInternalServerError, errors.New("Failed to compute ETA"))
+			}
+			return
+		}
+
+		c.JSON(http.StatusOK, h.dto.eta(eta))
+	}
+}
+
+// getOrderDriverHandler handles GET /orders/:id/driver
+func (h *Handler) getOrderDriverHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		driver, err := h.orderUC.GetOrderDriver(c.Param("id"))
+		if err != nil {
+			if err == errs.ErrOrderNotFound || err == errs.ErrDriverNotFound {
+				h.fail(c, http.StatusNotFound, err)
+			} else if err == errs.ErrOrderNotAssigned {
+				h.fail(c, http.StatusConflict, err)
+			} else {
+				h.fail(c, http.StatusInternalServerError, err)
+			}
+			return
+		}
+
+		c.JSON(http.StatusOK, h.dto.driver(driver))
+	}
+}
+
+// matcherHealthHandler handles GET /healthz/matcher, answering 503 while the
+// background matcher is stalled
+func (h *Handler) matcherHealthHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		health := h.debugUC.MatcherHealth()
+		status := http.StatusOK
+		if health.Status != models.HealthOK {
+			status = http.StatusServiceUnavailable
+		}
+		c.JSON(status, health)
+	}
+}
+
+// getStateHandler handles GET /debug/state.
+// The ETag is the state version, so unchanged state answers 304. With
+// wait, the request is a long poll: it blocks until the version differs
+// from since, the current version by default, and answers 304 if the wait
+// runs out first.
+func (h *Handler) getStateHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Query("wait") != "" {
+			if !h.waitForState(c) {
+				return
+			}
+		} else if etagMatches(c.GetHeader("If-None-Match"), stateETag(h.debugUC.GetStateVersion())) {
+			c.Status(http.StatusNotModified)
+			return
+		}
+
+		// The snapshot is encoded in memory and sent once the read lock is
+		// released, so a slow client cannot hold up writes. Encoding stops
+		// as soon as it outgrows MaxStateBytes.
+		var buf bytes.Buffer
+		var version uint64
+		err := h.debugUC.ViewState(func(view models.ReadView) error {
+			version = view.Version()
+			return writeSnapshot(&cappedWriter{w: &buf, max: h.cfg.MaxStateBytes}, view)
+		})
+		if errors.Is(err, errStateTooLarge) {
+			h.fail(c, http.StatusServiceUnavailable, err)
+			return
+		}
+		if err != nil {
+			h.fail(c, http.StatusInternalServerError, err)
+			return
+		}
+		c.Header("ETag", stateETag(version))
+		c.Data(http.StatusOK, "application/json; charset=utf-8", buf.Bytes())
+	}
+}
+
+// isLongPoll reports whether a state request waits for a change, which
+// exempts it from the request timeout
+func isLongPoll(c *gin.Context) bool {
+	return c.Query("wait") != ""
+}
+
+// waitForState blocks a long-polling state request until the state changes
+// past its since parameter. It writes a 304, or a 400 for invalid
+// parameters, and returns false if the snapshot should not be sent.
+func (h *Handler) waitForState(c *gin.Context) bool {
+	wait, err := time.ParseDuration(c.Query("wait"))
+	if err != nil || wait <= 0 {
+		h.fail(c, http.StatusBadRequest, errInvalidWait)
+		return false
+	}
+
+	since := h.debugUC.GetStateVersion()
+	if value := c.Query("since"); value != "" {
+		since, err = strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			h.fail(c, http.StatusBadRequest, errInvalidSince)
+			return false
+		}
+	}
+
+	// The server's write timeout runs from the end of the request headers,
+	// so give the response as long again after the wait
+	if h.cfg.WriteTimeout > 0 {
+		deadline := time.Now().Add(h.debugUC.StateWait(wait) + h.cfg.WriteTimeout)
+		if err := http.NewResponseController(c.Writer).SetWriteDeadline(deadline); err != nil {
+			log.Printf("Extending write deadline for long poll failed: %v", err)
+		}
+	}
+
+	version, changed := h.debugUC.WaitForStateVersion(c.Request.Context(), since, wait)
+	if !changed {
+		c.Header("ETag", stateETag(version))
+		c.Status(http.StatusNotModified)
+		return false
+	}
+	return true
+}
+
+// stateETag formats a state version as a strong ETag
+func stateETag(version uint64) string {
+	return `"` + strconv.FormatUint(version, 10) + `"`
+}
+
+// etagMatches reports whether an If-None-Match header matches etag
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// getSummaryHandler handles GET /debug/summary
+func (h *Handler) getSummaryHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		realOnly, ok := h.parseBoolQuery(c, "real_only", errInvalidRealOnly)
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusOK, h.debugUC.GetSummary(realOnly))
+	}
+}
+
+// getMatcherStatusHandler handles GET /debug/matcher
+func (h *Handler) getMatcherStatusHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, h.debugUC.GetMatcherStatus())
+	}
+}
+
+// requireDebugToken rejects requests without the configured debug bearer
+// token. It lets everything through when no token is configured.
+func (h *Handler) requireDebugToken() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if h.cfg.DebugToken == "" {
+			return
+		}
+
+		token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(h.cfg.DebugToken)) != 1 {
+			h.fail(c, http.StatusUnauthorized, errInvalidDebugToken)
+			c.Abort()
+		}
+	}
+}
+
+// resetStateHandler handles POST /debug/reset
+func (h *Handler) resetStateHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		result, err := h.debugUC.ResetState(c.Request.Context())
+		if err != nil {
+			h.fail(c, http.StatusServiceUnavailable, err)
+			return
+		}
+
+		log.Printf("State reset: %d drivers and %d orders cleared", result.DriversCleared, result.OrdersCleared)
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// purgeSimulatedHandler handles POST /debug/purge-simulated
+func (h *Handler) purgeSimulatedHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		result, err := h.debugUC.PurgeSimulated(c.Request.Context())
+		if err != nil {
+			h.fail(c, http.StatusServiceUnavailable, err)
+			return
+		}
+
+		log.Printf("Simulated state purged: %d drivers and %d orders removed", result.DriversCleared, result.OrdersCleared)
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// restoreStateHandler handles POST /debug/restore
+func (h *Handler) restoreStateHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var snapshot models.StateSnapshot
+		if !h.bindJSON(c, &snapshot) {
+			return
+		}
+
+		result, err := h.debugUC.RestoreState(c.Request.Context(), snapshot)
+		if err != nil {
+			if err == errs.ErrCapacityExceeded {
+				h.fail(c, http.StatusServiceUnavailable, err)
+			} else {
+				h.badRequest(c, err)
+			}
+			return
+		}
+
+		log.Printf("State restored: %d drivers and %d orders loaded", result.DriversRestored, result.OrdersRestored)
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// runMatcherHandler handles POST /debug/match
+func (h *Handler) runMatcherHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		result, err := h.debugUC.RunMatcher(c.Request.Context())
+		if err != nil {
+			h.fail(c, http.StatusServiceUnavailable, err)
+			return
+		}
+
+		log.Printf("Matcher run on demand: %d orders assigned", result.Assigned)
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// getMovementHandler handles GET /debug/simulate/movement
+func (h *Handler) getMovementHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, h.debugUC.MovementStatus())
+	}
+}
+
+// startMovementHandler handles POST /debug/simulate/movement. The body is
+// optional.
+func (h *Handler) startMovementHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req models.SimulateMovementRequest
+		if c.Request.ContentLength != 0 && !h.bindJSON(c, &req) {
+			return
+		}
+
+		status, err := h.debugUC.StartMovement(c.Request.Context(), req.SpeedKmh)
+		if err != nil {
+			h.badRequest(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, status)
+	}
+}
+
+// stopMovementHandler handles DELETE /debug/simulate/movement
+func (h *Handler) stopMovementHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, h.debugUC.StopMovement())
+	}
+}
+
+// seedStateHandler handles POST /debug/seed
+func (h *Handler) seedStateHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var seed models.SeedRequest
+		if !h.bindJSON(c, &seed) {
+			return
+		}
+
+		result, err := h.debugUC.SeedState(c.Request.Context(), seed)
+		if err != nil {
+			if err == errs.ErrCapacityExceeded {
+				h.fail(c, http.StatusServiceUnavailable, err)
+			} else {
+				h.badRequest(c, err)
+			}
+			return
+		}
+
+		log.Printf("State seeded: %d drivers and %d orders added", result.DriversSeeded, result.OrdersSeeded)
+		c.JSON(http.StatusCreated, result)
 	}
 }
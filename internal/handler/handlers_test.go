@@ -0,0 +1,219 @@
+package handler
+
+import (
+	"delivery-state-manager/internal/models"
+	"delivery-state-manager/internal/repository"
+	"delivery-state-manager/internal/service"
+	"delivery-state-manager/internal/usecase"
+	"delivery-state-manager/pkg/clock"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// stackConfig holds the settings of every layer a testStack wires up
+type stackConfig struct {
+	clock   clock.Clock
+	store   repository.Config
+	matcher service.MatcherConfig
+	driver  usecase.DriverConfig
+	order   usecase.OrderConfig
+	debug   usecase.DebugConfig
+	handler Config
+}
+
+// testStack is a Handler wired to a fresh in-memory store the way main
+// wires it, with main's defaults unless a test changes them
+type testStack struct {
+	t       *testing.T
+	repo    repository.Store
+	matcher *service.Matcher
+	handler *Handler
+	router  *gin.Engine
+}
+
+// newTestStack builds a testStack, letting configure change the defaults
+// first
+func newTestStack(t *testing.T, configure ...func(cfg *stackConfig)) *testStack {
+	t.Helper()
+
+	cfg := stackConfig{
+		clock: clock.New(),
+		store: repository.Config{GeoIndexEnabled: true, LocationHistorySize: 50, DriverCapacity: 1},
+		matcher: service.MatcherConfig{
+			MaxMatchAttempts: 100,
+			Workers:          1,
+			Mode:             service.MatchNearest,
+			Weights:          models.ScoreWeights{Distance: 1},
+			OfferDrivers:     3,
+			OfferTTL:         30 * time.Second,
+		},
+		driver: usecase.DriverConfig{
+			MaxIDLength:        128,
+			MaxNameLength:      200,
+			DuplicateLocations: usecase.DuplicateLocationsOff,
+			MaxBatchIDs:        100,
+		},
+		order: usecase.OrderConfig{
+			MaxNotesLength:     500,
+			MaxIDLength:        128,
+			IdempotencyTTL:     24 * time.Hour,
+			IdempotencyMaxKeys: 10000,
+			DriverSpeedKmh:     30,
+			BaseFare:           2.5,
+			PerKmRate:          1.2,
+			Admission:          usecase.AdmissionConfig{Mode: usecase.AdmissionOff, TripTime: 15 * time.Minute},
+		},
+		debug: usecase.DebugConfig{MatcherStallFactor: 3, DriverSpeedKmh: 30, StateMaxWait: 30 * time.Second},
+		handler: Config{
+			DefaultPageSize:   50,
+			MaxPageSize:       500,
+			GinMode:           gin.TestMode,
+			Naming:            NamingSnake,
+			DistanceUnit:      models.UnitKilometers,
+			ErrorFormat:       ErrorFormatStructured,
+			VersionPrefix:     "/v1",
+			UnversionedRoutes: true,
+			StrictStatus:      true,
+		},
+	}
+	for _, fn := range configure {
+		fn(&cfg)
+	}
+	cfg.store.Clock = cfg.clock
+
+	repo := repository.NewStateManager(cfg.store)
+	audit, err := repository.NewAuditLog(repository.AuditConfig{Size: 100})
+	if err != nil {
+		t.Fatalf("NewAuditLog: %v", err)
+	}
+	metrics := service.NewAssignmentMetrics(cfg.clock)
+	breaker := service.NewCircuitBreaker(cfg.clock, 5, 30*time.Second)
+	matcher := service.NewMatcher(repo, cfg.clock, metrics, breaker, cfg.matcher)
+	sim := service.NewMovementSimulator(repo, cfg.clock, time.Second)
+	t.Cleanup(func() { sim.Stop() })
+
+	h := NewHandler(
+		usecase.NewDriverUseCase(repo, cfg.clock, cfg.driver),
+		usecase.NewOrderUseCase(repo, cfg.clock, metrics, matcher, cfg.order),
+		usecase.NewDebugUseCase(repo, cfg.clock, metrics, breaker, matcher, audit, sim, cfg.debug),
+		cfg.clock,
+		cfg.handler,
+	)
+	return &testStack{t: t, repo: repo, matcher: matcher, handler: h, router: h.SetupRouter()}
+}
+
+// do sends a request with an optional JSON body and returns the response
+func (s *testStack) do(method, path, body string, headers ...string) *httptest.ResponseRecorder {
+	s.t.Helper()
+	var req *http.Request
+	if body == "" {
+		req = httptest.NewRequest(method, path, nil)
+	} else {
+		req = httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	return w
+}
+
+// mustDo is do, failing the test unless the response has status want
+func (s *testStack) mustDo(want int, method, path, body string, headers ...string) *httptest.ResponseRecorder {
+	s.t.Helper()
+	w := s.do(method, path, body, headers...)
+	if w.Code != want {
+		s.t.Fatalf("%s %s: status = %d, want %d; body %s", method, path, w.Code, want, w.Body.String())
+	}
+	return w
+}
+
+// decode unmarshals a response body into v
+func decode(t *testing.T, w *httptest.ResponseRecorder, v any) {
+	t.Helper()
+	if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+		t.Fatalf("decoding %q: %v", w.Body.String(), err)
+	}
+}
+
+// errorCodeOf returns the code of a structured error response
+func errorCodeOf(t *testing.T, w *httptest.ResponseRecorder) string {
+	t.Helper()
+	var body errorEnvelope
+	decode(t, w, &body)
+	return body.Error.Code
+}
+
+// fieldErrorsOf returns the invalid fields of a validation error response
+func fieldErrorsOf(t *testing.T, w *httptest.ResponseRecorder) map[string]string {
+	t.Helper()
+	var body errorEnvelope
+	decode(t, w, &body)
+	return body.Error.Fields
+}
+
+// idsOf decodes a list of drivers or orders and returns their IDs in order
+func idsOf(t *testing.T, w *httptest.ResponseRecorder) string {
+	t.Helper()
+	var drivers []struct {
+		ID string `json:"id"`
+	}
+	decode(t, w, &drivers)
+	ids := make([]string, 0, len(drivers))
+	for _, driver := range drivers {
+		ids = append(ids, driver.ID)
+	}
+	return fmt.Sprint(ids)
+}
+
+// withJSON sets fields on a JSON object body
+func withJSON(body string, fields map[string]any) string {
+	var obj map[string]any
+	json.Unmarshal([]byte(body), &obj)
+	for key, value := range fields {
+		obj[key] = value
+	}
+	b, _ := json.Marshal(obj)
+	return string(b)
+}
+
+// driverJSON is the body of a driver at lat, lon
+func driverJSON(id string, lat, lon float64) string {
+	b, _ := json.Marshal(map[string]any{
+		"id":       id,
+		"name":     "Driver " + id,
+		"location": models.Location{Lat: lat, Lon: lon},
+	})
+	return string(b)
+}
+
+// orderJSON is the body of an order picked up at lat, lon and dropped off
+// a kilometer or so north
+func orderJSON(id string, lat, lon float64) string {
+	b, _ := json.Marshal(map[string]any{
+		"id":       id,
+		"customer": "customer-" + id,
+		"pickup":   models.Location{Lat: lat, Lon: lon},
+		"dropoff":  models.Location{Lat: lat + 0.01, Lon: lon},
+	})
+	return string(b)
+}
+
+// testDriver is an available driver for seeding the store directly
+func testDriver(id string) *models.Driver {
+	return &models.Driver{
+		ID:       id,
+		Name:     "Driver " + id,
+		Status:   models.DriverAvailable,
+		Location: models.Location{Lat: 37.77, Lon: -122.42},
+	}
+}
@@ -0,0 +1,131 @@
+package handler
+
+import (
+	"bytes"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// listCacheMaxEntries caps how many distinct list requests are cached at once
+const listCacheMaxEntries = 256
+
+// listCacheEntry is a serialized list response and the state it reflects
+type listCacheEntry struct {
+	version     uint64
+	expires     time.Time
+	contentType string
+	body        []byte
+}
+
+// listCache keeps serialized list responses keyed by request URI. An entry
+// is served only while it is younger than the TTL and the state version it
+// was built from is still current, so a mutation invalidates every entry
+// the moment it is applied.
+type listCache struct {
+	ttl     time.Duration
+	mu      sync.Mutex
+	entries map[string]listCacheEntry
+}
+
+// newListCache creates a list cache, or returns nil when ttl disables it
+func newListCache(ttl time.Duration) *listCache {
+	if ttl <= 0 {
+		return nil
+	}
+	return &listCache{ttl: ttl, entries: make(map[string]listCacheEntry)}
+}
+
+// get returns the entry for key if it is fresh and built from version
+func (lc *listCache) get(key string, version uint64, now time.Time) (listCacheEntry, bool) {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+
+	entry, ok := lc.entries[key]
+	if !ok {
+		return listCacheEntry{}, false
+	}
+	if entry.version != version || !now.Before(entry.expires) {
+		delete(lc.entries, key)
+		return listCacheEntry{}, false
+	}
+	return entry, true
+}
+
+// put stores entry under key, first dropping entries that are stale or
+// expired. Nothing is stored while the cache is still full.
+func (lc *listCache) put(key string, entry listCacheEntry, now time.Time) {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+
+	if _, ok := lc.entries[key]; !ok && len(lc.entries) >= listCacheMaxEntries {
+		for k, e := range lc.entries {
+			if e.version != entry.version || !now.Before(e.expires) {
+				delete(lc.entries, k)
+			}
+		}
+		if len(lc.entries) >= listCacheMaxEntries {
+			return
+		}
+	}
+	lc.entries[key] = entry
+}
+
+// bodyRecorder copies everything written to the response so it can be cached
+type bodyRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+// Write writes data to the response and the copy
+func (w *bodyRecorder) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+// WriteString writes s to the response and the copy
+func (w *bodyRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// cacheList serves a route's successful responses from the list cache for
+// up to LIST_CACHE_TTL, until the next mutation. The X-Cache header reports
+// whether a response was a HIT or a MISS. With the cache disabled it does
+// nothing.
+func (h *Handler) cacheList() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if h.lists == nil {
+			c.Next()
+			return
+		}
+
+		// The version is read before the response is built, so an entry can
+		// only ever claim a version at or older than the state it shows
+		key := c.Request.URL.RequestURI()
+		version := h.debugUC.GetStateVersion()
+		if entry, ok := h.lists.get(key, version, h.clk.Now()); ok {
+			c.Header("X-Cache", "HIT")
+			c.Data(http.StatusOK, entry.contentType, entry.body)
+			c.Abort()
+			return
+		}
+
+		c.Header("X-Cache", "MISS")
+		recorder := &bodyRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		c.Next()
+
+		if c.Writer.Status() != http.StatusOK {
+			return
+		}
+		h.lists.put(key, listCacheEntry{
+			version:     version,
+			expires:     h.clk.Now().Add(h.lists.ttl),
+			contentType: c.Writer.Header().Get("Content-Type"),
+			body:        recorder.body.Bytes(),
+		}, h.clk.Now())
+	}
+}
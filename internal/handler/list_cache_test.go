@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"delivery-state-manager/pkg/clock"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestListCacheServesUntilMutationOrTTL(t *testing.T) {
+	clk := clock.NewFake(time.Unix(1700000000, 0))
+	s := newTestStack(t, func(cfg *stackConfig) {
+		cfg.clock = clk
+		cfg.handler.ListCacheTTL = 5 * time.Second
+	})
+	s.mustDo(http.StatusOK, http.MethodPost, "/drivers", driverJSON("d1", 37.77, -122.42))
+	list := func(path, cache, ids string) {
+		t.Helper()
+		w := s.mustDo(http.StatusOK, http.MethodGet, path, "")
+		if got := w.Header().Get("X-Cache"); got != cache {
+			t.Errorf("GET %s: X-Cache = %s, want %s", path, got, cache)
+		}
+		if got := idsOf(t, w); got != ids {
+			t.Errorf("GET %s: IDs = %s, want %s", path, got, ids)
+		}
+	}
+
+	list("/drivers", "MISS", "[d1]")
+	list("/drivers", "HIT", "[d1]")
+	// Each query is cached on its own
+	list("/drivers?sort=status", "MISS", "[d1]")
+
+	// A mutation is seen by the very next request
+	s.mustDo(http.StatusOK, http.MethodPost, "/drivers", driverJSON("d2", 37.77, -122.42))
+	list("/drivers", "MISS", "[d1 d2]")
+	list("/drivers", "HIT", "[d1 d2]")
+
+	clk.Advance(5 * time.Second)
+	list("/drivers", "MISS", "[d1 d2]")
+
+	// Order lists are cached too, and invalidated by driver changes alike
+	s.mustDo(http.StatusCreated, http.MethodPost, "/orders", orderJSON("o1", 37.77, -122.42))
+	list("/orders", "MISS", "[o1]")
+	list("/orders", "HIT", "[o1]")
+	s.mustDo(http.StatusOK, http.MethodPatch, "/drivers/d1/status", `{"status":"offline"}`)
+	list("/orders", "MISS", "[o1]")
+}
+
+func TestListCacheDisabled(t *testing.T) {
+	s := newTestStack(t)
+	for range 2 {
+		if cache := s.mustDo(http.StatusOK, http.MethodGet, "/drivers", "").Header().Get("X-Cache"); cache != "" {
+			t.Errorf("X-Cache = %q with the cache disabled, want none", cache)
+		}
+	}
+}
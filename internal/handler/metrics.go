@@ -0,0 +1,30 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// metricsHandler handles GET /metrics, reporting the store's lock wait
+// histograms in the Prometheus text format
+func (h *Handler) metricsHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var b strings.Builder
+		b.WriteString("# HELP repository_lock_wait_seconds Time spent waiting to acquire the repository lock.\n")
+		b.WriteString("# TYPE repository_lock_wait_seconds histogram\n")
+		for _, hist := range h.debugUC.LockWaits() {
+			for _, bucket := range hist.Buckets {
+				le := strconv.FormatFloat(bucket.UpperBound, 'g', -1, 64)
+				fmt.Fprintf(&b, "repository_lock_wait_seconds_bucket{mode=%q,le=%q} %d\n", hist.Mode, le, bucket.Count)
+			}
+			fmt.Fprintf(&b, "repository_lock_wait_seconds_bucket{mode=%q,le=\"+Inf\"} %d\n", hist.Mode, hist.Count)
+			fmt.Fprintf(&b, "repository_lock_wait_seconds_sum{mode=%q} %s\n", hist.Mode, strconv.FormatFloat(hist.SumSeconds, 'g', -1, 64))
+			fmt.Fprintf(&b, "repository_lock_wait_seconds_count{mode=%q} %d\n", hist.Mode, hist.Count)
+		}
+		c.Data(http.StatusOK, "text/plain; version=0.0.4; charset=utf-8", []byte(b.String()))
+	}
+}
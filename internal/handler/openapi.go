@@ -0,0 +1,308 @@
+package handler
+
+import (
+	"delivery-state-manager/internal/models"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// routeDoc describes one route in the OpenAPI document. Request and response
+// hold a value of the body type; their schemas are derived from its fields.
+type routeDoc struct {
+	summary  string
+	query    []string
+	request  any
+	response any
+	// status is the success status, 200 when unset
+	status int
+}
+
+// routeDocs documents the registered routes, keyed by "METHOD /path".
+// Routes without an entry are still listed, just without schemas.
+var routeDocs = map[string]routeDoc{
+	"GET /health":          {summary: "Health check", response: map[string]string{}},
+	"GET /healthz/matcher": {summary: "Check the background matcher is still ticking", response: models.MatcherHealth{}},
+	"GET /metrics":         {summary: "Repository lock wait histograms in the Prometheus text format"},
+
+	"POST /drivers":                   {summary: "Create or update a driver", request: models.Driver{}, response: models.Driver{}},
+	"GET /drivers":                    {summary: "List drivers, cursor-paginated when after or limit is given", query: []string{"sort", "after", "limit"}, response: []models.Driver{}},
+	"GET /drivers/nearby":             {summary: "List drivers within a radius", query: []string{"lat", "lon", "radius_km", "status"}, response: []models.Driver{}},
+	"GET /drivers/available":          {summary: "List available drivers, optionally within a radius", query: []string{"lat", "lon", "radius_km"}, response: []models.Driver{}},
+	"POST /drivers/batch":             {summary: "Fetch several drivers by ID, reporting missing ones", query: []string{"include_deleted"}, request: models.DriverBatchRequest{}, response: []models.DriverLookup{}},
+	"GET /drivers/:id":                {summary: "Get a driver", query: []string{"include_deleted"}, response: models.Driver{}},
+	"HEAD /drivers/:id":               {summary: "Check that a driver exists", query: []string{"include_deleted"}},
+	"DELETE /drivers/:id":             {summary: "Soft-delete a driver", response: models.Driver{}},
+	"GET /drivers/:id/stats":          {summary: "Get a driver's delivery stats", response: models.DriverStats{}},
+	"GET /drivers/:id/track":          {summary: "Get a driver's recent locations", response: models.DriverTrack{}},
+	"PATCH /drivers/:id":              {summary: "Update some of a driver's fields", request: patchDriverRequest{}, response: models.Driver{}},
+	"PATCH /drivers/:id/status":       {summary: "Update a driver's status", request: driverStatusRequest{}, response: models.Driver{}},
+	"POST /drivers/:id/go-available":  {summary: "Mark a driver available", response: models.Driver{}},
+	"POST /drivers/:id/go-offline":    {summary: "Take a driver offline", response: models.Driver{}},
+	"POST /orders":                    {summary: "Create an order", request: models.Order{}, response: models.Order{}, status: http.StatusCreated},
+	"GET /orders":                     {summary: "List orders, paginated when limit or offset is given", query: []string{"sort", "tag", "limit", "offset"}, response: []models.Order{}},
+	"GET /orders/unmatchable":         {summary: "List orders the matcher gave up on", response: []models.Order{}},
+	"GET /orders/within":              {summary: "List orders whose pickup is inside a bounding box", query: []string{"min_lat", "min_lon", "max_lat", "max_lon", "status"}, response: []models.Order{}},
+	"GET /orders/:id":                 {summary: "Get an order", response: models.Order{}},
+	"HEAD /orders/:id":                {summary: "Check that an order exists"},
+	"PATCH /orders/:id":               {summary: "Change an order's pickup, dropoff or notes before pickup", request: patchOrderRequest{}, response: models.Order{}},
+	"PATCH /orders/:id/status":        {summary: "Update an order's status", request: orderStatusRequest{}, response: models.Order{}},
+	"GET /orders/:id/eta":             {summary: "Estimate the time remaining for an order", response: models.ETA{}},
+	"GET /orders/:id/driver":          {summary: "Get the driver assigned to an order", response: models.Driver{}},
+	"POST /orders/:id/requeue":        {summary: "Return an unmatchable order to pending", response: models.Order{}},
+	"POST /orders/:id/assign":         {summary: "Assign an order to a specific driver", request: assignOrderRequest{}, response: models.Order{}},
+	"POST /orders/:id/auto-assign":    {summary: "Assign an order to the nearest eligible driver now", response: models.Driver{}},
+	"POST /orders/:id/offer":          {summary: "Offer an order to the best-ranked drivers", response: models.Order{}},
+	"POST /orders/:id/accept":         {summary: "Accept an offered order as one of its drivers", request: assignOrderRequest{}, response: models.Order{}},
+	"POST /bundles":                   {summary: "Group pending orders so one driver delivers them on one trip", request: models.BundleRequest{}, response: models.Bundle{}, status: http.StatusCreated},
+	"POST /orders/:id/handoff":        {summary: "Hand a picked-up order over to another driver", request: handoffOrderRequest{}, response: models.Order{}},
+	"GET /debug/state":                {summary: "Get a snapshot of the full state, long-polling for a change when wait is given", query: []string{"wait", "since"}, response: models.StateSnapshot{}},
+	"GET /debug/summary":              {summary: "Get aggregate counts and metrics", query: []string{"real_only"}, response: models.DebugSummary{}},
+	"GET /debug/matcher":              {summary: "Get the matcher's configuration and last pass", response: models.MatcherStatus{}},
+	"POST /debug/reset":               {summary: "Clear all drivers and orders", response: models.ResetResult{}},
+	"POST /debug/purge-simulated":     {summary: "Remove simulated drivers and orders", response: models.ResetResult{}},
+	"POST /debug/restore":             {summary: "Replace the state with a snapshot", request: models.StateSnapshot{}, response: models.RestoreResult{}},
+	"GET /debug/goroutines":           {summary: "Dump the stack of every goroutine as text"},
+	"GET /debug/pprof/":               {summary: "List the available runtime profiles"},
+	"GET /debug/pprof/profile":        {summary: "Capture a CPU profile", query: []string{"seconds"}},
+	"GET /debug/pprof/trace":          {summary: "Capture an execution trace", query: []string{"seconds"}},
+	"GET /debug/pprof/:name":          {summary: "Get a named runtime profile such as heap, goroutine, mutex or block", query: []string{"debug"}},
+	"GET /debug/audit":                {summary: "List the most recent state-changing requests", response: models.AuditLog{}},
+	"POST /debug/match":               {summary: "Run one matcher pass", response: models.MatchResult{}},
+	"GET /debug/simulate/movement":    {summary: "Report whether simulated drivers are being moved", response: models.MovementSimulation{}},
+	"POST /debug/simulate/movement":   {summary: "Start moving simulated drivers along their orders' routes", request: models.SimulateMovementRequest{}, response: models.MovementSimulation{}},
+	"DELETE /debug/simulate/movement": {summary: "Stop moving simulated drivers", response: models.MovementSimulation{}},
+	"POST /debug/seed":                {summary: "Add drivers and orders with arbitrary statuses", request: models.SeedRequest{}, response: models.SeedResult{}, status: http.StatusCreated},
+	"GET /openapi.json":               {summary: "Get this OpenAPI document", response: map[string]any{}},
+}
+
+// enumValues lists the allowed values of string types used in the API
+var enumValues = map[reflect.Type][]string{
+	reflect.TypeOf(models.DriverStatus("")): {
+		string(models.DriverAvailable), string(models.DriverBusy), string(models.DriverOffline),
+	},
+	reflect.TypeOf(models.OrderStatus("")): {
+		string(models.OrderPending), string(models.OrderAssigned), string(models.OrderPickedUp),
+		string(models.OrderDelivered), string(models.OrderCanceled), string(models.OrderUnmatchable),
+		string(models.OrderOffered),
+	},
+}
+
+// registerOpenAPI registers GET /openapi.json. The document is built once
+// from the routes on r, so it must be called after all other routes are added.
+func registerOpenAPI(r *gin.Engine, versionPrefix, errorFormat string) {
+	var spec map[string]any
+	r.GET("/openapi.json", func(c *gin.Context) {
+		c.JSON(http.StatusOK, spec)
+	})
+	spec = buildOpenAPI(r.Routes(), versionPrefix, errorFormat)
+}
+
+// errorTypes are the response bodies used for general and validation errors
+type errorTypes struct {
+	general    reflect.Type
+	validation reflect.Type
+}
+
+// errorTypesFor returns the error bodies written in errorFormat
+func errorTypesFor(errorFormat string) errorTypes {
+	if errorFormat == ErrorFormatLegacy {
+		return errorTypes{
+			general:    reflect.TypeOf(errorResponse{}),
+			validation: reflect.TypeOf(validationErrorResponse{}),
+		}
+	}
+	envelope := reflect.TypeOf(errorEnvelope{})
+	return errorTypes{general: envelope, validation: envelope}
+}
+
+// buildOpenAPI describes routes as an OpenAPI 3 document. Routes under
+// versionPrefix share the docs of their unprefixed path.
+func buildOpenAPI(routes gin.RoutesInfo, versionPrefix, errorFormat string) map[string]any {
+	schemas := newSchemaSet()
+	errTypes := errorTypesFor(errorFormat)
+
+	paths := make(map[string]any)
+	for _, route := range routes {
+		path, params := openAPIPath(route.Path)
+		item, ok := paths[path].(map[string]any)
+		if !ok {
+			item = make(map[string]any)
+			paths[path] = item
+		}
+		doc := routeDocs[route.Method+" "+strings.TrimPrefix(route.Path, versionPrefix)]
+		item[strings.ToLower(route.Method)] = operation(doc, params, schemas, errTypes)
+	}
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":   "Delivery State Manager",
+			"version": "1.0.0",
+			"description": "Keys are shown in snake_case. With API_NAMING=camel, driver and order " +
+				"responses use camelCase keys instead.",
+		},
+		"paths":      paths,
+		"components": map[string]any{"schemas": schemas.components},
+	}
+}
+
+// openAPIPath converts a gin path such as /orders/:id to /orders/{id},
+// returning the names of its path parameters
+func openAPIPath(ginPath string) (string, []string) {
+	var params []string
+	segments := strings.Split(ginPath, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			name := segment[1:]
+			params = append(params, name)
+			segments[i] = "{" + name + "}"
+		}
+	}
+	return strings.Join(segments, "/"), params
+}
+
+// operation describes a single route
+func operation(doc routeDoc, pathParams []string, schemas *schemaSet, errTypes errorTypes) map[string]any {
+	params := make([]any, 0, len(pathParams)+len(doc.query))
+	for _, name := range pathParams {
+		params = append(params, map[string]any{
+			"name": name, "in": "path", "required": true, "schema": map[string]any{"type": "string"},
+		})
+	}
+	for _, name := range doc.query {
+		params = append(params, map[string]any{
+			"name": name, "in": "query", "schema": map[string]any{"type": "string"},
+		})
+	}
+
+	status := doc.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	success := map[string]any{"description": http.StatusText(status)}
+	if doc.response != nil {
+		success["content"] = jsonContent(schemas.schema(reflect.TypeOf(doc.response)))
+	}
+
+	responses := map[string]any{
+		strconv.Itoa(status): success,
+		"default": map[string]any{
+			"description": "Error",
+			"content":     jsonContent(schemas.ref(errTypes.general)),
+		},
+	}
+
+	op := map[string]any{"summary": doc.summary, "responses": responses}
+	if len(params) > 0 {
+		op["parameters"] = params
+	}
+	if doc.request != nil {
+		op["requestBody"] = map[string]any{
+			"required": true,
+			"content":  jsonContent(schemas.schema(reflect.TypeOf(doc.request))),
+		}
+		responses[strconv.Itoa(http.StatusBadRequest)] = map[string]any{
+			"description": "Invalid request body",
+			"content":     jsonContent(schemas.ref(errTypes.validation)),
+		}
+	}
+	return op
+}
+
+// jsonContent wraps schema as an application/json media type
+func jsonContent(schema map[string]any) map[string]any {
+	return map[string]any{"application/json": map[string]any{"schema": schema}}
+}
+
+// schemaSet derives JSON schemas from Go types, collecting named structs as
+// reusable components
+type schemaSet struct {
+	components map[string]any
+}
+
+// newSchemaSet creates an empty schemaSet
+func newSchemaSet() *schemaSet {
+	return &schemaSet{components: make(map[string]any)}
+}
+
+// schema returns the schema for t, referencing named structs by component
+func (s *schemaSet) schema(t reflect.Type) map[string]any {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if values, ok := enumValues[t]; ok {
+		return map[string]any{"type": "string", "enum": values}
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		if t.Name() != "" {
+			return s.ref(t)
+		}
+		return s.object(t)
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": s.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": s.schema(t.Elem())}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number", "format": "double"}
+	}
+	return map[string]any{}
+}
+
+// ref registers the named struct t as a component and returns a reference to it
+func (s *schemaSet) ref(t reflect.Type) map[string]any {
+	name := componentName(t)
+	if _, exists := s.components[name]; !exists {
+		// Reserve the name first so self-referencing types terminate
+		s.components[name] = nil
+		s.components[name] = s.object(t)
+	}
+	return map[string]any{"$ref": "#/components/schemas/" + name}
+}
+
+// object describes the JSON fields of struct t, flattening embedded structs
+func (s *schemaSet) object(t reflect.Type) map[string]any {
+	properties := make(map[string]any)
+	s.addFields(t, properties)
+	return map[string]any{"type": "object", "properties": properties}
+}
+
+// addFields adds the JSON fields of struct t to properties
+func (s *schemaSet) addFields(t reflect.Type, properties map[string]any) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			s.addFields(field.Type, properties)
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = s.schema(field.Type)
+	}
+}
+
+// componentName names the component for t, capitalizing unexported types
+func componentName(t reflect.Type) string {
+	name := t.Name()
+	return strings.ToUpper(name[:1]) + name[1:]
+}
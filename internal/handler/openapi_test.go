@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// refsIn collects every $ref in a decoded JSON value
+func refsIn(v any, refs map[string]bool) {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			if ref, ok := value.(string); ok && key == "$ref" {
+				refs[ref] = true
+			}
+			refsIn(value, refs)
+		}
+	case []any:
+		for _, value := range v {
+			refsIn(value, refs)
+		}
+	}
+}
+
+func TestOpenAPIListsEveryRoute(t *testing.T) {
+	s := newTestStack(t, func(cfg *stackConfig) {
+		cfg.handler.ResetEnabled = true
+		cfg.handler.RestoreEnabled = true
+		cfg.handler.MatchEnabled = true
+		cfg.handler.SeedEnabled = true
+		cfg.handler.SimulateEnabled = true
+		cfg.handler.MetricsEnabled = true
+	})
+
+	var spec struct {
+		OpenAPI    string                               `json:"openapi"`
+		Paths      map[string]map[string]map[string]any `json:"paths"`
+		Components struct {
+			Schemas map[string]any `json:"schemas"`
+		} `json:"components"`
+	}
+	w := s.mustDo(http.StatusOK, http.MethodGet, "/openapi.json", "")
+	decode(t, w, &spec)
+	if !strings.HasPrefix(spec.OpenAPI, "3.") {
+		t.Errorf("openapi = %q, want a 3.x document", spec.OpenAPI)
+	}
+
+	for _, route := range s.router.Routes() {
+		path, _ := openAPIPath(route.Path)
+		op, ok := spec.Paths[path][strings.ToLower(route.Method)]
+		if !ok {
+			t.Errorf("%s %s is not documented", route.Method, route.Path)
+			continue
+		}
+		if op["summary"] == "" || op["summary"] == nil {
+			t.Errorf("%s %s has no summary", route.Method, route.Path)
+		}
+		if _, ok := op["responses"].(map[string]any); !ok {
+			t.Errorf("%s %s has no responses", route.Method, route.Path)
+		}
+	}
+
+	// Every schema reference resolves to a component
+	refs := make(map[string]bool)
+	var raw map[string]any
+	decode(t, w, &raw)
+	refsIn(raw, refs)
+	for ref := range refs {
+		name, ok := strings.CutPrefix(ref, "#/components/schemas/")
+		if _, defined := spec.Components.Schemas[name]; !ok || !defined {
+			t.Errorf("$ref %s does not resolve", ref)
+		}
+	}
+}
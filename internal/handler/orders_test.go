@@ -0,0 +1,915 @@
+package handler
+
+import (
+	"delivery-state-manager/internal/models"
+	"delivery-state-manager/internal/usecase"
+	"delivery-state-manager/pkg/clock"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestOrderNotesAndContactless(t *testing.T) {
+	s := newTestStack(t)
+	s.mustDo(http.StatusCreated, http.MethodPost, "/orders", withJSON(orderJSON("o1", 37.77, -122.42), map[string]any{
+		"notes":       "Leave at the front desk",
+		"contactless": true,
+	}))
+
+	var order struct {
+		Notes       string `json:"notes"`
+		Contactless bool   `json:"contactless"`
+	}
+	decode(t, s.mustDo(http.StatusOK, http.MethodGet, "/orders/o1", ""), &order)
+	if order.Notes != "Leave at the front desk" || !order.Contactless {
+		t.Errorf("order = %+v, want the notes and contactless flag as created", order)
+	}
+
+	// The audit log keeps the instructions each request gave
+	s.mustDo(http.StatusOK, http.MethodPatch, "/orders/o1", `{"notes":"Ring twice"}`)
+	s.mustDo(http.StatusOK, http.MethodPatch, "/orders/o1", `{"dropoff":{"lat":37.80,"lon":-122.42}}`)
+	var audit models.AuditLog
+	decode(t, s.mustDo(http.StatusOK, http.MethodGet, "/debug/audit", ""), &audit)
+	var got []string
+	for _, event := range audit.Events {
+		got = append(got, fmt.Sprintf("%s %q %v", event.Method, event.Notes, event.Contactless))
+	}
+	if want := `[POST "Leave at the front desk" true PATCH "Ring twice" false PATCH "" false]`; fmt.Sprint(got) != want {
+		t.Errorf("audited instructions = %v, want %s", got, want)
+	}
+}
+
+func TestOrderNotesLimitCountsCharacters(t *testing.T) {
+	s := newTestStack(t, func(cfg *stackConfig) { cfg.order.MaxNotesLength = 5 })
+
+	// Five characters but six bytes
+	s.mustDo(http.StatusCreated, http.MethodPost, "/orders", withJSON(orderJSON("o1", 37.77, -122.42), map[string]any{"notes": "héllo"}))
+	w := s.mustDo(http.StatusBadRequest, http.MethodPost, "/orders", withJSON(orderJSON("o2", 37.77, -122.42), map[string]any{"notes": "héllo!"}))
+	if _, ok := fieldErrorsOf(t, w)["notes"]; !ok {
+		t.Errorf("error does not name the notes field: %s", w.Body)
+	}
+}
+
+func TestCreateOrderIdempotencyKey(t *testing.T) {
+	s := newTestStack(t)
+	body := orderJSON("o1", 37.77, -122.42)
+
+	s.mustDo(http.StatusCreated, http.MethodPost, "/orders", body, "Idempotency-Key", "key-1")
+	var replay struct {
+		ID string `json:"id"`
+	}
+	decode(t, s.mustDo(http.StatusOK, http.MethodPost, "/orders", body, "Idempotency-Key", "key-1"), &replay)
+	if replay.ID != "o1" {
+		t.Errorf("replay returned order %q, want o1", replay.ID)
+	}
+
+	w := s.mustDo(http.StatusConflict, http.MethodPost, "/orders", orderJSON("o2", 37.77, -122.42), "Idempotency-Key", "key-1")
+	if code := errorCodeOf(t, w); code != "IDEMPOTENCY_KEY_CONFLICT" {
+		t.Errorf("code = %s, want IDEMPOTENCY_KEY_CONFLICT", code)
+	}
+	if got := len(s.repo.GetAllOrders()); got != 1 {
+		t.Errorf("%d orders stored, want 1", got)
+	}
+}
+
+func TestHeadOrder(t *testing.T) {
+	s := newTestStack(t)
+	s.mustDo(http.StatusCreated, http.MethodPost, "/orders", orderJSON("o1", 37.77, -122.42))
+
+	for path, want := range map[string]int{
+		"/orders/o1":     http.StatusOK,
+		"/orders/nobody": http.StatusNotFound,
+	} {
+		w := s.mustDo(want, http.MethodHead, path, "")
+		if w.Body.Len() != 0 {
+			t.Errorf("HEAD %s has a body: %s", path, w.Body.String())
+		}
+	}
+}
+
+func TestCreateOrderBeyondCapacity(t *testing.T) {
+	s := newTestStack(t, func(cfg *stackConfig) { cfg.store.MaxOrders = 1 })
+	s.mustDo(http.StatusCreated, http.MethodPost, "/orders", orderJSON("o1", 37.77, -122.42))
+
+	w := s.mustDo(http.StatusServiceUnavailable, http.MethodPost, "/orders", orderJSON("o2", 37.77, -122.42))
+	if code := errorCodeOf(t, w); code != "CAPACITY_EXCEEDED" {
+		t.Errorf("code = %s, want CAPACITY_EXCEEDED", code)
+	}
+}
+
+func TestCancelOrderRequiresOwningCustomer(t *testing.T) {
+	s := newTestStack(t, func(cfg *stackConfig) { cfg.order.RequireCustomerToCancel = true })
+	s.mustDo(http.StatusCreated, http.MethodPost, "/orders", orderJSON("o1", 37.77, -122.42))
+	s.mustDo(http.StatusCreated, http.MethodPost, "/orders", orderJSON("o2", 37.77, -122.42))
+
+	for _, tc := range []struct {
+		body    string
+		headers []string
+	}{
+		{`{"status":"canceled"}`, nil},
+		{`{"status":"canceled","customer":"customer-o2"}`, nil},
+		{`{"status":"canceled"}`, []string{"X-Customer-ID", "customer-o2"}},
+	} {
+		w := s.mustDo(http.StatusForbidden, http.MethodPatch, "/orders/o1/status", tc.body, tc.headers...)
+		if code := errorCodeOf(t, w); code != "NOT_ORDER_OWNER" {
+			t.Errorf("%s %v: code = %s, want NOT_ORDER_OWNER", tc.body, tc.headers, code)
+		}
+	}
+
+	s.mustDo(http.StatusOK, http.MethodPatch, "/orders/o1/status", `{"status":"canceled","customer":"customer-o1"}`)
+	s.mustDo(http.StatusOK, http.MethodPatch, "/orders/o2/status", `{"status":"canceled"}`, "X-Customer-ID", "customer-o2")
+}
+
+func TestCancelOrderOwnershipCheckDisabled(t *testing.T) {
+	s := newTestStack(t)
+	s.mustDo(http.StatusCreated, http.MethodPost, "/orders", orderJSON("o1", 37.77, -122.42))
+	s.mustDo(http.StatusOK, http.MethodPatch, "/orders/o1/status", `{"status":"canceled","customer":"someone-else"}`)
+}
+
+func TestFilterOrdersByTags(t *testing.T) {
+	s := newTestStack(t)
+	for id, tags := range map[string][]string{
+		"o1": {"vip", "fragile"},
+		"o2": {"vip"},
+		"o3": {"fragile"},
+		"o4": nil,
+	} {
+		s.mustDo(http.StatusCreated, http.MethodPost, "/orders", withJSON(orderJSON(id, 37.77, -122.42), map[string]any{"tags": tags}))
+	}
+
+	for query, want := range map[string]string{
+		"":                        "[o1 o2 o3 o4]",
+		"?tag=vip":                "[o1 o2]",
+		"?tag=fragile":            "[o1 o3]",
+		"?tag=vip&tag=fragile":    "[o1]",
+		"?tag=vip&tag=perishable": "[]",
+	} {
+		var orders []struct {
+			ID string `json:"id"`
+		}
+		decode(t, s.mustDo(http.StatusOK, http.MethodGet, "/orders"+query, ""), &orders)
+		ids := make([]string, 0, len(orders))
+		for _, order := range orders {
+			ids = append(ids, order.ID)
+		}
+		if got := fmt.Sprint(ids); got != want {
+			t.Errorf("GET /orders%s = %s, want %s", query, got, want)
+		}
+	}
+}
+
+func TestCreateOrderValidatesTags(t *testing.T) {
+	s := newTestStack(t)
+	tooMany := make([]string, 11)
+	for i := range tooMany {
+		tooMany[i] = fmt.Sprintf("tag%d", i)
+	}
+
+	for _, tc := range []struct {
+		tags  []string
+		field string
+	}{
+		{[]string{"VIP"}, "tags[0]"},
+		{[]string{"vip", "vip"}, "tags[1]"},
+		{[]string{""}, "tags[0]"},
+		{tooMany, "tags"},
+	} {
+		w := s.mustDo(http.StatusBadRequest, http.MethodPost, "/orders", withJSON(orderJSON("o1", 37.77, -122.42), map[string]any{"tags": tc.tags}))
+		if _, ok := fieldErrorsOf(t, w)[tc.field]; !ok {
+			t.Errorf("tags %v: fields = %v, want %s reported", tc.tags, fieldErrorsOf(t, w), tc.field)
+		}
+	}
+
+	var order struct {
+		Tags []string `json:"tags"`
+	}
+	decode(t, s.mustDo(http.StatusCreated, http.MethodPost, "/orders", withJSON(orderJSON("o1", 37.77, -122.42), map[string]any{"tags": []string{"vip", "same_day"}})), &order)
+	if fmt.Sprint(order.Tags) != "[vip same_day]" {
+		t.Errorf("tags = %v, want [vip same_day]", order.Tags)
+	}
+}
+
+func TestManualAssignment(t *testing.T) {
+	s := newTestStack(t)
+	s.mustDo(http.StatusOK, http.MethodPost, "/drivers", driverJSON("d1", 37.77, -122.42))
+	s.mustDo(http.StatusOK, http.MethodPost, "/drivers", driverJSON("d2", 37.77, -122.42))
+	s.mustDo(http.StatusOK, http.MethodPost, "/drivers", driverJSON("d3", 37.77, -122.42))
+	s.mustDo(http.StatusOK, http.MethodPatch, "/drivers/d3/status", `{"status":"offline"}`)
+	for _, id := range []string{"o1", "o2"} {
+		s.mustDo(http.StatusCreated, http.MethodPost, "/orders", orderJSON(id, 37.77, -122.42))
+	}
+
+	var order struct {
+		Status   string `json:"status"`
+		DriverID string `json:"driver_id"`
+	}
+	decode(t, s.mustDo(http.StatusOK, http.MethodPost, "/orders/o1/assign", `{"driver_id":"d1"}`), &order)
+	if order.Status != "assigned" || order.DriverID != "d1" {
+		t.Errorf("order = %+v, want assigned to d1", order)
+	}
+
+	for _, tc := range []struct {
+		path, body string
+		status     int
+		code       string
+	}{
+		{"/orders/nobody/assign", `{"driver_id":"d2"}`, http.StatusNotFound, "ORDER_NOT_FOUND"},
+		{"/orders/o2/assign", `{"driver_id":"nobody"}`, http.StatusNotFound, "DRIVER_NOT_FOUND"},
+		{"/orders/o1/assign", `{"driver_id":"d2"}`, http.StatusConflict, "ORDER_ALREADY_ASSIGNED"},
+		{"/orders/o2/assign", `{"driver_id":"d1"}`, http.StatusConflict, "DRIVER_NOT_AVAILABLE"},
+		{"/orders/o2/assign", `{"driver_id":"d3"}`, http.StatusConflict, "DRIVER_NOT_AVAILABLE"},
+	} {
+		w := s.mustDo(tc.status, http.MethodPost, tc.path, tc.body)
+		if code := errorCodeOf(t, w); code != tc.code {
+			t.Errorf("POST %s %s: code = %s, want %s", tc.path, tc.body, code, tc.code)
+		}
+	}
+}
+
+func TestCreateOrderBeyondCustomerLimit(t *testing.T) {
+	s := newTestStack(t, func(cfg *stackConfig) { cfg.store.MaxOrdersPerCustomer = 1 })
+	s.mustDo(http.StatusCreated, http.MethodPost, "/orders", withJSON(orderJSON("o1", 37.77, -122.42), map[string]any{"customer": "alice"}))
+
+	w := s.mustDo(http.StatusTooManyRequests, http.MethodPost, "/orders", withJSON(orderJSON("o2", 37.77, -122.42), map[string]any{"customer": "alice"}))
+	if code := errorCodeOf(t, w); code != "CUSTOMER_ORDER_LIMIT" {
+		t.Errorf("code = %s, want CUSTOMER_ORDER_LIMIT", code)
+	}
+}
+
+func TestPatchOrderDropoffBeforePickup(t *testing.T) {
+	clk := clock.NewFake(time.Unix(1700000000, 0))
+	s := newTestStack(t, func(cfg *stackConfig) { cfg.clock = clk })
+	s.mustDo(http.StatusOK, http.MethodPost, "/drivers", driverJSON("d1", 37.77, -122.42))
+	s.mustDo(http.StatusCreated, http.MethodPost, "/orders", orderJSON("o1", 37.77, -122.42))
+	s.repo.AssignOrderToDriver("o1", "d1")
+
+	type orderBody struct {
+		Dropoff        models.Location              `json:"dropoff"`
+		DropoffHistory []models.TimestampedLocation `json:"dropoff_history"`
+		Notes          string                       `json:"notes"`
+		Price          float64                      `json:"price"`
+	}
+	var before, after orderBody
+	decode(t, s.mustDo(http.StatusOK, http.MethodGet, "/orders/o1", ""), &before)
+	clk.Advance(time.Minute)
+	decode(t, s.mustDo(http.StatusOK, http.MethodPatch, "/orders/o1", `{"dropoff":{"lat":37.80,"lon":-122.42},"notes":"Ring twice"}`), &after)
+	if after.Dropoff != (models.Location{Lat: 37.80, Lon: -122.42}) || after.Notes != "Ring twice" || after.Price <= before.Price {
+		t.Errorf("patched order = %+v, want the new dropoff and notes at a higher price than %v", after, before.Price)
+	}
+	want := []models.TimestampedLocation{{Location: before.Dropoff, Timestamp: clk.Now().Unix()}}
+	if !reflect.DeepEqual(after.DropoffHistory, want) {
+		t.Errorf("dropoff history = %+v, want the replaced dropoff %+v", after.DropoffHistory, want)
+	}
+	// Notes alone, or the same dropoff again, leave the history as it is
+	decode(t, s.mustDo(http.StatusOK, http.MethodPatch, "/orders/o1", `{"dropoff":{"lat":37.80,"lon":-122.42},"notes":"Knock"}`), &after)
+	if !reflect.DeepEqual(after.DropoffHistory, want) {
+		t.Errorf("dropoff history after an unchanged dropoff = %+v, want %+v", after.DropoffHistory, want)
+	}
+
+	var audit models.AuditLog
+	decode(t, s.mustDo(http.StatusOK, http.MethodGet, "/debug/audit", ""), &audit)
+	if n := len(audit.Events); n == 0 || audit.Events[n-1].Route != "/orders/:id" || audit.Events[n-1].Method != http.MethodPatch ||
+		audit.Events[n-1].Timestamp != clk.Now().Unix() {
+		t.Errorf("audit log = %+v, want the dropoff change last, stamped by the store clock", audit.Events)
+	}
+
+	s.repo.UpdateOrderStatus("o1", "picked_up")
+	w := s.mustDo(http.StatusConflict, http.MethodPatch, "/orders/o1", `{"dropoff":{"lat":37.81,"lon":-122.42}}`)
+	if code := errorCodeOf(t, w); code != "INVALID_TRANSITION" {
+		t.Errorf("code = %s, want INVALID_TRANSITION", code)
+	}
+	decode(t, s.mustDo(http.StatusOK, http.MethodGet, "/orders/o1", ""), &before)
+	if before.Dropoff != after.Dropoff {
+		t.Errorf("rejected change moved the dropoff to %v", before.Dropoff)
+	}
+}
+
+func TestGetOrderDriver(t *testing.T) {
+	s := newTestStack(t)
+	s.mustDo(http.StatusOK, http.MethodPost, "/drivers", driverJSON("d1", 37.77, -122.42))
+	s.mustDo(http.StatusCreated, http.MethodPost, "/orders", orderJSON("o1", 37.77, -122.42))
+	s.mustDo(http.StatusCreated, http.MethodPost, "/orders", orderJSON("o2", 37.77, -122.42))
+	s.repo.AssignOrderToDriver("o1", "d1")
+
+	var driver struct {
+		ID     string `json:"id"`
+		Status string `json:"status"`
+	}
+	decode(t, s.mustDo(http.StatusOK, http.MethodGet, "/orders/o1/driver", ""), &driver)
+	if driver.ID != "d1" || driver.Status != "busy" {
+		t.Errorf("driver = %+v, want d1 busy", driver)
+	}
+
+	if code := errorCodeOf(t, s.mustDo(http.StatusConflict, http.MethodGet, "/orders/o2/driver", "")); code != "ORDER_NOT_ASSIGNED" {
+		t.Errorf("unassigned order: code = %s, want ORDER_NOT_ASSIGNED", code)
+	}
+	if code := errorCodeOf(t, s.mustDo(http.StatusNotFound, http.MethodGet, "/orders/nobody/driver", "")); code != "ORDER_NOT_FOUND" {
+		t.Errorf("unknown order: code = %s, want ORDER_NOT_FOUND", code)
+	}
+}
+
+func TestAutoAssignOrder(t *testing.T) {
+	s := newTestStack(t, func(cfg *stackConfig) { cfg.matcher.MaxDistanceKm = 5 })
+	s.mustDo(http.StatusOK, http.MethodPost, "/drivers", driverJSON("far", 37.87, -122.42))
+	s.mustDo(http.StatusOK, http.MethodPost, "/drivers", driverJSON("near", 37.78, -122.42))
+	s.mustDo(http.StatusOK, http.MethodPost, "/drivers", driverJSON("nearest", 37.77, -122.42))
+	s.mustDo(http.StatusCreated, http.MethodPost, "/orders", orderJSON("o1", 37.77, -122.42))
+
+	var driver struct {
+		ID string `json:"id"`
+	}
+	decode(t, s.mustDo(http.StatusOK, http.MethodPost, "/orders/o1/auto-assign", ""), &driver)
+	if order, _ := s.repo.GetOrder("o1"); driver.ID != "nearest" || order.DriverID != "nearest" {
+		t.Errorf("auto-assign chose %q and the order holds %q, want the nearest driver", driver.ID, order.DriverID)
+	}
+	if code := errorCodeOf(t, s.mustDo(http.StatusConflict, http.MethodPost, "/orders/o1/auto-assign", "")); code != "ORDER_ALREADY_ASSIGNED" {
+		t.Errorf("assigned order: code = %s, want ORDER_ALREADY_ASSIGNED", code)
+	}
+
+	// Only the driver beyond the radius is left once near is busy
+	s.mustDo(http.StatusCreated, http.MethodPost, "/orders", orderJSON("o2", 37.77, -122.42))
+	s.mustDo(http.StatusCreated, http.MethodPost, "/orders", orderJSON("o3", 37.77, -122.42))
+	s.mustDo(http.StatusOK, http.MethodPost, "/orders/o2/auto-assign", "")
+	if code := errorCodeOf(t, s.mustDo(http.StatusConflict, http.MethodPost, "/orders/o3/auto-assign", "")); code != "NO_ELIGIBLE_DRIVER" {
+		t.Errorf("no driver in range: code = %s, want NO_ELIGIBLE_DRIVER", code)
+	}
+	if order, _ := s.repo.GetOrder("o3"); order.Status != models.OrderPending {
+		t.Errorf("order without an eligible driver is %s, want pending", order.Status)
+	}
+	if code := errorCodeOf(t, s.mustDo(http.StatusNotFound, http.MethodPost, "/orders/nobody/auto-assign", "")); code != "ORDER_NOT_FOUND" {
+		t.Errorf("unknown order: code = %s, want ORDER_NOT_FOUND", code)
+	}
+}
+
+func TestCreateOrderGeneratesMissingID(t *testing.T) {
+	s := newTestStack(t, func(cfg *stackConfig) { cfg.order.GenerateIDs = true })
+	noID := withJSON(orderJSON("", 37.77, -122.42), map[string]any{"customer": "alice"})
+
+	var first, second struct {
+		ID string `json:"id"`
+	}
+	decode(t, s.mustDo(http.StatusCreated, http.MethodPost, "/orders", noID), &first)
+	decode(t, s.mustDo(http.StatusCreated, http.MethodPost, "/orders", noID), &second)
+	if first.ID == "" || first.ID == second.ID {
+		t.Errorf("generated IDs %q and %q, want two distinct IDs", first.ID, second.ID)
+	}
+	s.mustDo(http.StatusOK, http.MethodGet, "/orders/"+first.ID, "")
+
+	// Client-supplied IDs still work and still conflict
+	s.mustDo(http.StatusCreated, http.MethodPost, "/orders", orderJSON("o1", 37.77, -122.42))
+	if code := errorCodeOf(t, s.mustDo(http.StatusConflict, http.MethodPost, "/orders", orderJSON("o1", 37.77, -122.42))); code != "ORDER_EXISTS" {
+		t.Errorf("duplicate ID: code = %s, want ORDER_EXISTS", code)
+	}
+}
+
+func TestCreateOrderRequiresIDUnlessGenerated(t *testing.T) {
+	s := newTestStack(t)
+	w := s.mustDo(http.StatusBadRequest, http.MethodPost, "/orders", orderJSON("", 37.77, -122.42))
+	if fields := fieldErrorsOf(t, w); fields["id"] == "" {
+		t.Errorf("fields = %v, want id required", fields)
+	}
+}
+
+func TestOrdersWithinBoundingBox(t *testing.T) {
+	s := newTestStack(t)
+	for _, o := range []struct {
+		id       string
+		lat, lon float64
+	}{
+		{"inside", 37.77, -122.42},
+		{"on-edge", 37.80, -122.40},
+		{"north", 37.90, -122.42},
+		{"east", 37.77, -122.30},
+		{"fiji", -17.7, 179.9},
+	} {
+		s.mustDo(http.StatusCreated, http.MethodPost, "/orders", orderJSON(o.id, o.lat, o.lon))
+	}
+	s.mustDo(http.StatusOK, http.MethodPost, "/drivers", driverJSON("d1", 37.77, -122.42))
+	s.repo.AssignOrderToDriver("inside", "d1")
+
+	for _, tc := range []struct {
+		query, want string
+	}{
+		{"min_lat=37.70&min_lon=-122.50&max_lat=37.80&max_lon=-122.40", "[inside on-edge]"},
+		{"min_lat=37.70&min_lon=-122.50&max_lat=37.80&max_lon=-122.40&status=pending", "[on-edge]"},
+		// A box from 179°E to 179°W crosses the antimeridian
+		{"min_lat=-20&min_lon=179&max_lat=-15&max_lon=-179", "[fiji]"},
+		{"min_lat=0&min_lon=0&max_lat=1&max_lon=1", "[]"},
+	} {
+		if got := idsOf(t, s.mustDo(http.StatusOK, http.MethodGet, "/orders/within?"+tc.query, "")); got != tc.want {
+			t.Errorf("%s: orders = %s, want %s", tc.query, got, tc.want)
+		}
+	}
+
+	for _, tc := range []struct {
+		query, code string
+	}{
+		{"min_lat=37.70&min_lon=-122.50&max_lat=37.80", "INVALID_BOUNDS"},
+		{"min_lat=north&min_lon=-122.50&max_lat=37.80&max_lon=-122.40", "INVALID_BOUNDS"},
+		{"min_lat=37.80&min_lon=-122.50&max_lat=37.70&max_lon=-122.40", "VALIDATION_FAILED"},
+		{"min_lat=37.70&min_lon=-200&max_lat=37.80&max_lon=-122.40", "VALIDATION_FAILED"},
+	} {
+		if code := errorCodeOf(t, s.mustDo(http.StatusBadRequest, http.MethodGet, "/orders/within?"+tc.query, "")); code != tc.code {
+			t.Errorf("%s: code = %s, want %s", tc.query, code, tc.code)
+		}
+	}
+}
+
+// offeredOrder is the offer state of an order response
+type offeredOrder struct {
+	Status    string   `json:"status"`
+	DriverID  string   `json:"driver_id"`
+	OfferedTo []string `json:"offered_to"`
+}
+
+// newOfferStack is a testStack offering orders two drivers at a time, with
+// drivers d1 to d3 at increasing distance from the pickup of order o1
+func newOfferStack(t *testing.T, clk clock.Clock) *testStack {
+	t.Helper()
+	s := newTestStack(t, func(cfg *stackConfig) {
+		cfg.clock = clk
+		cfg.matcher.OfferDrivers = 2
+	})
+	for i, id := range []string{"d1", "d2", "d3"} {
+		s.mustDo(http.StatusOK, http.MethodPost, "/drivers", driverJSON(id, 37.77+float64(i)*0.01, -122.42))
+	}
+	s.mustDo(http.StatusCreated, http.MethodPost, "/orders", orderJSON("o1", 37.77, -122.42))
+	return s
+}
+
+func TestOfferAcceptedByFirstDriver(t *testing.T) {
+	s := newOfferStack(t, clock.New())
+
+	var order offeredOrder
+	decode(t, s.mustDo(http.StatusOK, http.MethodPost, "/orders/o1/offer", ""), &order)
+	if order.Status != "offered" || fmt.Sprint(order.OfferedTo) != "[d1 d2]" {
+		t.Fatalf("offered order = %+v, want offered to d1 and d2", order)
+	}
+	if code := errorCodeOf(t, s.mustDo(http.StatusConflict, http.MethodPost, "/orders/o1/accept", `{"driver_id":"d3"}`)); code != "OFFER_NOT_OPEN" {
+		t.Errorf("accept by a driver not offered: code = %s, want OFFER_NOT_OPEN", code)
+	}
+
+	decode(t, s.mustDo(http.StatusOK, http.MethodPost, "/orders/o1/accept", `{"driver_id":"d2"}`), &order)
+	if order.Status != "assigned" || order.DriverID != "d2" {
+		t.Errorf("accepted order = %+v, want assigned to d2", order)
+	}
+	if code := errorCodeOf(t, s.mustDo(http.StatusConflict, http.MethodPost, "/orders/o1/accept", `{"driver_id":"d1"}`)); code != "OFFER_NOT_OPEN" {
+		t.Errorf("second accept: code = %s, want OFFER_NOT_OPEN", code)
+	}
+	if code := errorCodeOf(t, s.mustDo(http.StatusConflict, http.MethodPost, "/orders/o1/offer", "")); code != "ORDER_ALREADY_ASSIGNED" {
+		t.Errorf("offering an assigned order: code = %s, want ORDER_ALREADY_ASSIGNED", code)
+	}
+}
+
+func TestLapsedOfferMovesDownTheRanking(t *testing.T) {
+	clk := clock.NewFake(time.Unix(1700000000, 0))
+	s := newOfferStack(t, clk)
+	s.mustDo(http.StatusOK, http.MethodPost, "/orders/o1/offer", "")
+
+	// Sweeping before the offer lapses changes nothing
+	clk.Advance(29 * time.Second)
+	s.matcher.SweepOffers()
+	order, _ := s.repo.GetOrder("o1")
+	if fmt.Sprint(order.OfferedTo) != "[d1 d2]" {
+		t.Fatalf("offer before it lapsed went to %v, want d1 and d2", order.OfferedTo)
+	}
+
+	clk.Advance(2 * time.Second)
+	s.matcher.SweepOffers()
+	order, _ = s.repo.GetOrder("o1")
+	if order.Status != models.OrderOffered || fmt.Sprint(order.OfferedTo) != "[d3]" {
+		t.Errorf("lapsed offer went to %v as %s, want offered to d3", order.OfferedTo, order.Status)
+	}
+	s.mustDo(http.StatusConflict, http.MethodPost, "/orders/o1/accept", `{"driver_id":"d1"}`)
+
+	// With the ranking exhausted the order waits to be requeued
+	clk.Advance(31 * time.Second)
+	s.matcher.SweepOffers()
+	if order, _ = s.repo.GetOrder("o1"); order.Status != models.OrderUnmatchable {
+		t.Errorf("order after every offer lapsed is %s, want unmatchable", order.Status)
+	}
+	if status := s.matcher.Status(); status.OffersRenewed != 1 || status.OffersExpired != 1 {
+		t.Errorf("matcher counts %d renewed and %d expired offers, want 1 of each", status.OffersRenewed, status.OffersExpired)
+	}
+}
+
+func TestCreateOrderAdmissionControl(t *testing.T) {
+	for _, mode := range []string{usecase.AdmissionAdvisory, usecase.AdmissionEnforce} {
+		s := newTestStack(t, func(cfg *stackConfig) {
+			cfg.order.Admission = usecase.AdmissionConfig{Mode: mode, MaxBacklogRatio: 1, TripTime: 15 * time.Minute}
+		})
+		s.mustDo(http.StatusOK, http.MethodPost, "/drivers", driverJSON("d1", 37.77, -122.42))
+		s.mustDo(http.StatusCreated, http.MethodPost, "/orders", orderJSON("o1", 37.77, -122.42))
+		s.mustDo(http.StatusCreated, http.MethodPost, "/orders", orderJSON("o2", 37.77, -122.42))
+
+		want := http.StatusCreated
+		if mode == usecase.AdmissionEnforce {
+			want = http.StatusServiceUnavailable
+		}
+		w := s.mustDo(want, http.MethodPost, "/orders", orderJSON("o3", 37.77, -122.42))
+		if ratio, wait := w.Header().Get("X-Backlog-Ratio"), w.Header().Get("X-Estimated-Wait"); ratio != "2.00" || wait != "1800" {
+			t.Errorf("%s: X-Backlog-Ratio %q, X-Estimated-Wait %q; want 2.00 and 1800", mode, ratio, wait)
+		}
+		if mode == usecase.AdmissionEnforce {
+			if code := errorCodeOf(t, w); code != "BACKLOG_OVERLOADED" || w.Header().Get("Retry-After") != "1800" {
+				t.Errorf("%s: code %s, Retry-After %q; want BACKLOG_OVERLOADED after 1800", mode, code, w.Header().Get("Retry-After"))
+			}
+		}
+
+		// Once a driver takes an order the backlog is admitted again
+		s.repo.AssignOrderToDriver("o1", "d1")
+		s.mustDo(http.StatusOK, http.MethodPost, "/drivers", driverJSON("d2", 37.77, -122.42))
+		w = s.mustDo(http.StatusCreated, http.MethodPost, "/orders", orderJSON("o4", 37.77, -122.42))
+		if ratio := w.Header().Get("X-Backlog-Ratio"); ratio != "" {
+			t.Errorf("%s: relaxed backlog still reported as %s", mode, ratio)
+		}
+	}
+}
+
+func TestIdempotentRetryBypassesAdmissionControl(t *testing.T) {
+	s := newTestStack(t, func(cfg *stackConfig) {
+		cfg.order.Admission = usecase.AdmissionConfig{Mode: usecase.AdmissionEnforce, MaxBacklogRatio: 1, TripTime: 15 * time.Minute}
+	})
+	s.mustDo(http.StatusOK, http.MethodPost, "/drivers", driverJSON("d1", 37.77, -122.42))
+	s.mustDo(http.StatusCreated, http.MethodPost, "/orders", orderJSON("o1", 37.77, -122.42), "Idempotency-Key", "key-1")
+	s.mustDo(http.StatusCreated, http.MethodPost, "/orders", orderJSON("o2", 37.77, -122.42), "Idempotency-Key", "key-2")
+
+	// The backlog now turns new orders away, but not retries of created ones
+	s.mustDo(http.StatusServiceUnavailable, http.MethodPost, "/orders", orderJSON("o3", 37.77, -122.42), "Idempotency-Key", "key-3")
+	var replay struct {
+		ID string `json:"id"`
+	}
+	decode(t, s.mustDo(http.StatusOK, http.MethodPost, "/orders", orderJSON("o2", 37.77, -122.42), "Idempotency-Key", "key-2"), &replay)
+	if replay.ID != "o2" {
+		t.Errorf("replay under backlog returned order %q, want o2", replay.ID)
+	}
+	w := s.mustDo(http.StatusConflict, http.MethodPost, "/orders", orderJSON("o4", 37.77, -122.42), "Idempotency-Key", "key-2")
+	if code := errorCodeOf(t, w); code != "IDEMPOTENCY_KEY_CONFLICT" {
+		t.Errorf("reused key with a new payload: code = %s, want IDEMPOTENCY_KEY_CONFLICT", code)
+	}
+	if got := len(s.repo.GetAllOrders()); got != 2 {
+		t.Errorf("store holds %d orders, want 2", got)
+	}
+}
+
+func TestPatchOrderPickupWhilePending(t *testing.T) {
+	s := newTestStack(t)
+	s.mustDo(http.StatusOK, http.MethodPost, "/drivers", driverJSON("d1", 37.77, -122.42))
+	s.mustDo(http.StatusCreated, http.MethodPost, "/orders", orderJSON("o1", 37.77, -122.42))
+
+	type orderBody struct {
+		Pickup        models.Location              `json:"pickup"`
+		PickupHistory []models.TimestampedLocation `json:"pickup_history"`
+		Price         float64                      `json:"price"`
+	}
+	var before, after orderBody
+	decode(t, s.mustDo(http.StatusOK, http.MethodGet, "/orders/o1", ""), &before)
+	decode(t, s.mustDo(http.StatusOK, http.MethodPatch, "/orders/o1", `{"pickup":{"lat":37.75,"lon":-122.42}}`), &after)
+	if after.Pickup != (models.Location{Lat: 37.75, Lon: -122.42}) || after.Price <= before.Price {
+		t.Errorf("patched order = %+v, want the new pickup at a higher price than %v", after, before.Price)
+	}
+	if len(after.PickupHistory) != 1 || after.PickupHistory[0].Location != before.Pickup {
+		t.Errorf("pickup history = %+v, want the replaced pickup %v", after.PickupHistory, before.Pickup)
+	}
+	w := s.mustDo(http.StatusBadRequest, http.MethodPatch, "/orders/o1", `{"pickup":{"lat":95,"lon":-122.42}}`)
+	if fields := fieldErrorsOf(t, w); fields["pickup.lat"] == "" {
+		t.Errorf("fields = %v, want pickup.lat rejected", fields)
+	}
+
+	s.repo.AssignOrderToDriver("o1", "d1")
+	w = s.mustDo(http.StatusConflict, http.MethodPatch, "/orders/o1", `{"pickup":{"lat":37.76,"lon":-122.42}}`)
+	if code := errorCodeOf(t, w); code != "INVALID_TRANSITION" {
+		t.Errorf("pickup change after assignment: code = %s, want INVALID_TRANSITION", code)
+	}
+}
+
+func TestCancelOrderReason(t *testing.T) {
+	s := newTestStack(t, func(cfg *stackConfig) { cfg.order.CancelReasons = []string{"customer_request", "driver_no_show"} })
+	for _, id := range []string{"o1", "o2"} {
+		s.mustDo(http.StatusCreated, http.MethodPost, "/orders", orderJSON(id, 37.77, -122.42))
+	}
+
+	w := s.mustDo(http.StatusBadRequest, http.MethodPatch, "/orders/o1/status", `{"status":"canceled","reason":"out_of_stock"}`)
+	if fields := fieldErrorsOf(t, w); fields["reason"] == "" {
+		t.Errorf("fields = %v, want the unknown reason rejected", fields)
+	}
+	if order, _ := s.repo.GetOrder("o1"); order.Status != models.OrderPending {
+		t.Errorf("order with a rejected reason is %s, want pending", order.Status)
+	}
+
+	s.mustDo(http.StatusOK, http.MethodPatch, "/orders/o1/status", `{"status":"canceled","reason":" driver_no_show "}`)
+	var order struct {
+		CancelReason string `json:"cancel_reason"`
+	}
+	decode(t, s.mustDo(http.StatusOK, http.MethodGet, "/orders/o1", ""), &order)
+	if order.CancelReason != "driver_no_show" {
+		t.Errorf("cancel_reason = %q, want driver_no_show", order.CancelReason)
+	}
+	var audit models.AuditLog
+	decode(t, s.mustDo(http.StatusOK, http.MethodGet, "/debug/audit", ""), &audit)
+	if n := len(audit.Events); n == 0 || audit.Events[n-1].Reason != "driver_no_show" {
+		t.Errorf("audit log = %+v, want the cancel reason last", audit.Events)
+	}
+
+	// A reason stays optional
+	s.mustDo(http.StatusOK, http.MethodPatch, "/orders/o2/status", `{"status":"canceled"}`)
+
+	// Without an allow-list any reason is accepted
+	open := newTestStack(t)
+	open.mustDo(http.StatusCreated, http.MethodPost, "/orders", orderJSON("o1", 37.77, -122.42))
+	open.mustDo(http.StatusOK, http.MethodPatch, "/orders/o1/status", `{"status":"canceled","reason":"out_of_stock"}`)
+	if order, _ := open.repo.GetOrder("o1"); order.CancelReason != "out_of_stock" {
+		t.Errorf("cancel reason without an allow-list = %q, want out_of_stock", order.CancelReason)
+	}
+}
+
+func TestFilterOrdersByDeliveryWindow(t *testing.T) {
+	clk := clock.NewFake(time.Unix(1700000000, 0))
+	s := newTestStack(t, func(cfg *stackConfig) { cfg.clock = clk })
+	deliver := func(id string, status models.OrderStatus) {
+		s.mustDo(http.StatusOK, http.MethodPost, "/drivers", driverJSON("driver-"+id, 37.77, -122.42))
+		s.mustDo(http.StatusCreated, http.MethodPost, "/orders", orderJSON(id, 37.77, -122.42))
+		s.repo.AssignOrderToDriver(id, "driver-"+id)
+		s.repo.UpdateOrderStatus(id, models.OrderPickedUp)
+		if status == models.OrderDelivered {
+			s.repo.UpdateOrderStatus(id, models.OrderDelivered)
+		}
+	}
+	// Delivered at 1700000000, 1700000060 and 1700000120, with o4 still on
+	// its way
+	deliver("o1", models.OrderDelivered)
+	clk.Advance(time.Minute)
+	deliver("o2", models.OrderDelivered)
+	clk.Advance(time.Minute)
+	deliver("o3", models.OrderDelivered)
+	deliver("o4", models.OrderPickedUp)
+
+	for _, tc := range []struct {
+		query, want string
+	}{
+		{"", "[o1 o2 o3 o4]"},
+		{"delivered_after=1700000060", "[o2 o3]"},
+		{"delivered_before=1700000060", "[o1]"},
+		{"delivered_after=1700000001&delivered_before=1700000120", "[o2]"},
+		{"delivered_after=1700000121", "[]"},
+	} {
+		if got := idsOf(t, s.mustDo(http.StatusOK, http.MethodGet, "/orders?"+tc.query, "")); got != tc.want {
+			t.Errorf("%s: orders = %s, want %s", tc.query, got, tc.want)
+		}
+	}
+
+	for _, query := range []string{
+		"delivered_after=yesterday",
+		"delivered_after=-1",
+		"delivered_after=1700000060&delivered_before=1700000060",
+	} {
+		s.mustDo(http.StatusBadRequest, http.MethodGet, "/orders?"+query, "")
+	}
+}
+
+func TestOrderAssignmentHistory(t *testing.T) {
+	s := newTestStack(t)
+	s.mustDo(http.StatusOK, http.MethodPost, "/drivers", driverJSON("d1", 37.77, -122.42))
+	s.mustDo(http.StatusOK, http.MethodPost, "/drivers", driverJSON("d2", 37.77, -122.42))
+	s.mustDo(http.StatusCreated, http.MethodPost, "/orders", orderJSON("o1", 37.77, -122.42))
+	s.repo.AssignOrderToDriver("o1", "d1")
+	s.repo.UpdateOrderStatus("o1", models.OrderPickedUp)
+	s.repo.HandoffOrder("o1", "d2")
+	s.mustDo(http.StatusOK, http.MethodPatch, "/orders/o1/status", `{"status":"canceled"}`)
+
+	var order struct {
+		History []struct {
+			DriverID   string `json:"driver_id"`
+			ReleasedAt int64  `json:"released_at"`
+			Reason     string `json:"reason"`
+		} `json:"assignment_history"`
+	}
+	decode(t, s.mustDo(http.StatusOK, http.MethodGet, "/orders/o1", ""), &order)
+	var got []string
+	for _, record := range order.History {
+		if record.ReleasedAt == 0 {
+			t.Errorf("record of %s is still open", record.DriverID)
+		}
+		got = append(got, record.DriverID+":"+record.Reason)
+	}
+	if fmt.Sprint(got) != "[d1:handed_off d2:canceled]" {
+		t.Errorf("assignment history = %v, want d1 handed off, then d2 canceled", got)
+	}
+}
+
+func TestOrderDistanceInConfiguredUnit(t *testing.T) {
+	for _, tc := range []struct {
+		unit, key string
+	}{
+		{models.UnitKilometers, "assignment_distance_km"},
+		{models.UnitMiles, "assignment_distance_mi"},
+	} {
+		s := newTestStack(t, func(cfg *stackConfig) { cfg.handler.DistanceUnit = tc.unit })
+		s.mustDo(http.StatusOK, http.MethodPost, "/drivers", driverJSON("d1", 37.80, -122.42))
+		s.mustDo(http.StatusCreated, http.MethodPost, "/orders", orderJSON("o1", 37.77, -122.42))
+		s.mustDo(http.StatusOK, http.MethodPost, "/orders/o1/auto-assign", "")
+
+		order, _ := s.repo.GetOrder("o1")
+		var body map[string]any
+		decode(t, s.mustDo(http.StatusOK, http.MethodGet, "/orders/o1", ""), &body)
+		got, ok := body[tc.key].(float64)
+		if want := models.KmTo(order.AssignmentDistanceKm, tc.unit); !ok || math.Abs(got-want) > 1e-9 || want == 0 {
+			t.Errorf("%s: %s = %v, want %v", tc.unit, tc.key, body[tc.key], want)
+		}
+		if _, ok := body["assignment_distance_km"]; ok && tc.unit == models.UnitMiles {
+			t.Errorf("mi: body reports kilometers too: %v", body)
+		}
+	}
+}
+
+func TestHandoffOrder(t *testing.T) {
+	s := newTestStack(t)
+	s.mustDo(http.StatusOK, http.MethodPost, "/drivers", driverJSON("d1", 37.77, -122.42))
+	s.mustDo(http.StatusOK, http.MethodPost, "/drivers", driverJSON("d2", 37.80, -122.42))
+	s.mustDo(http.StatusOK, http.MethodPost, "/drivers", driverJSON("d3", 37.90, -122.42))
+	s.mustDo(http.StatusCreated, http.MethodPost, "/orders", orderJSON("o1", 37.77, -122.42))
+	s.mustDo(http.StatusOK, http.MethodPost, "/orders/o1/auto-assign", "")
+
+	handoff := func(status int, to string) *httptest.ResponseRecorder {
+		return s.mustDo(status, http.MethodPost, "/orders/o1/handoff", fmt.Sprintf(`{"to_driver_id":%q}`, to))
+	}
+	if code := errorCodeOf(t, handoff(http.StatusConflict, "d2")); code != "INVALID_TRANSITION" {
+		t.Errorf("handoff before pickup: code = %s, want INVALID_TRANSITION", code)
+	}
+
+	s.mustDo(http.StatusOK, http.MethodPatch, "/orders/o1/status", `{"status":"picked_up"}`)
+	s.mustDo(http.StatusOK, http.MethodPatch, "/drivers/d3/status", `{"status":"offline"}`)
+	for _, tc := range []struct {
+		to     string
+		status int
+		code   string
+	}{
+		{"d3", http.StatusConflict, "DRIVER_NOT_AVAILABLE"},
+		{"nobody", http.StatusNotFound, "DRIVER_NOT_FOUND"},
+		{"d1", http.StatusConflict, "DRIVER_NOT_AVAILABLE"},
+	} {
+		if code := errorCodeOf(t, handoff(tc.status, tc.to)); code != tc.code {
+			t.Errorf("handoff to %s: code = %s, want %s", tc.to, code, tc.code)
+		}
+	}
+
+	var order struct {
+		DriverID          string `json:"driver_id"`
+		Status            string `json:"status"`
+		AssignmentHistory []struct {
+			DriverID string `json:"driver_id"`
+			Reason   string `json:"reason"`
+		} `json:"assignment_history"`
+	}
+	decode(t, handoff(http.StatusOK, "d2"), &order)
+	if order.DriverID != "d2" || order.Status != string(models.OrderPickedUp) {
+		t.Errorf("handed-off order held by %q in %s, want d2 still picked up", order.DriverID, order.Status)
+	}
+	if got := fmt.Sprint(order.AssignmentHistory); got != "[{d1 handed_off} {d2 }]" {
+		t.Errorf("assignment history = %s, want d1 handed off to d2", got)
+	}
+	d1, _ := s.repo.GetDriver("d1")
+	d2, _ := s.repo.GetDriver("d2")
+	if d1.Status != models.DriverAvailable || d2.Status != models.DriverBusy {
+		t.Errorf("after handoff d1 is %s and d2 is %s, want d1 freed and d2 busy", d1.Status, d2.Status)
+	}
+}
+
+func TestCreateOrderToleratesClockSkew(t *testing.T) {
+	clk := clock.NewFake(time.Unix(1700000000, 0))
+	s := newTestStack(t, func(cfg *stackConfig) {
+		cfg.clock = clk
+		cfg.order.MaxClockSkew = time.Minute
+	})
+
+	// A client clock running 30s behind still schedules for "now"
+	s.mustDo(http.StatusCreated, http.MethodPost, "/orders", withJSON(orderJSON("o1", 37.77, -122.42), map[string]any{
+		"scheduled_for": clk.Now().Add(-30 * time.Second).Unix(),
+	}))
+	w := s.mustDo(http.StatusBadRequest, http.MethodPost, "/orders", withJSON(orderJSON("o2", 37.77, -122.42), map[string]any{
+		"scheduled_for": clk.Now().Add(-2 * time.Minute).Unix(),
+	}))
+	if fields := fieldErrorsOf(t, w); fields["scheduled_for"] == "" {
+		t.Errorf("scheduled two minutes ago: fields = %v, want scheduled_for rejected", fields)
+	}
+}
+
+func TestBundledOrdersAssignedTogether(t *testing.T) {
+	s := newTestStack(t)
+	s.mustDo(http.StatusOK, http.MethodPost, "/drivers", driverJSON("small", 37.77, -122.42))
+	for _, id := range []string{"o1", "o2", "o3"} {
+		s.mustDo(http.StatusCreated, http.MethodPost, "/orders", orderJSON(id, 37.77, -122.42))
+	}
+
+	var bundle struct {
+		ID       string   `json:"id"`
+		OrderIDs []string `json:"order_ids"`
+	}
+	decode(t, s.mustDo(http.StatusCreated, http.MethodPost, "/bundles", `{"order_ids":["o1","o2"]}`), &bundle)
+	if bundle.ID == "" || fmt.Sprint(bundle.OrderIDs) != "[o1 o2]" {
+		t.Errorf("bundle = %+v, want an ID for o1 and o2", bundle)
+	}
+	for _, tc := range []struct {
+		body   string
+		status int
+		code   string
+	}{
+		{`{"order_ids":["o1","o3"]}`, http.StatusConflict, "ORDER_BUNDLED"},
+		{`{"order_ids":["o3","nobody"]}`, http.StatusNotFound, "ORDER_NOT_FOUND"},
+		{`{"order_ids":["o3"]}`, http.StatusBadRequest, "VALIDATION_FAILED"},
+	} {
+		if code := errorCodeOf(t, s.mustDo(tc.status, http.MethodPost, "/bundles", tc.body)); code != tc.code {
+			t.Errorf("bundling %s: code = %s, want %s", tc.body, code, tc.code)
+		}
+	}
+
+	// A driver with room for one order takes neither half of the bundle
+	s.matcher.MatchOrders()
+	for _, id := range []string{"o1", "o2"} {
+		if order, _ := s.repo.GetOrder(id); order.Status != models.OrderPending || order.BundleID != bundle.ID {
+			t.Errorf("%s is %s in bundle %q, want pending in %s", id, order.Status, order.BundleID, bundle.ID)
+		}
+	}
+
+	s.mustDo(http.StatusOK, http.MethodPost, "/drivers", withJSON(driverJSON("large", 37.78, -122.42), map[string]any{"capacity": 2}))
+	s.matcher.MatchOrders()
+	o1, _ := s.repo.GetOrder("o1")
+	o2, _ := s.repo.GetOrder("o2")
+	if o1.DriverID != "large" || o2.DriverID != "large" {
+		t.Errorf("bundle went to %q and %q, want both to the driver with room for it", o1.DriverID, o2.DriverID)
+	}
+}
+
+func TestPendingOrderEstimatesWait(t *testing.T) {
+	s := newTestStack(t)
+	waitOf := func(w *httptest.ResponseRecorder) (string, int) {
+		t.Helper()
+		var body struct {
+			EstimatedWaitSeconds int `json:"estimated_wait_seconds"`
+		}
+		decode(t, w, &body)
+		return w.Header().Get("Retry-After"), body.EstimatedWaitSeconds
+	}
+
+	// With no match history each trip of 15 minutes clears one order per
+	// driver, and a lone order still waits for a driver to appear
+	if header, seconds := waitOf(s.mustDo(http.StatusCreated, http.MethodPost, "/orders", orderJSON("o1", 37.77, -122.42))); header != "900" || seconds != 900 {
+		t.Errorf("first order: Retry-After %q, estimated_wait_seconds %d; want 900", header, seconds)
+	}
+	s.mustDo(http.StatusOK, http.MethodPost, "/drivers", driverJSON("d1", 37.90, -122.42))
+	s.mustDo(http.StatusCreated, http.MethodPost, "/orders", orderJSON("o2", 37.77, -122.42))
+	s.mustDo(http.StatusCreated, http.MethodPost, "/orders", orderJSON("o3", 37.77, -122.42))
+	if header, seconds := waitOf(s.mustDo(http.StatusOK, http.MethodGet, "/orders/o1", "")); header != "2700" || seconds != 2700 {
+		t.Errorf("three orders for one driver: Retry-After %q, estimated_wait_seconds %d; want 2700", header, seconds)
+	}
+
+	s.mustDo(http.StatusOK, http.MethodPost, "/orders/o1/auto-assign", "")
+	if header, seconds := waitOf(s.mustDo(http.StatusOK, http.MethodGet, "/orders/o1", "")); header != "" || seconds != 0 {
+		t.Errorf("assigned order: Retry-After %q, estimated_wait_seconds %d; want neither", header, seconds)
+	}
+
+	// Once assignments are made the backlog drains at the recent match
+	// rate, here one a minute for the two orders left
+	if header, seconds := waitOf(s.mustDo(http.StatusOK, http.MethodGet, "/orders/o2", "")); header != "120" || seconds != 120 {
+		t.Errorf("after one assignment: Retry-After %q, estimated_wait_seconds %d; want 120", header, seconds)
+	}
+}
+
+func TestUnmatchableOrdersListedAndRequeued(t *testing.T) {
+	s := newTestStack(t, func(cfg *stackConfig) {
+		cfg.matcher.MaxDistanceKm = 5
+		cfg.matcher.MaxMatchAttempts = 2
+	})
+	s.mustDo(http.StatusOK, http.MethodPost, "/drivers", driverJSON("far", 38.27, -122.42))
+	s.mustDo(http.StatusCreated, http.MethodPost, "/orders", orderJSON("o1", 37.77, -122.42))
+	s.mustDo(http.StatusCreated, http.MethodPost, "/orders", orderJSON("o2", 38.27, -122.42))
+	for range 2 {
+		s.matcher.MatchOrders()
+	}
+
+	if ids := idsOf(t, s.mustDo(http.StatusOK, http.MethodGet, "/orders/unmatchable", "")); ids != "[o1]" {
+		t.Errorf("unmatchable orders = %s, want [o1]", ids)
+	}
+
+	var requeued struct {
+		Status string `json:"status"`
+	}
+	decode(t, s.mustDo(http.StatusOK, http.MethodPost, "/orders/o1/requeue", ""), &requeued)
+	if order, _ := s.repo.GetOrder("o1"); requeued.Status != string(models.OrderPending) || order.MatchAttempts != 0 {
+		t.Errorf("requeued order is %s with %d attempts, want pending with its attempts reset", requeued.Status, order.MatchAttempts)
+	}
+	if ids := idsOf(t, s.mustDo(http.StatusOK, http.MethodGet, "/orders/unmatchable", "")); ids != "[]" {
+		t.Errorf("unmatchable orders after the requeue = %s, want none", ids)
+	}
+
+	if code := errorCodeOf(t, s.mustDo(http.StatusBadRequest, http.MethodPost, "/orders/o1/requeue", "")); code != "INVALID_TRANSITION" {
+		t.Errorf("requeueing a pending order: code = %s, want INVALID_TRANSITION", code)
+	}
+	if code := errorCodeOf(t, s.mustDo(http.StatusNotFound, http.MethodPost, "/orders/nobody/requeue", "")); code != "ORDER_NOT_FOUND" {
+		t.Errorf("unknown order: code = %s, want ORDER_NOT_FOUND", code)
+	}
+}
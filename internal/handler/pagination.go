@@ -0,0 +1,54 @@
+package handler
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// pagination holds the parsed paging parameters of a list request
+type pagination struct {
+	Limit  int
+	Offset int
+	After  string
+	// Requested reports whether the client asked for a paginated response
+	Requested bool
+}
+
+// parsePagination reads limit, offset and after from the query string.
+// limit defaults to the configured page size and is clamped to [1, MaxPageSize];
+// non-numeric values and negative offsets are rejected.
+func (h *Handler) parsePagination(c *gin.Context) (pagination, error) {
+	p := pagination{Limit: h.cfg.DefaultPageSize}
+
+	if value, ok := c.GetQuery("limit"); ok {
+		limit, err := strconv.Atoi(value)
+		if err != nil {
+			return pagination{}, errInvalidLimit
+		}
+		p.Limit = limit
+		p.Requested = true
+	}
+
+	if value, ok := c.GetQuery("offset"); ok {
+		offset, err := strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			return pagination{}, errInvalidOffset
+		}
+		p.Offset = offset
+		p.Requested = true
+	}
+
+	if value, ok := c.GetQuery("after"); ok {
+		p.After = value
+		p.Requested = true
+	}
+
+	if p.Limit < 1 {
+		p.Limit = 1
+	}
+	if p.Limit > h.cfg.MaxPageSize {
+		p.Limit = h.cfg.MaxPageSize
+	}
+	return p, nil
+}
@@ -0,0 +1,105 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestDriversRejectOffset(t *testing.T) {
+	s := newTestStack(t)
+	s.mustDo(http.StatusOK, http.MethodPost, "/drivers", driverJSON("d1", 37.77, -122.42))
+
+	for _, path := range []string{"/drivers?offset=50", "/drivers?limit=10&offset=0", "/drivers?after=d1&offset=1"} {
+		w := s.mustDo(http.StatusBadRequest, http.MethodGet, path, "")
+		if code := errorCodeOf(t, w); code != "INVALID_OFFSET" {
+			t.Errorf("%s: code = %s, want INVALID_OFFSET", path, code)
+		}
+	}
+}
+
+func TestDriversCursorPagination(t *testing.T) {
+	s := newTestStack(t)
+	for i := range 5 {
+		s.mustDo(http.StatusOK, http.MethodPost, "/drivers", driverJSON(fmt.Sprintf("d%d", i), 37.77, -122.42))
+	}
+
+	var ids []string
+	path := "/drivers?limit=2"
+	for pages := 0; ; pages++ {
+		if pages > 5 {
+			t.Fatal("cursor never ran out")
+		}
+		var page struct {
+			Drivers    []struct{ ID string } `json:"drivers"`
+			NextCursor string                `json:"next_cursor"`
+		}
+		decode(t, s.mustDo(http.StatusOK, http.MethodGet, path, ""), &page)
+		for _, driver := range page.Drivers {
+			ids = append(ids, driver.ID)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		path = "/drivers?limit=2&after=" + page.NextCursor
+	}
+	if fmt.Sprint(ids) != "[d0 d1 d2 d3 d4]" {
+		t.Errorf("paged through %v, want d0 to d4 in order", ids)
+	}
+}
+
+func TestOrdersOffsetPagination(t *testing.T) {
+	s := newTestStack(t, func(cfg *stackConfig) { cfg.handler.MaxPageSize = 2 })
+	for i := range 3 {
+		s.mustDo(http.StatusCreated, http.MethodPost, "/orders", orderJSON(fmt.Sprintf("o%d", i), 37.77, -122.42))
+	}
+
+	var page struct {
+		Orders []struct{ ID string } `json:"orders"`
+		Offset int                   `json:"offset"`
+		Total  int                   `json:"total"`
+	}
+	// limit is clamped to MAX_PAGE_SIZE
+	decode(t, s.mustDo(http.StatusOK, http.MethodGet, "/orders?limit=10&offset=1", ""), &page)
+	if len(page.Orders) != 2 || page.Orders[0].ID != "o1" || page.Offset != 1 || page.Total != 3 {
+		t.Errorf("page = %+v, want o1 and o2 of 3 at offset 1", page)
+	}
+
+	for path, code := range map[string]string{
+		"/orders?offset=-1": "INVALID_OFFSET",
+		"/orders?offset=x":  "INVALID_OFFSET",
+		"/orders?limit=x":   "INVALID_LIMIT",
+	} {
+		if got := errorCodeOf(t, s.mustDo(http.StatusBadRequest, http.MethodGet, path, "")); got != code {
+			t.Errorf("%s: code = %s, want %s", path, got, code)
+		}
+	}
+}
+
+func TestPageSizeDefaultsAndClamps(t *testing.T) {
+	s := newTestStack(t, func(cfg *stackConfig) {
+		cfg.handler.DefaultPageSize = 2
+		cfg.handler.MaxPageSize = 3
+	})
+	for i := range 5 {
+		s.mustDo(http.StatusCreated, http.MethodPost, "/orders", orderJSON(fmt.Sprintf("o%d", i), 37.77, -122.42))
+	}
+
+	for path, want := range map[string]int{
+		// Paginated by offset alone, the page holds DEFAULT_PAGE_SIZE orders
+		"/orders?offset=0":  2,
+		"/orders?limit=0":   1,
+		"/orders?limit=-5":  1,
+		"/orders?limit=3":   3,
+		"/orders?limit=100": 3,
+	} {
+		var page struct {
+			Orders []struct{ ID string } `json:"orders"`
+			Total  int                   `json:"total"`
+		}
+		decode(t, s.mustDo(http.StatusOK, http.MethodGet, path, ""), &page)
+		if len(page.Orders) != want || page.Total != 5 {
+			t.Errorf("%s: %d of %d orders, want %d of 5", path, len(page.Orders), page.Total, want)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/pprof"
+	rtpprof "runtime/pprof"
+
+	"github.com/gin-gonic/gin"
+)
+
+// registerPprof serves the net/http/pprof profiles under /debug/pprof and a
+// text dump of every goroutine's stack at /debug/goroutines, all guarded by
+// DebugToken. Importing net/http/pprof also registers its handlers on
+// http.DefaultServeMux, but the server only ever serves the gin engine, so
+// they are unreachable unless added here. FeatureFlags can turn off any of
+// them.
+//
+// CPU profiles, traces and delta profiles run for as many seconds as they
+// are asked to, so the routes are exempt from the request timeout. Those
+// handlers push the connection's write deadline back by the same amount
+// themselves, through the response writer gin unwraps to.
+func (h *Handler) registerPprof(r *gin.Engine) {
+	g := h.routes(r.Group("/debug", h.requireDebugToken()), "/debug").untimed(always)
+	g.GET("/goroutines", h.goroutinesHandler())
+	g.GET("/pprof/", gin.WrapF(pprof.Index))
+	g.GET("/pprof/cmdline", gin.WrapF(pprof.Cmdline))
+	g.GET("/pprof/profile", gin.WrapF(pprof.Profile))
+	g.GET("/pprof/symbol", gin.WrapF(pprof.Symbol))
+	g.POST("/pprof/symbol", gin.WrapF(pprof.Symbol))
+	g.GET("/pprof/trace", gin.WrapF(pprof.Trace))
+	// Named profiles such as heap, goroutine, mutex and block
+	g.GET("/pprof/:name", gin.WrapF(pprof.Index))
+}
+
+// goroutinesHandler handles GET /debug/goroutines
+func (h *Handler) goroutinesHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Content-Type", "text/plain; charset=utf-8")
+		c.Status(http.StatusOK)
+		// Debug level 2 prints each goroutine's full stack, as in a panic
+		if err := rtpprof.Lookup("goroutine").WriteTo(c.Writer, 2); err != nil {
+			c.Error(err)
+		}
+	}
+}
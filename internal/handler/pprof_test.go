@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"delivery-state-manager/pkg/clock"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestPprofProfileOutlastsTimeouts(t *testing.T) {
+	if testing.Short() {
+		t.Skip("takes two seconds of CPU profiling")
+	}
+
+	h := NewHandler(nil, nil, nil, clock.New(), Config{RequestTimeout: 100 * time.Millisecond})
+	r := gin.New()
+	h.registerPprof(r)
+
+	srv := httptest.NewUnstartedServer(r)
+	srv.Config.WriteTimeout = time.Second
+	srv.Start()
+	defer srv.Close()
+
+	start := time.Now()
+	resp, err := http.Get(srv.URL + "/debug/pprof/profile?seconds=2")
+	if err != nil {
+		t.Fatalf("GET profile: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("reading profile: %v", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, body %q", resp.StatusCode, body)
+	}
+	if len(body) == 0 {
+		t.Error("profile is empty")
+	}
+	// A request timeout would have cut the profile short
+	if elapsed := time.Since(start); elapsed < 2*time.Second {
+		t.Errorf("profile took %v, want the full 2s", elapsed)
+	}
+}
+
+func TestPprofGoroutineDump(t *testing.T) {
+	h := NewHandler(nil, nil, nil, clock.New(), Config{DebugToken: "secret"})
+	r := gin.New()
+	h.registerPprof(r)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/debug/goroutines", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("without token: status = %d, want 401", w.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/debug/goroutines", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "goroutine ") {
+		t.Errorf("dump has no goroutines: %.200q", w.Body.String())
+	}
+}
@@ -0,0 +1,50 @@
+package handler
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestResetClearsState(t *testing.T) {
+	s := newTestStack(t, func(cfg *stackConfig) { cfg.handler.ResetEnabled = true })
+	s.mustDo(http.StatusOK, http.MethodPost, "/drivers", driverJSON("d1", 37.77, -122.42))
+	s.mustDo(http.StatusOK, http.MethodPost, "/drivers", driverJSON("d2", 37.77, -122.42))
+	s.mustDo(http.StatusCreated, http.MethodPost, "/orders", orderJSON("o1", 37.77, -122.42))
+
+	var result struct {
+		Drivers int `json:"drivers_cleared"`
+		Orders  int `json:"orders_cleared"`
+	}
+	decode(t, s.mustDo(http.StatusOK, http.MethodPost, "/debug/reset", ""), &result)
+	if result.Drivers != 2 || result.Orders != 1 {
+		t.Errorf("cleared %+v, want 2 drivers and 1 order", result)
+	}
+	if drivers, orders := s.repo.GetAllDrivers(), s.repo.GetAllOrders(); len(drivers) != 0 || len(orders) != 0 {
+		t.Errorf("%d drivers and %d orders left after reset", len(drivers), len(orders))
+	}
+}
+
+func TestResetDisabledIsNotFound(t *testing.T) {
+	s := newTestStack(t)
+	s.mustDo(http.StatusOK, http.MethodPost, "/drivers", driverJSON("d1", 37.77, -122.42))
+
+	s.mustDo(http.StatusNotFound, http.MethodPost, "/debug/reset", "")
+	if drivers := s.repo.GetAllDrivers(); len(drivers) != 1 {
+		t.Errorf("%d drivers after a disabled reset, want 1", len(drivers))
+	}
+}
+
+func TestResetRequiresDebugToken(t *testing.T) {
+	s := newTestStack(t, func(cfg *stackConfig) {
+		cfg.handler.ResetEnabled = true
+		cfg.handler.DebugToken = "secret"
+	})
+	s.mustDo(http.StatusOK, http.MethodPost, "/drivers", driverJSON("d1", 37.77, -122.42))
+
+	s.mustDo(http.StatusUnauthorized, http.MethodPost, "/debug/reset", "")
+	s.mustDo(http.StatusUnauthorized, http.MethodPost, "/debug/reset", "", "Authorization", "Bearer wrong")
+	if drivers := s.repo.GetAllDrivers(); len(drivers) != 1 {
+		t.Fatalf("%d drivers after unauthorized resets, want 1", len(drivers))
+	}
+	s.mustDo(http.StatusOK, http.MethodPost, "/debug/reset", "", "Authorization", "Bearer secret")
+}
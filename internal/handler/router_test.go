@@ -0,0 +1,59 @@
+package handler
+
+import (
+	"delivery-state-manager/pkg/logger"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSetupRouterAppliesReleaseMode(t *testing.T) {
+	t.Cleanup(func() {
+		gin.SetMode(gin.TestMode)
+		logger.SetLevel(logger.LevelInfo)
+	})
+	release := func(cfg *stackConfig) { cfg.handler.GinMode = gin.ReleaseMode }
+
+	logger.SetLevel(logger.LevelInfo)
+	quiet := newTestStack(t, release)
+	if gin.Mode() != gin.ReleaseMode {
+		t.Errorf("gin mode = %s, want release", gin.Mode())
+	}
+	logger.SetLevel(logger.LevelDebug)
+	verbose := newTestStack(t, release)
+
+	// Debug logging adds only the per-request access log
+	if got := len(verbose.router.Handlers) - len(quiet.router.Handlers); got != 1 {
+		t.Errorf("debug logging adds %d middleware, want the access log alone", got)
+	}
+}
+
+func TestRoutesServedUnderVersionPrefix(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		unversioned bool
+		want        map[string]int
+	}{
+		{"prefix only", false, map[string]int{
+			"/v2/drivers/d1": http.StatusOK,
+			"/drivers/d1":    http.StatusNotFound,
+			"/v1/drivers/d1": http.StatusNotFound,
+		}},
+		{"with unversioned routes", true, map[string]int{
+			"/v2/drivers/d1": http.StatusOK,
+			"/drivers/d1":    http.StatusOK,
+		}},
+	} {
+		s := newTestStack(t, func(cfg *stackConfig) {
+			cfg.handler.VersionPrefix = "/v2"
+			cfg.handler.UnversionedRoutes = tc.unversioned
+		})
+		s.mustDo(http.StatusOK, http.MethodPost, "/v2/drivers", driverJSON("d1", 37.77, -122.42))
+		for path, want := range tc.want {
+			if w := s.do(http.MethodGet, path, ""); w.Code != want {
+				t.Errorf("%s: GET %s = %d, want %d", tc.name, path, w.Code, want)
+			}
+		}
+	}
+}
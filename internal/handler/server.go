@@ -0,0 +1,27 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+)
+
+// ServerTimeouts holds the connection timeouts for the HTTP server
+type ServerTimeouts struct {
+	Read  time.Duration
+	Write time.Duration
+	Idle  time.Duration
+}
+
+// NewServer creates an HTTP server with explicit timeouts so slow clients
+// cannot hold connections open indefinitely. Handler deadlines are set per
+// route by requestTimeout instead, so long-running routes can opt out.
+func NewServer(addr string, handler http.Handler, timeouts ServerTimeouts) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadTimeout:       timeouts.Read,
+		ReadHeaderTimeout: timeouts.Read,
+		WriteTimeout:      timeouts.Write,
+		IdleTimeout:       timeouts.Idle,
+	}
+}
@@ -0,0 +1,278 @@
+package handler
+
+import (
+	"delivery-state-manager/internal/models"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLongPollStateBlocksUntilMutation(t *testing.T) {
+	s := newTestStack(t, func(cfg *stackConfig) {
+		cfg.handler.RequestTimeout = 50 * time.Millisecond
+	})
+	since := s.repo.GetVersion()
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		s.repo.CreateOrUpdateDriver(testDriver("d1"))
+	}()
+
+	start := time.Now()
+	w := s.mustDo(http.StatusOK, http.MethodGet, "/debug/state?wait=5s&since="+strconv.FormatUint(since, 10), "")
+	elapsed := time.Since(start)
+
+	// Longer than REQUEST_TIMEOUT, which long polls are exempt from
+	if elapsed < 100*time.Millisecond || elapsed > 4*time.Second {
+		t.Errorf("long poll returned after %v, want shortly after the 100ms mutation", elapsed)
+	}
+	if !strings.Contains(w.Body.String(), `"d1"`) {
+		t.Errorf("snapshot does not include the new driver: %s", w.Body.String())
+	}
+	if etag := w.Header().Get("ETag"); etag == stateETag(since) {
+		t.Errorf("ETag = %s, want a newer version", etag)
+	}
+}
+
+func TestLongPollStateTimesOutWith304(t *testing.T) {
+	s := newTestStack(t)
+	since := s.repo.GetVersion()
+
+	start := time.Now()
+	w := s.mustDo(http.StatusNotModified, http.MethodGet, "/v1/debug/state?wait=50ms&since="+strconv.FormatUint(since, 10), "")
+
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("returned after %v, before the wait ran out", elapsed)
+	}
+	if etag := w.Header().Get("ETag"); etag != stateETag(since) {
+		t.Errorf("ETag = %s, want %s", etag, stateETag(since))
+	}
+	if w.Body.Len() != 0 {
+		t.Errorf("304 has a body: %s", w.Body.String())
+	}
+}
+
+func TestLongPollStateIsCappedByMaxWait(t *testing.T) {
+	s := newTestStack(t, func(cfg *stackConfig) {
+		cfg.debug.StateMaxWait = 30 * time.Millisecond
+	})
+
+	start := time.Now()
+	s.mustDo(http.StatusNotModified, http.MethodGet, "/debug/state?wait=1m", "")
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("wait was not capped: returned after %v", elapsed)
+	}
+}
+
+func TestLongPollStateStaleSinceReturnsAtOnce(t *testing.T) {
+	s := newTestStack(t)
+	s.repo.CreateOrUpdateDriver(testDriver("d1"))
+
+	s.mustDo(http.StatusOK, http.MethodGet, "/debug/state?wait=10s&since=0", "")
+}
+
+func TestLongPollStateRejectsInvalidParameters(t *testing.T) {
+	s := newTestStack(t)
+
+	for path, code := range map[string]string{
+		"/debug/state?wait=soon":       "INVALID_WAIT",
+		"/debug/state?wait=-1s":        "INVALID_WAIT",
+		"/debug/state?wait=1s&since=x": "INVALID_SINCE",
+	} {
+		w := s.mustDo(http.StatusBadRequest, http.MethodGet, path, "")
+		if got := errorCodeOf(t, w); got != code {
+			t.Errorf("%s: code = %s, want %s", path, got, code)
+		}
+	}
+}
+
+// seedSnapshot is a state with every persisted field the API responses
+// leave out or compute
+func seedSnapshot() models.StateSnapshot {
+	driver := testDriver("d1")
+	driver.LocationHistory = []models.TimestampedLocation{
+		{Location: models.Location{Lat: 37.76, Lon: -122.41}, Timestamp: 1700000000},
+		{Location: driver.Location, Timestamp: 1700000060},
+	}
+	driver.OfferLapsedAt = 1700000030
+	driver.DailyOrders = 4
+	driver.DailyOrdersDate = "2023-11-14"
+	return models.StateSnapshot{
+		Drivers: map[string]*models.Driver{"d1": driver, "d2": testDriver("d2")},
+		Orders: map[string]*models.Order{"o1": {
+			ID:         "o1",
+			Customer:   "customer-o1",
+			Status:     models.OrderPending,
+			Pickup:     models.Location{Lat: 37.77, Lon: -122.42},
+			Dropoff:    models.Location{Lat: 37.78, Lon: -122.42},
+			OfferQueue: []string{"d2", "d1"},
+			CreatedAt:  1700000000,
+		}},
+	}
+}
+
+// snapshotOf decodes a GET /debug/state response
+func snapshotOf(t *testing.T, w *httptest.ResponseRecorder) models.StateSnapshot {
+	t.Helper()
+	var snapshot models.StateSnapshot
+	decode(t, w, &snapshot)
+	return snapshot
+}
+
+func TestStateSnapshotRoundTrips(t *testing.T) {
+	enableRestore := func(cfg *stackConfig) { cfg.handler.RestoreEnabled = true }
+	seed, err := json.Marshal(seedSnapshot())
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := newTestStack(t, enableRestore)
+	src.mustDo(http.StatusOK, http.MethodPost, "/debug/restore", string(seed))
+	out := src.mustDo(http.StatusOK, http.MethodGet, "/debug/state", "")
+
+	dst := newTestStack(t, enableRestore)
+	dst.mustDo(http.StatusOK, http.MethodPost, "/debug/restore", out.Body.String())
+	back := snapshotOf(t, dst.mustDo(http.StatusOK, http.MethodGet, "/debug/state", ""))
+
+	want := snapshotOf(t, out)
+	if !reflect.DeepEqual(back.Drivers, want.Drivers) || !reflect.DeepEqual(back.Orders, want.Orders) {
+		t.Fatalf("restored state differs:\n got %s\nwant %s", dst.do(http.MethodGet, "/debug/state", "").Body, out.Body)
+	}
+	d1 := back.Drivers["d1"]
+	if len(d1.LocationHistory) != 2 || d1.OfferLapsedAt != 1700000030 || d1.DailyOrdersDate != "2023-11-14" || d1.DailyOrders != 4 {
+		t.Errorf("driver lost persisted fields: %+v", d1)
+	}
+	if q := back.Orders["o1"].OfferQueue; !reflect.DeepEqual(q, []string{"d2", "d1"}) {
+		t.Errorf("offer_queue = %v, want [d2 d1]", q)
+	}
+}
+
+func TestStateSnapshotIgnoresAPINaming(t *testing.T) {
+	seed, err := json.Marshal(seedSnapshot())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newTestStack(t, func(cfg *stackConfig) {
+		cfg.handler.Naming = NamingCamel
+		cfg.handler.ResetEnabled = true
+		cfg.handler.RestoreEnabled = true
+	})
+	s.mustDo(http.StatusOK, http.MethodPost, "/debug/restore", string(seed))
+	out := s.mustDo(http.StatusOK, http.MethodGet, "/debug/state", "")
+
+	if strings.Contains(out.Body.String(), "locationHistory") || !strings.Contains(out.Body.String(), `"location_history"`) {
+		t.Fatalf("snapshot does not use the model field names: %s", out.Body)
+	}
+	s.mustDo(http.StatusOK, http.MethodPost, "/debug/reset", "")
+	s.mustDo(http.StatusOK, http.MethodPost, "/debug/restore", out.Body.String())
+	back := snapshotOf(t, s.mustDo(http.StatusOK, http.MethodGet, "/debug/state", ""))
+	if len(back.Drivers) != 2 || len(back.Orders) != 1 || len(back.Drivers["d1"].LocationHistory) != 2 {
+		t.Errorf("camel-naming snapshot did not restore: %+v", back)
+	}
+}
+
+func TestStateSnapshotDecodes(t *testing.T) {
+	s := newTestStack(t)
+	want := seedSnapshot()
+	if err := s.repo.RestoreSnapshot(want); err != nil {
+		t.Fatalf("RestoreSnapshot: %v", err)
+	}
+
+	w := s.mustDo(http.StatusOK, http.MethodGet, "/debug/state", "")
+	got := snapshotOf(t, w)
+	if !reflect.DeepEqual(got.Drivers, want.Drivers) || !reflect.DeepEqual(got.Orders, want.Orders) {
+		t.Errorf("decoded snapshot = %+v, want %+v", got, want)
+	}
+	if got.Version != s.repo.GetVersion() || w.Header().Get("ETag") != stateETag(got.Version) {
+		t.Errorf("version = %d with ETag %s, want %d", got.Version, w.Header().Get("ETag"), s.repo.GetVersion())
+	}
+}
+
+// stalledWriter is a response writer whose first write blocks until
+// release is closed, like a client that stops reading
+type stalledWriter struct {
+	*httptest.ResponseRecorder
+	writing chan struct{}
+	release chan struct{}
+	once    sync.Once
+}
+
+func (w *stalledWriter) Write(p []byte) (int, error) {
+	w.once.Do(func() {
+		close(w.writing)
+		<-w.release
+	})
+	return w.ResponseRecorder.Write(p)
+}
+
+func TestStateSnapshotSlowClientDoesNotBlockWrites(t *testing.T) {
+	s := newTestStack(t)
+	s.repo.CreateOrUpdateDriver(testDriver("d1"))
+
+	w := &stalledWriter{ResponseRecorder: httptest.NewRecorder(), writing: make(chan struct{}), release: make(chan struct{})}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/debug/state", nil))
+	}()
+	<-w.writing
+
+	written := make(chan struct{})
+	go func() {
+		s.repo.CreateOrUpdateDriver(testDriver("d2"))
+		close(written)
+	}()
+	select {
+	case <-written:
+	case <-time.After(2 * time.Second):
+		t.Error("write blocked while the snapshot was being sent")
+	}
+	close(w.release)
+	<-done
+
+	if got := snapshotOf(t, w.ResponseRecorder); len(got.Drivers) != 1 {
+		t.Errorf("snapshot has %d drivers, want the 1 present when it was taken", len(got.Drivers))
+	}
+}
+
+func TestStateSnapshotOverMaxBytes(t *testing.T) {
+	s := newTestStack(t, func(cfg *stackConfig) {
+		cfg.handler.MaxStateBytes = 2048
+	})
+	s.repo.CreateOrUpdateDriver(testDriver("d1"))
+	if w := s.mustDo(http.StatusOK, http.MethodGet, "/debug/state", ""); len(snapshotOf(t, w).Drivers) != 1 {
+		t.Fatalf("small snapshot = %s, want d1", w.Body.String())
+	}
+
+	for i := range 20 {
+		s.repo.CreateOrUpdateDriver(testDriver(fmt.Sprintf("d%d", i+2)))
+	}
+	w := s.mustDo(http.StatusServiceUnavailable, http.MethodGet, "/debug/state", "")
+	if code := errorCodeOf(t, w); code != "STATE_TOO_LARGE" {
+		t.Errorf("error code = %s, want STATE_TOO_LARGE", code)
+	}
+}
+
+func TestStateConditionalGet(t *testing.T) {
+	s := newTestStack(t)
+	etag := s.mustDo(http.StatusOK, http.MethodGet, "/debug/state", "").Header().Get("ETag")
+
+	for _, ifNoneMatch := range []string{etag, "W/" + etag, `"0", ` + etag, "*"} {
+		w := s.mustDo(http.StatusNotModified, http.MethodGet, "/debug/state", "", "If-None-Match", ifNoneMatch)
+		if w.Body.Len() != 0 {
+			t.Errorf("If-None-Match %s: 304 has a body: %s", ifNoneMatch, w.Body.String())
+		}
+	}
+
+	s.repo.CreateOrUpdateDriver(testDriver("d1"))
+	w := s.mustDo(http.StatusOK, http.MethodGet, "/debug/state", "", "If-None-Match", etag)
+	if next := w.Header().Get("ETag"); next == etag || next != stateETag(s.repo.GetVersion()) {
+		t.Errorf("ETag after a mutation = %s, want %s", next, stateETag(s.repo.GetVersion()))
+	}
+}
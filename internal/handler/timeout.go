@@ -0,0 +1,39 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// requestTimeout bounds a request with a RequestTimeout context deadline,
+// which the use cases honor by giving up with the context's error. If the
+// deadline passes before the handler has written anything the client gets
+// a 503; a response already under way is left to finish. Nothing is
+// buffered, so streamed responses reach the client as they are written.
+// Requests exempt reports true for run without a deadline.
+func (h *Handler) requestTimeout(exempt func(c *gin.Context) bool) gin.HandlerFunc {
+	timeout := h.cfg.RequestTimeout
+	return func(c *gin.Context) {
+		if timeout <= 0 || (exempt != nil && exempt(c)) {
+			c.Next()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+
+		if ctx.Err() == context.DeadlineExceeded && !c.Writer.Written() {
+			h.fail(c, http.StatusServiceUnavailable, errRequestTimeout)
+		}
+	}
+}
+
+// always exempts every request of a route from the request timeout
+func always(*gin.Context) bool {
+	return true
+}
@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"context"
+	"delivery-state-manager/pkg/clock"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// newTimeoutRouter registers handler at /slow under a request timeout of
+// timeout, exempting the requests exempt reports true for
+func newTimeoutRouter(timeout time.Duration, exempt func(c *gin.Context) bool, handler gin.HandlerFunc) *gin.Engine {
+	h := NewHandler(nil, nil, nil, clock.New(), Config{RequestTimeout: timeout})
+	r := gin.New()
+	h.routes(r.Group(""), "").untimed(exempt).GET("/slow", handler)
+	return r
+}
+
+func TestRequestTimeoutAnswers503AndCancelsContext(t *testing.T) {
+	ctxErr := make(chan error, 1)
+	r := newTimeoutRouter(20*time.Millisecond, nil, func(c *gin.Context) {
+		select {
+		case <-c.Request.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+		ctxErr <- c.Request.Context().Err()
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/slow", nil))
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want 503", w.Code)
+	}
+	var body errorEnvelope
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decoding body %q: %v", w.Body.String(), err)
+	}
+	if body.Error.Code != "REQUEST_TIMEOUT" {
+		t.Errorf("code = %q, want REQUEST_TIMEOUT", body.Error.Code)
+	}
+	if err := <-ctxErr; err != context.DeadlineExceeded {
+		t.Errorf("handler context error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestRequestTimeoutMapsUseCaseDeadlineTo503(t *testing.T) {
+	h := NewHandler(nil, nil, nil, clock.New(), Config{RequestTimeout: 10 * time.Millisecond})
+	r := gin.New()
+	h.routes(r.Group(""), "").GET("/slow", func(c *gin.Context) {
+		<-c.Request.Context().Done()
+		// As a use case would after noticing the deadline
+		h.badRequest(c, c.Request.Context().Err())
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/slow", nil))
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want 503", w.Code)
+	}
+}
+
+func TestRequestTimeoutLeavesStartedResponse(t *testing.T) {
+	r := newTimeoutRouter(10*time.Millisecond, nil, func(c *gin.Context) {
+		c.Status(http.StatusOK)
+		c.Writer.WriteString("partial")
+		<-c.Request.Context().Done()
+		c.Writer.WriteString(" rest")
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/slow", nil))
+
+	if w.Code != http.StatusOK || w.Body.String() != "partial rest" {
+		t.Errorf("got %d %q, want 200 %q", w.Code, w.Body.String(), "partial rest")
+	}
+}
+
+func TestRequestTimeoutExemptRequests(t *testing.T) {
+	exempt := func(c *gin.Context) bool { return c.Query("wait") != "" }
+	r := newTimeoutRouter(10*time.Millisecond, exempt, func(c *gin.Context) {
+		if _, ok := c.Request.Context().Deadline(); ok {
+			c.Status(http.StatusTeapot)
+			return
+		}
+		time.Sleep(30 * time.Millisecond)
+		c.Status(http.StatusOK)
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/slow?wait=1s", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("exempt request: status = %d, want 200", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/slow", nil))
+	if w.Code != http.StatusTeapot {
+		t.Errorf("timed request: status = %d, want its context to have a deadline", w.Code)
+	}
+}
+
+func TestRequestTimeoutDisabled(t *testing.T) {
+	r := newTimeoutRouter(0, nil, func(c *gin.Context) {
+		if _, ok := c.Request.Context().Deadline(); ok {
+			t.Error("context has a deadline with the timeout disabled")
+		}
+		c.Status(http.StatusOK)
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/slow", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("status = %d, want 200", w.Code)
+	}
+}
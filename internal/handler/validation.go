@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"delivery-state-manager/pkg/errs"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// validationErrorResponse represents a request with one or more invalid fields
+type validationErrorResponse struct {
+	Error  string            `json:"error"`
+	Fields map[string]string `json:"fields"`
+}
+
+// bindJSON decodes the request body into obj, writing a 400 response and
+// returning false on failure. Type mismatches are reported per field.
+func (h *Handler) bindJSON(c *gin.Context, obj any) bool {
+	err := c.ShouldBindJSON(obj)
+	if err == nil {
+		return true
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		h.badRequest(c, &errs.ValidationError{
+			Fields: map[string]string{typeErr.Field: "must be of type " + typeErr.Type.String()},
+		})
+		return false
+	}
+
+	h.badRequest(c, errInvalidBody)
+	return false
+}
+
+// statusAliases maps spellings of statuses that clients commonly send, after
+// lower-casing and replacing separators, to the documented status
+var statusAliases = map[string]string{
+	"cancelled": "canceled",
+	"pickedup":  "picked_up",
+}
+
+// statusSeparators turns the hyphens and spaces of "picked-up" or
+// "picked up" into the underscore of "picked_up"
+var statusSeparators = strings.NewReplacer("-", "_", " ", "_")
+
+// normalizeStatus returns status in its documented spelling when strict is
+// off: surrounding whitespace is trimmed, letters are lower-cased and
+// common variants such as "Picked-Up" or "cancelled" are mapped to the
+// status they mean. Anything still unknown is left for validation to
+// reject. With strict on, status is returned unchanged.
+func normalizeStatus[S ~string](strict bool, status S) S {
+	if strict {
+		return status
+	}
+	s := statusSeparators.Replace(strings.ToLower(strings.TrimSpace(string(status))))
+	if alias, ok := statusAliases[s]; ok {
+		s = alias
+	}
+	return S(s)
+}
+
+// badRequest writes err as a 400 response, listing field errors when err
+// is a validation failure
+func (h *Handler) badRequest(c *gin.Context, err error) {
+	h.fail(c, http.StatusBadRequest, err)
+}
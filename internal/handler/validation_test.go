@@ -0,0 +1,88 @@
+package handler
+
+import (
+	"delivery-state-manager/internal/models"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestCreateDriverReportsEveryInvalidField(t *testing.T) {
+	s := newTestStack(t)
+	w := s.mustDo(http.StatusBadRequest, http.MethodPost, "/drivers", `{"id":"d1","location":{"lat":91,"lon":-181}}`)
+	if code := errorCodeOf(t, w); code != "VALIDATION_FAILED" {
+		t.Errorf("code = %s, want VALIDATION_FAILED", code)
+	}
+	want := map[string]string{"name": "required", "location.lat": "out of range", "location.lon": "out of range"}
+	if fields := fieldErrorsOf(t, w); !reflect.DeepEqual(fields, want) {
+		t.Errorf("fields = %v, want %v", fields, want)
+	}
+}
+
+func TestCreateOrderReportsEveryInvalidField(t *testing.T) {
+	s := newTestStack(t)
+	body := withJSON(orderJSON("o1", 37.77, -122.42), map[string]any{
+		"customer": "",
+		"dropoff":  map[string]any{"lat": 37.78, "lon": 200},
+	})
+	fields := fieldErrorsOf(t, s.mustDo(http.StatusBadRequest, http.MethodPost, "/orders", body))
+	if fields["customer"] != "required" || fields["dropoff.lon"] != "out of range" {
+		t.Errorf("fields = %v, want customer and dropoff.lon reported together", fields)
+	}
+}
+
+func TestBindJSONReportsMistypedField(t *testing.T) {
+	s := newTestStack(t)
+	w := s.mustDo(http.StatusBadRequest, http.MethodPost, "/drivers", `{"id":"d1","name":"D1","location":{"lat":"north","lon":0}}`)
+	if fields := fieldErrorsOf(t, w); fields["location.lat"] != "must be of type float64" {
+		t.Errorf("fields = %v, want location.lat reported as mistyped", fields)
+	}
+
+	w = s.mustDo(http.StatusBadRequest, http.MethodPost, "/drivers", `{not json`)
+	if code := errorCodeOf(t, w); code == "VALIDATION_FAILED" {
+		t.Errorf("malformed body reported as %s, want the invalid body error", code)
+	}
+}
+
+func TestNormalizeStatus(t *testing.T) {
+	for _, tc := range []struct {
+		in, lenient string
+	}{
+		{"available", "available"},
+		{"Available", "available"},
+		{"AVAILABLE", "available"},
+		{" available ", "available"},
+		{"Picked-Up", "picked_up"},
+		{"picked up", "picked_up"},
+		{"PickedUp", "picked_up"},
+		{"cancelled", "canceled"},
+		{"parked", "parked"},
+	} {
+		if got := normalizeStatus(false, tc.in); got != tc.lenient {
+			t.Errorf("lenient normalizeStatus(%q) = %q, want %q", tc.in, got, tc.lenient)
+		}
+		if got := normalizeStatus(true, tc.in); got != tc.in {
+			t.Errorf("strict normalizeStatus(%q) = %q, want it unchanged", tc.in, got)
+		}
+	}
+}
+
+func TestDriverStatusSpellings(t *testing.T) {
+	for _, strict := range []bool{true, false} {
+		s := newTestStack(t, func(cfg *stackConfig) { cfg.handler.StrictStatus = strict })
+		s.mustDo(http.StatusOK, http.MethodPost, "/drivers", driverJSON("d1", 37.77, -122.42))
+
+		for _, status := range []string{"Available", "AVAILABLE", " available "} {
+			want := http.StatusBadRequest
+			if !strict {
+				want = http.StatusOK
+			}
+			s.mustDo(http.StatusOK, http.MethodPatch, "/drivers/d1/status", `{"status":"offline"}`)
+			s.mustDo(want, http.MethodPatch, "/drivers/d1/status", fmt.Sprintf(`{"status":%q}`, status))
+			if driver, _ := s.repo.GetDriver("d1"); !strict && driver.Status != models.DriverAvailable {
+				t.Errorf("lenient %q: driver is %s, want available", status, driver.Status)
+			}
+		}
+	}
+}
@@ -1,11 +1,96 @@
 package models
 
-import "time"
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
 
-// Location represents a geographic coordinate
+// Location represents a geographic coordinate. The validate tags on it and
+// the other models are checked by the use cases before anything is stored.
 type Location struct {
-	Lat float64 `json:"lat"`
-	Lon float64 `json:"lon"`
+	Lat float64 `json:"lat" validate:"lat"`
+	Lon float64 `json:"lon" validate:"lon"`
+}
+
+// Bounds is a latitude/longitude box. A box whose MinLon is greater than its
+// MaxLon crosses the antimeridian.
+type Bounds struct {
+	MinLat float64
+	MinLon float64
+	MaxLat float64
+	MaxLon float64
+}
+
+// InBounds reports whether l lies inside b, edges included
+func (l Location) InBounds(b Bounds) bool {
+	if l.Lat < b.MinLat || l.Lat > b.MaxLat {
+		return false
+	}
+	if b.MinLon <= b.MaxLon {
+		return l.Lon >= b.MinLon && l.Lon <= b.MaxLon
+	}
+	return l.Lon >= b.MinLon || l.Lon <= b.MaxLon
+}
+
+// Zone is a named rectangular region of the service area
+type Zone struct {
+	Name   string
+	Bounds Bounds
+}
+
+// ZoneMap resolves locations to zones. Where zones overlap the one listed
+// first wins.
+type ZoneMap []Zone
+
+// Resolve returns the name of the zone containing l, or "" if none does
+func (zm ZoneMap) Resolve(l Location) string {
+	for _, zone := range zm {
+		if l.InBounds(zone.Bounds) {
+			return zone.Name
+		}
+	}
+	return ""
+}
+
+// ParseZones parses a zone map written as
+// "name:minLat,minLon,maxLat,maxLon;name:..." An empty string yields no zones.
+func ParseZones(s string) (ZoneMap, error) {
+	var zones ZoneMap
+	for _, entry := range strings.Split(s, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		name, box, ok := strings.Cut(entry, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("zone %q: expected name:minLat,minLon,maxLat,maxLon", entry)
+		}
+		parts := strings.Split(box, ",")
+		if len(parts) != 4 {
+			return nil, fmt.Errorf("zone %q: expected 4 coordinates, got %d", name, len(parts))
+		}
+		var coords [4]float64
+		for i, part := range parts {
+			value, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+			if err != nil {
+				return nil, fmt.Errorf("zone %q: invalid coordinate %q", name, part)
+			}
+			coords[i] = value
+		}
+
+		bounds := Bounds{MinLat: coords[0], MinLon: coords[1], MaxLat: coords[2], MaxLon: coords[3]}
+		if bounds.MinLat > bounds.MaxLat {
+			return nil, fmt.Errorf("zone %q: minLat is greater than maxLat", name)
+		}
+		zones = append(zones, Zone{Name: name, Bounds: bounds})
+	}
+	return zones, nil
 }
 
 // DriverStatus represents the current status of a driver
@@ -19,11 +104,173 @@ const (
 
 // Driver represents a delivery driver
 type Driver struct {
-	ID        string       `json:"id"`
-	Name      string       `json:"name"`
-	Status    DriverStatus `json:"status"`
-	Location  Location     `json:"location"`
-	UpdatedAt int64        `json:"updated_at"`
+	ID       string       `json:"id" validate:"required"`
+	Name     string       `json:"name" validate:"required"`
+	Status   DriverStatus `json:"status"`
+	Location Location     `json:"location"`
+	// CooldownUntil is the Unix time before which the matcher skips the driver
+	CooldownUntil int64 `json:"cooldown_until,omitempty"`
+	// LocationHistory holds the most recent location updates, oldest first
+	LocationHistory []TimestampedLocation `json:"location_history,omitempty"`
+	// Deleted drivers are kept so orders can still resolve their DriverID,
+	// but are hidden from listings and never matched
+	Deleted   bool  `json:"deleted,omitempty"`
+	DeletedAt int64 `json:"deleted_at,omitempty"`
+	// Simulated marks load-test drivers, which are left out of metrics and
+	// can be purged on their own
+	Simulated bool `json:"simulated,omitempty"`
+	// MaxDailyOrders caps how many orders the driver may be assigned per
+	// local calendar day. Zero means unlimited.
+	MaxDailyOrders int `json:"max_daily_orders,omitempty" validate:"gte=0"`
+	// Capacity is how many assigned or picked-up orders the driver may carry
+	// at once. Zero uses the store's default.
+	Capacity int `json:"capacity,omitempty" validate:"gte=0"`
+	// Zone pins the driver to a zone. Empty means the zone is resolved from
+	// the driver's current location.
+	Zone string `json:"zone,omitempty"`
+	// Rating is the driver's customer rating from 0 to MaxRating, weighed
+	// by the weighted matcher. Zero means unrated.
+	Rating float64 `json:"rating,omitempty" validate:"gte=0,lte=5"`
+	// LastAssignedAt is the Unix time the driver was last given an order
+	LastAssignedAt int64 `json:"last_assigned_at,omitempty"`
+	// OfferLapses counts the offers the driver let expire, decayed as of
+	// OfferLapsedAt, the Unix time of the latest one
+	OfferLapses   float64 `json:"offer_lapses,omitempty" validate:"gte=0"`
+	OfferLapsedAt int64   `json:"offer_lapsed_at,omitempty"`
+	// DailyOrders counts the orders assigned on DailyOrdersDate
+	DailyOrders     int    `json:"daily_orders,omitempty" validate:"gte=0"`
+	DailyOrdersDate string `json:"daily_orders_date,omitempty"`
+	CreatedAt       int64  `json:"created_at"`
+	UpdatedAt       int64  `json:"updated_at"`
+}
+
+// MaxRating is the highest driver rating; keep the rating validate tag in sync
+const MaxRating = 5.0
+
+// Clone returns a deep copy of the driver
+func (d *Driver) Clone() *Driver {
+	driverCopy := *d
+	if d.LocationHistory != nil {
+		driverCopy.LocationHistory = make([]TimestampedLocation, len(d.LocationHistory))
+		copy(driverCopy.LocationHistory, d.LocationHistory)
+	}
+	return &driverCopy
+}
+
+// OrdersOn returns how many orders the driver was assigned on day, as
+// formatted by Day
+func (d *Driver) OrdersOn(day string) int {
+	if d.DailyOrdersDate != day {
+		return 0
+	}
+	return d.DailyOrders
+}
+
+// RemainingDailyOrders returns how many more orders the driver may be
+// assigned on day, or -1 when they have no daily cap
+func (d *Driver) RemainingDailyOrders(day string) int {
+	if d.MaxDailyOrders <= 0 {
+		return -1
+	}
+	return max(d.MaxDailyOrders-d.OrdersOn(day), 0)
+}
+
+// DecayedOfferLapses returns the driver's lapsed offer count at the Unix
+// time now, halved for every halfLife since the latest lapse. A zero
+// halfLife never decays.
+func (d *Driver) DecayedOfferLapses(now int64, halfLife time.Duration) float64 {
+	if d.OfferLapses == 0 || halfLife <= 0 {
+		return d.OfferLapses
+	}
+	elapsed := float64(max(now-d.OfferLapsedAt, 0))
+	return d.OfferLapses * math.Exp2(-elapsed/halfLife.Seconds())
+}
+
+// Day formats the local calendar day of t, used to reset daily counters at
+// midnight
+func Day(t time.Time) string {
+	return t.Format(time.DateOnly)
+}
+
+// TimestampedLocation is a location recorded at a point in time
+type TimestampedLocation struct {
+	Location
+	Timestamp int64 `json:"timestamp"`
+}
+
+// ReleaseReason says why a driver stopped holding an order
+type ReleaseReason string
+
+const (
+	ReleaseDelivered ReleaseReason = "delivered"
+	ReleaseCanceled  ReleaseReason = "canceled"
+	// ReleaseOrphaned is set when the driver was deleted and the order went
+	// back to pending
+	ReleaseOrphaned ReleaseReason = "orphaned"
+	// ReleaseHandedOff is set when another driver took over a picked-up
+	// order mid-route
+	ReleaseHandedOff ReleaseReason = "handed_off"
+)
+
+// AssignmentRecord is one driver's hold on an order. ReleasedAt and Reason
+// stay empty while the driver still holds it.
+type AssignmentRecord struct {
+	DriverID   string        `json:"driver_id"`
+	AssignedAt int64         `json:"assigned_at"`
+	ReleasedAt int64         `json:"released_at,omitempty"`
+	Reason     ReleaseReason `json:"reason,omitempty"`
+}
+
+// DriverTrack represents a driver's recent location history
+type DriverTrack struct {
+	DriverID  string                `json:"driver_id"`
+	Locations []TimestampedLocation `json:"locations"`
+}
+
+// DriverPatch describes a partial driver update; nil fields are left unchanged
+type DriverPatch struct {
+	Name     *string
+	Status   *DriverStatus
+	Location *Location
+}
+
+// DriverPage represents one page of drivers in a cursor-paginated listing
+type DriverPage struct {
+	Drivers    []*Driver `json:"drivers"`
+	NextCursor string    `json:"next_cursor,omitempty"`
+}
+
+// DriverBatchRequest lists the drivers to fetch in one call
+type DriverBatchRequest struct {
+	IDs []string `json:"ids"`
+}
+
+// BundleRequest lists the pending orders to deliver on one trip
+type BundleRequest struct {
+	OrderIDs []string `json:"order_ids"`
+}
+
+// Bundle is a group of orders delivered on one trip
+type Bundle struct {
+	ID       string   `json:"id"`
+	OrderIDs []string `json:"order_ids"`
+}
+
+// DriverLookup is one ID of a batch fetch and the driver found for it
+type DriverLookup struct {
+	ID     string  `json:"id"`
+	Found  bool    `json:"found"`
+	Driver *Driver `json:"driver,omitempty"`
+}
+
+// DriverStats aggregates a driver's order history
+type DriverStats struct {
+	DriverID                string  `json:"driver_id"`
+	DeliveriesCompleted     int     `json:"deliveries_completed"`
+	CanceledAfterAssignment int     `json:"canceled_after_assignment"`
+	TotalAssignedDistanceKm float64 `json:"total_assigned_distance_km"`
+	// OfferLapses is the driver's decayed count of offers let expire
+	OfferLapses float64 `json:"offer_lapses"`
 }
 
 // OrderStatus represents the current status of an order
@@ -35,27 +282,395 @@ const (
 	OrderPickedUp  OrderStatus = "picked_up"
 	OrderDelivered OrderStatus = "delivered"
 	OrderCanceled  OrderStatus = "canceled"
+	// OrderUnmatchable holds orders that failed too many matcher passes
+	OrderUnmatchable OrderStatus = "unmatchable"
+	// OrderOffered holds orders offered to several drivers, waiting for one
+	// to accept before the offer expires
+	OrderOffered OrderStatus = "offered"
 )
 
 // Order represents a customer order
 type Order struct {
-	ID        string      `json:"id"`
-	Customer  string      `json:"customer"`
-	Pickup    Location    `json:"pickup"`
-	Dropoff   Location    `json:"dropoff"`
+	ID       string   `json:"id" validate:"required"`
+	Customer string   `json:"customer" validate:"required"`
+	Pickup   Location `json:"pickup"`
+	Dropoff  Location `json:"dropoff"`
+	// Zone is the zone the order is matched in, given explicitly or resolved
+	// from the pickup at creation
+	Zone string `json:"zone,omitempty"`
+	// PickupHistory holds the pickups the order had before each correction,
+	// oldest first, timestamped with when they were replaced
+	PickupHistory []TimestampedLocation `json:"pickup_history,omitempty"`
+	// DropoffHistory is the same for dropoffs, which may change until pickup
+	DropoffHistory []TimestampedLocation `json:"dropoff_history,omitempty"`
+	// Waypoints are ordered stops between the pickup and the dropoff
+	Waypoints []Location  `json:"waypoints,omitempty" validate:"dive"`
 	Status    OrderStatus `json:"status"`
 	DriverID  string      `json:"driver_id,omitempty"`
-	CreatedAt int64       `json:"created_at"`
-	UpdatedAt int64       `json:"updated_at"`
+	// BundleID groups orders that are delivered on one trip. The pending
+	// orders of a bundle are always assigned together, to the same driver.
+	BundleID string `json:"bundle_id,omitempty"`
+	// AssignmentHistory lists every driver who has held the order, oldest
+	// first
+	AssignmentHistory []AssignmentRecord `json:"assignment_history,omitempty"`
+	// AssignmentDistanceKm is how far the driver was from the pickup when assigned
+	AssignmentDistanceKm float64 `json:"assignment_distance_km,omitempty"`
+	Notes                string  `json:"notes,omitempty"`
+	Contactless          bool    `json:"contactless"`
+	// Price is the estimated fare, computed from the route distance at creation
+	Price float64 `json:"price"`
+	// Tags are free-form labels such as "vip" or "fragile"
+	Tags []string `json:"tags,omitempty"`
+	// MatchAttempts counts matcher passes that left the order unmatched
+	MatchAttempts int `json:"match_attempts,omitempty"`
+	// ScheduledFor is the Unix time before which the order must not be matched
+	ScheduledFor int64 `json:"scheduled_for,omitempty"`
+	// OfferedTo lists the drivers an offered order is waiting on, and
+	// OfferExpiresAt is the Unix time their offers lapse
+	OfferedTo      []string `json:"offered_to,omitempty"`
+	OfferExpiresAt int64    `json:"offer_expires_at,omitempty"`
+	// OfferQueue lists, best first, the ranked drivers still waiting to be
+	// offered the order should the current offers expire
+	OfferQueue []string `json:"offer_queue,omitempty"`
+	// CancelReason is the reason code given when the order was canceled
+	CancelReason string `json:"cancel_reason,omitempty"`
+	// StatusChangedAt is when the order entered its current status
+	StatusChangedAt int64 `json:"status_changed_at,omitempty"`
+	// Simulated marks load-test orders, which are left out of metrics and
+	// can be purged on their own
+	Simulated bool  `json:"simulated,omitempty"`
+	CreatedAt int64 `json:"created_at"`
+	UpdatedAt int64 `json:"updated_at"`
+}
+
+// Clone returns a deep copy of the order
+func (o *Order) Clone() *Order {
+	orderCopy := *o
+	if o.Waypoints != nil {
+		orderCopy.Waypoints = make([]Location, len(o.Waypoints))
+		copy(orderCopy.Waypoints, o.Waypoints)
+	}
+	if o.Tags != nil {
+		orderCopy.Tags = make([]string, len(o.Tags))
+		copy(orderCopy.Tags, o.Tags)
+	}
+	if o.PickupHistory != nil {
+		orderCopy.PickupHistory = make([]TimestampedLocation, len(o.PickupHistory))
+		copy(orderCopy.PickupHistory, o.PickupHistory)
+	}
+	if o.DropoffHistory != nil {
+		orderCopy.DropoffHistory = make([]TimestampedLocation, len(o.DropoffHistory))
+		copy(orderCopy.DropoffHistory, o.DropoffHistory)
+	}
+	if o.AssignmentHistory != nil {
+		orderCopy.AssignmentHistory = make([]AssignmentRecord, len(o.AssignmentHistory))
+		copy(orderCopy.AssignmentHistory, o.AssignmentHistory)
+	}
+	if o.OfferedTo != nil {
+		orderCopy.OfferedTo = make([]string, len(o.OfferedTo))
+		copy(orderCopy.OfferedTo, o.OfferedTo)
+	}
+	if o.OfferQueue != nil {
+		orderCopy.OfferQueue = make([]string, len(o.OfferQueue))
+		copy(orderCopy.OfferQueue, o.OfferQueue)
+	}
+	return &orderCopy
+}
+
+// HasTags reports whether the order carries every one of tags
+func (o *Order) HasTags(tags []string) bool {
+	for _, tag := range tags {
+		if !slices.Contains(o.Tags, tag) {
+			return false
+		}
+	}
+	return true
+}
+
+// OrderPatch describes a partial order update; nil fields are left unchanged
+type OrderPatch struct {
+	Pickup  *Location
+	Dropoff *Location
+	Notes   *string
+	// Zone replaces the order's zone along with a new pickup
+	Zone *string
+}
+
+// OrderFilter narrows an order listing; zero fields don't filter
+type OrderFilter struct {
+	// Tags keeps orders carrying every one of the tags
+	Tags []string
+	// DeliveredAfter and DeliveredBefore keep only delivered orders whose
+	// delivery, as a Unix timestamp, is at or after DeliveredAfter and
+	// before DeliveredBefore
+	DeliveredAfter  int64
+	DeliveredBefore int64
+}
+
+// Delivered reports whether the filter asks for a delivery window
+func (f OrderFilter) Delivered() bool {
+	return f.DeliveredAfter != 0 || f.DeliveredBefore != 0
+}
+
+// Matches reports whether order passes the filter. An order's delivery time
+// is when it last changed status, which for a delivered order is final.
+func (f OrderFilter) Matches(order *Order) bool {
+	if !order.HasTags(f.Tags) {
+		return false
+	}
+	if !f.Delivered() {
+		return true
+	}
+	if order.Status != OrderDelivered || order.StatusChangedAt == 0 {
+		return false
+	}
+	return order.StatusChangedAt >= f.DeliveredAfter &&
+		(f.DeliveredBefore == 0 || order.StatusChangedAt < f.DeliveredBefore)
+}
+
+// CanEditOrderStatus reports whether an order's route and notes may still
+// change, which is only the case before pickup
+func CanEditOrderStatus(status OrderStatus) bool {
+	return status == OrderPending || status == OrderAssigned
+}
+
+// OrderPage represents one page of orders in an offset-paginated listing
+type OrderPage struct {
+	Orders []*Order `json:"orders"`
+	Offset int      `json:"offset"`
+	Total  int      `json:"total"`
+}
+
+// ETA represents the estimated time remaining for an order in transit
+type ETA struct {
+	OrderID          string      `json:"order_id"`
+	DriverID         string      `json:"driver_id"`
+	Status           OrderStatus `json:"status"`
+	DistanceKm       float64     `json:"distance_km"`
+	RemainingMinutes float64     `json:"remaining_minutes"`
+	ComputedAt       int64       `json:"computed_at"`
 }
 
 // StateSnapshot represents a complete snapshot of the system state
 type StateSnapshot struct {
 	Drivers   map[string]*Driver `json:"drivers"`
 	Orders    map[string]*Order  `json:"orders"`
+	Version   uint64             `json:"version"`
 	Timestamp int64              `json:"timestamp"`
 }
 
+// AssignmentDistanceStats summarizes how far drivers travel to reach pickups
+type AssignmentDistanceStats struct {
+	Count     int64   `json:"count"`
+	AverageKm float64 `json:"average_km"`
+	P95Km     float64 `json:"p95_km"`
+}
+
+// LockWaitHistogram is the distribution of how long operations waited for
+// one side ("read" or "write") of the store's lock
+type LockWaitHistogram struct {
+	Mode       string            `json:"mode"`
+	Buckets    []HistogramBucket `json:"buckets"`
+	Count      uint64            `json:"count"`
+	SumSeconds float64           `json:"sum_seconds"`
+}
+
+// HistogramBucket counts the observations up to UpperBound, cumulatively
+type HistogramBucket struct {
+	UpperBound float64 `json:"upper_bound"`
+	Count      uint64  `json:"count"`
+}
+
+// CircuitBreakerStatus describes the matcher's circuit breaker
+type CircuitBreakerStatus struct {
+	State               string `json:"state"`
+	ConsecutiveFailures int    `json:"consecutive_failures"`
+	OpenedAt            int64  `json:"opened_at,omitempty"`
+}
+
+// MatcherRun describes one matcher pass
+type MatcherRun struct {
+	StartedAt        int64 `json:"started_at"`
+	DurationMs       int64 `json:"duration_ms"`
+	PendingOrders    int   `json:"pending_orders"`
+	AvailableDrivers int   `json:"available_drivers"`
+	Assigned         int   `json:"assigned"`
+	Failed           int   `json:"failed"`
+	// Released counts assigned orders returned to pending because their
+	// driver was deleted
+	Released int `json:"released"`
+	// Skipped is set when the circuit breaker was open and the pass did nothing
+	Skipped bool `json:"skipped"`
+}
+
+// ReadView gives consistent lookups inside a repository read transaction.
+// Driver and Order return copies; EachDriver and EachOrder pass the stored
+// entities, which fn must not modify or retain.
+type ReadView interface {
+	Driver(id string) (*Driver, error)
+	Order(id string) (*Order, error)
+	EachDriver(fn func(driver *Driver))
+	EachOrder(fn func(order *Order))
+	Version() uint64
+}
+
+// AuditEvent records one state-changing API request
+type AuditEvent struct {
+	Timestamp int64  `json:"timestamp"`
+	Method    string `json:"method"`
+	// Route is the matched route pattern, such as /orders/:id/status, and
+	// Path the requested path
+	Route    string `json:"route"`
+	Path     string `json:"path"`
+	Status   int    `json:"status"`
+	ClientIP string `json:"client_ip"`
+	// Reason is the reason code the request gave, such as a cancel reason
+	Reason string `json:"reason,omitempty"`
+	// Notes and Contactless are the delivery instructions an order was
+	// created or patched with, if any
+	Notes       string `json:"notes,omitempty"`
+	Contactless bool   `json:"contactless,omitempty"`
+}
+
+// AuditLog lists audit events, oldest first
+type AuditLog struct {
+	Events []AuditEvent `json:"events"`
+}
+
+// ScoreWeights are the weights of the weighted matcher's score components
+type ScoreWeights struct {
+	Distance float64 `json:"distance"`
+	Rating   float64 `json:"rating"`
+	Age      float64 `json:"age"`
+	Heading  float64 `json:"heading"`
+}
+
+// MatcherStatus reports the matcher's live configuration and last pass.
+// Durations are formatted like the settings that configure them.
+type MatcherStatus struct {
+	Mode               string       `json:"mode"`
+	Interval           string       `json:"interval,omitempty"`
+	Workers            int          `json:"workers"`
+	MaxDistanceKm      float64      `json:"max_distance_km"`
+	AgingWeight        float64      `json:"aging_weight"`
+	MaxMatchAttempts   int          `json:"max_match_attempts"`
+	BalanceToleranceKm float64      `json:"balance_tolerance_km"`
+	BalanceWindow      string       `json:"balance_window"`
+	Weights            ScoreWeights `json:"weights"`
+	OfferDrivers       int          `json:"offer_drivers"`
+	OfferTTL           string       `json:"offer_ttl"`
+	// OffersRenewed counts offers passed on to the next ranked drivers
+	// after no driver accepted in time, and OffersExpired the offered
+	// orders moved to unmatchable once the ranked drivers ran out
+	OffersRenewed int64                `json:"offers_renewed"`
+	OffersExpired int64                `json:"offers_expired"`
+	LastRun       *MatcherRun          `json:"last_run,omitempty"`
+	Breaker       CircuitBreakerStatus `json:"breaker"`
+}
+
+// Health statuses reported by health checks
+const (
+	HealthOK       = "ok"
+	HealthDegraded = "degraded"
+)
+
+// MatcherHealth reports whether the background matcher is still ticking
+type MatcherHealth struct {
+	Status string `json:"status"`
+	// LastHeartbeat is the Unix time the matcher last started or finished a
+	// pass, and StaleAfter how long it may go quiet before it is degraded
+	LastHeartbeat int64  `json:"last_heartbeat,omitempty"`
+	Interval      string `json:"interval,omitempty"`
+	StaleAfter    string `json:"stale_after,omitempty"`
+}
+
+// SimulateMovementRequest starts the movement simulation. A zero SpeedKmh
+// uses the configured driver speed.
+type SimulateMovementRequest struct {
+	SpeedKmh float64 `json:"speed_kmh" validate:"gte=0"`
+}
+
+// MovementSimulation reports whether simulated drivers are being moved
+type MovementSimulation struct {
+	Running   bool    `json:"running"`
+	SpeedKmh  float64 `json:"speed_kmh,omitempty"`
+	Tick      string  `json:"tick,omitempty"`
+	StartedAt int64   `json:"started_at,omitempty"`
+}
+
+// ResetResult reports how much state a reset cleared
+type ResetResult struct {
+	DriversCleared int   `json:"drivers_cleared"`
+	OrdersCleared  int   `json:"orders_cleared"`
+	Timestamp      int64 `json:"timestamp"`
+}
+
+// RestoreResult reports how much state a restore loaded
+type RestoreResult struct {
+	DriversRestored int    `json:"drivers_restored"`
+	OrdersRestored  int    `json:"orders_restored"`
+	Version         uint64 `json:"version"`
+}
+
+// MatchResult reports the outcome of an on-demand matcher pass
+type MatchResult struct {
+	Assigned int `json:"assigned"`
+	// AssignedOrders and FailedOrders are the pass's per-order outcomes
+	AssignedOrders []MatchOutcome `json:"assigned_orders"`
+	FailedOrders   []MatchOutcome `json:"failed_orders"`
+	BreakerState   string         `json:"breaker_state"`
+	Timestamp      int64          `json:"timestamp"`
+}
+
+// MatchOutcome is what a matcher pass did with one order: the driver it was
+// assigned to, or why it was left unassigned
+type MatchOutcome struct {
+	OrderID    string  `json:"order_id"`
+	DriverID   string  `json:"driver_id,omitempty"`
+	DistanceKm float64 `json:"distance_km,omitempty"`
+	// Reason is the error code of the last failure, such as
+	// NO_ELIGIBLE_DRIVER or DRIVER_NOT_AVAILABLE
+	Reason string `json:"reason,omitempty"`
+}
+
+// MatchReport lists the ready orders a matcher pass assigned and the ones
+// it left unassigned, each sorted by order ID. Both are empty when the
+// circuit breaker skipped the pass.
+type MatchReport struct {
+	Assigned []MatchOutcome `json:"assigned"`
+	Failed   []MatchOutcome `json:"failed"`
+}
+
+// SeedRequest lists drivers and orders to load with their given statuses
+type SeedRequest struct {
+	Drivers []*Driver `json:"drivers"`
+	Orders  []*Order  `json:"orders"`
+}
+
+// SeedResult reports how much state a seed added
+type SeedResult struct {
+	DriversSeeded int `json:"drivers_seeded"`
+	OrdersSeeded  int `json:"orders_seeded"`
+}
+
+// StuckOrders counts orders that have stayed in a status longer than its
+// configured threshold
+type StuckOrders struct {
+	Assigned int `json:"assigned"`
+	PickedUp int `json:"picked_up"`
+}
+
+// DebugSummary represents aggregate counts and metrics about the system
+type DebugSummary struct {
+	DriversByStatus    map[DriverStatus]int    `json:"drivers_by_status"`
+	OrdersByStatus     map[OrderStatus]int     `json:"orders_by_status"`
+	StuckOrders        StuckOrders             `json:"stuck_orders"`
+	AssignmentDistance AssignmentDistanceStats `json:"assignment_distance"`
+	MatchRatePerMinute float64                 `json:"match_rate_per_minute"`
+	MatcherBreaker     CircuitBreakerStatus    `json:"matcher_breaker"`
+	Timestamp          int64                   `json:"timestamp"`
+}
+
 // ===== Utility Functions =====
 
 // IsValidDriverStatus checks if a driver status is valid
@@ -70,21 +685,28 @@ func IsValidDriverStatus(status DriverStatus) bool {
 // IsValidOrderStatus checks if an order status is valid
 func IsValidOrderStatus(status OrderStatus) bool {
 	switch status {
-	case OrderPending, OrderAssigned, OrderPickedUp, OrderDelivered, OrderCanceled:
+	case OrderPending, OrderAssigned, OrderPickedUp, OrderDelivered, OrderCanceled, OrderUnmatchable, OrderOffered:
 		return true
 	}
 	return false
 }
 
+// IsTerminalOrderStatus reports whether an order status is final
+func IsTerminalOrderStatus(status OrderStatus) bool {
+	return status == OrderDelivered || status == OrderCanceled
+}
+
 // CanTransitionOrderStatus checks if an order status transition is valid
 func CanTransitionOrderStatus(from, to OrderStatus) bool {
 	// Define valid state transitions
 	validTransitions := map[OrderStatus][]OrderStatus{
-		OrderPending:   {OrderAssigned, OrderCanceled},
-		OrderAssigned:  {OrderPickedUp, OrderCanceled},
-		OrderPickedUp:  {OrderDelivered, OrderCanceled},
-		OrderDelivered: {},
-		OrderCanceled:  {},
+		OrderPending:     {OrderAssigned, OrderCanceled, OrderUnmatchable, OrderOffered},
+		OrderAssigned:    {OrderPickedUp, OrderCanceled},
+		OrderPickedUp:    {OrderDelivered, OrderCanceled},
+		OrderDelivered:   {},
+		OrderCanceled:    {},
+		OrderUnmatchable: {OrderPending, OrderCanceled},
+		OrderOffered:     {OrderAssigned, OrderPending, OrderCanceled, OrderUnmatchable},
 	}
 
 	allowedStates, ok := validTransitions[from]
@@ -100,6 +722,74 @@ func CanTransitionOrderStatus(from, to OrderStatus) bool {
 	return false
 }
 
+// earthRadiusKm is the mean radius of the Earth in kilometers
+const earthRadiusKm = 6371.0
+
+// DistanceKm returns the great-circle distance between two locations in kilometers
+func DistanceKm(a, b Location) float64 {
+	lat1 := a.Lat * math.Pi / 180
+	lat2 := b.Lat * math.Pi / 180
+	dLat := (b.Lat - a.Lat) * math.Pi / 180
+	dLon := (b.Lon - a.Lon) * math.Pi / 180
+
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(h))
+}
+
+// Units that distances can be reported in
+const (
+	UnitKilometers = "km"
+	UnitMiles      = "mi"
+)
+
+// kmPerMile is the length of a statute mile in kilometers
+const kmPerMile = 1.609344
+
+// KmTo converts a distance in kilometers to unit, UnitKilometers or UnitMiles
+func KmTo(km float64, unit string) float64 {
+	if unit == UnitMiles {
+		return km / kmPerMile
+	}
+	return km
+}
+
+// Bearing returns the initial compass bearing from a to b in degrees,
+// clockwise from north in [0, 360)
+func Bearing(a, b Location) float64 {
+	lat1 := a.Lat * math.Pi / 180
+	lat2 := b.Lat * math.Pi / 180
+	dLon := (b.Lon - a.Lon) * math.Pi / 180
+
+	y := math.Sin(dLon) * math.Cos(lat2)
+	x := math.Cos(lat1)*math.Sin(lat2) - math.Sin(lat1)*math.Cos(lat2)*math.Cos(dLon)
+	return math.Mod(math.Atan2(y, x)*180/math.Pi+360, 360)
+}
+
+// Heading returns the bearing of the driver's last movement, between the last
+// two entries of their location history. ok is false when fewer than two
+// entries are kept or the driver did not move between them.
+func (d *Driver) Heading() (bearing float64, ok bool) {
+	n := len(d.LocationHistory)
+	if n < 2 {
+		return 0, false
+	}
+	from, to := d.LocationHistory[n-2].Location, d.LocationHistory[n-1].Location
+	if from == to {
+		return 0, false
+	}
+	return Bearing(from, to), true
+}
+
+// RouteDistanceKm returns the total distance of visiting stops in order
+func RouteDistanceKm(stops ...Location) float64 {
+	total := 0.0
+	for i := 1; i < len(stops); i++ {
+		total += DistanceKm(stops[i-1], stops[i])
+	}
+	return total
+}
+
 // GetCurrentTimestamp returns the current Unix timestamp
 func GetCurrentTimestamp() int64 {
 	return time.Now().Unix()
@@ -0,0 +1,93 @@
+package models
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestParseZones(t *testing.T) {
+	zones, err := ParseZones(" north: 37.78,-122.52,37.82,-122.35 ; south:37.70,-122.52,37.78,-122.35;")
+	if err != nil {
+		t.Fatalf("ParseZones: %v", err)
+	}
+	want := ZoneMap{
+		{Name: "north", Bounds: Bounds{MinLat: 37.78, MinLon: -122.52, MaxLat: 37.82, MaxLon: -122.35}},
+		{Name: "south", Bounds: Bounds{MinLat: 37.70, MinLon: -122.52, MaxLat: 37.78, MaxLon: -122.35}},
+	}
+	if !reflect.DeepEqual(zones, want) {
+		t.Errorf("zones = %+v, want %+v", zones, want)
+	}
+
+	for _, tc := range []struct {
+		loc  Location
+		want string
+	}{
+		{Location{Lat: 37.80, Lon: -122.42}, "north"},
+		{Location{Lat: 37.75, Lon: -122.42}, "south"},
+		// On the shared edge the zone listed first wins
+		{Location{Lat: 37.78, Lon: -122.42}, "north"},
+		{Location{Lat: 40.71, Lon: -74.00}, ""},
+	} {
+		if got := zones.Resolve(tc.loc); got != tc.want {
+			t.Errorf("Resolve(%v) = %q, want %q", tc.loc, got, tc.want)
+		}
+	}
+
+	if zones, err := ParseZones(""); err != nil || zones != nil {
+		t.Errorf("ParseZones(\"\") = %v, %v; want no zones", zones, err)
+	}
+	for _, bad := range []string{
+		"north",
+		":37.78,-122.52,37.82,-122.35",
+		"north:37.78,-122.52,37.82",
+		"north:37.78,west,37.82,-122.35",
+		"north:37.82,-122.52,37.78,-122.35",
+	} {
+		if _, err := ParseZones(bad); err == nil {
+			t.Errorf("ParseZones(%q) accepted a malformed zone", bad)
+		}
+	}
+}
+
+func TestDriverHeading(t *testing.T) {
+	at := func(lat, lon float64) TimestampedLocation {
+		return TimestampedLocation{Location: Location{Lat: lat, Lon: lon}}
+	}
+	for _, tc := range []struct {
+		name    string
+		history []TimestampedLocation
+		want    float64
+		ok      bool
+	}{
+		{"no history", nil, 0, false},
+		{"one point", []TimestampedLocation{at(37.77, -122.42)}, 0, false},
+		{"standing still", []TimestampedLocation{at(37.77, -122.42), at(37.77, -122.42)}, 0, false},
+		{"north", []TimestampedLocation{at(37.70, -122.50), at(37.76, -122.42), at(37.77, -122.42)}, 0, true},
+		{"east", []TimestampedLocation{at(0, 10), at(0, 11)}, 90, true},
+		{"south", []TimestampedLocation{at(37.77, -122.42), at(37.76, -122.42)}, 180, true},
+		{"west", []TimestampedLocation{at(0, 11), at(0, 10)}, 270, true},
+	} {
+		driver := Driver{LocationHistory: tc.history}
+		got, ok := driver.Heading()
+		if ok != tc.ok || math.Abs(got-tc.want) > 1e-6 {
+			t.Errorf("%s: Heading() = %v, %v; want %v, %v", tc.name, got, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestKmTo(t *testing.T) {
+	for _, tc := range []struct {
+		km   float64
+		unit string
+		want float64
+	}{
+		{8.04672, UnitKilometers, 8.04672},
+		{8.04672, UnitMiles, 5},
+		{0, UnitMiles, 0},
+	} {
+		if got := KmTo(tc.km, tc.unit); math.Abs(got-tc.want) > 1e-9 {
+			t.Errorf("KmTo(%v, %s) = %v, want %v", tc.km, tc.unit, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package repository
+
+import (
+	"bufio"
+	"bytes"
+	"delivery-state-manager/internal/models"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// auditQueueSize is how many events may wait for the background writer
+// before new ones are dropped from the file
+const auditQueueSize = 1024
+
+// AuditConfig holds the audit log settings
+type AuditConfig struct {
+	// Path is the JSONL file events are appended to. Empty keeps them in
+	// memory only.
+	Path string
+	// Size is how many of the most recent events are kept in memory
+	Size int
+	// FlushInterval is how often buffered events are written to the file.
+	// Zero writes each event as soon as it is recorded.
+	FlushInterval time.Duration
+}
+
+// AuditLog keeps the most recent audit events in memory and, when a path is
+// configured, appends every event to a JSONL file. File writes happen on a
+// background goroutine fed by a buffered channel, so Record never waits on
+// disk; when the writer falls behind, events are dropped from the file but
+// still kept in memory.
+type AuditLog struct {
+	mu      sync.Mutex
+	events  []models.AuditEvent
+	size    int
+	dropped int
+
+	queue chan models.AuditEvent
+	done  chan struct{}
+}
+
+// NewAuditLog creates an audit log. With a path, the last Size events in
+// the file are loaded back into memory and the file is opened for appending.
+func NewAuditLog(cfg AuditConfig) (*AuditLog, error) {
+	al := &AuditLog{size: max(cfg.Size, 1)}
+	if cfg.Path == "" {
+		return al, nil
+	}
+
+	events, err := ReadAuditLog(cfg.Path, al.size)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	al.events = events
+
+	file, err := os.OpenFile(cfg.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open audit log: %w", err)
+	}
+	al.queue = make(chan models.AuditEvent, auditQueueSize)
+	al.done = make(chan struct{})
+	go al.write(al.queue, file, cfg.FlushInterval)
+	return al, nil
+}
+
+// Record adds an event without blocking on the file
+func (al *AuditLog) Record(event models.AuditEvent) {
+	al.mu.Lock()
+	defer al.mu.Unlock()
+
+	al.events = append(al.events, event)
+	if len(al.events) > al.size {
+		al.events = al.events[len(al.events)-al.size:]
+	}
+
+	if al.queue == nil {
+		return
+	}
+	select {
+	case al.queue <- event:
+	default:
+		al.dropped++
+		if al.dropped == 1 || al.dropped%1000 == 0 {
+			log.Printf("Audit log writer is behind, %d events not persisted", al.dropped)
+		}
+	}
+}
+
+// Recent returns up to limit of the most recent events, oldest first.
+// A limit of zero or less returns every event kept in memory.
+func (al *AuditLog) Recent(limit int) []models.AuditEvent {
+	al.mu.Lock()
+	defer al.mu.Unlock()
+
+	events := al.events
+	if limit > 0 && len(events) > limit {
+		events = events[len(events)-limit:]
+	}
+	out := make([]models.AuditEvent, len(events))
+	copy(out, events)
+	return out
+}
+
+// Close stops accepting file writes and waits for queued events to be
+// written. Events recorded after Close are kept in memory only.
+func (al *AuditLog) Close() {
+	al.mu.Lock()
+	queue := al.queue
+	al.queue = nil
+	al.mu.Unlock()
+
+	if queue == nil {
+		return
+	}
+	close(queue)
+	<-al.done
+}
+
+// write appends events from queue to file, flushing after each one or every
+// flushInterval, until queue is closed. It takes queue rather than reading
+// al.queue, which Close clears before closing the channel.
+func (al *AuditLog) write(queue <-chan models.AuditEvent, file *os.File, flushInterval time.Duration) {
+	defer close(al.done)
+	defer file.Close()
+
+	w := bufio.NewWriter(file)
+	flush := func() {
+		if err := w.Flush(); err != nil {
+			log.Printf("Failed to write audit log: %v", err)
+		}
+	}
+	defer flush()
+
+	var tick <-chan time.Time
+	if flushInterval > 0 {
+		ticker := time.NewTicker(flushInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case event, ok := <-queue:
+			if !ok {
+				return
+			}
+			line, err := json.Marshal(event)
+			if err != nil {
+				log.Printf("Failed to encode audit event: %v", err)
+				continue
+			}
+			w.Write(append(line, '\n'))
+			if flushInterval <= 0 {
+				flush()
+			}
+		case <-tick:
+			flush()
+		}
+	}
+}
+
+// ReadAuditLog returns the last limit events of the JSONL audit log at path,
+// oldest first, or every event when limit is zero or less. A torn or
+// unreadable line, such as one cut short by a crash, is skipped.
+func ReadAuditLog(path string, limit int) ([]models.AuditEvent, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var events []models.AuditEvent
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return nil, fmt.Errorf("read audit log: %w", err)
+		}
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			var event models.AuditEvent
+			if jsonErr := json.Unmarshal(line, &event); jsonErr != nil {
+				log.Printf("Skipping unreadable audit event in %s: %v", path, jsonErr)
+			} else {
+				events = append(events, event)
+				if limit > 0 && len(events) > 2*limit {
+					events = append(events[:0], events[len(events)-limit:]...)
+				}
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+
+	if limit > 0 && len(events) > limit {
+		events = events[len(events)-limit:]
+	}
+	return events, nil
+}
@@ -0,0 +1,105 @@
+package repository
+
+import (
+	"delivery-state-manager/internal/models"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// auditEvent is a recorded request to path
+func auditEvent(i int) models.AuditEvent {
+	return models.AuditEvent{
+		Timestamp: 1700000000 + int64(i),
+		Method:    "POST",
+		Route:     "/orders/:id/cancel",
+		Path:      fmt.Sprintf("/orders/o%d/cancel", i),
+		Status:    200,
+		ClientIP:  "10.0.0.1",
+		Reason:    "customer_request",
+	}
+}
+
+// openAuditLog opens an audit log at path, failing the test on error
+func openAuditLog(t *testing.T, cfg AuditConfig) *AuditLog {
+	t.Helper()
+	al, err := NewAuditLog(cfg)
+	if err != nil {
+		t.Fatalf("NewAuditLog: %v", err)
+	}
+	t.Cleanup(al.Close)
+	return al
+}
+
+func TestAuditLogPersistsEvents(t *testing.T) {
+	for _, flush := range []time.Duration{0, time.Hour} {
+		path := filepath.Join(t.TempDir(), "audit.jsonl")
+		al := openAuditLog(t, AuditConfig{Path: path, Size: 3, FlushInterval: flush})
+		var want []models.AuditEvent
+		for i := range 5 {
+			al.Record(auditEvent(i))
+			want = append(want, auditEvent(i))
+		}
+		// Closing writes out whatever a batched flush still holds
+		al.Close()
+
+		got, err := ReadAuditLog(path, 0)
+		if err != nil {
+			t.Fatalf("flush %v: ReadAuditLog: %v", flush, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("flush %v: file holds %+v, want %+v", flush, got, want)
+		}
+
+		// Reopening loads the last Size events back and appends after them
+		reopened := openAuditLog(t, AuditConfig{Path: path, Size: 3, FlushInterval: flush})
+		if recent := reopened.Recent(0); !reflect.DeepEqual(recent, want[2:]) {
+			t.Errorf("flush %v: reopened log holds %+v, want the last 3 events", flush, recent)
+		}
+		reopened.Record(auditEvent(5))
+		reopened.Close()
+		if got, _ := ReadAuditLog(path, 2); !reflect.DeepEqual(got, []models.AuditEvent{auditEvent(4), auditEvent(5)}) {
+			t.Errorf("flush %v: last 2 events in the file = %+v, want events 4 and 5", flush, got)
+		}
+	}
+}
+
+func TestReadAuditLogSkipsTornLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	al := openAuditLog(t, AuditConfig{Path: path, Size: 10})
+	al.Record(auditEvent(0))
+	al.Record(auditEvent(1))
+	al.Close()
+
+	// A crash mid-write leaves the last line cut short
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString(`{"timestamp":1700000002,"meth`)
+	file.Close()
+
+	got, err := ReadAuditLog(path, 0)
+	if err != nil {
+		t.Fatalf("ReadAuditLog: %v", err)
+	}
+	if want := []models.AuditEvent{auditEvent(0), auditEvent(1)}; !reflect.DeepEqual(got, want) {
+		t.Errorf("events = %+v, want the two whole ones", got)
+	}
+}
+
+func TestAuditLogInMemoryOnly(t *testing.T) {
+	al := openAuditLog(t, AuditConfig{Size: 2})
+	for i := range 3 {
+		al.Record(auditEvent(i))
+	}
+	if got := al.Recent(1); !reflect.DeepEqual(got, []models.AuditEvent{auditEvent(2)}) {
+		t.Errorf("Recent(1) = %+v, want the last event", got)
+	}
+	if got := al.Recent(0); len(got) != 2 {
+		t.Errorf("log keeps %d events, want Size 2", len(got))
+	}
+}
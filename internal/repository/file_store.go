@@ -0,0 +1,400 @@
+package repository
+
+import (
+	"delivery-state-manager/internal/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+)
+
+// defaultCompactAfter is used when Config.CompactAfter is not positive
+const defaultCompactAfter = 1000
+
+// FileStore is a Store that keeps state in memory and persists it as a JSON
+// snapshot plus a write-ahead log. Every mutation appends the entities it
+// changed to the log, and the log is folded into a fresh snapshot once it
+// holds CompactAfter records, so a crash loses no acknowledged mutation.
+type FileStore struct {
+	*StateManager
+	path    string
+	walPath string
+	// mu serializes log appends and snapshot writes so records reach the log
+	// in the order the state they describe was read
+	mu           sync.Mutex
+	wal          *os.File
+	walRecords   int
+	compactAfter int
+}
+
+// NewFileStore creates a FileStore backed by path and path+".wal", loading
+// the last snapshot and replaying any logged mutations made after it
+func NewFileStore(path string, cfg Config) (Store, error) {
+	fs := &FileStore{
+		StateManager: newStateManager(cfg),
+		path:         path,
+		walPath:      path + ".wal",
+		compactAfter: cfg.CompactAfter,
+	}
+	if fs.compactAfter <= 0 {
+		fs.compactAfter = defaultCompactAfter
+	}
+
+	var snapshotVersion uint64
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		var snapshot models.StateSnapshot
+		if err := json.Unmarshal(data, &snapshot); err != nil {
+			return nil, fmt.Errorf("decode state file: %w", err)
+		}
+		fs.restore(snapshot)
+		snapshotVersion = snapshot.Version
+		log.Printf("Loaded %d drivers and %d orders from %s", len(snapshot.Drivers), len(snapshot.Orders), path)
+	case !errors.Is(err, os.ErrNotExist):
+		return nil, fmt.Errorf("read state file: %w", err)
+	}
+
+	if err := fs.openWAL(snapshotVersion); err != nil {
+		return nil, err
+	}
+	return fs, nil
+}
+
+// CreateOrUpdateDriver creates or updates a driver and logs the change
+func (fs *FileStore) CreateOrUpdateDriver(driver *models.Driver) error {
+	if err := fs.StateManager.CreateOrUpdateDriver(driver); err != nil {
+		return err
+	}
+	fs.logPut([]string{driver.ID}, nil)
+	return nil
+}
+
+// UpdateDriverStatus updates a driver's status and logs the change
+func (fs *FileStore) UpdateDriverStatus(id string, status models.DriverStatus) error {
+	if err := fs.StateManager.UpdateDriverStatus(id, status); err != nil {
+		return err
+	}
+	fs.logPut([]string{id}, nil)
+	return nil
+}
+
+// PatchDriver partially updates a driver and logs the change
+func (fs *FileStore) PatchDriver(id string, patch models.DriverPatch) (*models.Driver, error) {
+	driver, err := fs.StateManager.PatchDriver(id, patch)
+	if err != nil {
+		return nil, err
+	}
+	fs.logPut([]string{id}, nil)
+	return driver, nil
+}
+
+// SetDriverCooldown sets a driver's cooldown and logs the change
+func (fs *FileStore) SetDriverCooldown(id string, until int64) error {
+	if err := fs.StateManager.SetDriverCooldown(id, until); err != nil {
+		return err
+	}
+	fs.logPut([]string{id}, nil)
+	return nil
+}
+
+// CompareAndSetDriverStatus conditionally updates a driver's status and logs the change
+func (fs *FileStore) CompareAndSetDriverStatus(id string, expected, status models.DriverStatus) error {
+	if err := fs.StateManager.CompareAndSetDriverStatus(id, expected, status); err != nil {
+		return err
+	}
+	fs.logPut([]string{id}, nil)
+	return nil
+}
+
+// SetDriverAvailability toggles a driver's availability and logs the change
+func (fs *FileStore) SetDriverAvailability(id string, status models.DriverStatus) ([]string, error) {
+	activeOrderIDs, err := fs.StateManager.SetDriverAvailability(id, status)
+	if err != nil {
+		return activeOrderIDs, err
+	}
+	fs.logPut([]string{id}, nil)
+	return nil, nil
+}
+
+// DeleteDriver soft-deletes a driver and logs the change
+func (fs *FileStore) DeleteDriver(id string) ([]string, error) {
+	activeOrderIDs, err := fs.StateManager.DeleteDriver(id)
+	if err != nil {
+		return activeOrderIDs, err
+	}
+	fs.logPut([]string{id}, nil)
+	return nil, nil
+}
+
+// CreateOrder creates an order and logs the change
+func (fs *FileStore) CreateOrder(order *models.Order) error {
+	if err := fs.StateManager.CreateOrder(order); err != nil {
+		return err
+	}
+	fs.logPut(nil, []string{order.ID})
+	return nil
+}
+
+// UpdateOrderStatus updates an order's status and logs the change
+func (fs *FileStore) UpdateOrderStatus(id string, status models.OrderStatus) error {
+	if err := fs.StateManager.UpdateOrderStatus(id, status); err != nil {
+		return err
+	}
+	fs.logPut(nil, []string{id})
+	return nil
+}
+
+// CancelOrder cancels an order with a reason and logs the change
+func (fs *FileStore) CancelOrder(id, reason string) error {
+	if err := fs.StateManager.CancelOrder(id, reason); err != nil {
+		return err
+	}
+	fs.logPut(nil, []string{id})
+	return nil
+}
+
+// PatchOrder partially updates an order and logs the change
+func (fs *FileStore) PatchOrder(id string, patch models.OrderPatch, price func(order *models.Order) float64) (*models.Order, error) {
+	order, err := fs.StateManager.PatchOrder(id, patch, price)
+	if err != nil {
+		return nil, err
+	}
+	fs.logPut(nil, []string{id})
+	return order, nil
+}
+
+// RecordMatchFailures counts failed match attempts and logs the change
+func (fs *FileStore) RecordMatchFailures(orderIDs []string, maxAttempts int) []string {
+	deadLettered := fs.StateManager.RecordMatchFailures(orderIDs, maxAttempts)
+	fs.logPut(nil, orderIDs)
+	return deadLettered
+}
+
+// RequeueOrder returns an unmatchable order to pending and logs the change
+func (fs *FileStore) RequeueOrder(id string) error {
+	if err := fs.StateManager.RequeueOrder(id); err != nil {
+		return err
+	}
+	fs.logPut(nil, []string{id})
+	return nil
+}
+
+// ReleaseOrphanedOrders returns orders of vanished drivers to pending and
+// logs the change
+func (fs *FileStore) ReleaseOrphanedOrders() []string {
+	released := fs.StateManager.ReleaseOrphanedOrders()
+	if len(released) > 0 {
+		fs.logPut(nil, released)
+	}
+	return released
+}
+
+// OfferOrder offers an order to drivers and logs the change
+func (fs *FileStore) OfferOrder(orderID string, driverIDs, queue []string, expiresAt int64) (*models.Order, error) {
+	order, err := fs.StateManager.OfferOrder(orderID, driverIDs, queue, expiresAt)
+	if err != nil {
+		return nil, err
+	}
+	fs.logPut(nil, []string{orderID})
+	return order, nil
+}
+
+// AcceptOffer assigns an offered order to the accepting driver and logs the
+// change
+func (fs *FileStore) AcceptOffer(orderID, driverID string) error {
+	if err := fs.StateManager.AcceptOffer(orderID, driverID); err != nil {
+		return err
+	}
+	fs.logPut([]string{driverID}, []string{orderID})
+	return nil
+}
+
+// BundleOrders groups pending orders into a bundle and logs them
+func (fs *FileStore) BundleOrders(bundleID string, orderIDs []string) error {
+	if err := fs.StateManager.BundleOrders(bundleID, orderIDs); err != nil {
+		return err
+	}
+	fs.logPut(nil, orderIDs)
+	return nil
+}
+
+// HandoffOrder moves a picked-up order to another driver and logs the order
+// and both drivers
+func (fs *FileStore) HandoffOrder(orderID, driverID string) (string, error) {
+	previous, err := fs.StateManager.HandoffOrder(orderID, driverID)
+	if err != nil {
+		return "", err
+	}
+	fs.logPut([]string{previous, driverID}, []string{orderID})
+	return previous, nil
+}
+
+// ExpireOffers renews or expires lapsed offers and logs the change
+func (fs *FileStore) ExpireOffers(now, expiresAt int64, batch int) (renewed, expired, lapsed []string) {
+	renewed, expired, lapsed = fs.StateManager.ExpireOffers(now, expiresAt, batch)
+	if changed := slices.Concat(renewed, expired); len(changed) > 0 {
+		drivers := slices.Clone(lapsed)
+		slices.Sort(drivers)
+		fs.logPut(slices.Compact(drivers), changed)
+	}
+	return renewed, expired, lapsed
+}
+
+// AssignMatchedOrder assigns an order whose pickup is unchanged and logs
+// the change
+func (fs *FileStore) AssignMatchedOrder(orderID, driverID string, pickup models.Location) error {
+	if err := fs.StateManager.AssignMatchedOrder(orderID, driverID, pickup); err != nil {
+		return err
+	}
+	fs.logPut([]string{driverID}, fs.bundleOf(orderID))
+	return nil
+}
+
+// AssignOrderToDriver assigns an order, with the rest of its bundle, to a
+// driver and logs the change
+func (fs *FileStore) AssignOrderToDriver(orderID, driverID string) error {
+	if err := fs.StateManager.AssignOrderToDriver(orderID, driverID); err != nil {
+		return err
+	}
+	fs.logPut([]string{driverID}, fs.bundleOf(orderID))
+	return nil
+}
+
+// Reset removes every driver and order, logs the empty state and writes it
+// as a fresh snapshot
+func (fs *FileStore) Reset() (drivers, orders int) {
+	drivers, orders = fs.StateManager.Reset()
+	fs.logReplace()
+	return drivers, orders
+}
+
+// PurgeSimulated removes simulated drivers and orders, logs the remaining
+// state and writes it as a fresh snapshot
+func (fs *FileStore) PurgeSimulated() (drivers, orders int) {
+	drivers, orders = fs.StateManager.PurgeSimulated()
+	fs.logReplace()
+	return drivers, orders
+}
+
+// RestoreSnapshot replaces all state, logs it and writes it as a fresh
+// snapshot
+func (fs *FileStore) RestoreSnapshot(snapshot models.StateSnapshot) error {
+	if err := fs.StateManager.RestoreSnapshot(snapshot); err != nil {
+		return err
+	}
+	fs.logReplace()
+	return nil
+}
+
+// Seed adds drivers and orders as given and logs them
+func (fs *FileStore) Seed(drivers []*models.Driver, orders []*models.Order) error {
+	if err := fs.StateManager.Seed(drivers, orders); err != nil {
+		return err
+	}
+	driverIDs := make([]string, 0, len(drivers))
+	for _, driver := range drivers {
+		driverIDs = append(driverIDs, driver.ID)
+	}
+	orderIDs := make([]string, 0, len(orders))
+	for _, order := range orders {
+		orderIDs = append(orderIDs, order.ID)
+	}
+	fs.logPut(driverIDs, orderIDs)
+	return nil
+}
+
+// Flush writes the current state as a snapshot and empties the log,
+// returning any error
+func (fs *FileStore) Flush() error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return fs.compact()
+}
+
+// logPut appends the current state of the given drivers and orders to the
+// log, compacting it once it is full. Failures are logged since the
+// mutation that triggered it has already been applied.
+func (fs *FileStore) logPut(driverIDs, orderIDs []string) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	// Reading under mu keeps records in log order: a later record always
+	// holds state at least as new as an earlier one
+	drivers, orders, version := fs.entities(driverIDs, orderIDs)
+	rec := walRecord{Op: walPut, Drivers: drivers, Orders: orders, Version: version}
+	if err := fs.appendWAL(rec); err != nil {
+		log.Printf("Failed to persist state: %v", err)
+		return
+	}
+	if fs.walRecords >= fs.compactAfter {
+		if err := fs.compact(); err != nil {
+			log.Printf("Failed to persist state: %v", err)
+		}
+	}
+}
+
+// logReplace appends the whole state to the log as a record that discards
+// everything before it, then compacts the log. The record keeps the change
+// durable when the snapshot cannot be written, and the snapshot is still
+// attempted when the record cannot be. Failures are logged as in logPut.
+func (fs *FileStore) logReplace() {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	snapshot := fs.GetSnapshot()
+	rec := walRecord{
+		Op:      walReplace,
+		Drivers: slices.Collect(maps.Values(snapshot.Drivers)),
+		Orders:  slices.Collect(maps.Values(snapshot.Orders)),
+		Version: snapshot.Version,
+	}
+	if err := fs.appendWAL(rec); err != nil {
+		log.Printf("Failed to persist state: %v", err)
+	}
+	if err := fs.compact(); err != nil {
+		log.Printf("Failed to persist state: %v", err)
+	}
+}
+
+// compact writes a snapshot and truncates the log it supersedes.
+// The caller must hold fs.mu.
+func (fs *FileStore) compact() error {
+	if err := fs.writeSnapshot(); err != nil {
+		return err
+	}
+	return fs.truncateWAL()
+}
+
+// writeSnapshot saves the current snapshot to disk atomically via a temp
+// file. The caller must hold fs.mu.
+func (fs *FileStore) writeSnapshot() error {
+	data, err := json.Marshal(fs.GetSnapshot())
+	if err != nil {
+		return fmt.Errorf("encode state for %s: %w", fs.path, err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(fs.path), filepath.Base(fs.path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("create temp state file for %s: %w", fs.path, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write state file %s: %w", fs.path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write state file %s: %w", fs.path, err)
+	}
+
+	if err := os.Rename(tmp.Name(), fs.path); err != nil {
+		return fmt.Errorf("replace state file %s: %w", fs.path, err)
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package repository
+
+import (
+	"delivery-state-manager/internal/models"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// openFileStore opens a FileStore at path, failing the test on error
+func openFileStore(t *testing.T, path string) *FileStore {
+	t.Helper()
+	store, err := NewFileStore(path, Config{GeoIndexEnabled: true})
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+	fs := store.(*FileStore)
+	t.Cleanup(func() { fs.wal.Close() })
+	return fs
+}
+
+// assertRecovered reopens the store at path, as after a crash that lost
+// everything in memory, and checks it holds the same state as want
+func assertRecovered(t *testing.T, path string, want *FileStore) {
+	t.Helper()
+	got, expected := openFileStore(t, path).GetSnapshot(), want.GetSnapshot()
+	if !reflect.DeepEqual(got.Drivers, expected.Drivers) || !reflect.DeepEqual(got.Orders, expected.Orders) {
+		t.Errorf("recovered state differs:\n got %+v %+v\nwant %+v %+v", got.Drivers, got.Orders, expected.Drivers, expected.Orders)
+	}
+	// Loading a snapshot moves past its version, so it may end up ahead
+	if got.Version < expected.Version {
+		t.Errorf("recovered version = %d, want at least %d", got.Version, expected.Version)
+	}
+}
+
+func TestFileStoreRecoversLoggedMutations(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	fs := openFileStore(t, path)
+
+	fs.CreateOrUpdateDriver(testDriver("d1"))
+	fs.CreateOrUpdateDriver(testDriver("d2"))
+	fs.CreateOrder(testOrder("o1"))
+	if err := fs.AssignOrderToDriver("o1", "d1"); err != nil {
+		t.Fatalf("AssignOrderToDriver: %v", err)
+	}
+	fs.DeleteDriver("d2")
+
+	assertRecovered(t, path, fs)
+}
+
+func TestFileStoreRecoversReplacedState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	fs := openFileStore(t, path)
+	fs.CreateOrUpdateDriver(testDriver("d1"))
+
+	// A directory in the snapshot's place makes every snapshot write fail,
+	// leaving the log as the only record of the restore
+	if err := os.MkdirAll(filepath.Join(path, "blocked"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	err := fs.RestoreSnapshot(models.StateSnapshot{Drivers: map[string]*models.Driver{"d2": testDriver("d2")}})
+	if err != nil {
+		t.Fatalf("RestoreSnapshot: %v", err)
+	}
+	fs.CreateOrUpdateDriver(testDriver("d3"))
+	if err := os.RemoveAll(path); err != nil {
+		t.Fatal(err)
+	}
+
+	assertRecovered(t, path, fs)
+}
+
+func TestFileStoreRecoversReset(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	fs := openFileStore(t, path)
+	fs.CreateOrUpdateDriver(testDriver("d1"))
+	if err := os.MkdirAll(filepath.Join(path, "blocked"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	fs.Reset()
+	fs.CreateOrUpdateDriver(testDriver("d2"))
+	if err := os.RemoveAll(path); err != nil {
+		t.Fatal(err)
+	}
+
+	assertRecovered(t, path, fs)
+}
+
+func TestFileStoreLoadsFlushedSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	fs := openFileStore(t, path)
+	fs.CreateOrUpdateDriver(testDriver("d1"))
+	fs.CreateOrder(testOrder("o1"))
+	if err := fs.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if info, err := os.Stat(path + ".wal"); err != nil || info.Size() != 0 {
+		t.Fatalf("log after Flush: %v, %v; want it emptied", info, err)
+	}
+
+	assertRecovered(t, path, fs)
+}
+
+func TestFileStoreRejectsCorruptSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := os.WriteFile(path, []byte("{not json"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewFileStore(path, Config{}); err == nil {
+		t.Error("NewFileStore accepted a corrupt state file")
+	}
+}
@@ -0,0 +1,167 @@
+package repository
+
+import (
+	"delivery-state-manager/internal/models"
+	"math"
+)
+
+// geohashBase32 is the standard geohash alphabet
+const geohashBase32 = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+// maxGeohashPrecision is the finest precision indexed (cells of about 1.2km x 0.6km)
+const maxGeohashPrecision = 6
+
+// minKmPerDegree is a lower bound on the length of one degree of latitude,
+// so cell sizes are never overestimated
+const minKmPerDegree = 110.5
+
+// geoIndex buckets driver IDs by geohash cell at every precision up to
+// maxGeohashPrecision, so a radius query only visits the cells around it.
+// It is not safe for concurrent use; StateManager guards it with its lock.
+type geoIndex struct {
+	// cells[p] maps a geohash of length p to the driver IDs inside it
+	cells  [maxGeohashPrecision + 1]map[string]map[string]bool
+	hashes map[string]string
+}
+
+// newGeoIndex creates an empty geoIndex
+func newGeoIndex() *geoIndex {
+	idx := &geoIndex{hashes: make(map[string]string)}
+	for p := 1; p <= maxGeohashPrecision; p++ {
+		idx.cells[p] = make(map[string]map[string]bool)
+	}
+	return idx
+}
+
+// upsert indexes a driver at loc, moving it if it was indexed elsewhere
+func (idx *geoIndex) upsert(driverID string, loc models.Location) {
+	hash := encodeGeohash(loc, maxGeohashPrecision)
+	if old, ok := idx.hashes[driverID]; ok {
+		if old == hash {
+			return
+		}
+		idx.remove(driverID)
+	}
+
+	idx.hashes[driverID] = hash
+	for p := 1; p <= maxGeohashPrecision; p++ {
+		cell := hash[:p]
+		if idx.cells[p][cell] == nil {
+			idx.cells[p][cell] = make(map[string]bool)
+		}
+		idx.cells[p][cell][driverID] = true
+	}
+}
+
+// remove drops a driver from the index
+func (idx *geoIndex) remove(driverID string) {
+	hash, ok := idx.hashes[driverID]
+	if !ok {
+		return
+	}
+
+	delete(idx.hashes, driverID)
+	for p := 1; p <= maxGeohashPrecision; p++ {
+		cell := hash[:p]
+		delete(idx.cells[p][cell], driverID)
+		if len(idx.cells[p][cell]) == 0 {
+			delete(idx.cells[p], cell)
+		}
+	}
+}
+
+// candidates returns the IDs of drivers in the cell containing center and its
+// eight neighbors, at the finest precision whose cells are at least radiusKm
+// across. ok is false when the radius is too large for any cell, in which
+// case the caller must scan linearly.
+func (idx *geoIndex) candidates(center models.Location, radiusKm float64) (ids []string, ok bool) {
+	// Degrees of longitude are narrowest at the most poleward point in range
+	poleward := math.Abs(center.Lat) + radiusKm/minKmPerDegree
+	if poleward >= 90 {
+		return nil, false
+	}
+
+	precision := 0
+	var latStep, lonStep float64
+	for p := maxGeohashPrecision; p >= 1; p-- {
+		latStep, lonStep = geohashCellSize(p)
+		heightKm := latStep * minKmPerDegree
+		widthKm := lonStep * minKmPerDegree * math.Cos(poleward*math.Pi/180)
+		if heightKm >= radiusKm && widthKm >= radiusKm {
+			precision = p
+			break
+		}
+	}
+	if precision == 0 {
+		return nil, false
+	}
+
+	seenCells := make(map[string]bool, 9)
+	for _, dLat := range []float64{-latStep, 0, latStep} {
+		for _, dLon := range []float64{-lonStep, 0, lonStep} {
+			lat := center.Lat + dLat
+			if lat > 90 || lat < -90 {
+				continue
+			}
+			lon := math.Mod(center.Lon+dLon+540, 360) - 180
+
+			cell := encodeGeohash(models.Location{Lat: lat, Lon: lon}, precision)
+			if seenCells[cell] {
+				continue
+			}
+			seenCells[cell] = true
+
+			for id := range idx.cells[precision][cell] {
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids, true
+}
+
+// geohashCellSize returns the height and width in degrees of a cell at precision
+func geohashCellSize(precision int) (latStep, lonStep float64) {
+	bits := 5 * precision
+	lonBits := (bits + 1) / 2
+	latBits := bits / 2
+	return 180 / math.Pow(2, float64(latBits)), 360 / math.Pow(2, float64(lonBits))
+}
+
+// encodeGeohash returns the geohash of loc with the given number of characters
+func encodeGeohash(loc models.Location, precision int) string {
+	latRange := [2]float64{-90, 90}
+	lonRange := [2]float64{-180, 180}
+
+	hash := make([]byte, 0, precision)
+	bit, ch := 0, 0
+	evenBit := true
+	for len(hash) < precision {
+		if evenBit {
+			mid := (lonRange[0] + lonRange[1]) / 2
+			if loc.Lon >= mid {
+				ch = ch<<1 | 1
+				lonRange[0] = mid
+			} else {
+				ch <<= 1
+				lonRange[1] = mid
+			}
+		} else {
+			mid := (latRange[0] + latRange[1]) / 2
+			if loc.Lat >= mid {
+				ch = ch<<1 | 1
+				latRange[0] = mid
+			} else {
+				ch <<= 1
+				latRange[1] = mid
+			}
+		}
+		evenBit = !evenBit
+
+		bit++
+		if bit == 5 {
+			hash = append(hash, geohashBase32[ch])
+			bit, ch = 0, 0
+		}
+	}
+	return string(hash)
+}
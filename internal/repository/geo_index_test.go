@@ -0,0 +1,101 @@
+package repository
+
+import (
+	"delivery-state-manager/internal/models"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"testing"
+)
+
+// wrapLon wraps a longitude into [-180, 180)
+func wrapLon(lon float64) float64 {
+	return math.Mod(lon+540, 360) - 180
+}
+
+// seedDrivers creates n drivers scattered around center on both an indexed
+// and a linear store, returning the two stores
+func seedDrivers(n int, center models.Location, spread float64) (indexed, linear *StateManager) {
+	indexed = newStateManager(Config{GeoIndexEnabled: true})
+	linear = newStateManager(Config{})
+	rng := rand.New(rand.NewPCG(1, 2))
+	for i := range n {
+		driver := testDriver(fmt.Sprintf("d%05d", i))
+		driver.Location = models.Location{
+			Lat: center.Lat + (rng.Float64()-0.5)*spread,
+			Lon: wrapLon(center.Lon + (rng.Float64()-0.5)*spread),
+		}
+		indexed.CreateOrUpdateDriver(driver)
+		linear.CreateOrUpdateDriver(driver.Clone())
+	}
+	return indexed, linear
+}
+
+// nearbyIDs lists the IDs GetNearbyDrivers returns, in order
+func nearbyIDs(sm *StateManager, center models.Location, radiusKm float64) []string {
+	var ids []string
+	for _, driver := range sm.GetNearbyDrivers(center, radiusKm) {
+		ids = append(ids, driver.ID)
+	}
+	return ids
+}
+
+func TestGeoIndexMatchesLinearScan(t *testing.T) {
+	for _, area := range []struct {
+		name   string
+		center models.Location
+	}{
+		{"city", models.Location{Lat: 37.77, Lon: -122.42}},
+		{"equator", models.Location{Lat: 0, Lon: 0}},
+		{"antimeridian", models.Location{Lat: -17.7, Lon: 179.99}},
+		{"far north", models.Location{Lat: 78.2, Lon: 15.6}},
+	} {
+		indexed, linear := seedDrivers(2000, area.center, 1)
+
+		// Move and delete some drivers so the index has to have kept up
+		for i := 0; i < 2000; i += 7 {
+			id := fmt.Sprintf("d%05d", i)
+			loc := models.Location{Lat: area.center.Lat + float64(i%13)*0.01, Lon: area.center.Lon}
+			indexed.PatchDriver(id, moveTo(loc.Lat, loc.Lon))
+			linear.PatchDriver(id, moveTo(loc.Lat, loc.Lon))
+		}
+		for i := 3; i < 2000; i += 11 {
+			indexed.DeleteDriver(fmt.Sprintf("d%05d", i))
+			linear.DeleteDriver(fmt.Sprintf("d%05d", i))
+		}
+
+		rng := rand.New(rand.NewPCG(3, 4))
+		for range 20 {
+			center := models.Location{
+				Lat: area.center.Lat + (rng.Float64()-0.5)*1.2,
+				Lon: wrapLon(area.center.Lon + (rng.Float64()-0.5)*1.2),
+			}
+			for _, radiusKm := range []float64{0.1, 0.5, 2, 10, 50, 500} {
+				got, want := nearbyIDs(indexed, center, radiusKm), nearbyIDs(linear, center, radiusKm)
+				if fmt.Sprint(got) != fmt.Sprint(want) {
+					t.Fatalf("%s: %.1fkm around %v: indexed found %d drivers, linear %d", area.name, radiusKm, center, len(got), len(want))
+				}
+			}
+		}
+	}
+}
+
+// BenchmarkNearbyDrivers compares indexed and linear nearby queries over
+// drivers spread across a city
+func BenchmarkNearbyDrivers(b *testing.B) {
+	center := models.Location{Lat: 37.77, Lon: -122.42}
+	indexed, linear := seedDrivers(20000, center, 0.5)
+	for _, bench := range []struct {
+		name string
+		sm   *StateManager
+	}{
+		{"indexed", indexed},
+		{"linear", linear},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			for range b.N {
+				bench.sm.GetNearbyDrivers(center, 1)
+			}
+		})
+	}
+}
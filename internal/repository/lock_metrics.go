@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"delivery-state-manager/internal/models"
+	"sync/atomic"
+	"time"
+)
+
+// lockWaitBounds are the upper bounds, in seconds, of the lock wait
+// histogram buckets, from one microsecond to one second
+var lockWaitBounds = []float64{1e-6, 1e-5, 1e-4, 1e-3, 1e-2, 1e-1, 1}
+
+// waitHistogram counts lock waits by duration. It is lock-free so recording
+// a wait never waits itself.
+type waitHistogram struct {
+	// buckets counts waits per bound of lockWaitBounds, with a last bucket
+	// for longer waits; they are not cumulative
+	buckets [8]atomic.Uint64
+	sum     atomic.Int64
+}
+
+// observe records one wait
+func (h *waitHistogram) observe(wait time.Duration) {
+	i := 0
+	for i < len(lockWaitBounds) && wait.Seconds() > lockWaitBounds[i] {
+		i++
+	}
+	h.buckets[i].Add(1)
+	h.sum.Add(int64(wait))
+}
+
+// snapshot returns the histogram with cumulative buckets, as Prometheus
+// expects. Waits recorded meanwhile may be partly counted.
+func (h *waitHistogram) snapshot(mode string) models.LockWaitHistogram {
+	hist := models.LockWaitHistogram{
+		Mode:       mode,
+		Buckets:    make([]models.HistogramBucket, 0, len(lockWaitBounds)),
+		SumSeconds: time.Duration(h.sum.Load()).Seconds(),
+	}
+	for i, bound := range lockWaitBounds {
+		hist.Count += h.buckets[i].Load()
+		hist.Buckets = append(hist.Buckets, models.HistogramBucket{UpperBound: bound, Count: hist.Count})
+	}
+	hist.Count += h.buckets[len(lockWaitBounds)].Load()
+	return hist
+}
+
+// lockWaits holds the wait histograms of both sides of StateManager.mu
+type lockWaits struct {
+	read  waitHistogram
+	write waitHistogram
+}
+
+// lock takes the write lock, timing the wait when lock metrics are enabled
+func (sm *StateManager) lock() {
+	if sm.waits == nil {
+		sm.mu.Lock()
+		return
+	}
+	start := time.Now()
+	sm.mu.Lock()
+	sm.waits.write.observe(time.Since(start))
+}
+
+// rlock takes the read lock, timing the wait when lock metrics are enabled
+func (sm *StateManager) rlock() {
+	if sm.waits == nil {
+		sm.mu.RLock()
+		return
+	}
+	start := time.Now()
+	sm.mu.RLock()
+	sm.waits.read.observe(time.Since(start))
+}
+
+// LockWaits returns the read and write lock wait histograms, or nil when
+// lock metrics are disabled
+func (sm *StateManager) LockWaits() []models.LockWaitHistogram {
+	if sm.waits == nil {
+		return nil
+	}
+	return []models.LockWaitHistogram{sm.waits.read.snapshot("read"), sm.waits.write.snapshot("write")}
+}
@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"testing"
+	"time"
+)
+
+// contend holds the write lock for hold while take waits for the lock,
+// returning once take has it and released it again
+func contend(sm *StateManager, hold time.Duration, take, release func()) {
+	sm.lock()
+	done := make(chan struct{})
+	go func() {
+		take()
+		release()
+		close(done)
+	}()
+	time.Sleep(hold)
+	sm.unlock()
+	<-done
+}
+
+func TestLockWaitsRecordContention(t *testing.T) {
+	sm := newStateManager(Config{LockMetrics: true})
+	contend(sm, 10*time.Millisecond, sm.rlock, sm.mu.RUnlock)
+	contend(sm, 10*time.Millisecond, sm.lock, sm.unlock)
+
+	waits := sm.LockWaits()
+	if len(waits) != 2 || waits[0].Mode != "read" || waits[1].Mode != "write" {
+		t.Fatalf("LockWaits() = %+v, want read and write histograms", waits)
+	}
+	read, write := waits[0], waits[1]
+	if read.Count != 1 || read.SumSeconds < 0.01 {
+		t.Errorf("read waits: %d totalling %vs, want one of at least 10ms", read.Count, read.SumSeconds)
+	}
+	// Both holders took the write lock too, without waiting
+	if write.Count != 3 || write.SumSeconds < 0.01 {
+		t.Errorf("write waits: %d totalling %vs, want three, one of at least 10ms", write.Count, write.SumSeconds)
+	}
+
+	// The contended read waited longer than 1ms but less than a second
+	for _, bucket := range read.Buckets {
+		want := uint64(0)
+		if bucket.UpperBound >= 1 {
+			want = 1
+		}
+		if bucket.UpperBound > 1e-3 && bucket.UpperBound < 1 {
+			continue
+		}
+		if bucket.Count != want {
+			t.Errorf("read waits up to %vs = %d, want %d", bucket.UpperBound, bucket.Count, want)
+		}
+	}
+
+	if waits := newStateManager(Config{}).LockWaits(); waits != nil {
+		t.Errorf("LockWaits() with metrics disabled = %+v, want nil", waits)
+	}
+}
@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"delivery-state-manager/internal/models"
+	"delivery-state-manager/pkg/errs"
+)
+
+// readView answers lookups for WithReadTx. It must only be used while the
+// read lock taken by WithReadTx is held.
+type readView struct {
+	sm *StateManager
+}
+
+// WithReadTx calls fn with a view of the state under a single read lock, so
+// every lookup fn makes sees the same version and no write can land between
+// them. fn must not call back into the store, which would deadlock against
+// a waiting writer, and should return quickly since it blocks all writes,
+// driver moves included.
+func (sm *StateManager) WithReadTx(fn func(view models.ReadView) error) error {
+	sm.rlockDrivers()
+	defer sm.runlockDrivers()
+
+	return fn(readView{sm: sm})
+}
+
+// Driver returns a copy of a driver, including deleted ones
+func (v readView) Driver(id string) (*models.Driver, error) {
+	driver, ok := v.sm.drivers[id]
+	if !ok {
+		return nil, errs.ErrDriverNotFound
+	}
+	return driver.Clone(), nil
+}
+
+// Order returns a copy of an order
+func (v readView) Order(id string) (*models.Order, error) {
+	order, ok := v.sm.orders[id]
+	if !ok {
+		return nil, errs.ErrOrderNotFound
+	}
+	return order.Clone(), nil
+}
+
+// EachDriver calls fn for every driver, deleted ones included, in no
+// particular order
+func (v readView) EachDriver(fn func(driver *models.Driver)) {
+	for _, driver := range v.sm.drivers {
+		fn(driver)
+	}
+}
+
+// EachOrder calls fn for every order in no particular order
+func (v readView) EachOrder(fn func(order *models.Order)) {
+	for _, order := range v.sm.orders {
+		fn(order)
+	}
+}
+
+// Version returns the state version the view reflects
+func (v readView) Version() uint64 {
+	return v.sm.version.Load()
+}
@@ -0,0 +1,79 @@
+package repository
+
+import (
+	"delivery-state-manager/internal/models"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestReadTxSeesOneVersion(t *testing.T) {
+	const n = 200
+	sm := newStateManager(Config{GeoIndexEnabled: true, DriverCapacity: 1})
+	for i := range n {
+		sm.CreateOrUpdateDriver(testDriver(fmt.Sprintf("d%03d", i)))
+		sm.CreateOrder(testOrder(fmt.Sprintf("o%03d", i)))
+	}
+
+	// Assignments land while a mover walks a driver north; every view must
+	// see each assigned order's driver busy, as many busy drivers as
+	// assigned orders, and nothing move under it
+	var stop atomic.Bool
+	var writers sync.WaitGroup
+	writers.Add(2)
+	go func() {
+		defer writers.Done()
+		for i := range n {
+			id := fmt.Sprintf("%03d", i)
+			if err := sm.AssignOrderToDriver("o"+id, "d"+id); err != nil {
+				t.Errorf("AssignOrderToDriver o%s: %v", id, err)
+			}
+		}
+	}()
+	go func() {
+		defer writers.Done()
+		for step := 1; !stop.Load(); step++ {
+			sm.PatchDriver("d000", moveTo(latAt(step), -122.42))
+		}
+	}()
+
+	for views := 0; views < 1000 || sm.CountOrders(models.OrderAssigned) < n; views++ {
+		err := sm.WithReadTx(func(view models.ReadView) error {
+			version := view.Version()
+			before, err := view.Driver("d000")
+			if err != nil {
+				return err
+			}
+
+			assigned, busy := 0, 0
+			var inconsistent []string
+			view.EachOrder(func(order *models.Order) {
+				if order.Status != models.OrderAssigned {
+					return
+				}
+				assigned++
+				if driver, err := view.Driver(order.DriverID); err != nil || driver.Status != models.DriverBusy {
+					inconsistent = append(inconsistent, order.ID)
+				}
+			})
+			view.EachDriver(func(driver *models.Driver) {
+				if driver.Status == models.DriverBusy {
+					busy++
+				}
+			})
+
+			after, _ := view.Driver("d000")
+			if len(inconsistent) > 0 || assigned != busy || before.Location != after.Location || view.Version() != version {
+				t.Errorf("view at version %d changed to %d: %d assigned orders, %d busy drivers, orders without a busy driver %v, d000 moved from %v to %v",
+					version, view.Version(), assigned, busy, inconsistent, before.Location, after.Location)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("WithReadTx: %v", err)
+		}
+	}
+	stop.Store(true)
+	writers.Wait()
+}
@@ -1,62 +1,270 @@
 package repository
 
 import (
+	"cmp"
+	"context"
 	"delivery-state-manager/internal/models"
+	"delivery-state-manager/pkg/clock"
 	"delivery-state-manager/pkg/errs"
+	"fmt"
+	"slices"
+	"sort"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
-// Repository defines the interface for data access operations
-type Repository interface {
+// Store defines the interface for data access operations.
+// StateManager is the in-memory implementation; FileStore adds persistence.
+type Store interface {
 	// Driver operations
-	CreateOrUpdateDriver(driver *models.Driver)
+	CreateOrUpdateDriver(driver *models.Driver) error
 	GetDriver(id string) (*models.Driver, error)
 	GetAllDrivers() []*models.Driver
 	UpdateDriverStatus(id string, status models.DriverStatus) error
+	PatchDriver(id string, patch models.DriverPatch) (*models.Driver, error)
+	SetDriverCooldown(id string, until int64) error
+	CompareAndSetDriverStatus(id string, expected, status models.DriverStatus) error
 	GetAvailableDrivers() []*models.Driver
+	GetAssignableDrivers() []*models.Driver
+	GetNearbyDrivers(center models.Location, radiusKm float64) []*models.Driver
+	ListDriversAfter(afterID string, limit int) []*models.Driver
+	SetDriverAvailability(id string, status models.DriverStatus) ([]string, error)
+	DeleteDriver(id string) ([]string, error)
 
 	// Order operations
-	CreateOrder(order *models.Order)
+	CreateOrder(order *models.Order) error
 	GetOrder(id string) (*models.Order, error)
 	GetAllOrders() []*models.Order
+	StreamOrders(fn func(order *models.Order) bool)
 	UpdateOrderStatus(id string, status models.OrderStatus) error
+	CancelOrder(id, reason string) error
+	PatchOrder(id string, patch models.OrderPatch, price func(order *models.Order) float64) (*models.Order, error)
 	GetPendingOrders() []*models.Order
+	GetOrdersByDriver(driverID string) []*models.Order
+	GetReadyOrders(now int64) []*models.Order
+	GetOrdersByStatus(status models.OrderStatus) []*models.Order
+	RecordMatchFailures(orderIDs []string, maxAttempts int) []string
+	RequeueOrder(id string) error
+	ReleaseOrphanedOrders() []string
+	OfferOrder(orderID string, driverIDs, queue []string, expiresAt int64) (*models.Order, error)
+	AcceptOffer(orderID, driverID string) error
+	ExpireOffers(now, expiresAt int64, batch int) (renewed, expired, lapsed []string)
 
 	// Assignment operations
 	AssignOrderToDriver(orderID, driverID string) error
+	AssignMatchedOrder(orderID, driverID string, pickup models.Location) error
+	HandoffOrder(orderID, driverID string) (string, error)
+	BundleOrders(bundleID string, orderIDs []string) error
+
+	// CountDrivers and CountOrders read the size of a status index
+	CountDrivers(status models.DriverStatus) int
+	CountOrders(status models.OrderStatus) int
+
+	// WithReadTx runs fn against a consistent view of the state
+	WithReadTx(fn func(view models.ReadView) error) error
 
 	// Debug operations
 	GetSnapshot() models.StateSnapshot
+	GetVersion() uint64
+	WaitForVersion(ctx context.Context, since uint64) (uint64, bool)
+	LockWaits() []models.LockWaitHistogram
+	Reset() (drivers, orders int)
+	PurgeSimulated() (drivers, orders int)
+	RestoreSnapshot(snapshot models.StateSnapshot) error
+	Seed(drivers []*models.Driver, orders []*models.Order) error
+}
+
+// Flusher is implemented by stores that can write their state to durable
+// storage on demand
+type Flusher interface {
+	Flush() error
+}
+
+// maxLocationHistory caps how many replaced pickups, and separately
+// dropoffs, an order remembers
+const maxLocationHistory = 20
+
+// Config holds storage tuning options
+type Config struct {
+	// GeoIndexEnabled answers nearby queries from the geohash index instead
+	// of a linear scan over every driver
+	GeoIndexEnabled bool
+	// MaxDrivers and MaxOrders cap how many entities may be stored.
+	// Zero means unlimited.
+	MaxDrivers int
+	MaxOrders  int
+	// LocationHistorySize is how many location updates are kept per driver.
+	// Zero disables history.
+	LocationHistorySize int
+	// MaxOrdersPerCustomer caps each customer's non-terminal orders.
+	// Zero means unlimited.
+	MaxOrdersPerCustomer int
+	// Clock decides the day that drivers' daily order counts belong to.
+	// Nil uses the system clock.
+	Clock clock.Clock
+	// CompactAfter is how many write-ahead log records the file store keeps
+	// before folding them into a new snapshot
+	CompactAfter int
+	// DriverCapacity is how many active orders a driver without their own
+	// capacity may carry at once. Zero or less means one.
+	DriverCapacity int
+	// OfferLapseHalfLife is how long it takes a driver's count of lapsed
+	// offers to halve. Zero never decays it.
+	OfferLapseHalfLife time.Duration
+	// OnOrderStatus, when set, receives a copy of every order whose status
+	// changed, once the mutation that changed it is complete. It is called
+	// with the store locked, so it must not block or call back into the store.
+	OnOrderStatus func(order *models.Order)
+	// LockMetrics times every wait for the store's lock; see LockWaits
+	LockMetrics bool
 }
 
 // StateManager manages all drivers and orders with thread-safe access
 type StateManager struct {
 	drivers map[string]*models.Driver
 	orders  map[string]*models.Order
+	// driverStatuses and orderStatuses index IDs by status; they must be
+	// updated through putDriver, setDriverStatus, putOrder and setOrderStatus
+	driverStatuses statusIndex[models.DriverStatus]
+	orderStatuses  statusIndex[models.OrderStatus]
+	// geo indexes driver locations; nil when the index is disabled
+	geo        *geoIndex
+	maxDrivers int
+	maxOrders  int
+	// historySize bounds each driver's LocationHistory
+	historySize int
+	// maxOrdersPerCustomer bounds each customer's active orders
+	maxOrdersPerCustomer int
+	// driverCapacity is the default of each driver's Capacity
+	driverCapacity int
+	// offerLapseHalfLife is Config.OfferLapseHalfLife
+	offerLapseHalfLife time.Duration
+	// onOrderStatus is Config.OnOrderStatus, and statusChanged holds the
+	// orders whose status changed during the current mutation
+	onOrderStatus func(order *models.Order)
+	statusChanged []*models.Order
+	clock         clock.Clock
+	// version is incremented on every mutation. Driver moves bump it under
+	// the read lock, so it is atomic.
+	version atomic.Uint64
+	// versionChanged is broadcast whenever version changes
+	versionChanged versionSignal
+	// mu guards the maps, the indexes and every order. Mutations that touch
+	// one driver's location only take it for reading plus the driver's
+	// stripe for writing, so moves of different drivers run in parallel
+	// with each other and with order reads; anything that reads driver
+	// fields takes the stripes as well. See stripes.go.
 	mu      sync.RWMutex
+	stripes [driverStripes]sync.RWMutex
+	// waits records how long mu took to acquire; nil unless lock metrics
+	// are enabled. mu is always taken through lock and rlock.
+	waits *lockWaits
+	// geoMu serializes geo index updates from parallel driver moves
+	geoMu sync.Mutex
+}
+
+// unlock publishes the status changes of the mutation that is ending and
+// releases the write lock. Mutators release the lock through it rather than
+// sm.mu.Unlock, so OnOrderStatus sees each order in its final state.
+func (sm *StateManager) unlock() {
+	for i, order := range sm.statusChanged {
+		sm.onOrderStatus(order.Clone())
+		sm.statusChanged[i] = nil
+	}
+	sm.statusChanged = sm.statusChanged[:0]
+	sm.mu.Unlock()
 }
 
 // NewStateManager creates a new StateManager instance
-func NewStateManager() Repository {
-	return &StateManager{
-		drivers: make(map[string]*models.Driver),
-		orders:  make(map[string]*models.Order),
+func NewStateManager(cfg Config) Store {
+	return newStateManager(cfg)
+}
+
+// newStateManager creates an empty StateManager
+func newStateManager(cfg Config) *StateManager {
+	sm := &StateManager{
+		drivers:              make(map[string]*models.Driver),
+		orders:               make(map[string]*models.Order),
+		driverStatuses:       make(statusIndex[models.DriverStatus]),
+		orderStatuses:        make(statusIndex[models.OrderStatus]),
+		maxDrivers:           cfg.MaxDrivers,
+		maxOrders:            cfg.MaxOrders,
+		historySize:          cfg.LocationHistorySize,
+		maxOrdersPerCustomer: cfg.MaxOrdersPerCustomer,
+		driverCapacity:       max(cfg.DriverCapacity, 1),
+		offerLapseHalfLife:   cfg.OfferLapseHalfLife,
+		onOrderStatus:        cfg.OnOrderStatus,
+		clock:                cfg.Clock,
+	}
+	if sm.clock == nil {
+		sm.clock = clock.New()
 	}
+	if cfg.GeoIndexEnabled {
+		sm.geo = newGeoIndex()
+	}
+	if cfg.LockMetrics {
+		sm.waits = &lockWaits{}
+	}
+	return sm
 }
 
-// CreateOrUpdateDriver creates a new driver or updates an existing one
-func (sm *StateManager) CreateOrUpdateDriver(driver *models.Driver) {
-	sm.mu.Lock()
-	defer sm.mu.Unlock()
+// CreateOrUpdateDriver creates a new driver or updates an existing one.
+// New drivers are rejected with ErrCapacityExceeded once MaxDrivers is reached.
+func (sm *StateManager) CreateOrUpdateDriver(driver *models.Driver) error {
+	sm.lock()
+	defer sm.unlock()
 
-	driver.UpdatedAt = models.GetCurrentTimestamp()
-	sm.drivers[driver.ID] = driver
+	now := sm.clock.Now().Unix()
+	driver.CreatedAt = now
+	var history []models.TimestampedLocation
+	if existing, ok := sm.drivers[driver.ID]; ok {
+		if existing.Deleted {
+			return errs.ErrDriverDeleted
+		}
+		driver.CreatedAt = existing.CreatedAt
+		driver.CooldownUntil = existing.CooldownUntil
+		driver.DailyOrders = existing.DailyOrders
+		driver.DailyOrdersDate = existing.DailyOrdersDate
+		driver.OfferLapses = existing.OfferLapses
+		driver.OfferLapsedAt = existing.OfferLapsedAt
+		history = existing.LocationHistory
+	} else if sm.maxDrivers > 0 && len(sm.drivers) >= sm.maxDrivers {
+		return errs.ErrCapacityExceeded
+	} else {
+		driver.DailyOrders = 0
+		driver.DailyOrdersDate = ""
+		driver.OfferLapses = 0
+		driver.OfferLapsedAt = 0
+	}
+	driver.LocationHistory = sm.appendHistory(history, driver.Location, now)
+	driver.UpdatedAt = now
+	// Store a copy so the caller can keep reading driver without racing the matcher
+	sm.putDriver(driver.Clone())
+	if sm.geo != nil {
+		sm.geo.upsert(driver.ID, driver.Location)
+	}
+	sm.bumpVersion()
+	return nil
 }
 
-// GetDriver retrieves a driver by ID
+// appendHistory returns history with loc added, keeping only the newest
+// historySize entries. A new slice is always built so copies handed out
+// earlier never observe the change.
+func (sm *StateManager) appendHistory(history []models.TimestampedLocation, loc models.Location, at int64) []models.TimestampedLocation {
+	if sm.historySize <= 0 {
+		return nil
+	}
+
+	start := max(len(history)+1-sm.historySize, 0)
+	next := make([]models.TimestampedLocation, 0, len(history)-start+1)
+	next = append(next, history[start:]...)
+	return append(next, models.TimestampedLocation{Location: loc, Timestamp: at})
+}
+
+// GetDriver retrieves a driver by ID, including deleted drivers
 func (sm *StateManager) GetDriver(id string) (*models.Driver, error) {
-	sm.mu.RLock()
-	defer sm.mu.RUnlock()
+	defer sm.rlockDriver(id)()
 
 	driver, ok := sm.drivers[id]
 	if !ok {
@@ -64,19 +272,58 @@ func (sm *StateManager) GetDriver(id string) (*models.Driver, error) {
 	}
 
 	// Return a copy to prevent external mutation
-	driverCopy := *driver
-	return &driverCopy, nil
+	return driver.Clone(), nil
 }
 
-// GetAllDrivers returns all drivers
+// liveDriver returns the stored driver with the given ID unless it is missing
+// or deleted. The caller must hold sm.mu.
+func (sm *StateManager) liveDriver(id string) (*models.Driver, bool) {
+	driver, ok := sm.drivers[id]
+	if !ok || driver.Deleted {
+		return nil, false
+	}
+	return driver, true
+}
+
+// GetAllDrivers returns all drivers that are not deleted, ordered by ID
 func (sm *StateManager) GetAllDrivers() []*models.Driver {
-	sm.mu.RLock()
-	defer sm.mu.RUnlock()
+	sm.rlockDrivers()
+	defer sm.runlockDrivers()
 
 	drivers := make([]*models.Driver, 0, len(sm.drivers))
 	for _, driver := range sm.drivers {
-		driverCopy := *driver
-		drivers = append(drivers, &driverCopy)
+		if !driver.Deleted {
+			drivers = append(drivers, driver.Clone())
+		}
+	}
+	sort.Slice(drivers, func(i, j int) bool {
+		return drivers[i].ID < drivers[j].ID
+	})
+	return drivers
+}
+
+// ListDriversAfter returns up to limit drivers with IDs greater than afterID,
+// ordered by ID and skipping deleted drivers. Keyset ordering keeps pages
+// stable while drivers are added.
+func (sm *StateManager) ListDriversAfter(afterID string, limit int) []*models.Driver {
+	sm.rlockDrivers()
+	defer sm.runlockDrivers()
+
+	ids := make([]string, 0, len(sm.drivers))
+	for id, driver := range sm.drivers {
+		if id > afterID && !driver.Deleted {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	if len(ids) > limit {
+		ids = ids[:limit]
+	}
+
+	drivers := make([]*models.Driver, 0, len(ids))
+	for _, id := range ids {
+		drivers = append(drivers, sm.drivers[id].Clone())
 	}
 	return drivers
 }
@@ -87,36 +334,248 @@ func (sm *StateManager) UpdateDriverStatus(id string, status models.DriverStatus
 		return errs.ErrInvalidStatusUpdate
 	}
 
-	sm.mu.Lock()
-	defer sm.mu.Unlock()
+	sm.lock()
+	defer sm.unlock()
 
-	driver, ok := sm.drivers[id]
+	driver, ok := sm.liveDriver(id)
+	if !ok {
+		return errs.ErrDriverNotFound
+	}
+
+	sm.setDriverStatus(driver, status)
+	driver.UpdatedAt = sm.clock.Now().Unix()
+	sm.bumpVersion()
+	return nil
+}
+
+// PatchDriver applies the non-nil fields of patch to a driver and returns
+// the updated driver
+func (sm *StateManager) PatchDriver(id string, patch models.DriverPatch) (*models.Driver, error) {
+	if patch.Status != nil && !models.IsValidDriverStatus(*patch.Status) {
+		return nil, errs.ErrInvalidStatusUpdate
+	}
+
+	if patch.Name == nil && patch.Status == nil && patch.Location != nil {
+		return sm.moveDriver(id, *patch.Location)
+	}
+
+	sm.lock()
+	defer sm.unlock()
+
+	driver, ok := sm.liveDriver(id)
+	if !ok {
+		return nil, errs.ErrDriverNotFound
+	}
+
+	if patch.Name != nil {
+		driver.Name = *patch.Name
+	}
+	if patch.Status != nil {
+		sm.setDriverStatus(driver, *patch.Status)
+	}
+	now := sm.clock.Now().Unix()
+	if patch.Location != nil {
+		driver.Location = *patch.Location
+		driver.LocationHistory = sm.appendHistory(driver.LocationHistory, driver.Location, now)
+		if sm.geo != nil {
+			sm.geo.upsert(id, driver.Location)
+		}
+	}
+	driver.UpdatedAt = now
+	sm.bumpVersion()
+
+	return driver.Clone(), nil
+}
+
+// moveDriver updates only a driver's location, under the driver's stripe
+// rather than the write lock, so location pings for different drivers do
+// not wait on each other or on reads of orders
+func (sm *StateManager) moveDriver(id string, loc models.Location) (*models.Driver, error) {
+	defer sm.lockDriver(id)()
+
+	driver, ok := sm.liveDriver(id)
+	if !ok {
+		return nil, errs.ErrDriverNotFound
+	}
+
+	now := sm.clock.Now().Unix()
+	driver.Location = loc
+	driver.LocationHistory = sm.appendHistory(driver.LocationHistory, loc, now)
+	if sm.geo != nil {
+		sm.geoMu.Lock()
+		sm.geo.upsert(id, loc)
+		sm.geoMu.Unlock()
+	}
+	driver.UpdatedAt = now
+	sm.bumpVersion()
+
+	return driver.Clone(), nil
+}
+
+// SetDriverCooldown makes the matcher skip a driver until the given Unix time
+func (sm *StateManager) SetDriverCooldown(id string, until int64) error {
+	sm.lock()
+	defer sm.unlock()
+
+	driver, ok := sm.liveDriver(id)
 	if !ok {
 		return errs.ErrDriverNotFound
 	}
 
-	driver.Status = status
-	driver.UpdatedAt = models.GetCurrentTimestamp()
+	driver.CooldownUntil = until
+	driver.UpdatedAt = sm.clock.Now().Unix()
+	sm.bumpVersion()
 	return nil
 }
 
-// CreateOrder creates a new order with pending status
-func (sm *StateManager) CreateOrder(order *models.Order) {
-	sm.mu.Lock()
-	defer sm.mu.Unlock()
+// CompareAndSetDriverStatus updates a driver's status only if it currently
+// equals expected, returning ErrDriverStatusConflict otherwise
+func (sm *StateManager) CompareAndSetDriverStatus(id string, expected, status models.DriverStatus) error {
+	if !models.IsValidDriverStatus(status) || !models.IsValidDriverStatus(expected) {
+		return errs.ErrInvalidStatusUpdate
+	}
 
-	now := models.GetCurrentTimestamp()
+	sm.lock()
+	defer sm.unlock()
+
+	driver, ok := sm.liveDriver(id)
+	if !ok {
+		return errs.ErrDriverNotFound
+	}
+
+	if driver.Status != expected {
+		return errs.ErrDriverStatusConflict
+	}
+
+	sm.setDriverStatus(driver, status)
+	driver.UpdatedAt = sm.clock.Now().Unix()
+	sm.bumpVersion()
+	return nil
+}
+
+// SetDriverAvailability moves a driver to available or offline, refusing while
+// the driver still holds assigned or picked-up orders. On refusal the IDs of
+// the blocking orders are returned alongside ErrDriverHasActiveOrder.
+func (sm *StateManager) SetDriverAvailability(id string, status models.DriverStatus) ([]string, error) {
+	if status != models.DriverAvailable && status != models.DriverOffline {
+		return nil, errs.ErrInvalidStatusUpdate
+	}
+
+	sm.lock()
+	defer sm.unlock()
+
+	driver, ok := sm.liveDriver(id)
+	if !ok {
+		return nil, errs.ErrDriverNotFound
+	}
+
+	if activeOrderIDs := sm.activeOrdersOfDriver(id); len(activeOrderIDs) > 0 {
+		return activeOrderIDs, errs.ErrDriverHasActiveOrder
+	}
+
+	sm.setDriverStatus(driver, status)
+	driver.UpdatedAt = sm.clock.Now().Unix()
+	sm.bumpVersion()
+	return nil, nil
+}
+
+// DeleteDriver soft-deletes a driver: it is taken offline and marked deleted
+// but kept so orders can still resolve it. Like SetDriverAvailability it
+// refuses while the driver holds assigned or picked-up orders.
+func (sm *StateManager) DeleteDriver(id string) ([]string, error) {
+	sm.lock()
+	defer sm.unlock()
+
+	driver, ok := sm.liveDriver(id)
+	if !ok {
+		return nil, errs.ErrDriverNotFound
+	}
+
+	if activeOrderIDs := sm.activeOrdersOfDriver(id); len(activeOrderIDs) > 0 {
+		return activeOrderIDs, errs.ErrDriverHasActiveOrder
+	}
+
+	now := sm.clock.Now().Unix()
+	sm.driverStatuses.remove(id, driver.Status)
+	driver.Status = models.DriverOffline
+	driver.Deleted = true
+	driver.DeletedAt = now
+	driver.UpdatedAt = now
+	if sm.geo != nil {
+		sm.geo.remove(id)
+	}
+	sm.bumpVersion()
+	return nil, nil
+}
+
+// activeOrdersOfDriver returns the IDs of the assigned and picked-up orders
+// held by a driver, sorted. The caller must hold sm.mu.
+func (sm *StateManager) activeOrdersOfDriver(driverID string) []string {
+	activeOrderIDs := make([]string, 0)
+	for _, active := range []models.OrderStatus{models.OrderAssigned, models.OrderPickedUp} {
+		for _, orderID := range sm.orderStatuses.ids(active) {
+			if sm.orders[orderID].DriverID == driverID {
+				activeOrderIDs = append(activeOrderIDs, orderID)
+			}
+		}
+	}
+	sort.Strings(activeOrderIDs)
+	return activeOrderIDs
+}
+
+// CreateOrder creates a new order with pending status. It fails with
+// ErrOrderExists if the ID is taken.
+// New orders are rejected with ErrCapacityExceeded once MaxOrders is reached,
+// and with ErrCustomerOrderLimit once the customer has MaxOrdersPerCustomer
+// active orders.
+func (sm *StateManager) CreateOrder(order *models.Order) error {
+	sm.lock()
+	defer sm.unlock()
+
+	if _, exists := sm.orders[order.ID]; exists {
+		return errs.ErrOrderExists
+	}
+	if sm.maxOrders > 0 && len(sm.orders) >= sm.maxOrders {
+		return errs.ErrCapacityExceeded
+	}
+	if sm.maxOrdersPerCustomer > 0 && sm.activeOrdersOf(order.Customer, order.ID) >= sm.maxOrdersPerCustomer {
+		return errs.ErrCustomerOrderLimit
+	}
+
+	now := sm.clock.Now().Unix()
 	order.Status = models.OrderPending
 	order.CreatedAt = now
 	order.UpdatedAt = now
+	order.StatusChangedAt = now
 	order.DriverID = ""
+	order.BundleID = ""
 
-	sm.orders[order.ID] = order
+	// Store a copy so the caller can keep reading order without racing the matcher
+	sm.putOrder(order.Clone())
+	sm.bumpVersion()
+	return nil
+}
+
+// activeOrdersOf counts the customer's non-terminal orders, ignoring
+// excludeID. The caller must hold sm.mu.
+func (sm *StateManager) activeOrdersOf(customer, excludeID string) int {
+	count := 0
+	for status, ids := range sm.orderStatuses {
+		if models.IsTerminalOrderStatus(status) {
+			continue
+		}
+		for id := range ids {
+			if id != excludeID && sm.orders[id].Customer == customer {
+				count++
+			}
+		}
+	}
+	return count
 }
 
 // GetOrder retrieves an order by ID
 func (sm *StateManager) GetOrder(id string) (*models.Order, error) {
-	sm.mu.RLock()
+	sm.rlock()
 	defer sm.mu.RUnlock()
 
 	order, ok := sm.orders[id]
@@ -125,31 +584,68 @@ func (sm *StateManager) GetOrder(id string) (*models.Order, error) {
 	}
 
 	// Return a copy to prevent external mutation
-	orderCopy := *order
-	return &orderCopy, nil
+	return order.Clone(), nil
 }
 
-// GetAllOrders returns all orders
+// GetAllOrders returns all orders ordered by ID
 func (sm *StateManager) GetAllOrders() []*models.Order {
-	sm.mu.RLock()
+	sm.rlock()
 	defer sm.mu.RUnlock()
 
 	orders := make([]*models.Order, 0, len(sm.orders))
 	for _, order := range sm.orders {
-		orderCopy := *order
-		orders = append(orders, &orderCopy)
+		orders = append(orders, order.Clone())
 	}
+	sort.Slice(orders, func(i, j int) bool {
+		return orders[i].ID < orders[j].ID
+	})
 	return orders
 }
 
+// StreamOrders calls fn for each order, in no particular order, until fn
+// returns false. It avoids copying every order, but fn runs under the read
+// lock: it must not block, call back into the store, or modify or retain
+// the order it is given.
+func (sm *StateManager) StreamOrders(fn func(order *models.Order) bool) {
+	sm.rlock()
+	defer sm.mu.RUnlock()
+
+	for _, order := range sm.orders {
+		if !fn(order) {
+			return
+		}
+	}
+}
+
+// CancelOrder cancels an order and records reason, which may be empty
+func (sm *StateManager) CancelOrder(id, reason string) error {
+	sm.lock()
+	defer sm.unlock()
+
+	order, ok := sm.orders[id]
+	if !ok {
+		return errs.ErrOrderNotFound
+	}
+
+	if !models.CanTransitionOrderStatus(order.Status, models.OrderCanceled) {
+		return errs.ErrInvalidTransition
+	}
+
+	sm.setOrderStatus(order, models.OrderCanceled)
+	order.CancelReason = reason
+	order.UpdatedAt = sm.clock.Now().Unix()
+	sm.bumpVersion()
+	return nil
+}
+
 // UpdateOrderStatus updates the status of an order with validation
 func (sm *StateManager) UpdateOrderStatus(id string, status models.OrderStatus) error {
 	if !models.IsValidOrderStatus(status) {
 		return errs.ErrInvalidStatusUpdate
 	}
 
-	sm.mu.Lock()
-	defer sm.mu.Unlock()
+	sm.lock()
+	defer sm.unlock()
 
 	order, ok := sm.orders[id]
 	if !ok {
@@ -161,52 +657,473 @@ func (sm *StateManager) UpdateOrderStatus(id string, status models.OrderStatus)
 		return errs.ErrInvalidTransition
 	}
 
-	order.Status = status
-	order.UpdatedAt = models.GetCurrentTimestamp()
+	// Leaving unmatchable starts the order's matcher passes over, as
+	// RequeueOrder does, or the next failure would dead-letter it again
+	if order.Status == models.OrderUnmatchable && status == models.OrderPending {
+		order.MatchAttempts = 0
+	}
+	sm.setOrderStatus(order, status)
+	order.UpdatedAt = sm.clock.Now().Unix()
+	sm.bumpVersion()
 	return nil
 }
 
-// GetPendingOrders returns all orders with pending status
-func (sm *StateManager) GetPendingOrders() []*models.Order {
-	sm.mu.RLock()
+// PatchOrder applies the non-nil fields of patch to an order that has not
+// been picked up yet and re-prices it with price, under the same lock so the
+// price always matches the stored route. Later orders fail with
+// ErrInvalidTransition, as do pickup changes once the order has left
+// pending. Each replaced pickup or dropoff is added to the order's
+// PickupHistory or DropoffHistory.
+func (sm *StateManager) PatchOrder(id string, patch models.OrderPatch, price func(order *models.Order) float64) (*models.Order, error) {
+	sm.lock()
+	defer sm.unlock()
+
+	order, ok := sm.orders[id]
+	if !ok {
+		return nil, errs.ErrOrderNotFound
+	}
+
+	if !models.CanEditOrderStatus(order.Status) {
+		return nil, errs.ErrInvalidTransition
+	}
+	// Drivers are chosen by pickup, so it is fixed once one is on the way
+	if patch.Pickup != nil && order.Status != models.OrderPending {
+		return nil, errs.ErrInvalidTransition
+	}
+
+	now := sm.clock.Now().Unix()
+	if patch.Pickup != nil && *patch.Pickup != order.Pickup {
+		order.PickupHistory = appendLocationHistory(order.PickupHistory, order.Pickup, now)
+		order.Pickup = *patch.Pickup
+	}
+	if patch.Zone != nil {
+		order.Zone = *patch.Zone
+	}
+	if patch.Dropoff != nil && *patch.Dropoff != order.Dropoff {
+		order.DropoffHistory = appendLocationHistory(order.DropoffHistory, order.Dropoff, now)
+		order.Dropoff = *patch.Dropoff
+	}
+	if patch.Pickup != nil || patch.Dropoff != nil {
+		order.Price = price(order)
+	}
+	if patch.Notes != nil {
+		order.Notes = *patch.Notes
+	}
+	order.UpdatedAt = now
+	sm.bumpVersion()
+
+	return order.Clone(), nil
+}
+
+// appendLocationHistory records loc, replaced at now, at the end of history,
+// dropping the oldest entry once maxLocationHistory are kept
+func appendLocationHistory(history []models.TimestampedLocation, loc models.Location, now int64) []models.TimestampedLocation {
+	if len(history) >= maxLocationHistory {
+		history = history[1:]
+	}
+	return append(slices.Clip(history), models.TimestampedLocation{Location: loc, Timestamp: now})
+}
+
+// GetOrdersByDriver returns every order ever assigned to a driver, ordered by ID
+func (sm *StateManager) GetOrdersByDriver(driverID string) []*models.Order {
+	sm.rlock()
 	defer sm.mu.RUnlock()
 
-	pending := make([]*models.Order, 0)
+	orders := make([]*models.Order, 0)
 	for _, order := range sm.orders {
-		if order.Status == models.OrderPending {
-			orderCopy := *order
-			pending = append(pending, &orderCopy)
+		if order.DriverID == driverID {
+			orders = append(orders, order.Clone())
 		}
 	}
-	return pending
+	sort.Slice(orders, func(i, j int) bool {
+		return orders[i].ID < orders[j].ID
+	})
+	return orders
 }
 
-// GetAvailableDrivers returns all drivers with available status
-func (sm *StateManager) GetAvailableDrivers() []*models.Driver {
-	sm.mu.RLock()
+// GetPendingOrders returns all orders with pending status, ordered by ID
+func (sm *StateManager) GetPendingOrders() []*models.Order {
+	return sm.GetOrdersByStatus(models.OrderPending)
+}
+
+// GetReadyOrders returns pending orders that are not scheduled after now,
+// ordered by ID
+func (sm *StateManager) GetReadyOrders(now int64) []*models.Order {
+	sm.rlock()
 	defer sm.mu.RUnlock()
 
-	available := make([]*models.Driver, 0)
-	for _, driver := range sm.drivers {
-		if driver.Status == models.DriverAvailable {
-			driverCopy := *driver
-			available = append(available, &driverCopy)
+	ready := make([]*models.Order, 0)
+	for _, id := range sm.orderStatuses.ids(models.OrderPending) {
+		if order := sm.orders[id]; order.ScheduledFor <= now {
+			ready = append(ready, order.Clone())
+		}
+	}
+	return ready
+}
+
+// GetOrdersByStatus returns all orders with the given status, ordered by ID
+func (sm *StateManager) GetOrdersByStatus(status models.OrderStatus) []*models.Order {
+	sm.rlock()
+	defer sm.mu.RUnlock()
+
+	ids := sm.orderStatuses.ids(status)
+	orders := make([]*models.Order, 0, len(ids))
+	for _, id := range ids {
+		orders = append(orders, sm.orders[id].Clone())
+	}
+	return orders
+}
+
+// RecordMatchFailures increments the match attempts of each still-pending
+// order and moves those reaching maxAttempts to unmatchable.
+// It returns the IDs of the orders that were moved.
+func (sm *StateManager) RecordMatchFailures(orderIDs []string, maxAttempts int) []string {
+	sm.lock()
+	defer sm.unlock()
+
+	now := sm.clock.Now().Unix()
+	deadLettered := make([]string, 0)
+	for _, id := range orderIDs {
+		order, ok := sm.orders[id]
+		if !ok || order.Status != models.OrderPending {
+			continue
 		}
+
+		order.MatchAttempts++
+		if order.MatchAttempts >= maxAttempts {
+			sm.setOrderStatus(order, models.OrderUnmatchable)
+			order.UpdatedAt = now
+			deadLettered = append(deadLettered, id)
+		}
+	}
+	sm.bumpVersion()
+	return deadLettered
+}
+
+// RequeueOrder moves an unmatchable order back to pending with its match
+// attempts reset
+func (sm *StateManager) RequeueOrder(id string) error {
+	sm.lock()
+	defer sm.unlock()
+
+	order, ok := sm.orders[id]
+	if !ok {
+		return errs.ErrOrderNotFound
+	}
+
+	if order.Status != models.OrderUnmatchable {
+		return errs.ErrInvalidTransition
+	}
+
+	sm.setOrderStatus(order, models.OrderPending)
+	order.MatchAttempts = 0
+	order.UpdatedAt = sm.clock.Now().Unix()
+	sm.bumpVersion()
+	return nil
+}
+
+// ReleaseOrphanedOrders returns assigned orders whose driver no longer
+// exists or has been deleted to pending, and returns their IDs
+func (sm *StateManager) ReleaseOrphanedOrders() []string {
+	sm.lock()
+	defer sm.unlock()
+
+	var released []string
+	for _, id := range sm.orderStatuses.ids(models.OrderAssigned) {
+		order := sm.orders[id]
+		if _, ok := sm.liveDriver(order.DriverID); ok {
+			continue
+		}
+
+		sm.setOrderStatus(order, models.OrderPending)
+		order.DriverID = ""
+		order.AssignmentDistanceKm = 0
+		order.UpdatedAt = sm.clock.Now().Unix()
+		released = append(released, id)
+	}
+	if len(released) > 0 {
+		sm.bumpVersion()
+	}
+	return released
+}
+
+// OfferOrder offers a pending order to driverIDs until expiresAt and returns
+// the offered order. The order waits in the offered status, out of the
+// matcher's reach, until one driver accepts or the offers expire; queue
+// holds the drivers to offer it to next, best first.
+func (sm *StateManager) OfferOrder(orderID string, driverIDs, queue []string, expiresAt int64) (*models.Order, error) {
+	sm.lock()
+	defer sm.unlock()
+
+	order, ok := sm.orders[orderID]
+	if !ok {
+		return nil, errs.ErrOrderNotFound
+	}
+	if order.Status != models.OrderPending {
+		return nil, errs.ErrOrderAlreadyAssigned
+	}
+
+	sm.setOrderStatus(order, models.OrderOffered)
+	order.OfferedTo = slices.Clone(driverIDs)
+	order.OfferQueue = slices.Clone(queue)
+	order.OfferExpiresAt = expiresAt
+	order.UpdatedAt = sm.clock.Now().Unix()
+	sm.bumpVersion()
+	return order.Clone(), nil
+}
+
+// AcceptOffer assigns an offered order to driverID if the driver holds an
+// unexpired offer for it. The first driver to accept wins and every other
+// offer is withdrawn, so later accepts fail with ErrOfferNotOpen.
+func (sm *StateManager) AcceptOffer(orderID, driverID string) error {
+	sm.lock()
+	defer sm.unlock()
+
+	order, ok := sm.orders[orderID]
+	if !ok {
+		return errs.ErrOrderNotFound
+	}
+	if order.Status != models.OrderOffered || !slices.Contains(order.OfferedTo, driverID) ||
+		sm.clock.Now().Unix() >= order.OfferExpiresAt {
+		return errs.ErrOfferNotOpen
+	}
+
+	driver, ok := sm.liveDriver(driverID)
+	if !ok {
+		return errs.ErrDriverNotFound
+	}
+	return sm.assign(order, driver)
+}
+
+// ExpireOffers handles offered orders whose offers lapsed by now. Each is
+// offered until expiresAt to the next batch drivers of its queue who can
+// still take it, skipping the rest; an order whose queue runs dry moves to
+// unmatchable. Each driver the lapsed offer was waiting on has it counted
+// against their OfferLapses. It returns the IDs of the renewed and the
+// expired orders and of the drivers who let an offer lapse.
+func (sm *StateManager) ExpireOffers(now, expiresAt int64, batch int) (renewed, expired, lapsed []string) {
+	sm.lock()
+	defer sm.unlock()
+
+	today := models.Day(sm.clock.Now())
+	for _, id := range sm.orderStatuses.ids(models.OrderOffered) {
+		order := sm.orders[id]
+		if order.OfferExpiresAt > now {
+			continue
+		}
+
+		// Every driver the offer was waiting on let it lapse
+		for _, driverID := range order.OfferedTo {
+			if driver, ok := sm.liveDriver(driverID); ok {
+				driver.OfferLapses = driver.DecayedOfferLapses(now, sm.offerLapseHalfLife) + 1
+				driver.OfferLapsedAt = now
+				lapsed = append(lapsed, driverID)
+			}
+		}
+
+		var next []string
+		taken := 0
+		for _, driverID := range order.OfferQueue {
+			if len(next) >= batch {
+				break
+			}
+			taken++
+			if driver, ok := sm.liveDriver(driverID); ok && sm.hasSpareCapacity(driver) && driver.RemainingDailyOrders(today) != 0 {
+				next = append(next, driverID)
+			}
+		}
+
+		if len(next) > 0 {
+			order.OfferedTo = next
+			order.OfferQueue = slices.Clone(order.OfferQueue[taken:])
+			order.OfferExpiresAt = expiresAt
+			renewed = append(renewed, id)
+		} else {
+			sm.setOrderStatus(order, models.OrderUnmatchable)
+			expired = append(expired, id)
+		}
+		order.UpdatedAt = sm.clock.Now().Unix()
+	}
+	if len(renewed) > 0 || len(expired) > 0 {
+		sm.bumpVersion()
+	}
+	return renewed, expired, lapsed
+}
+
+// CountDrivers returns how many live drivers hold status
+func (sm *StateManager) CountDrivers(status models.DriverStatus) int {
+	sm.rlock()
+	defer sm.mu.RUnlock()
+
+	return len(sm.driverStatuses[status])
+}
+
+// CountOrders returns how many orders hold status
+func (sm *StateManager) CountOrders(status models.OrderStatus) int {
+	sm.rlock()
+	defer sm.mu.RUnlock()
+
+	return len(sm.orderStatuses[status])
+}
+
+// GetAvailableDrivers returns all drivers with available status, sorted by ID
+func (sm *StateManager) GetAvailableDrivers() []*models.Driver {
+	sm.rlockDrivers()
+	defer sm.runlockDrivers()
+
+	ids := sm.driverStatuses.ids(models.DriverAvailable)
+	available := make([]*models.Driver, 0, len(ids))
+	for _, id := range ids {
+		available = append(available, sm.drivers[id].Clone())
 	}
 	return available
 }
 
+// GetAssignableDrivers returns the drivers who can take another order,
+// sorted by ID: every available driver, plus busy drivers who carry at least
+// one active order but fewer than their capacity. Busy drivers without
+// active orders are left alone until they go available again.
+func (sm *StateManager) GetAssignableDrivers() []*models.Driver {
+	sm.rlockDrivers()
+	defer sm.runlockDrivers()
+
+	ids := sm.driverStatuses.ids(models.DriverAvailable)
+	loads := sm.activeOrderCounts()
+	for _, id := range sm.driverStatuses.ids(models.DriverBusy) {
+		if load := loads[id]; load > 0 && load < sm.capacityOf(sm.drivers[id]) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	assignable := make([]*models.Driver, 0, len(ids))
+	for _, id := range ids {
+		assignable = append(assignable, sm.drivers[id].Clone())
+	}
+	return assignable
+}
+
+// activeOrderCounts returns how many assigned and picked-up orders each
+// driver carries. The caller must hold sm.mu.
+func (sm *StateManager) activeOrderCounts() map[string]int {
+	counts := make(map[string]int)
+	for _, active := range []models.OrderStatus{models.OrderAssigned, models.OrderPickedUp} {
+		for orderID := range sm.orderStatuses[active] {
+			counts[sm.orders[orderID].DriverID]++
+		}
+	}
+	return counts
+}
+
+// hasSpareCapacity reports whether driver can take another order: they are
+// available, or busy with at least one but fewer than their capacity of
+// active orders. The caller must hold sm.mu.
+func (sm *StateManager) hasSpareCapacity(driver *models.Driver) bool {
+	switch driver.Status {
+	case models.DriverAvailable:
+		return true
+	case models.DriverBusy:
+		load := len(sm.activeOrdersOfDriver(driver.ID))
+		return load > 0 && load < sm.capacityOf(driver)
+	default:
+		return false
+	}
+}
+
+// capacityOf returns how many active orders driver may carry at once
+func (sm *StateManager) capacityOf(driver *models.Driver) int {
+	if driver.Capacity > 0 {
+		return driver.Capacity
+	}
+	return sm.driverCapacity
+}
+
+// GetNearbyDrivers returns drivers within radiusKm of center, nearest first
+// with ties broken by ID. Deleted drivers are skipped.
+func (sm *StateManager) GetNearbyDrivers(center models.Location, radiusKm float64) []*models.Driver {
+	sm.rlockDrivers()
+	defer sm.runlockDrivers()
+
+	var candidates []*models.Driver
+	if ids, ok := sm.indexedCandidates(center, radiusKm); ok {
+		candidates = make([]*models.Driver, 0, len(ids))
+		for _, id := range ids {
+			candidates = append(candidates, sm.drivers[id])
+		}
+	} else {
+		candidates = make([]*models.Driver, 0, len(sm.drivers))
+		for _, driver := range sm.drivers {
+			candidates = append(candidates, driver)
+		}
+	}
+
+	nearby := make([]*models.Driver, 0)
+	distances := make(map[string]float64)
+	for _, driver := range candidates {
+		if driver.Deleted {
+			continue
+		}
+		distance := models.DistanceKm(center, driver.Location)
+		if distance <= radiusKm {
+			nearby = append(nearby, driver.Clone())
+			distances[driver.ID] = distance
+		}
+	}
+
+	sort.Slice(nearby, func(i, j int) bool {
+		di, dj := distances[nearby[i].ID], distances[nearby[j].ID]
+		if di != dj {
+			return di < dj
+		}
+		return nearby[i].ID < nearby[j].ID
+	})
+	return nearby
+}
+
+// indexedCandidates returns candidate driver IDs from the geohash index, or
+// false if the index is disabled or cannot serve the radius.
+// The caller must hold sm.mu.
+func (sm *StateManager) indexedCandidates(center models.Location, radiusKm float64) ([]string, bool) {
+	if sm.geo == nil {
+		return nil, false
+	}
+	return sm.geo.candidates(center, radiusKm)
+}
+
+// AssignMatchedOrder assigns an order like AssignOrderToDriver, but only if
+// its pickup is still pickup. The matcher ranks drivers on a copy of the
+// order, so this keeps a pass from assigning on a pickup corrected in the
+// meantime; it fails with ErrPickupChanged instead.
+func (sm *StateManager) AssignMatchedOrder(orderID, driverID string, pickup models.Location) error {
+	sm.lock()
+	defer sm.unlock()
+
+	order, ok := sm.orders[orderID]
+	if !ok {
+		return errs.ErrOrderNotFound
+	}
+	if order.Pickup != pickup {
+		return errs.ErrPickupChanged
+	}
+	return sm.assignOrder(order, driverID)
+}
+
 // AssignOrderToDriver atomically assigns an order to a driver
 func (sm *StateManager) AssignOrderToDriver(orderID, driverID string) error {
-	sm.mu.Lock()
-	defer sm.mu.Unlock()
+	sm.lock()
+	defer sm.unlock()
 
 	order, ok := sm.orders[orderID]
 	if !ok {
 		return errs.ErrOrderNotFound
 	}
+	return sm.assignOrder(order, driverID)
+}
 
-	driver, ok := sm.drivers[driverID]
+// assignOrder assigns a pending order to a live driver. A bundled order
+// takes the rest of its bundle with it. The caller must hold sm.mu.
+func (sm *StateManager) assignOrder(order *models.Order, driverID string) error {
+	driver, ok := sm.liveDriver(driverID)
 	if !ok {
 		return errs.ErrDriverNotFound
 	}
@@ -216,42 +1133,392 @@ func (sm *StateManager) AssignOrderToDriver(orderID, driverID string) error {
 		return errs.ErrOrderAlreadyAssigned
 	}
 
+	if order.BundleID != "" {
+		return sm.assignBundle(order.BundleID, driver)
+	}
+	return sm.assign(order, driver)
+}
+
+// BundleOrders groups pending orders under bundleID so they are assigned
+// together. Every order must exist, be pending and not already be in a
+// bundle, or none is bundled. Members are rescheduled to the latest
+// scheduled time among them, so the bundle becomes ready all at once.
+func (sm *StateManager) BundleOrders(bundleID string, orderIDs []string) error {
+	sm.lock()
+	defer sm.unlock()
+
+	members := make([]*models.Order, 0, len(orderIDs))
+	var scheduledFor int64
+	for _, id := range orderIDs {
+		order, ok := sm.orders[id]
+		if !ok {
+			return errs.ErrOrderNotFound
+		}
+		if order.Status != models.OrderPending {
+			return errs.ErrOrderAlreadyAssigned
+		}
+		if order.BundleID != "" {
+			return errs.ErrOrderBundled
+		}
+		members = append(members, order)
+		scheduledFor = max(scheduledFor, order.ScheduledFor)
+	}
+
+	now := sm.clock.Now().Unix()
+	for _, order := range members {
+		order.BundleID = bundleID
+		order.ScheduledFor = scheduledFor
+		order.UpdatedAt = now
+	}
+	sm.bumpVersion()
+	return nil
+}
+
+// assignBundle gives every pending order of bundleID to driver, or none of
+// them when the driver cannot carry them all. The caller must hold sm.mu.
+func (sm *StateManager) assignBundle(bundleID string, driver *models.Driver) error {
+	var members []*models.Order
+	for _, id := range sm.orderStatuses.ids(models.OrderPending) {
+		if order := sm.orders[id]; order.BundleID == bundleID {
+			members = append(members, order)
+		}
+	}
+
+	if !sm.hasSpareCapacity(driver) {
+		return errs.ErrDriverNotAvailable
+	}
+	if sm.capacityOf(driver)-len(sm.activeOrdersOfDriver(driver.ID)) < len(members) {
+		return errs.ErrBundleExceedsCapacity
+	}
+	remaining := driver.RemainingDailyOrders(models.Day(sm.clock.Now()))
+	if remaining == 0 {
+		return errs.ErrDriverDailyLimit
+	}
+	if remaining > 0 && remaining < len(members) {
+		return errs.ErrBundleExceedsCapacity
+	}
+
+	for _, order := range members {
+		if err := sm.assign(order, driver); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bundleOf returns orderID and the IDs of the other orders in its bundle,
+// if any, sorted
+func (sm *StateManager) bundleOf(orderID string) []string {
+	sm.rlock()
+	defer sm.mu.RUnlock()
+
+	order, ok := sm.orders[orderID]
+	if !ok || order.BundleID == "" {
+		return []string{orderID}
+	}
+	var ids []string
+	for id, other := range sm.orders {
+		if other.BundleID == order.BundleID {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// assign gives order to driver if the driver is available, or busy with
+// spare capacity, and below their daily cap. The caller must hold sm.mu and
+// have checked the order's status.
+func (sm *StateManager) assign(order *models.Order, driver *models.Driver) error {
 	// Validate driver status
-	if driver.Status != models.DriverAvailable {
+	if !sm.hasSpareCapacity(driver) {
 		return errs.ErrDriverNotAvailable
 	}
 
+	now := sm.clock.Now()
+	today := models.Day(now)
+	if driver.RemainingDailyOrders(today) == 0 {
+		return errs.ErrDriverDailyLimit
+	}
+
 	// Perform atomic assignment
-	order.Status = models.OrderAssigned
-	order.DriverID = driverID
-	order.UpdatedAt = models.GetCurrentTimestamp()
+	sm.setOrderStatus(order, models.OrderAssigned)
+	order.DriverID = driver.ID
+	order.AssignmentDistanceKm = models.DistanceKm(driver.Location, order.Pickup)
+	order.UpdatedAt = now.Unix()
+	order.AssignmentHistory = append(slices.Clip(order.AssignmentHistory), models.AssignmentRecord{
+		DriverID:   driver.ID,
+		AssignedAt: order.UpdatedAt,
+	})
 
-	driver.Status = models.DriverBusy
-	driver.UpdatedAt = models.GetCurrentTimestamp()
+	sm.setDriverStatus(driver, models.DriverBusy)
+	driver.DailyOrders = driver.OrdersOn(today) + 1
+	driver.DailyOrdersDate = today
+	driver.LastAssignedAt = now.Unix()
+	driver.UpdatedAt = now.Unix()
+	sm.bumpVersion()
 
 	return nil
 }
 
+// HandoffOrder moves a picked-up order to another available driver mid-route
+// and returns the driver who held it. The order stays picked up; its open
+// assignment record is closed as handed off and a new one opened. The
+// previous driver becomes available again unless they still hold other
+// active orders. Orders in any other status fail with ErrInvalidTransition.
+func (sm *StateManager) HandoffOrder(orderID, driverID string) (string, error) {
+	sm.lock()
+	defer sm.unlock()
+
+	order, ok := sm.orders[orderID]
+	if !ok {
+		return "", errs.ErrOrderNotFound
+	}
+	if order.Status != models.OrderPickedUp {
+		return "", errs.ErrInvalidTransition
+	}
+
+	driver, ok := sm.liveDriver(driverID)
+	if !ok {
+		return "", errs.ErrDriverNotFound
+	}
+	if driver.Status != models.DriverAvailable {
+		return "", errs.ErrDriverNotAvailable
+	}
+	today := models.Day(sm.clock.Now())
+	if driver.RemainingDailyOrders(today) == 0 {
+		return "", errs.ErrDriverDailyLimit
+	}
+
+	now := sm.clock.Now().Unix()
+	if n := len(order.AssignmentHistory); n > 0 && order.AssignmentHistory[n-1].ReleasedAt == 0 {
+		record := &order.AssignmentHistory[n-1]
+		record.ReleasedAt = now
+		record.Reason = models.ReleaseHandedOff
+	}
+	order.AssignmentHistory = append(slices.Clip(order.AssignmentHistory), models.AssignmentRecord{
+		DriverID:   driver.ID,
+		AssignedAt: now,
+	})
+	previous := order.DriverID
+	order.DriverID = driver.ID
+	order.UpdatedAt = now
+
+	if old, ok := sm.liveDriver(previous); ok && old.Status == models.DriverBusy && len(sm.activeOrdersOfDriver(previous)) == 0 {
+		sm.setDriverStatus(old, models.DriverAvailable)
+		old.UpdatedAt = now
+	}
+
+	sm.setDriverStatus(driver, models.DriverBusy)
+	driver.DailyOrders = driver.OrdersOn(today) + 1
+	driver.DailyOrdersDate = today
+	driver.LastAssignedAt = sm.clock.Now().Unix()
+	driver.UpdatedAt = now
+	sm.bumpVersion()
+
+	return previous, nil
+}
+
 // GetSnapshot returns a complete snapshot of the current state
 func (sm *StateManager) GetSnapshot() models.StateSnapshot {
-	sm.mu.RLock()
-	defer sm.mu.RUnlock()
+	sm.rlockDrivers()
+	defer sm.runlockDrivers()
 
 	snapshot := models.StateSnapshot{
 		Drivers:   make(map[string]*models.Driver),
 		Orders:    make(map[string]*models.Order),
-		Timestamp: models.GetCurrentTimestamp(),
+		Version:   sm.version.Load(),
+		Timestamp: sm.clock.Now().Unix(),
 	}
 
 	for id, driver := range sm.drivers {
-		driverCopy := *driver
-		snapshot.Drivers[id] = &driverCopy
+		snapshot.Drivers[id] = driver.Clone()
 	}
 
 	for id, order := range sm.orders {
-		orderCopy := *order
-		snapshot.Orders[id] = &orderCopy
+		snapshot.Orders[id] = order.Clone()
 	}
 
 	return snapshot
 }
+
+// GetVersion returns the current state version, which changes on every mutation
+func (sm *StateManager) GetVersion() uint64 {
+	return sm.version.Load()
+}
+
+// Reset removes every driver and order, returning how many were removed
+func (sm *StateManager) Reset() (drivers, orders int) {
+	sm.lock()
+	defer sm.unlock()
+
+	drivers, orders = len(sm.drivers), len(sm.orders)
+	sm.clear()
+	sm.bumpVersion()
+
+	return drivers, orders
+}
+
+// clear removes every driver and order along with their indexes, leaving
+// the version alone. The caller must hold the write lock.
+func (sm *StateManager) clear() {
+	sm.drivers = make(map[string]*models.Driver)
+	sm.orders = make(map[string]*models.Order)
+	sm.driverStatuses = make(statusIndex[models.DriverStatus])
+	sm.orderStatuses = make(statusIndex[models.OrderStatus])
+	if sm.geo != nil {
+		sm.geo = newGeoIndex()
+	}
+}
+
+// PurgeSimulated removes every simulated driver and order, leaving real
+// ones untouched, and returns how many of each were removed
+func (sm *StateManager) PurgeSimulated() (drivers, orders int) {
+	sm.lock()
+	defer sm.unlock()
+
+	for _, driver := range sm.drivers {
+		if !driver.Simulated {
+			continue
+		}
+		sm.deleteDriver(driver)
+		if sm.geo != nil {
+			sm.geo.remove(driver.ID)
+		}
+		drivers++
+	}
+	for _, order := range sm.orders {
+		if !order.Simulated {
+			continue
+		}
+		sm.deleteOrder(order)
+		orders++
+	}
+	if drivers > 0 || orders > 0 {
+		sm.bumpVersion()
+	}
+	return drivers, orders
+}
+
+// RestoreSnapshot replaces all state with the contents of snapshot. It fails
+// with ErrCapacityExceeded, leaving state untouched, if the snapshot holds
+// more drivers or orders than allowed.
+func (sm *StateManager) RestoreSnapshot(snapshot models.StateSnapshot) error {
+	if sm.maxDrivers > 0 && len(snapshot.Drivers) > sm.maxDrivers {
+		return errs.ErrCapacityExceeded
+	}
+	if sm.maxOrders > 0 && len(snapshot.Orders) > sm.maxOrders {
+		return errs.ErrCapacityExceeded
+	}
+
+	sm.restore(snapshot)
+	return nil
+}
+
+// Seed adds drivers and orders with their statuses and assignments as given.
+// New IDs only are accepted, and every assigned or picked-up order must
+// reference a busy driver, either seeded alongside it or already stored.
+// Inconsistencies are reported as a ValidationError and nothing is added.
+func (sm *StateManager) Seed(drivers []*models.Driver, orders []*models.Order) error {
+	sm.lock()
+	defer sm.unlock()
+
+	if sm.maxDrivers > 0 && len(sm.drivers)+len(drivers) > sm.maxDrivers {
+		return errs.ErrCapacityExceeded
+	}
+	if sm.maxOrders > 0 && len(sm.orders)+len(orders) > sm.maxOrders {
+		return errs.ErrCapacityExceeded
+	}
+
+	fields := make(map[string]string)
+	seeded := make(map[string]*models.Driver, len(drivers))
+	for i, driver := range drivers {
+		_, stored := sm.drivers[driver.ID]
+		if stored || seeded[driver.ID] != nil {
+			fields[fmt.Sprintf("drivers[%d].id", i)] = "already exists"
+			continue
+		}
+		seeded[driver.ID] = driver
+	}
+
+	orderIDs := make(map[string]bool, len(orders))
+	for i, order := range orders {
+		prefix := fmt.Sprintf("orders[%d]", i)
+		if _, stored := sm.orders[order.ID]; stored || orderIDs[order.ID] {
+			fields[prefix+".id"] = "already exists"
+		}
+		orderIDs[order.ID] = true
+
+		driver := seeded[order.DriverID]
+		if driver == nil {
+			driver = sm.drivers[order.DriverID]
+		}
+		switch {
+		case order.Status == models.OrderAssigned || order.Status == models.OrderPickedUp:
+			if driver == nil {
+				fields[prefix+".driver_id"] = errs.ErrDriverNotFound.Error()
+			} else if driver.Status != models.DriverBusy {
+				fields[prefix+".driver_id"] = "driver of an active order must be busy"
+			}
+		case order.DriverID == "":
+		case order.Status == models.OrderPending || order.Status == models.OrderUnmatchable || order.Status == models.OrderOffered:
+			fields[prefix+".driver_id"] = "must be empty for an unassigned order"
+		case driver == nil:
+			fields[prefix+".driver_id"] = errs.ErrDriverNotFound.Error()
+		}
+	}
+	if len(fields) > 0 {
+		return &errs.ValidationError{Fields: fields}
+	}
+
+	now := sm.clock.Now().Unix()
+	for _, driver := range drivers {
+		driverCopy := driver.Clone()
+		driverCopy.CreatedAt = cmp.Or(driverCopy.CreatedAt, now)
+		driverCopy.UpdatedAt = cmp.Or(driverCopy.UpdatedAt, now)
+		sm.putDriver(driverCopy)
+		if sm.geo != nil {
+			sm.geo.upsert(driverCopy.ID, driverCopy.Location)
+		}
+	}
+	for _, order := range orders {
+		orderCopy := order.Clone()
+		orderCopy.CreatedAt = cmp.Or(orderCopy.CreatedAt, now)
+		orderCopy.UpdatedAt = cmp.Or(orderCopy.UpdatedAt, now)
+		sm.putOrder(orderCopy)
+	}
+	sm.bumpVersion()
+	return nil
+}
+
+// restore replaces all state with copies of the drivers and orders in snapshot
+func (sm *StateManager) restore(snapshot models.StateSnapshot) {
+	sm.lock()
+	defer sm.unlock()
+
+	sm.drivers = make(map[string]*models.Driver, len(snapshot.Drivers))
+	sm.driverStatuses = make(statusIndex[models.DriverStatus])
+	if sm.geo != nil {
+		sm.geo = newGeoIndex()
+	}
+	for id, driver := range snapshot.Drivers {
+		driverCopy := driver.Clone()
+		driverCopy.ID = id
+		sm.putDriver(driverCopy)
+		if sm.geo != nil {
+			sm.geo.upsert(id, driver.Location)
+		}
+	}
+
+	sm.orders = make(map[string]*models.Order, len(snapshot.Orders))
+	sm.orderStatuses = make(statusIndex[models.OrderStatus])
+	for id, order := range snapshot.Orders {
+		orderCopy := order.Clone()
+		orderCopy.ID = id
+		sm.putOrder(orderCopy)
+	}
+
+	// Move past both versions so no earlier ETag can match the restored state
+	sm.version.Store(max(sm.version.Load(), snapshot.Version) + 1)
+	sm.versionChanged.broadcast()
+}
@@ -0,0 +1,440 @@
+package repository
+
+import (
+	"delivery-state-manager/internal/models"
+	"delivery-state-manager/pkg/clock"
+	"delivery-state-manager/pkg/errs"
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testDriver is an available driver for seeding a store
+func testDriver(id string) *models.Driver {
+	return &models.Driver{ID: id, Name: "Driver " + id, Status: models.DriverAvailable, Location: models.Location{Lat: 37.77, Lon: -122.42}}
+}
+
+// testOrder is a pending order for seeding a store
+func testOrder(id string) *models.Order {
+	return &models.Order{
+		ID:       id,
+		Customer: "customer-" + id,
+		Status:   models.OrderPending,
+		Pickup:   models.Location{Lat: 37.77, Lon: -122.42},
+		Dropoff:  models.Location{Lat: 37.78, Lon: -122.42},
+	}
+}
+
+func TestUpdateOrderStatusFromUnmatchableResetsAttempts(t *testing.T) {
+	sm := newStateManager(Config{})
+	if err := sm.CreateOrder(testOrder("o1")); err != nil {
+		t.Fatalf("CreateOrder: %v", err)
+	}
+	if dead := sm.RecordMatchFailures([]string{"o1"}, 1); len(dead) != 1 {
+		t.Fatalf("RecordMatchFailures moved %v, want o1 to unmatchable", dead)
+	}
+
+	if err := sm.UpdateOrderStatus("o1", models.OrderPending); err != nil {
+		t.Fatalf("UpdateOrderStatus: %v", err)
+	}
+	order, _ := sm.GetOrder("o1")
+	if order.Status != models.OrderPending || order.MatchAttempts != 0 {
+		t.Fatalf("order is %s with %d attempts, want pending with 0", order.Status, order.MatchAttempts)
+	}
+	// A single failure no longer dead-letters it
+	if dead := sm.RecordMatchFailures([]string{"o1"}, 2); len(dead) != 0 {
+		t.Errorf("RecordMatchFailures moved %v after one failure, want none", dead)
+	}
+}
+
+func TestDailyOrderCapResetsAtMidnight(t *testing.T) {
+	clk := clock.NewFake(time.Date(2026, 3, 9, 23, 50, 0, 0, time.Local))
+	sm := newStateManager(Config{Clock: clk, DriverCapacity: 1})
+	driver := testDriver("d1")
+	driver.MaxDailyOrders = 1
+	sm.CreateOrUpdateDriver(driver)
+	for _, id := range []string{"o1", "o2", "o3"} {
+		sm.CreateOrder(testOrder(id))
+	}
+
+	if err := sm.AssignOrderToDriver("o1", "d1"); err != nil {
+		t.Fatalf("first assignment: %v", err)
+	}
+	sm.UpdateOrderStatus("o1", models.OrderPickedUp)
+	sm.UpdateOrderStatus("o1", models.OrderDelivered)
+	if err := sm.UpdateDriverStatus("d1", models.DriverAvailable); err != nil {
+		t.Fatalf("UpdateDriverStatus: %v", err)
+	}
+	if err := sm.AssignOrderToDriver("o2", "d1"); err != errs.ErrDriverDailyLimit {
+		t.Fatalf("second assignment the same day: err = %v, want %v", err, errs.ErrDriverDailyLimit)
+	}
+
+	clk.Advance(20 * time.Minute)
+	if err := sm.AssignOrderToDriver("o3", "d1"); err != nil {
+		t.Fatalf("assignment after midnight: %v", err)
+	}
+	got, _ := sm.GetDriver("d1")
+	if got.DailyOrdersDate != "2026-03-10" || got.DailyOrders != 1 {
+		t.Errorf("daily count = %d on %q, want 1 on 2026-03-10", got.DailyOrders, got.DailyOrdersDate)
+	}
+	order, _ := sm.GetOrder("o3")
+	if order.UpdatedAt != clk.Now().Unix() || order.StatusChangedAt != clk.Now().Unix() || got.UpdatedAt != clk.Now().Unix() {
+		t.Errorf("timestamps %d, %d and %d do not come from the store clock %d", order.UpdatedAt, order.StatusChangedAt, got.UpdatedAt, clk.Now().Unix())
+	}
+	delivered, _ := sm.GetOrder("o1")
+	if record := delivered.AssignmentHistory[0]; record.ReleasedAt != clk.Now().Add(-20*time.Minute).Unix() {
+		t.Errorf("ReleasedAt = %d, want the store clock's %d", record.ReleasedAt, clk.Now().Add(-20*time.Minute).Unix())
+	}
+}
+
+func TestListDriversAfterDoesNotDrift(t *testing.T) {
+	sm := newStateManager(Config{})
+	for _, id := range []string{"b", "d", "f"} {
+		sm.CreateOrUpdateDriver(testDriver(id))
+	}
+
+	page := sm.ListDriversAfter("", 2)
+	if len(page) != 2 || page[1].ID != "d" {
+		t.Fatalf("first page = %v, want b and d", page)
+	}
+	// A driver added before the cursor neither repeats nor shifts the next page
+	sm.CreateOrUpdateDriver(testDriver("a"))
+	sm.CreateOrUpdateDriver(testDriver("e"))
+	page = sm.ListDriversAfter("d", 2)
+	if len(page) != 2 || page[0].ID != "e" || page[1].ID != "f" {
+		t.Errorf("second page = %v, want e and f", page)
+	}
+}
+
+func TestCompareAndSetDriverStatusHasOneWinner(t *testing.T) {
+	sm := newStateManager(Config{})
+	sm.CreateOrUpdateDriver(testDriver("d1"))
+
+	if err := sm.CompareAndSetDriverStatus("d1", models.DriverBusy, models.DriverOffline); err != errs.ErrDriverStatusConflict {
+		t.Fatalf("mismatched expected status: err = %v, want %v", err, errs.ErrDriverStatusConflict)
+	}
+	if err := sm.CompareAndSetDriverStatus("nobody", models.DriverAvailable, models.DriverOffline); err != errs.ErrDriverNotFound {
+		t.Errorf("unknown driver: err = %v, want %v", err, errs.ErrDriverNotFound)
+	}
+
+	// Dispatchers racing to take the same available driver: exactly one wins
+	var wins atomic.Int32
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			switch err := sm.CompareAndSetDriverStatus("d1", models.DriverAvailable, models.DriverOffline); err {
+			case nil:
+				wins.Add(1)
+			case errs.ErrDriverStatusConflict:
+			default:
+				t.Errorf("CompareAndSetDriverStatus: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if wins.Load() != 1 {
+		t.Errorf("%d dispatchers won, want 1", wins.Load())
+	}
+	if driver, _ := sm.GetDriver("d1"); driver.Status != models.DriverOffline {
+		t.Errorf("status = %s, want offline", driver.Status)
+	}
+}
+
+func TestCapacityLimitsOnlyBlockNewEntities(t *testing.T) {
+	sm := newStateManager(Config{MaxDrivers: 2, MaxOrders: 2})
+	for _, id := range []string{"d1", "d2"} {
+		if err := sm.CreateOrUpdateDriver(testDriver(id)); err != nil {
+			t.Fatalf("driver %s within the limit: %v", id, err)
+		}
+	}
+	for _, id := range []string{"o1", "o2"} {
+		if err := sm.CreateOrder(testOrder(id)); err != nil {
+			t.Fatalf("order %s within the limit: %v", id, err)
+		}
+	}
+
+	if err := sm.CreateOrUpdateDriver(testDriver("d3")); err != errs.ErrCapacityExceeded {
+		t.Errorf("driver beyond the limit: err = %v, want %v", err, errs.ErrCapacityExceeded)
+	}
+	if err := sm.CreateOrder(testOrder("o3")); err != errs.ErrCapacityExceeded {
+		t.Errorf("order beyond the limit: err = %v, want %v", err, errs.ErrCapacityExceeded)
+	}
+
+	updated := testDriver("d1")
+	updated.Name = "Renamed"
+	if err := sm.CreateOrUpdateDriver(updated); err != nil {
+		t.Errorf("updating a driver at the limit: %v", err)
+	}
+	if err := sm.UpdateOrderStatus("o1", models.OrderCanceled); err != nil {
+		t.Errorf("updating an order at the limit: %v", err)
+	}
+}
+
+func TestLocationHistoryKeepsMostRecent(t *testing.T) {
+	clk := clock.NewFake(time.Unix(1700000000, 0))
+	sm := newStateManager(Config{Clock: clk, LocationHistorySize: 3})
+	sm.CreateOrUpdateDriver(testDriver("d1"))
+	for step := 1; step <= 4; step++ {
+		clk.Advance(time.Second)
+		sm.PatchDriver("d1", moveTo(latAt(step), -122.42))
+	}
+
+	driver, _ := sm.GetDriver("d1")
+	if len(driver.LocationHistory) != 3 {
+		t.Fatalf("history holds %d entries, want 3", len(driver.LocationHistory))
+	}
+	for i, entry := range driver.LocationHistory {
+		step := i + 2
+		if entry.Lat != latAt(step) || entry.Timestamp != 1700000000+int64(step) {
+			t.Errorf("history[%d] = %+v, want step %d", i, entry, step)
+		}
+	}
+
+	// Reads get their own copy of the history
+	driver.LocationHistory[0].Lat = 0
+	if again, _ := sm.GetDriver("d1"); again.LocationHistory[0].Lat != latAt(2) {
+		t.Errorf("changing a read driver's history changed the stored driver")
+	}
+}
+
+func TestLocationHistoryDisabled(t *testing.T) {
+	sm := newStateManager(Config{})
+	sm.CreateOrUpdateDriver(testDriver("d1"))
+	sm.PatchDriver("d1", moveTo(latAt(1), -122.42))
+	if driver, _ := sm.GetDriver("d1"); driver.LocationHistory != nil {
+		t.Errorf("history = %v with LOCATION_HISTORY_SIZE 0, want none", driver.LocationHistory)
+	}
+}
+
+func TestCustomerOrderLimitCountsActiveOrders(t *testing.T) {
+	sm := newStateManager(Config{MaxOrdersPerCustomer: 2, DriverCapacity: 1})
+	sm.CreateOrUpdateDriver(testDriver("d1"))
+	// testOrder gives every order its own customer; these share one
+	order := func(id string) *models.Order {
+		o := testOrder(id)
+		o.Customer = "alice"
+		return o
+	}
+	for _, id := range []string{"o1", "o2"} {
+		if err := sm.CreateOrder(order(id)); err != nil {
+			t.Fatalf("order %s within the limit: %v", id, err)
+		}
+	}
+	if err := sm.CreateOrder(order("o3")); err != errs.ErrCustomerOrderLimit {
+		t.Fatalf("order beyond the limit: err = %v, want %v", err, errs.ErrCustomerOrderLimit)
+	}
+	if err := sm.CreateOrder(testOrder("other")); err != nil {
+		t.Errorf("another customer's order: %v", err)
+	}
+
+	// An assigned order is still active; canceled and delivered ones are not
+	sm.AssignOrderToDriver("o1", "d1")
+	if err := sm.CreateOrder(order("o3")); err != errs.ErrCustomerOrderLimit {
+		t.Fatalf("order with one assigned: err = %v, want %v", err, errs.ErrCustomerOrderLimit)
+	}
+	sm.UpdateOrderStatus("o1", models.OrderPickedUp)
+	sm.UpdateOrderStatus("o1", models.OrderDelivered)
+	if err := sm.CreateOrder(order("o3")); err != nil {
+		t.Fatalf("order after a delivery: %v", err)
+	}
+	sm.UpdateOrderStatus("o2", models.OrderCanceled)
+	if err := sm.CreateOrder(order("o4")); err != nil {
+		t.Errorf("order after a cancellation: %v", err)
+	}
+}
+
+func TestStreamOrdersStopsEarly(t *testing.T) {
+	sm := newStateManager(Config{})
+	for i := range 10 {
+		sm.CreateOrder(testOrder(fmt.Sprintf("o%d", i)))
+	}
+
+	seen := 0
+	sm.StreamOrders(func(order *models.Order) bool {
+		seen++
+		return seen < 3
+	})
+	if seen != 3 {
+		t.Errorf("callback ran %d times, want it to stop after the third", seen)
+	}
+
+	seen = 0
+	sm.StreamOrders(func(order *models.Order) bool {
+		seen++
+		return true
+	})
+	if seen != 10 {
+		t.Errorf("callback ran %d times, want every order", seen)
+	}
+}
+
+func TestStreamOrdersBlocksWriters(t *testing.T) {
+	sm := newStateManager(Config{})
+	sm.CreateOrder(testOrder("o1"))
+
+	inCallback, release := make(chan struct{}), make(chan struct{})
+	go sm.StreamOrders(func(order *models.Order) bool {
+		close(inCallback)
+		<-release
+		return true
+	})
+	<-inCallback
+
+	written := make(chan struct{})
+	go func() {
+		sm.CreateOrder(testOrder("o2"))
+		close(written)
+	}()
+	select {
+	case <-written:
+		t.Fatal("write completed while a stream callback was running")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	select {
+	case <-written:
+	case <-time.After(5 * time.Second):
+		t.Fatal("write still blocked after the stream finished")
+	}
+}
+
+func TestAcceptOfferHasOneWinner(t *testing.T) {
+	sm := newStateManager(Config{DriverCapacity: 1})
+	drivers := make([]string, 0, 10)
+	for i := range 10 {
+		id := fmt.Sprintf("d%d", i)
+		sm.CreateOrUpdateDriver(testDriver(id))
+		drivers = append(drivers, id)
+	}
+	sm.CreateOrder(testOrder("o1"))
+	if _, err := sm.OfferOrder("o1", drivers, nil, 1<<40); err != nil {
+		t.Fatalf("OfferOrder: %v", err)
+	}
+
+	// Every offered driver accepts at once: exactly one gets the order
+	var winner atomic.Value
+	var wg sync.WaitGroup
+	for _, id := range drivers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			switch err := sm.AcceptOffer("o1", id); err {
+			case nil:
+				if !winner.CompareAndSwap(nil, id) {
+					t.Errorf("%s accepted after %s", id, winner.Load())
+				}
+			case errs.ErrOfferNotOpen:
+			default:
+				t.Errorf("AcceptOffer %s: %v", id, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	order, _ := sm.GetOrder("o1")
+	if order.Status != models.OrderAssigned || order.DriverID != winner.Load() || len(order.OfferedTo) != 0 {
+		t.Errorf("order = %s with %q offered to %v, want assigned to the winner %v alone", order.Status, order.DriverID, order.OfferedTo, winner.Load())
+	}
+	if busy := sm.CountDrivers(models.DriverBusy); busy != 1 {
+		t.Errorf("%d drivers busy, want only the winner", busy)
+	}
+}
+
+func TestAssignMatchedOrderRejectsStalePickup(t *testing.T) {
+	sm := newStateManager(Config{DriverCapacity: 1})
+	sm.CreateOrUpdateDriver(testDriver("d1"))
+	sm.CreateOrder(testOrder("o1"))
+	// The matcher ranked drivers against the pickup as it was read
+	seen, _ := sm.GetOrder("o1")
+
+	moved := models.Location{Lat: seen.Pickup.Lat + 0.05, Lon: seen.Pickup.Lon}
+	if _, err := sm.PatchOrder("o1", models.OrderPatch{Pickup: &moved}, func(*models.Order) float64 { return 10 }); err != nil {
+		t.Fatalf("PatchOrder: %v", err)
+	}
+	if err := sm.AssignMatchedOrder("o1", "d1", seen.Pickup); err != errs.ErrPickupChanged {
+		t.Errorf("assignment on the stale pickup: err = %v, want %v", err, errs.ErrPickupChanged)
+	}
+	if order, _ := sm.GetOrder("o1"); order.Status != models.OrderPending {
+		t.Errorf("order is %s after a stale assignment, want pending", order.Status)
+	}
+	if err := sm.AssignMatchedOrder("o1", "d1", moved); err != nil {
+		t.Errorf("assignment on the current pickup: %v", err)
+	}
+}
+
+func TestAssignableDriversIncludeBusyWithSpareCapacity(t *testing.T) {
+	sm := newStateManager(Config{DriverCapacity: 2})
+	for _, id := range []string{"d1", "d2", "d3", "d4"} {
+		sm.CreateOrUpdateDriver(testDriver(id))
+	}
+	for _, id := range []string{"o1", "o2", "o3"} {
+		sm.CreateOrder(testOrder(id))
+	}
+	// d1 has room for one more, d2 is full, d3 is busy with no order and
+	// d4 is offline
+	sm.AssignOrderToDriver("o1", "d1")
+	sm.AssignOrderToDriver("o2", "d2")
+	sm.AssignOrderToDriver("o3", "d2")
+	sm.UpdateDriverStatus("d3", models.DriverBusy)
+	sm.UpdateDriverStatus("d4", models.DriverOffline)
+
+	ids := func(drivers []*models.Driver) string {
+		var ids []string
+		for _, driver := range drivers {
+			ids = append(ids, driver.ID)
+		}
+		return fmt.Sprint(ids)
+	}
+	if got := ids(sm.GetAssignableDrivers()); got != "[d1]" {
+		t.Errorf("assignable drivers = %s, want [d1]", got)
+	}
+	// The available list still means the status alone
+	if got := ids(sm.GetAvailableDrivers()); got != "[]" {
+		t.Errorf("available drivers = %s, want none", got)
+	}
+
+	// Delivering frees a slot on the full driver
+	sm.UpdateOrderStatus("o2", models.OrderPickedUp)
+	sm.UpdateOrderStatus("o2", models.OrderDelivered)
+	if got := ids(sm.GetAssignableDrivers()); got != "[d1 d2]" {
+		t.Errorf("assignable drivers after a delivery = %s, want [d1 d2]", got)
+	}
+}
+
+func TestAssignmentHistoryAcrossDrivers(t *testing.T) {
+	clk := clock.NewFake(time.Unix(1700000000, 0))
+	sm := newStateManager(Config{Clock: clk, DriverCapacity: 1})
+	a := testDriver("a")
+	a.Simulated = true
+	sm.CreateOrUpdateDriver(a)
+	sm.CreateOrUpdateDriver(testDriver("b"))
+	sm.CreateOrder(testOrder("o1"))
+
+	// Driver a holds the order until they are removed and it is released
+	sm.AssignOrderToDriver("o1", "a")
+	clk.Advance(time.Minute)
+	sm.PurgeSimulated()
+	sm.ReleaseOrphanedOrders()
+
+	clk.Advance(time.Minute)
+	sm.AssignOrderToDriver("o1", "b")
+	clk.Advance(time.Minute)
+	sm.UpdateOrderStatus("o1", models.OrderPickedUp)
+	sm.UpdateOrderStatus("o1", models.OrderDelivered)
+
+	order, _ := sm.GetOrder("o1")
+	want := []models.AssignmentRecord{
+		{DriverID: "a", AssignedAt: 1700000000, ReleasedAt: 1700000060, Reason: models.ReleaseOrphaned},
+		{DriverID: "b", AssignedAt: 1700000120, ReleasedAt: 1700000180, Reason: models.ReleaseDelivered},
+	}
+	if !reflect.DeepEqual(order.AssignmentHistory, want) {
+		t.Errorf("assignment history = %+v, want %+v", order.AssignmentHistory, want)
+	}
+}
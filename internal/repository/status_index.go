@@ -0,0 +1,118 @@
+package repository
+
+import (
+	"delivery-state-manager/internal/models"
+	"slices"
+	"sort"
+)
+
+// statusIndex maps each status to the IDs of the entities that hold it, so
+// status queries only touch matching entities. It is not safe for concurrent
+// use; StateManager guards it with its own lock.
+type statusIndex[S comparable] map[S]map[string]struct{}
+
+// add records that id holds status
+func (idx statusIndex[S]) add(id string, status S) {
+	ids, ok := idx[status]
+	if !ok {
+		ids = make(map[string]struct{})
+		idx[status] = ids
+	}
+	ids[id] = struct{}{}
+}
+
+// remove forgets that id holds status
+func (idx statusIndex[S]) remove(id string, status S) {
+	if ids, ok := idx[status]; ok {
+		delete(ids, id)
+	}
+}
+
+// ids returns the IDs holding status in ascending order
+func (idx statusIndex[S]) ids(status S) []string {
+	ids := make([]string, 0, len(idx[status]))
+	for id := range idx[status] {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// putDriver stores driver, replacing any driver with the same ID, and keeps
+// the status index in sync. Deleted drivers are left out of the index.
+// The caller must hold sm.mu.
+func (sm *StateManager) putDriver(driver *models.Driver) {
+	if existing, ok := sm.drivers[driver.ID]; ok {
+		sm.driverStatuses.remove(existing.ID, existing.Status)
+	}
+	sm.drivers[driver.ID] = driver
+	if !driver.Deleted {
+		sm.driverStatuses.add(driver.ID, driver.Status)
+	}
+}
+
+// setDriverStatus changes a stored driver's status and keeps the status
+// index in sync. The caller must hold sm.mu.
+func (sm *StateManager) setDriverStatus(driver *models.Driver, status models.DriverStatus) {
+	sm.driverStatuses.remove(driver.ID, driver.Status)
+	driver.Status = status
+	sm.driverStatuses.add(driver.ID, status)
+}
+
+// deleteDriver removes a stored driver and its status index entry.
+// The caller must hold sm.mu.
+func (sm *StateManager) deleteDriver(driver *models.Driver) {
+	sm.driverStatuses.remove(driver.ID, driver.Status)
+	delete(sm.drivers, driver.ID)
+}
+
+// putOrder stores order, replacing any order with the same ID, and keeps
+// the status index in sync. The caller must hold sm.mu.
+func (sm *StateManager) putOrder(order *models.Order) {
+	if existing, ok := sm.orders[order.ID]; ok {
+		sm.orderStatuses.remove(existing.ID, existing.Status)
+	}
+	sm.orders[order.ID] = order
+	sm.orderStatuses.add(order.ID, order.Status)
+}
+
+// deleteOrder removes a stored order and its status index entry.
+// The caller must hold sm.mu.
+func (sm *StateManager) deleteOrder(order *models.Order) {
+	sm.orderStatuses.remove(order.ID, order.Status)
+	delete(sm.orders, order.ID)
+}
+
+// setOrderStatus changes a stored order's status, records when it changed and
+// keeps the status index in sync. Leaving the offered status withdraws any
+// outstanding offers, and leaving assigned or picked up for anything else
+// closes the driver's entry in the assignment history. The change is published when the caller releases
+// sm.mu with sm.unlock. The caller must hold sm.mu.
+func (sm *StateManager) setOrderStatus(order *models.Order, status models.OrderStatus) {
+	if sm.onOrderStatus != nil && !slices.Contains(sm.statusChanged, order) {
+		sm.statusChanged = append(sm.statusChanged, order)
+	}
+	sm.orderStatuses.remove(order.ID, order.Status)
+	if status != models.OrderOffered {
+		order.OfferedTo = nil
+		order.OfferExpiresAt = 0
+		order.OfferQueue = nil
+	}
+	if status != models.OrderAssigned && status != models.OrderPickedUp {
+		if n := len(order.AssignmentHistory); n > 0 && order.AssignmentHistory[n-1].ReleasedAt == 0 {
+			record := &order.AssignmentHistory[n-1]
+			record.ReleasedAt = sm.clock.Now().Unix()
+			switch status {
+			case models.OrderDelivered:
+				record.Reason = models.ReleaseDelivered
+			case models.OrderCanceled:
+				record.Reason = models.ReleaseCanceled
+			default:
+				record.Reason = models.ReleaseOrphaned
+			}
+		}
+	}
+	order.Status = status
+	order.StatusChangedAt = sm.clock.Now().Unix()
+	sm.orderStatuses.add(order.ID, status)
+}
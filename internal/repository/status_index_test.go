@@ -0,0 +1,138 @@
+package repository
+
+import (
+	"delivery-state-manager/internal/models"
+	"fmt"
+	"math/rand/v2"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// scanStatuses lists the IDs holding each driver and order status by
+// scanning every entity, as the queries did before the indexes
+func scanStatuses(sm *StateManager) (drivers map[models.DriverStatus][]string, orders map[models.OrderStatus][]string) {
+	drivers = make(map[models.DriverStatus][]string)
+	for _, driver := range sm.GetAllDrivers() {
+		drivers[driver.Status] = append(drivers[driver.Status], driver.ID)
+	}
+	orders = make(map[models.OrderStatus][]string)
+	for _, order := range sm.GetAllOrders() {
+		orders[order.Status] = append(orders[order.Status], order.ID)
+	}
+	for _, ids := range drivers {
+		sort.Strings(ids)
+	}
+	for _, ids := range orders {
+		sort.Strings(ids)
+	}
+	return drivers, orders
+}
+
+// assertIndexesMatchScan fails the test if a status query disagrees with a
+// full scan
+func assertIndexesMatchScan(t *testing.T, sm *StateManager, after string) {
+	t.Helper()
+	drivers, orders := scanStatuses(sm)
+	for _, status := range []models.DriverStatus{models.DriverAvailable, models.DriverBusy, models.DriverOffline} {
+		if got := sm.CountDrivers(status); got != len(drivers[status]) {
+			t.Fatalf("after %s: %d %s drivers indexed, scan finds %v", after, got, status, drivers[status])
+		}
+	}
+	var available []string
+	for _, driver := range sm.GetAvailableDrivers() {
+		available = append(available, driver.ID)
+	}
+	if !reflect.DeepEqual(available, drivers[models.DriverAvailable]) {
+		t.Fatalf("after %s: available drivers = %v, scan finds %v", after, available, drivers[models.DriverAvailable])
+	}
+	for _, status := range []models.OrderStatus{models.OrderPending, models.OrderAssigned, models.OrderPickedUp, models.OrderDelivered, models.OrderCanceled, models.OrderUnmatchable} {
+		var ids []string
+		for _, order := range sm.GetOrdersByStatus(status) {
+			ids = append(ids, order.ID)
+		}
+		if !reflect.DeepEqual(ids, orders[status]) {
+			t.Fatalf("after %s: %s orders = %v, scan finds %v", after, status, ids, orders[status])
+		}
+	}
+}
+
+func TestStatusIndexesMatchFullScan(t *testing.T) {
+	sm := newStateManager(Config{DriverCapacity: 1})
+	rng := rand.New(rand.NewPCG(7, 8))
+	driver := func() string { return fmt.Sprintf("d%d", rng.IntN(10)) }
+	order := func() string { return fmt.Sprintf("o%d", rng.IntN(30)) }
+	driverStatuses := []models.DriverStatus{models.DriverAvailable, models.DriverBusy, models.DriverOffline}
+	orderStatuses := []models.OrderStatus{models.OrderPickedUp, models.OrderDelivered, models.OrderCanceled}
+
+	for step := range 2000 {
+		var op string
+		switch rng.IntN(10) {
+		case 0:
+			op = "create driver"
+			sm.CreateOrUpdateDriver(testDriver(driver()))
+		case 1:
+			op = "create order"
+			sm.CreateOrder(testOrder(order()))
+		case 2:
+			op = "update driver status"
+			sm.UpdateDriverStatus(driver(), driverStatuses[rng.IntN(len(driverStatuses))])
+		case 3:
+			op = "patch driver status"
+			sm.PatchDriver(driver(), models.DriverPatch{Status: &driverStatuses[rng.IntN(len(driverStatuses))]})
+		case 4, 5:
+			op = "assign"
+			sm.AssignOrderToDriver(order(), driver())
+		case 6:
+			op = "update order status"
+			sm.UpdateOrderStatus(order(), orderStatuses[rng.IntN(len(orderStatuses))])
+		case 7:
+			op = "record match failures"
+			sm.RecordMatchFailures([]string{order(), order()}, 2)
+		case 8:
+			op = "delete driver"
+			sm.DeleteDriver(driver())
+		case 9:
+			op = "release orphans"
+			sm.ReleaseOrphanedOrders()
+		}
+		assertIndexesMatchScan(t, sm, fmt.Sprintf("step %d (%s)", step, op))
+	}
+
+	snapshot := sm.GetSnapshot()
+	sm.Reset()
+	assertIndexesMatchScan(t, sm, "reset")
+	if err := sm.RestoreSnapshot(snapshot); err != nil {
+		t.Fatalf("RestoreSnapshot: %v", err)
+	}
+	assertIndexesMatchScan(t, sm, "restore")
+}
+
+// BenchmarkPendingOrders reads the pending orders out of a store where most
+// orders are long delivered, as the matcher does every tick
+func BenchmarkPendingOrders(b *testing.B) {
+	sm := newStateManager(Config{})
+	for i := range 20000 {
+		id := fmt.Sprintf("o%05d", i)
+		sm.CreateOrder(testOrder(id))
+		if i%100 != 0 {
+			sm.UpdateOrderStatus(id, models.OrderCanceled)
+		}
+	}
+
+	b.Run("indexed", func(b *testing.B) {
+		for range b.N {
+			sm.GetPendingOrders()
+		}
+	})
+	b.Run("scan", func(b *testing.B) {
+		for range b.N {
+			var pending []*models.Order
+			for _, order := range sm.GetAllOrders() {
+				if order.Status == models.OrderPending {
+					pending = append(pending, order)
+				}
+			}
+		}
+	})
+}
@@ -0,0 +1,191 @@
+package repository
+
+import (
+	"delivery-state-manager/internal/models"
+	"delivery-state-manager/pkg/errs"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// runStoreSuite runs the behavior every Store implementation shares against
+// stores made by newStore, one fresh store per case
+func runStoreSuite(t *testing.T, newStore func(t *testing.T) Store) {
+	for _, tc := range []struct {
+		name string
+		run  func(t *testing.T, store Store)
+	}{
+		{"drivers", func(t *testing.T, store Store) {
+			store.CreateOrUpdateDriver(testDriver("d1"))
+			store.CreateOrUpdateDriver(testDriver("d2"))
+			if err := store.UpdateDriverStatus("d1", models.DriverOffline); err != nil {
+				t.Fatalf("UpdateDriverStatus: %v", err)
+			}
+			name, location := "Ada", models.Location{Lat: 37.80, Lon: -122.40}
+			if _, err := store.PatchDriver("d2", models.DriverPatch{Name: &name, Location: &location}); err != nil {
+				t.Fatalf("PatchDriver: %v", err)
+			}
+			if err := store.CompareAndSetDriverStatus("d2", models.DriverOffline, models.DriverBusy); !errors.Is(err, errs.ErrDriverStatusConflict) {
+				t.Errorf("CompareAndSetDriverStatus from the wrong status: err = %v, want ErrDriverStatusConflict", err)
+			}
+
+			d1, _ := store.GetDriver("d1")
+			d2, _ := store.GetDriver("d2")
+			if d1.Status != models.DriverOffline || d2.Name != "Ada" || d2.Location != location {
+				t.Errorf("drivers = %+v and %+v, want d1 offline and d2 renamed and moved", d1, d2)
+			}
+			if _, err := store.DeleteDriver("d1"); err != nil {
+				t.Fatalf("DeleteDriver: %v", err)
+			}
+			if d1, _ := store.GetDriver("d1"); !d1.Deleted || store.CountDrivers(models.DriverAvailable) != 1 {
+				t.Errorf("after delete d1 = %+v with %d available drivers, want d1 deleted and d2 left", d1, store.CountDrivers(models.DriverAvailable))
+			}
+			if _, err := store.GetDriver("nobody"); !errors.Is(err, errs.ErrDriverNotFound) {
+				t.Errorf("GetDriver(nobody): err = %v, want ErrDriverNotFound", err)
+			}
+		}},
+		{"orders", func(t *testing.T, store Store) {
+			store.CreateOrder(testOrder("o1"))
+			store.CreateOrder(testOrder("o2"))
+			if err := store.CreateOrder(testOrder("o1")); !errors.Is(err, errs.ErrOrderExists) {
+				t.Errorf("CreateOrder of a taken ID: err = %v, want ErrOrderExists", err)
+			}
+			if err := store.UpdateOrderStatus("o1", models.OrderPickedUp); !errors.Is(err, errs.ErrInvalidTransition) {
+				t.Errorf("picking up a pending order: err = %v, want ErrInvalidTransition", err)
+			}
+			if err := store.CancelOrder("o2", "customer_request"); err != nil {
+				t.Fatalf("CancelOrder: %v", err)
+			}
+			if o2, _ := store.GetOrder("o2"); o2.Status != models.OrderCanceled || o2.CancelReason != "customer_request" {
+				t.Errorf("canceled order = %+v, want canceled for customer_request", o2)
+			}
+			if pending := store.GetPendingOrders(); len(pending) != 1 || pending[0].ID != "o1" {
+				t.Errorf("pending orders = %v, want o1 alone", pending)
+			}
+		}},
+		{"assign", func(t *testing.T, store Store) {
+			store.CreateOrUpdateDriver(testDriver("d1"))
+			store.CreateOrder(testOrder("o1"))
+			if err := store.AssignOrderToDriver("o1", "d1"); err != nil {
+				t.Fatalf("AssignOrderToDriver: %v", err)
+			}
+			for _, status := range []models.OrderStatus{models.OrderPickedUp, models.OrderDelivered} {
+				if err := store.UpdateOrderStatus("o1", status); err != nil {
+					t.Fatalf("UpdateOrderStatus(%s): %v", status, err)
+				}
+			}
+			o1, _ := store.GetOrder("o1")
+			d1, _ := store.GetDriver("d1")
+			if o1.Status != models.OrderDelivered || o1.DriverID != "d1" || d1.Status != models.DriverBusy {
+				t.Errorf("order %s by %q, driver %s; want delivered by d1, who the repository leaves busy", o1.Status, o1.DriverID, d1.Status)
+			}
+			if err := store.AssignOrderToDriver("o1", "d1"); err == nil {
+				t.Error("AssignOrderToDriver accepted a delivered order")
+			}
+		}},
+		{"offer and accept", func(t *testing.T, store Store) {
+			store.CreateOrUpdateDriver(testDriver("d1"))
+			store.CreateOrUpdateDriver(testDriver("d2"))
+			store.CreateOrder(testOrder("o1"))
+			if _, err := store.OfferOrder("o1", []string{"d1", "d2"}, nil, time.Now().Add(time.Hour).Unix()); err != nil {
+				t.Fatalf("OfferOrder: %v", err)
+			}
+			if err := store.AcceptOffer("o1", "d2"); err != nil {
+				t.Fatalf("AcceptOffer: %v", err)
+			}
+			if err := store.AcceptOffer("o1", "d1"); !errors.Is(err, errs.ErrOfferNotOpen) {
+				t.Errorf("second AcceptOffer: err = %v, want ErrOfferNotOpen", err)
+			}
+			if o1, _ := store.GetOrder("o1"); o1.Status != models.OrderAssigned || o1.DriverID != "d2" {
+				t.Errorf("accepted order is %s by %q, want assigned to d2", o1.Status, o1.DriverID)
+			}
+		}},
+		{"patch", func(t *testing.T, store Store) {
+			store.CreateOrder(testOrder("o1"))
+			dropoff, notes := models.Location{Lat: 37.80, Lon: -122.42}, "Ring twice"
+			price := func(order *models.Order) float64 { return 10 * order.Dropoff.Lat }
+			if _, err := store.PatchOrder("o1", models.OrderPatch{Dropoff: &dropoff, Notes: &notes}, price); err != nil {
+				t.Fatalf("PatchOrder: %v", err)
+			}
+			o1, _ := store.GetOrder("o1")
+			if o1.Dropoff != dropoff || o1.Notes != notes || o1.Price != 378 {
+				t.Errorf("patched order = %+v, want the new dropoff and notes, priced at 378", o1)
+			}
+			if len(o1.DropoffHistory) != 1 || o1.DropoffHistory[0].Location != testOrder("o1").Dropoff {
+				t.Errorf("dropoff history = %+v, want the replaced dropoff", o1.DropoffHistory)
+			}
+			if _, err := store.PatchOrder("nobody", models.OrderPatch{Notes: &notes}, price); !errors.Is(err, errs.ErrOrderNotFound) {
+				t.Errorf("PatchOrder(nobody): err = %v, want ErrOrderNotFound", err)
+			}
+		}},
+		{"reset", func(t *testing.T, store Store) {
+			store.CreateOrUpdateDriver(testDriver("d1"))
+			store.CreateOrder(testOrder("o1"))
+			store.CreateOrder(testOrder("o2"))
+			if drivers, orders := store.Reset(); drivers != 1 || orders != 2 {
+				t.Errorf("Reset() = %d, %d; want 1 driver and 2 orders removed", drivers, orders)
+			}
+			if len(store.GetAllDrivers()) != 0 || len(store.GetAllOrders()) != 0 {
+				t.Error("store is not empty after Reset")
+			}
+			store.CreateOrUpdateDriver(testDriver("d2"))
+		}},
+		{"restore", func(t *testing.T, store Store) {
+			store.CreateOrUpdateDriver(testDriver("d1"))
+			err := store.RestoreSnapshot(models.StateSnapshot{
+				Drivers: map[string]*models.Driver{"d2": testDriver("d2")},
+				Orders:  map[string]*models.Order{"o1": testOrder("o1")},
+			})
+			if err != nil {
+				t.Fatalf("RestoreSnapshot: %v", err)
+			}
+			if _, err := store.GetDriver("d1"); !errors.Is(err, errs.ErrDriverNotFound) {
+				t.Errorf("driver from before the restore: err = %v, want ErrDriverNotFound", err)
+			}
+			if _, err := store.GetOrder("o1"); err != nil || store.CountDrivers(models.DriverAvailable) != 1 {
+				t.Errorf("restored state lacks o1 (%v) or d2", err)
+			}
+		}},
+		{"purge simulated", func(t *testing.T, store Store) {
+			simDriver, simOrder := testDriver("sim-d"), testOrder("sim-o")
+			simDriver.Simulated, simOrder.Simulated = true, true
+			store.CreateOrUpdateDriver(simDriver)
+			store.CreateOrUpdateDriver(testDriver("d1"))
+			store.CreateOrder(simOrder)
+			store.CreateOrder(testOrder("o1"))
+			if drivers, orders := store.PurgeSimulated(); drivers != 1 || orders != 1 {
+				t.Errorf("PurgeSimulated() = %d, %d; want one of each", drivers, orders)
+			}
+			var left []string
+			for _, driver := range store.GetAllDrivers() {
+				left = append(left, driver.ID)
+			}
+			for _, order := range store.GetAllOrders() {
+				left = append(left, order.ID)
+			}
+			if fmt.Sprint(left) != "[d1 o1]" {
+				t.Errorf("left after the purge: %v, want the real driver and order", left)
+			}
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.run(t, newStore(t))
+		})
+	}
+}
+
+func TestStateManagerStoreSuite(t *testing.T) {
+	runStoreSuite(t, func(t *testing.T) Store { return newStateManager(Config{}) })
+}
+
+func TestFileStoreStoreSuite(t *testing.T) {
+	runStoreSuite(t, func(t *testing.T) Store {
+		path := filepath.Join(t.TempDir(), "state.json")
+		fs := openFileStore(t, path)
+		// Once the case is done, a reopened store must hold what it left
+		t.Cleanup(func() { assertRecovered(t, path, fs) })
+		return fs
+	})
+}
@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"hash/fnv"
+	"sync"
+)
+
+// driverStripes is how many locks driver moves are spread over
+const driverStripes = 64
+
+// stripe returns the lock guarding the fields of driver id that a move
+// changes
+func (sm *StateManager) stripe(id string) *sync.RWMutex {
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	return &sm.stripes[h.Sum32()%driverStripes]
+}
+
+// rlockDriver takes the read lock and the read side of id's stripe, enough
+// to read one driver while other drivers move
+func (sm *StateManager) rlockDriver(id string) func() {
+	sm.rlock()
+	stripe := sm.stripe(id)
+	stripe.RLock()
+	return func() {
+		stripe.RUnlock()
+		sm.mu.RUnlock()
+	}
+}
+
+// lockDriver takes the read lock and the write side of id's stripe, enough
+// to move one driver. Its location, history and update time are the only
+// fields that may change this way; the maps, the indexes and the driver's
+// status still need the write lock.
+func (sm *StateManager) lockDriver(id string) func() {
+	sm.rlock()
+	stripe := sm.stripe(id)
+	stripe.Lock()
+	return func() {
+		stripe.Unlock()
+		sm.mu.RUnlock()
+	}
+}
+
+// rlockDrivers takes the read lock and the read side of every stripe, so
+// no driver moves while many are read. Stripes are always taken in order,
+// so two callers cannot deadlock.
+func (sm *StateManager) rlockDrivers() {
+	sm.rlock()
+	for i := range sm.stripes {
+		sm.stripes[i].RLock()
+	}
+}
+
+// runlockDrivers releases what rlockDrivers took
+func (sm *StateManager) runlockDrivers() {
+	for i := len(sm.stripes) - 1; i >= 0; i-- {
+		sm.stripes[i].RUnlock()
+	}
+	sm.mu.RUnlock()
+}
@@ -0,0 +1,123 @@
+package repository
+
+import (
+	"delivery-state-manager/internal/models"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// latAt is a mover's latitude after step moves north
+func latAt(step int) float64 {
+	return 37.77 + float64(step)*0.0001
+}
+
+// moveTo is a patch that only moves a driver, which takes the striped path
+func moveTo(lat, lon float64) models.DriverPatch {
+	return models.DriverPatch{Location: &models.Location{Lat: lat, Lon: lon}}
+}
+
+func TestConcurrentMovesAndReads(t *testing.T) {
+	const drivers, moves = 16, 200
+	sm := newStateManager(Config{GeoIndexEnabled: true, LocationHistorySize: 10})
+	for i := range drivers {
+		sm.CreateOrUpdateDriver(testDriver(fmt.Sprintf("d%02d", i)))
+	}
+	start := sm.GetVersion()
+
+	// Each mover walks its own driver north; readers check every driver
+	// they see is whole, with its latest history entry at its location
+	var stop atomic.Bool
+	var readers, movers sync.WaitGroup
+	check := func(driver *models.Driver) {
+		n := len(driver.LocationHistory)
+		if n == 0 || driver.LocationHistory[n-1].Location != driver.Location {
+			t.Errorf("driver %s read mid-move: at %v with history %v", driver.ID, driver.Location, driver.LocationHistory)
+		}
+	}
+	for range 4 {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for !stop.Load() {
+				for _, driver := range sm.GetAllDrivers() {
+					check(driver)
+				}
+				if driver, err := sm.GetDriver("d00"); err == nil {
+					check(driver)
+				}
+				sm.GetNearbyDrivers(models.Location{Lat: 37.8, Lon: -122.42}, 50)
+				sm.GetSnapshot()
+			}
+		}()
+	}
+	for i := range drivers {
+		movers.Add(1)
+		go func(id string) {
+			defer movers.Done()
+			for step := 1; step <= moves; step++ {
+				if _, err := sm.PatchDriver(id, moveTo(latAt(step), -122.42)); err != nil {
+					t.Errorf("PatchDriver %s: %v", id, err)
+					return
+				}
+			}
+		}(fmt.Sprintf("d%02d", i))
+	}
+	movers.Wait()
+	stop.Store(true)
+	readers.Wait()
+
+	if got, want := sm.GetVersion()-start, uint64(drivers*moves); got != want {
+		t.Errorf("version advanced by %d, want one per move (%d)", got, want)
+	}
+	final := models.Location{Lat: latAt(moves), Lon: -122.42}
+	for _, driver := range sm.GetAllDrivers() {
+		if driver.Location != final || len(driver.LocationHistory) != 10 {
+			t.Errorf("driver %s ended at %v with %d history entries, want %v with 10", driver.ID, driver.Location, len(driver.LocationHistory), final)
+		}
+	}
+	if nearby := sm.GetNearbyDrivers(final, 0.01); len(nearby) != drivers {
+		t.Errorf("geo index finds %d drivers at their final location, want %d", len(nearby), drivers)
+	}
+}
+
+// BenchmarkDriverMoves moves a different driver from each goroutine while
+// others read, through the striped path and, for comparison, through the
+// write lock a patch that also renames takes
+func BenchmarkDriverMoves(b *testing.B) {
+	for _, bench := range []struct {
+		name  string
+		patch func(lat float64) models.DriverPatch
+	}{
+		{"stripes", func(lat float64) models.DriverPatch { return moveTo(lat, -122.42) }},
+		{"write_lock", func(lat float64) models.DriverPatch {
+			patch := moveTo(lat, -122.42)
+			name := "Renamed"
+			patch.Name = &name
+			return patch
+		}},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			sm := newStateManager(Config{GeoIndexEnabled: true, LocationHistorySize: 10})
+			for i := range 256 {
+				sm.CreateOrUpdateDriver(testDriver(fmt.Sprintf("d%03d", i)))
+			}
+			var next atomic.Int64
+			b.RunParallel(func(pb *testing.PB) {
+				n := next.Add(1)
+				id := fmt.Sprintf("d%03d", n%256)
+				lat := 37.77
+				for i := 0; pb.Next(); i++ {
+					// Every tenth operation reads a driver, as GET /drivers/:id
+					if i%10 == 9 {
+						sm.GetDriver(id)
+						continue
+					}
+					lat += 0.0001
+					sm.PatchDriver(id, bench.patch(lat))
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"context"
+	"sync"
+)
+
+// versionSignal wakes goroutines waiting for the state version to change.
+// It works like a condition variable whose wait can also end on a context:
+// waiters take the current channel, and every change closes it and starts
+// a new one. The zero value is ready to use.
+type versionSignal struct {
+	mu      sync.Mutex
+	changed chan struct{}
+}
+
+// wait returns a channel that is closed on the next broadcast
+func (s *versionSignal) wait() <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.changed == nil {
+		s.changed = make(chan struct{})
+	}
+	return s.changed
+}
+
+// broadcast wakes every goroutine waiting on a channel from wait
+func (s *versionSignal) broadcast() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.changed != nil {
+		close(s.changed)
+		s.changed = nil
+	}
+}
+
+// bumpVersion moves the state version on after a mutation and wakes
+// WaitForVersion callers
+func (sm *StateManager) bumpVersion() {
+	sm.version.Add(1)
+	sm.versionChanged.broadcast()
+}
+
+// WaitForVersion blocks until the state version differs from since or ctx
+// is done. It returns the current version and whether it changed.
+func (sm *StateManager) WaitForVersion(ctx context.Context, since uint64) (uint64, bool) {
+	for {
+		// Take the channel before reading the version so a change in
+		// between still wakes us
+		changed := sm.versionChanged.wait()
+		if version := sm.version.Load(); version != since {
+			return version, true
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return sm.version.Load(), false
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"context"
+	"delivery-state-manager/internal/models"
+	"testing"
+	"time"
+)
+
+func TestWaitForVersionUnblocksOnMutation(t *testing.T) {
+	sm := newStateManager(Config{})
+	since := sm.GetVersion()
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		sm.CreateOrUpdateDriver(&models.Driver{ID: "d1", Name: "D1", Status: models.DriverAvailable})
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	version, changed := sm.WaitForVersion(ctx, since)
+	if !changed {
+		t.Fatal("WaitForVersion timed out instead of waking on the mutation")
+	}
+	if version <= since {
+		t.Errorf("version = %d, want past %d", version, since)
+	}
+}
+
+func TestWaitForVersionTimesOut(t *testing.T) {
+	sm := newStateManager(Config{})
+	since := sm.GetVersion()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	version, changed := sm.WaitForVersion(ctx, since)
+	if changed || version != since {
+		t.Errorf("WaitForVersion = %d, %v; want %d, false", version, changed, since)
+	}
+}
+
+func TestWaitForVersionReturnsAtOnceForStaleVersion(t *testing.T) {
+	sm := newStateManager(Config{})
+	sm.CreateOrUpdateDriver(&models.Driver{ID: "d1", Name: "D1", Status: models.DriverAvailable})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	version, changed := sm.WaitForVersion(ctx, 0)
+	if !changed || version == 0 {
+		t.Errorf("WaitForVersion = %d, %v; want the current version at once", version, changed)
+	}
+}
+
+func TestWaitForVersionWakesOnRestore(t *testing.T) {
+	sm := newStateManager(Config{})
+	since := sm.GetVersion()
+
+	done := make(chan bool, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_, changed := sm.WaitForVersion(ctx, since)
+		done <- changed
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	if err := sm.RestoreSnapshot(models.StateSnapshot{}); err != nil {
+		t.Fatalf("RestoreSnapshot: %v", err)
+	}
+	if !<-done {
+		t.Error("WaitForVersion did not wake on restore")
+	}
+}
@@ -0,0 +1,167 @@
+package repository
+
+import (
+	"bufio"
+	"bytes"
+	"delivery-state-manager/internal/models"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+)
+
+// Log operations. walPut stores the drivers and orders of a record as they
+// are. walReplace discards the state first, so the record holds all of it;
+// mutations that replace the whole state, such as a reset or restore, log
+// one before they are folded into a snapshot.
+const (
+	walPut     = "put"
+	walReplace = "replace"
+)
+
+// walRecord is one line of the write-ahead log. Records hold the full state
+// of the entities a mutation changed rather than the operation itself, so
+// replaying one is idempotent and reproduces timestamps exactly. Each is
+// read while holding FileStore.mu, so later records never hold older state.
+type walRecord struct {
+	Op      string           `json:"op"`
+	Drivers []*models.Driver `json:"drivers,omitempty"`
+	Orders  []*models.Order  `json:"orders,omitempty"`
+	// Version is the state version once the mutation was applied; records
+	// at or below the snapshot's version are already part of it
+	Version uint64 `json:"version"`
+}
+
+// openWAL replays the log on top of the loaded snapshot and opens it for
+// appending. A torn final record, left by a crash mid-write, is dropped.
+func (fs *FileStore) openWAL(snapshotVersion uint64) error {
+	file, err := os.OpenFile(fs.walPath, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return fmt.Errorf("open write-ahead log: %w", err)
+	}
+
+	reader := bufio.NewReader(file)
+	var offset int64
+	replayed := 0
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			if len(line) > 0 {
+				log.Printf("Dropping incomplete record at the end of %s", fs.walPath)
+			}
+			break
+		}
+		if err != nil {
+			file.Close()
+			return fmt.Errorf("read write-ahead log: %w", err)
+		}
+
+		var rec walRecord
+		if err := json.Unmarshal(bytes.TrimSpace(line), &rec); err != nil {
+			log.Printf("Dropping unreadable record in %s and everything after it: %v", fs.walPath, err)
+			break
+		}
+		offset += int64(len(line))
+		fs.walRecords++
+		if rec.Version > snapshotVersion {
+			fs.apply(rec)
+			replayed++
+		}
+	}
+
+	// Cut off anything after the last good record so new appends follow it
+	if err := file.Truncate(offset); err != nil {
+		file.Close()
+		return fmt.Errorf("truncate write-ahead log: %w", err)
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return fmt.Errorf("seek write-ahead log: %w", err)
+	}
+	fs.wal = file
+
+	if replayed > 0 {
+		log.Printf("Replayed %d mutations from %s", replayed, fs.walPath)
+	}
+	return nil
+}
+
+// appendWAL writes rec to the log and syncs it to disk.
+// The caller must hold fs.mu.
+func (fs *FileStore) appendWAL(rec walRecord) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("encode log record: %w", err)
+	}
+	data = append(data, '\n')
+
+	if _, err := fs.wal.Write(data); err != nil {
+		return fmt.Errorf("append to %s: %w", fs.walPath, err)
+	}
+	if err := fs.wal.Sync(); err != nil {
+		return fmt.Errorf("sync %s: %w", fs.walPath, err)
+	}
+	fs.walRecords++
+	return nil
+}
+
+// truncateWAL empties the log once a snapshot covers it.
+// The caller must hold fs.mu.
+func (fs *FileStore) truncateWAL() error {
+	if err := fs.wal.Truncate(0); err != nil {
+		return fmt.Errorf("truncate %s: %w", fs.walPath, err)
+	}
+	if _, err := fs.wal.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("seek %s: %w", fs.walPath, err)
+	}
+	fs.walRecords = 0
+	return nil
+}
+
+// entities returns copies of the given drivers and orders along with the
+// state version, read atomically. Unknown IDs are skipped.
+func (sm *StateManager) entities(driverIDs, orderIDs []string) ([]*models.Driver, []*models.Order, uint64) {
+	sm.rlockDrivers()
+	defer sm.runlockDrivers()
+
+	drivers := make([]*models.Driver, 0, len(driverIDs))
+	for _, id := range driverIDs {
+		if driver, ok := sm.drivers[id]; ok {
+			drivers = append(drivers, driver.Clone())
+		}
+	}
+	orders := make([]*models.Order, 0, len(orderIDs))
+	for _, id := range orderIDs {
+		if order, ok := sm.orders[id]; ok {
+			orders = append(orders, order.Clone())
+		}
+	}
+	return drivers, orders, sm.version.Load()
+}
+
+// apply replays a log record
+func (sm *StateManager) apply(rec walRecord) {
+	sm.lock()
+	defer sm.mu.Unlock()
+
+	switch rec.Op {
+	case walPut:
+	case walReplace:
+		sm.clear()
+	default:
+		log.Printf("Skipping unknown log operation %q", rec.Op)
+		return
+	}
+
+	for _, driver := range rec.Drivers {
+		sm.putDriver(driver)
+		if sm.geo != nil {
+			sm.geo.upsert(driver.ID, driver.Location)
+		}
+	}
+	for _, order := range rec.Orders {
+		sm.putOrder(order)
+	}
+	sm.version.Store(max(sm.version.Load(), rec.Version))
+}
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"delivery-state-manager/internal/models"
+	"delivery-state-manager/pkg/clock"
+	"sort"
+	"sync"
+	"time"
+)
+
+// distanceSampleSize bounds how many recent distances are kept for the p95
+const distanceSampleSize = 1000
+
+// matchRateWindow is how far back assignments count toward the match rate
+const matchRateWindow = 15 * time.Minute
+
+// AssignmentMetrics accumulates assignment distances from every assignment
+// source. It is safe for concurrent use.
+type AssignmentMetrics struct {
+	clock   clock.Clock
+	started time.Time
+	count   int64
+	totalKm float64
+	samples []float64
+	// times holds when each sample was recorded, at the same index
+	times []time.Time
+	next  int
+	mu    sync.Mutex
+}
+
+// NewAssignmentMetrics creates a new AssignmentMetrics instance
+func NewAssignmentMetrics(clk clock.Clock) *AssignmentMetrics {
+	return &AssignmentMetrics{
+		clock:   clk,
+		started: clk.Now(),
+		samples: make([]float64, 0, distanceSampleSize),
+		times:   make([]time.Time, 0, distanceSampleSize),
+	}
+}
+
+// RecordAssignment records the distance a driver travels to reach a pickup
+func (am *AssignmentMetrics) RecordAssignment(distanceKm float64) {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+
+	am.count++
+	am.totalKm += distanceKm
+
+	// Keep the most recent samples in a ring buffer
+	now := am.clock.Now()
+	if len(am.samples) < distanceSampleSize {
+		am.samples = append(am.samples, distanceKm)
+		am.times = append(am.times, now)
+	} else {
+		am.samples[am.next] = distanceKm
+		am.times[am.next] = now
+	}
+	am.next = (am.next + 1) % distanceSampleSize
+}
+
+// AssignmentDistance returns the average over all assignments and the p95
+// over the most recent ones
+func (am *AssignmentMetrics) AssignmentDistance() models.AssignmentDistanceStats {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+
+	stats := models.AssignmentDistanceStats{Count: am.count}
+	if am.count == 0 {
+		return stats
+	}
+
+	stats.AverageKm = am.totalKm / float64(am.count)
+
+	sorted := make([]float64, len(am.samples))
+	copy(sorted, am.samples)
+	sort.Float64s(sorted)
+	// Nearest-rank percentile
+	rank := (95*len(sorted) + 99) / 100
+	stats.P95Km = sorted[rank-1]
+
+	return stats
+}
+
+// MatchRate returns the assignments per minute over the last fifteen
+// minutes, or since startup if that is more recent. Only the most recent
+// samples are kept, so a rate above distanceSampleSize per window is
+// underestimated.
+func (am *AssignmentMetrics) MatchRate() float64 {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+
+	now := am.clock.Now()
+	window := min(matchRateWindow, now.Sub(am.started))
+	if window < time.Minute {
+		window = time.Minute
+	}
+
+	recent := 0
+	for _, t := range am.times {
+		if now.Sub(t) <= window {
+			recent++
+		}
+	}
+	return float64(recent) / window.Minutes()
+}
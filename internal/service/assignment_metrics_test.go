@@ -0,0 +1,96 @@
+package service
+
+import (
+	"delivery-state-manager/internal/repository"
+	"delivery-state-manager/pkg/clock"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAssignmentDistanceAverageAndP95(t *testing.T) {
+	metrics := NewAssignmentMetrics(clock.NewFake(time.Unix(1700000000, 0)))
+	if stats := metrics.AssignmentDistance(); stats.Count != 0 || stats.AverageKm != 0 || stats.P95Km != 0 {
+		t.Errorf("stats before any assignment = %+v, want zeros", stats)
+	}
+
+	// 1km through 100km: average 50.5, and the 95th of 100 by nearest rank
+	var wg sync.WaitGroup
+	for km := 1; km <= 100; km++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			metrics.RecordAssignment(float64(km))
+		}()
+	}
+	wg.Wait()
+
+	stats := metrics.AssignmentDistance()
+	if stats.Count != 100 || stats.AverageKm != 50.5 || stats.P95Km != 95 {
+		t.Errorf("stats = %+v, want count 100, average 50.5, p95 95", stats)
+	}
+}
+
+func TestAssignmentDistanceP95UsesRecentSamples(t *testing.T) {
+	metrics := NewAssignmentMetrics(clock.NewFake(time.Unix(1700000000, 0)))
+	metrics.RecordAssignment(1000)
+	for range distanceSampleSize {
+		metrics.RecordAssignment(2)
+	}
+
+	// The outlier still counts toward the average but has left the sample
+	stats := metrics.AssignmentDistance()
+	if want := (1000 + 2*float64(distanceSampleSize)) / float64(distanceSampleSize+1); stats.AverageKm != want {
+		t.Errorf("average = %v, want %v", stats.AverageKm, want)
+	}
+	if stats.P95Km != 2 {
+		t.Errorf("p95 = %v, want 2", stats.P95Km)
+	}
+}
+
+func TestMatcherRecordsAssignmentDistance(t *testing.T) {
+	clk := clock.NewFake(time.Unix(1700000000, 0))
+	repo := repository.NewStateManager(repository.Config{Clock: clk, GeoIndexEnabled: true, DriverCapacity: 1})
+	metrics := NewAssignmentMetrics(clk)
+	matcher := NewMatcher(repo, clk, metrics, NewCircuitBreaker(clk, 5, 30*time.Second), MatcherConfig{Workers: 1, Mode: MatchNearest})
+	repo.CreateOrUpdateDriver(testDriverAt("d1", 37.77, -122.42))
+	repo.CreateOrder(testOrderAt("o1", 37.78, -122.42))
+
+	matcher.MatchOrders()
+	stats := metrics.AssignmentDistance()
+	// A hundredth of a degree of latitude is about 1.11km
+	if stats.Count != 1 || stats.AverageKm < 1.1 || stats.AverageKm > 1.12 {
+		t.Errorf("stats = %+v, want one assignment of about 1.11km", stats)
+	}
+}
+
+func TestMatchRateCountsRecentAssignments(t *testing.T) {
+	clk := clock.NewFake(time.Unix(1700000000, 0))
+	metrics := NewAssignmentMetrics(clk)
+	if rate := metrics.MatchRate(); rate != 0 {
+		t.Errorf("rate before any assignment = %v, want 0", rate)
+	}
+
+	// Under a minute after startup the rate is still per whole minute
+	for range 3 {
+		metrics.RecordAssignment(1)
+	}
+	if rate := metrics.MatchRate(); rate != 3 {
+		t.Errorf("rate in the first minute = %v, want 3", rate)
+	}
+
+	// Five minutes in, the window has grown to match
+	clk.Advance(5 * time.Minute)
+	for range 7 {
+		metrics.RecordAssignment(1)
+	}
+	if rate := metrics.MatchRate(); rate != 2 {
+		t.Errorf("rate after 5 minutes = %v, want 10 assignments over 5 minutes", rate)
+	}
+
+	// The window stops at fifteen minutes, leaving the first three behind
+	clk.Advance(15 * time.Minute)
+	if rate := metrics.MatchRate(); rate != 7.0/15 {
+		t.Errorf("rate after 20 minutes = %v, want 7 assignments over 15 minutes", rate)
+	}
+}
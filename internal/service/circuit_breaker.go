@@ -0,0 +1,106 @@
+package service
+
+import (
+	"delivery-state-manager/internal/models"
+	"delivery-state-manager/pkg/clock"
+	"log"
+	"sync"
+	"time"
+)
+
+// Circuit breaker states
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half-open"
+)
+
+// CircuitBreaker pauses the matcher after repeated failed passes.
+// After threshold consecutive failures it opens for cooldown, then lets a
+// single trial pass through (half-open) which either closes or reopens it.
+// It is safe for concurrent use.
+type CircuitBreaker struct {
+	clock     clock.Clock
+	threshold int
+	cooldown  time.Duration
+
+	state    string
+	failures int
+	openedAt time.Time
+	mu       sync.Mutex
+}
+
+// NewCircuitBreaker creates a closed CircuitBreaker. A threshold of zero
+// disables it so it never opens.
+func NewCircuitBreaker(clk clock.Clock, threshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		clock:     clk,
+		threshold: threshold,
+		cooldown:  cooldown,
+		state:     BreakerClosed,
+	}
+}
+
+// Allow reports whether a pass may run, moving an open breaker to half-open
+// once its cooldown has elapsed
+func (cb *CircuitBreaker) Allow() bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if cb.state == BreakerOpen {
+		if cb.clock.Now().Sub(cb.openedAt) < cb.cooldown {
+			return false
+		}
+		cb.transition(BreakerHalfOpen)
+	}
+	return true
+}
+
+// RecordSuccess closes the breaker and resets the failure count
+func (cb *CircuitBreaker) RecordSuccess() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	cb.failures = 0
+	if cb.state != BreakerClosed {
+		cb.transition(BreakerClosed)
+	}
+}
+
+// RecordFailure counts a failed pass, opening the breaker when the threshold
+// is reached or when the half-open trial fails
+func (cb *CircuitBreaker) RecordFailure() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	cb.failures++
+	if cb.threshold <= 0 {
+		return
+	}
+
+	if cb.state == BreakerHalfOpen || (cb.state == BreakerClosed && cb.failures >= cb.threshold) {
+		cb.openedAt = cb.clock.Now()
+		cb.transition(BreakerOpen)
+	}
+}
+
+// Status returns the current breaker state
+func (cb *CircuitBreaker) Status() models.CircuitBreakerStatus {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	status := models.CircuitBreakerStatus{
+		State:               cb.state,
+		ConsecutiveFailures: cb.failures,
+	}
+	if cb.state != BreakerClosed {
+		status.OpenedAt = cb.openedAt.Unix()
+	}
+	return status
+}
+
+// transition changes state and logs it. The caller must hold cb.mu.
+func (cb *CircuitBreaker) transition(state string) {
+	log.Printf("Matcher circuit breaker %s -> %s (consecutive failures: %d)", cb.state, state, cb.failures)
+	cb.state = state
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"delivery-state-manager/internal/models"
+	"delivery-state-manager/pkg/clock"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerOpensPausesAndRecovers(t *testing.T) {
+	clk := clock.NewFake(time.Unix(1700000000, 0))
+	cb := NewCircuitBreaker(clk, 3, 30*time.Second)
+
+	for i := range 3 {
+		if !cb.Allow() {
+			t.Fatalf("closed breaker refused pass %d", i+1)
+		}
+		cb.RecordFailure()
+	}
+	if status := cb.Status(); status.State != BreakerOpen || status.ConsecutiveFailures != 3 || status.OpenedAt != clk.Now().Unix() {
+		t.Fatalf("status after 3 failures = %+v, want open since now", status)
+	}
+
+	clk.Advance(29 * time.Second)
+	if cb.Allow() {
+		t.Error("open breaker allowed a pass during its cooldown")
+	}
+
+	// The half-open trial fails, so the cooldown starts over
+	clk.Advance(time.Second)
+	if !cb.Allow() || cb.Status().State != BreakerHalfOpen {
+		t.Fatalf("breaker after its cooldown is %s, want a half-open trial", cb.Status().State)
+	}
+	cb.RecordFailure()
+	if cb.Status().State != BreakerOpen || cb.Allow() {
+		t.Fatalf("breaker after a failed trial is %s, want open again", cb.Status().State)
+	}
+
+	clk.Advance(30 * time.Second)
+	cb.Allow()
+	cb.RecordSuccess()
+	if status := cb.Status(); status.State != BreakerClosed || status.ConsecutiveFailures != 0 {
+		t.Errorf("status after a successful trial = %+v, want closed with no failures", status)
+	}
+}
+
+func TestCircuitBreakerSuccessResetsFailures(t *testing.T) {
+	cb := NewCircuitBreaker(clock.NewFake(time.Unix(1700000000, 0)), 3, 30*time.Second)
+	cb.RecordFailure()
+	cb.RecordFailure()
+	cb.RecordSuccess()
+	cb.RecordFailure()
+	cb.RecordFailure()
+	if cb.Status().State != BreakerClosed {
+		t.Errorf("breaker is %s after failures interrupted by a success, want closed", cb.Status().State)
+	}
+}
+
+func TestCircuitBreakerDisabled(t *testing.T) {
+	cb := NewCircuitBreaker(clock.NewFake(time.Unix(1700000000, 0)), 0, 30*time.Second)
+	for range 100 {
+		cb.RecordFailure()
+	}
+	if !cb.Allow() || cb.Status().State != BreakerClosed {
+		t.Errorf("disabled breaker is %s, want it never to open", cb.Status().State)
+	}
+}
+
+func TestMatcherSkipsPassesWhileBreakerOpen(t *testing.T) {
+	clk := clock.NewFake(time.Unix(1700000000, 0))
+	repo, matcher := newTestMatcher(t, clk, MatcherConfig{})
+	for range 5 {
+		matcher.breaker.RecordFailure()
+	}
+	repo.CreateOrUpdateDriver(testDriverAt("d1", 37.77, -122.42))
+	repo.CreateOrder(testOrderAt("o1", 37.77, -122.42))
+
+	matcher.MatchOrders()
+	if order, _ := repo.GetOrder("o1"); order.Status != models.OrderPending {
+		t.Fatalf("order while the breaker is open is %s, want pending", order.Status)
+	}
+
+	clk.Advance(30 * time.Second)
+	matcher.MatchOrders()
+	if order, _ := repo.GetOrder("o1"); order.Status != models.OrderAssigned {
+		t.Errorf("order after the cooldown is %s, want assigned", order.Status)
+	}
+	if state := matcher.breaker.Status().State; state != BreakerClosed {
+		t.Errorf("breaker after a successful trial is %s, want closed", state)
+	}
+}
@@ -0,0 +1,55 @@
+package service
+
+import (
+	"sync"
+	"time"
+)
+
+// driverLoad tracks when the matcher assigned each driver an order, so the
+// balanced mode can prefer drivers who have handled fewer orders recently.
+// It is safe for concurrent use.
+type driverLoad struct {
+	window      time.Duration
+	assignments map[string][]int64
+	mu          sync.Mutex
+}
+
+// newDriverLoad creates a driverLoad counting assignments within window
+func newDriverLoad(window time.Duration) *driverLoad {
+	return &driverLoad{
+		window:      window,
+		assignments: make(map[string][]int64),
+	}
+}
+
+// record notes an assignment to driverID at now (Unix seconds)
+func (l *driverLoad) record(driverID string, now int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.assignments[driverID] = append(l.assignments[driverID], now)
+}
+
+// counts returns the number of assignments per driver within the window
+// ending at now, dropping older entries
+func (l *driverLoad) counts(now int64) map[string]int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	cutoff := now - int64(l.window/time.Second)
+	counts := make(map[string]int, len(l.assignments))
+	for driverID, times := range l.assignments {
+		// Timestamps are appended in order, so expired ones form a prefix
+		start := 0
+		for start < len(times) && times[start] <= cutoff {
+			start++
+		}
+		if start == len(times) {
+			delete(l.assignments, driverID)
+			continue
+		}
+		l.assignments[driverID] = times[start:]
+		counts[driverID] = len(times) - start
+	}
+	return counts
+}
@@ -1,77 +1,781 @@
 package service
 
 import (
+	"cmp"
+	"context"
 	"delivery-state-manager/internal/models"
+	"delivery-state-manager/pkg/clock"
+	"delivery-state-manager/pkg/errs"
+	"delivery-state-manager/pkg/logger"
 	"log"
+	"math"
+	"slices"
+	"sort"
+	"sync"
 	"time"
 )
 
 // MatcherRepository defines the interface for the matching repository
 type MatcherRepository interface {
-	AssignOrderToDriver(orderID, driverID string) error
-	GetAvailableDrivers() []*models.Driver
-	GetPendingOrders() []*models.Order
+	AssignMatchedOrder(orderID, driverID string, pickup models.Location) error
+	GetOrder(id string) (*models.Order, error)
+	GetDriver(id string) (*models.Driver, error)
+	GetAssignableDrivers() []*models.Driver
+	GetReadyOrders(now int64) []*models.Order
+	RecordMatchFailures(orderIDs []string, maxAttempts int) []string
+	ReleaseOrphanedOrders() []string
+	OfferOrder(orderID string, driverIDs, queue []string, expiresAt int64) (*models.Order, error)
+	ExpireOffers(now, expiresAt int64, batch int) (renewed, expired, lapsed []string)
+}
+
+// AssignmentRecorder receives the pickup distance of each successful assignment
+type AssignmentRecorder interface {
+	RecordAssignment(distanceKm float64)
+}
+
+// Supported values for MatcherConfig.Mode
+const (
+	// MatchNearest ranks drivers by pickup distance alone
+	MatchNearest = "nearest"
+	// MatchBalanced also penalizes drivers by their recent assignments
+	MatchBalanced = "balanced"
+	// MatchFIFO serves orders strictly in creation order, each taking the
+	// nearest driver still free
+	MatchFIFO = "fifo"
+	// MatchWeighted ranks pairs by a weighted sum of normalized distance,
+	// driver rating, order age and driver heading
+	MatchWeighted = "weighted"
+)
+
+// MatcherConfig holds the tunable matching parameters
+type MatcherConfig struct {
+	// AgingWeight is the distance in kilometers an order is forgiven for every
+	// minute it has been pending, so old orders eventually outrank closer ones
+	AgingWeight float64
+	// MaxMatchAttempts is how many passes may leave an order unmatched before
+	// it is moved to unmatchable. Zero retries forever.
+	MaxMatchAttempts int
+	// Workers is how many goroutines score candidate pairs in parallel.
+	// Assignments are always applied serially.
+	Workers int
+	// Mode is MatchNearest, MatchBalanced, MatchFIFO or MatchWeighted
+	Mode string
+	// BalanceToleranceKm is the extra pickup distance accepted, per recent
+	// assignment, to reach a less busy driver in balanced mode
+	BalanceToleranceKm float64
+	// BalanceWindow is how far back assignments count toward a driver's load
+	BalanceWindow time.Duration
+	// MaxDistanceKm is the farthest a driver may be from the pickup to be
+	// matched. Zero means no limit.
+	MaxDistanceKm float64
+	// Weights are how much each score component counts in weighted mode
+	Weights models.ScoreWeights
+	// OfferDrivers is how many of the best-ranked drivers an order is
+	// offered to, and OfferTTL how long they have to accept
+	OfferDrivers int
+	OfferTTL     time.Duration
+	// OfferLapseHalfLife is how long it takes a driver's count of lapsed
+	// offers to halve. Drivers are offered orders after drivers with fewer
+	// whole lapses.
+	OfferLapseHalfLife time.Duration
+	// Zones resolves the zone of drivers not pinned to one, and of orders
+	// created before zones were configured
+	Zones models.ZoneMap
+	// ZoneOverflow lets an order take a driver from another zone once no
+	// driver of its own zone is left. Otherwise orders only get drivers of
+	// their own zone.
+	ZoneOverflow bool
 }
 
 // Matcher handles order-to-driver matching
 type Matcher struct {
-	repo MatcherRepository
+	repo    MatcherRepository
+	clock   clock.Clock
+	metrics AssignmentRecorder
+	breaker *CircuitBreaker
+	load    *driverLoad
+	cfg     MatcherConfig
+	// runMu keeps passes from overlapping when one is triggered on demand
+	runMu sync.Mutex
+
+	// statsMu guards interval, heartbeat, lastRun and the offer counts,
+	// which are read while a pass runs
+	statsMu  sync.Mutex
+	interval time.Duration
+	// heartbeat is when the background loop last started or finished a pass
+	heartbeat     time.Time
+	lastRun       *models.MatcherRun
+	offersRenewed int64
+	offersExpired int64
 }
 
 // NewMatcher creates a new Matcher instance
-func NewMatcher(repo MatcherRepository) *Matcher {
+func NewMatcher(repo MatcherRepository, clk clock.Clock, metrics AssignmentRecorder, breaker *CircuitBreaker, cfg MatcherConfig) *Matcher {
 	return &Matcher{
-		repo: repo,
+		repo:    repo,
+		clock:   clk,
+		metrics: metrics,
+		breaker: breaker,
+		load:    newDriverLoad(cfg.BalanceWindow),
+		cfg:     cfg,
 	}
 }
 
-// StartMatcher runs the background matching engine
-func (m *Matcher) StartMatcher(interval time.Duration) {
+// candidate is a possible order-driver pairing with its matching score
+type candidate struct {
+	order      *models.Order
+	driver     *models.Driver
+	distanceKm float64
+	score      float64
+	// crossZone marks a driver from another zone than the order
+	crossZone bool
+}
+
+// StartMatcher runs the background matching engine until ctx is canceled.
+// A pass already in progress finishes before it returns.
+func (m *Matcher) StartMatcher(ctx context.Context, interval time.Duration) {
 	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
+	m.statsMu.Lock()
+	m.interval = interval
+	m.statsMu.Unlock()
+	m.beat()
+
 	log.Printf("Matcher started with interval: %v", interval)
 
-	for range ticker.C {
-		m.MatchOrders()
+	for {
+		select {
+		case <-ctx.Done():
+			log.Printf("Matcher stopped")
+			return
+		case <-ticker.C:
+			logReport(m.MatchOrders())
+			m.beat()
+		}
+	}
+}
+
+// beat records that the background loop is alive
+func (m *Matcher) beat() {
+	now := m.clock.Now()
+	m.statsMu.Lock()
+	m.heartbeat = now
+	m.statsMu.Unlock()
+}
+
+// Heartbeat returns when the background loop last started or finished a
+// pass, and its interval. Both are zero until StartMatcher runs.
+func (m *Matcher) Heartbeat() (time.Time, time.Duration) {
+	m.statsMu.Lock()
+	defer m.statsMu.Unlock()
+	return m.heartbeat, m.interval
+}
+
+// StartOfferSweeper checks for lapsed offers every interval until ctx is
+// canceled
+func (m *Matcher) StartOfferSweeper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.SweepOffers()
+		}
+	}
+}
+
+// SweepOffers passes every offer that lapsed without an accept on to the next
+// OfferDrivers drivers of the order's ranked list, each with a fresh
+// OfferTTL. Orders whose list is exhausted move to unmatchable, where they
+// wait to be requeued.
+func (m *Matcher) SweepOffers() {
+	now := m.clock.Now()
+	renewed, expired, _ := m.repo.ExpireOffers(now.Unix(), now.Add(m.cfg.OfferTTL).Unix(), m.cfg.OfferDrivers)
+	for _, id := range renewed {
+		logger.Debugf("Offer for order %s lapsed, offered to the next drivers", id)
+	}
+	for _, id := range expired {
+		log.Printf("Order %s moved to unmatchable: no offered driver accepted it", id)
+	}
+
+	m.statsMu.Lock()
+	m.offersRenewed += int64(len(renewed))
+	m.offersExpired += int64(len(expired))
+	m.statsMu.Unlock()
+}
+
+// MatchOrders runs one matching pass and reports which ready orders it
+// assigned and why the others were left unassigned. Concurrent calls run one
+// at a time.
+func (m *Matcher) MatchOrders() models.MatchReport {
+	m.runMu.Lock()
+	defer m.runMu.Unlock()
+
+	started := m.clock.Now()
+	run, report := m.matchOrders(started.Unix())
+	run.StartedAt = started.Unix()
+	run.DurationMs = m.clock.Now().Sub(started).Milliseconds()
+
+	m.statsMu.Lock()
+	m.lastRun = &run
+	m.statsMu.Unlock()
+	return report
+}
+
+// logReport logs a background pass's assignments, with each unassigned
+// order and its reason at debug level
+func logReport(report models.MatchReport) {
+	if len(report.Assigned) > 0 {
+		log.Printf("Matcher completed: %d orders assigned to drivers", len(report.Assigned))
+	}
+	for _, outcome := range report.Failed {
+		logger.Debugf("Order %s left unassigned: %s", outcome.OrderID, outcome.Reason)
 	}
 }
 
-// MatchOrders performs the actual matching logic
-func (m *Matcher) MatchOrders() {
-	pendingOrders := m.repo.GetPendingOrders()
-	availableDrivers := m.repo.GetAvailableDrivers()
+// Status reports the matcher's configuration, its last pass and its
+// circuit breaker
+func (m *Matcher) Status() models.MatcherStatus {
+	m.statsMu.Lock()
+	defer m.statsMu.Unlock()
+
+	status := models.MatcherStatus{
+		Mode:               m.cfg.Mode,
+		Workers:            m.cfg.Workers,
+		MaxDistanceKm:      m.cfg.MaxDistanceKm,
+		AgingWeight:        m.cfg.AgingWeight,
+		MaxMatchAttempts:   m.cfg.MaxMatchAttempts,
+		BalanceToleranceKm: m.cfg.BalanceToleranceKm,
+		BalanceWindow:      m.cfg.BalanceWindow.String(),
+		Weights:            m.cfg.Weights,
+		OfferDrivers:       m.cfg.OfferDrivers,
+		OfferTTL:           m.cfg.OfferTTL.String(),
+		OffersRenewed:      m.offersRenewed,
+		OffersExpired:      m.offersExpired,
+		Breaker:            m.breaker.Status(),
+	}
+	if m.interval > 0 {
+		status.Interval = m.interval.String()
+	}
+	if m.lastRun != nil {
+		run := *m.lastRun
+		status.LastRun = &run
+	}
+	return status
+}
+
+// matchOrders runs the body of a pass and reports what it did, in total and
+// per order. The caller must hold runMu.
+func (m *Matcher) matchOrders(now int64) (models.MatcherRun, models.MatchReport) {
+	var run models.MatcherRun
+	report := models.MatchReport{Assigned: []models.MatchOutcome{}, Failed: []models.MatchOutcome{}}
+
+	// Orders whose driver vanished go back into this pass's pending pool
+	released := m.repo.ReleaseOrphanedOrders()
+	for _, id := range released {
+		log.Printf("Order %s returned to pending: its driver no longer exists", id)
+	}
+	run.Released = len(released)
+
+	if !m.breaker.Allow() {
+		logger.Debugf("Matcher paused by open circuit breaker")
+		run.Skipped = true
+		return run, report
+	}
+
+	// Scheduled orders are held back until their time arrives
+	pendingOrders := m.repo.GetReadyOrders(now)
+	availableDrivers := m.readyDrivers(now)
+	run.PendingOrders = len(pendingOrders)
+	run.AvailableDrivers = len(availableDrivers)
 
 	if len(pendingOrders) == 0 {
-		return
+		return run, report
 	}
 
 	if len(availableDrivers) == 0 {
 		log.Printf("No available drivers for %d pending orders", len(pendingOrders))
-		return
+		m.recordFailures(pendingOrders, nil)
+		report.Failed = failedOutcomes(pendingOrders, nil, nil)
+		return run, report
 	}
 
-	matched := 0
+	candidates := m.candidates(pendingOrders, availableDrivers)
 
-	// Simple first-come-first-served matching
-	for i, order := range pendingOrders {
-		if i >= len(availableDrivers) {
-			break
+	// The ready orders of each bundle, which are assigned together
+	bundles := make(map[string][]*models.Order)
+	for _, order := range pendingOrders {
+		if order.BundleID != "" {
+			bundles[order.BundleID] = append(bundles[order.BundleID], order)
 		}
+	}
 
-		driver := availableDrivers[i]
+	matched, failed := 0, 0
+	usedOrders := make(map[string]bool)
+	usedDrivers := make(map[string]bool)
+	// lastErr is the latest assignment error of each order still unassigned
+	lastErr := make(map[string]error)
+	assigned := make(map[string]bool)
 
-		err := m.repo.AssignOrderToDriver(order.ID, driver.ID)
+	// Greedily take the best-scoring pairs, each order and driver at most once
+	for _, c := range candidates {
+		if usedOrders[c.order.ID] || usedDrivers[c.driver.ID] {
+			continue
+		}
+
+		err := m.repo.AssignMatchedOrder(c.order.ID, c.driver.ID, c.order.Pickup)
+		if err == errs.ErrPickupChanged {
+			// Ranked on a pickup that has since been corrected; the next
+			// pass scores the order again
+			logger.Debugf("Skipped order %s: pickup changed during the pass", c.order.ID)
+			usedOrders[c.order.ID] = true
+			lastErr[c.order.ID] = err
+			continue
+		}
+		if err == errs.ErrBundleExceedsCapacity {
+			// Not a failure: a driver with more room may still take it
+			lastErr[c.order.ID] = err
+			continue
+		}
 		if err != nil {
-			log.Printf("Failed to assign order %s to driver %s: %v", order.ID, driver.ID, err)
+			log.Printf("Failed to assign order %s to driver %s: %v", c.order.ID, c.driver.ID, err)
+			failed++
+			lastErr[c.order.ID] = err
 			continue
 		}
 
-		log.Printf("Matched order %s to driver %s", order.ID, driver.ID)
-		matched++
+		usedDrivers[c.driver.ID] = true
+		members := []candidate{c}
+		if c.order.BundleID != "" {
+			members = members[:0]
+			for _, order := range bundles[c.order.BundleID] {
+				members = append(members, candidate{order: order, driver: c.driver, distanceKm: models.DistanceKm(c.driver.Location, order.Pickup)})
+			}
+		}
+		for _, member := range members {
+			usedOrders[member.order.ID] = true
+			assigned[member.order.ID] = true
+			m.recordAssignment(member, now)
+			report.Assigned = append(report.Assigned, models.MatchOutcome{
+				OrderID:    member.order.ID,
+				DriverID:   member.driver.ID,
+				DistanceKm: member.distanceKm,
+			})
+
+			logger.Debugf("Matched order %s to driver %s", member.order.ID, member.driver.ID)
+			matched++
+		}
 	}
 
+	m.recordFailures(pendingOrders, usedOrders)
+
+	// A pass fails when every assignment it attempted errored
 	if matched > 0 {
-		log.Printf("Matcher completed: %d orders assigned to drivers", matched)
+		m.breaker.RecordSuccess()
+	} else if failed > 0 {
+		m.breaker.RecordFailure()
+	}
+
+	slices.SortFunc(report.Assigned, func(a, b models.MatchOutcome) int { return cmp.Compare(a.OrderID, b.OrderID) })
+	report.Failed = failedOutcomes(pendingOrders, assigned, lastErr)
+	run.Assigned = matched
+	run.Failed = failed
+	return run, report
+}
+
+// failedOutcomes lists the orders not in assigned, sorted by ID, with the
+// code of their last assignment error. Orders that never got that far had no
+// eligible driver.
+func failedOutcomes(orders []*models.Order, assigned map[string]bool, lastErr map[string]error) []models.MatchOutcome {
+	failed := make([]models.MatchOutcome, 0, len(orders)-len(assigned))
+	for _, order := range orders {
+		if assigned[order.ID] {
+			continue
+		}
+		err := lastErr[order.ID]
+		if err == nil {
+			err = errs.ErrNoEligibleDriver
+		}
+		failed = append(failed, models.MatchOutcome{
+			OrderID: order.ID,
+			Reason:  cmp.Or(errs.Code(err), err.Error()),
+		})
+	}
+	slices.SortFunc(failed, func(a, b models.MatchOutcome) int { return cmp.Compare(a.OrderID, b.OrderID) })
+	return failed
+}
+
+// AssignNearest immediately assigns one pending order to its best-scoring
+// ready driver, ranked exactly as a matcher pass would rank them, and returns
+// that driver. A bundled order brings the rest of its bundle along, so only
+// drivers with room for all of it qualify. It returns ErrNoEligibleDriver
+// when no driver qualifies.
+func (m *Matcher) AssignNearest(orderID string) (*models.Driver, error) {
+	m.runMu.Lock()
+	defer m.runMu.Unlock()
+
+	order, err := m.repo.GetOrder(orderID)
+	if err != nil {
+		return nil, err
+	}
+	if order.Status != models.OrderPending {
+		return nil, errs.ErrOrderAlreadyAssigned
+	}
+
+	now := m.clock.Now().Unix()
+	for _, c := range m.candidates([]*models.Order{order}, m.readyDrivers(now)) {
+		err := m.repo.AssignMatchedOrder(order.ID, c.driver.ID, order.Pickup)
+		if err == errs.ErrDriverNotAvailable || err == errs.ErrDriverNotFound || err == errs.ErrDriverDailyLimit || err == errs.ErrBundleExceedsCapacity {
+			// The driver changed since they were listed; try the next one
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		m.recordAssignment(c, now)
+		logger.Debugf("Auto-assigned order %s to driver %s", order.ID, c.driver.ID)
+		return m.repo.GetDriver(c.driver.ID)
+	}
+	return nil, errs.ErrNoEligibleDriver
+}
+
+// OfferOrder offers one pending order to its OfferDrivers best-ranked ready
+// drivers, ranked exactly as a matcher pass would rank them, and returns the
+// offered order. It returns ErrNoEligibleDriver when no driver qualifies.
+func (m *Matcher) OfferOrder(orderID string) (*models.Order, error) {
+	m.runMu.Lock()
+	defer m.runMu.Unlock()
+
+	order, err := m.repo.GetOrder(orderID)
+	if err != nil {
+		return nil, err
+	}
+	if order.Status != models.OrderPending {
+		return nil, errs.ErrOrderAlreadyAssigned
+	}
+	// Offers are accepted order by order, which would split the bundle
+	if order.BundleID != "" {
+		return nil, errs.ErrOrderBundled
+	}
+
+	now := m.clock.Now()
+	candidates := m.candidates([]*models.Order{order}, m.readyDrivers(now.Unix()))
+	if len(candidates) == 0 {
+		return nil, errs.ErrNoEligibleDriver
+	}
+
+	// Drivers who keep letting offers lapse move down the list, still
+	// within their zone tier, until their lapses decay
+	slices.SortStableFunc(candidates, func(a, b candidate) int {
+		if a.crossZone != b.crossZone {
+			if a.crossZone {
+				return 1
+			}
+			return -1
+		}
+		return cmp.Compare(m.lapseTier(a.driver, now.Unix()), m.lapseTier(b.driver, now.Unix()))
+	})
+
+	ranked := make([]string, 0, len(candidates))
+	for _, c := range candidates {
+		ranked = append(ranked, c.driver.ID)
+	}
+	batch := min(len(ranked), m.cfg.OfferDrivers)
+	return m.repo.OfferOrder(order.ID, ranked[:batch], ranked[batch:], now.Add(m.cfg.OfferTTL).Unix())
+}
+
+// lapseTier is the whole number of offers the driver let lapse, decayed to
+// now
+func (m *Matcher) lapseTier(driver *models.Driver, now int64) float64 {
+	return math.Floor(driver.DecayedOfferLapses(now, m.cfg.OfferLapseHalfLife))
+}
+
+// recordAssignment counts a successful assignment toward the distance
+// metrics and, in balanced mode, the driver's load. Simulated orders and
+// drivers are left out of the metrics.
+func (m *Matcher) recordAssignment(c candidate, now int64) {
+	if !c.order.Simulated && !c.driver.Simulated {
+		m.metrics.RecordAssignment(c.distanceKm)
+	}
+	if m.cfg.Mode == MatchBalanced {
+		m.load.record(c.driver.ID, now)
+	}
+}
+
+// readyDrivers returns the assignable drivers, available or busy with spare
+// capacity, whose cooldown has elapsed and who are below their daily order cap
+func (m *Matcher) readyDrivers(now int64) []*models.Driver {
+	drivers := m.repo.GetAssignableDrivers()
+	today := models.Day(m.clock.Now())
+
+	ready := drivers[:0]
+	for _, driver := range drivers {
+		if driver.CooldownUntil <= now && driver.RemainingDailyOrders(today) != 0 {
+			ready = append(ready, driver)
+		}
+	}
+	return ready
+}
+
+// recordFailures counts a failed attempt for every order not in matched and
+// logs the orders that ran out of attempts
+func (m *Matcher) recordFailures(orders []*models.Order, matched map[string]bool) {
+	if m.cfg.MaxMatchAttempts <= 0 {
+		return
+	}
+
+	unmatched := make([]string, 0, len(orders))
+	for _, order := range orders {
+		if !matched[order.ID] {
+			unmatched = append(unmatched, order.ID)
+		}
+	}
+	if len(unmatched) == 0 {
+		return
+	}
+
+	for _, id := range m.repo.RecordMatchFailures(unmatched, m.cfg.MaxMatchAttempts) {
+		log.Printf("Order %s moved to unmatchable after %d failed matcher passes", id, m.cfg.MaxMatchAttempts)
+	}
+}
+
+// candidates lists the order-driver pairs to try, best first, as ranked by
+// the configured mode. Pairs within one zone all come before cross-zone
+// pairs, which are dropped unless ZoneOverflow is set, so the greedy
+// assignment only crosses zones once an order's own zone has run dry.
+func (m *Matcher) candidates(orders []*models.Order, drivers []*models.Driver) []candidate {
+	var ranked []candidate
+	switch m.cfg.Mode {
+	case MatchFIFO:
+		ranked = m.queueCandidates(orders, drivers)
+	case MatchWeighted:
+		ranked = m.weightedCandidates(orders, drivers)
+	default:
+		ranked = m.rankCandidates(orders, drivers)
+	}
+
+	driverZones := make(map[string]string, len(drivers))
+	for _, driver := range drivers {
+		driverZones[driver.ID] = cmp.Or(driver.Zone, m.cfg.Zones.Resolve(driver.Location))
+	}
+
+	sameZone := ranked[:0]
+	var crossZone []candidate
+	for _, c := range ranked {
+		orderZone := cmp.Or(c.order.Zone, m.cfg.Zones.Resolve(c.order.Pickup))
+		if driverZones[c.driver.ID] == orderZone {
+			sameZone = append(sameZone, c)
+		} else if m.cfg.ZoneOverflow {
+			c.crossZone = true
+			crossZone = append(crossZone, c)
+		}
+	}
+	return append(sameZone, crossZone...)
+}
+
+// rankCandidates scores every order-driver pair and sorts them best first.
+// The score is the pickup distance minus the aging boost, so lower is better.
+// In balanced mode each recent assignment adds BalanceToleranceKm to a
+// driver's score, so a less busy driver wins unless they are that much farther.
+// Orders are scored across the worker pool, but results are gathered in
+// order so the ranking does not depend on the number of workers.
+func (m *Matcher) rankCandidates(orders []*models.Order, drivers []*models.Driver) []candidate {
+	now := m.clock.Now().Unix()
+
+	var loads map[string]int
+	if m.cfg.Mode == MatchBalanced {
+		loads = m.load.counts(now)
+	}
+
+	perOrder := make([][]candidate, len(orders))
+	m.forEach(len(orders), func(i int) {
+		perOrder[i] = m.scoreOrder(orders[i], drivers, loads, now)
+	})
+
+	candidates := make([]candidate, 0, len(orders)*len(drivers))
+	for _, scored := range perOrder {
+		candidates = append(candidates, scored...)
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].less(candidates[j])
+	})
+	return candidates
+}
+
+// less reports whether c ranks before other. Equal scores, such as two
+// drivers exactly as far from a pickup, go to the driver assigned least
+// recently (never-assigned drivers first), then the lowest driver ID, then
+// the lowest order ID, so every pass over the same state picks the same pairs.
+func (c candidate) less(other candidate) bool {
+	if c.score != other.score {
+		return c.score < other.score
+	}
+	if c.driver.LastAssignedAt != other.driver.LastAssignedAt {
+		return c.driver.LastAssignedAt < other.driver.LastAssignedAt
+	}
+	if c.driver.ID != other.driver.ID {
+		return c.driver.ID < other.driver.ID
+	}
+	return c.order.ID < other.order.ID
+}
+
+// queueCandidates lists candidates order by order, oldest order first and
+// each order's drivers nearest first, so the greedy assignment serves orders
+// strictly in creation order. An order with no driver in range is passed
+// over rather than holding up the queue.
+func (m *Matcher) queueCandidates(orders []*models.Order, drivers []*models.Driver) []candidate {
+	now := m.clock.Now().Unix()
+
+	queue := slices.Clone(orders)
+	sort.Slice(queue, func(i, j int) bool {
+		if queue[i].CreatedAt != queue[j].CreatedAt {
+			return queue[i].CreatedAt < queue[j].CreatedAt
+		}
+		return queue[i].ID < queue[j].ID
+	})
+
+	perOrder := make([][]candidate, len(queue))
+	m.forEach(len(queue), func(i int) {
+		scored := m.scoreOrder(queue[i], drivers, nil, now)
+		sort.Slice(scored, func(a, b int) bool {
+			return scored[a].less(scored[b])
+		})
+		perOrder[i] = scored
+	})
+
+	candidates := make([]candidate, 0, len(queue)*len(drivers))
+	for _, scored := range perOrder {
+		candidates = append(candidates, scored...)
+	}
+	return candidates
+}
+
+// weightedCandidates scores every order-driver pair as the weighted sum of
+// four components, each normalized to [0, 1]: pickup proximity relative to
+// MaxDistanceKm (or the farthest pair in the pass when unlimited), driver
+// rating relative to MaxRating, waiting time relative to the oldest order
+// in the pass, and how directly the driver is heading toward the pickup.
+// Pairs are sorted highest sum first; score holds the
+// negated sum so lower is still better.
+func (m *Matcher) weightedCandidates(orders []*models.Order, drivers []*models.Driver) []candidate {
+	now := m.clock.Now().Unix()
+
+	perOrder := make([][]candidate, len(orders))
+	m.forEach(len(orders), func(i int) {
+		perOrder[i] = m.scoreOrder(orders[i], drivers, nil, now)
+	})
+
+	candidates := make([]candidate, 0, len(orders)*len(drivers))
+	for _, scored := range perOrder {
+		candidates = append(candidates, scored...)
+	}
+
+	maxDistance := m.cfg.MaxDistanceKm
+	if maxDistance <= 0 {
+		for _, c := range candidates {
+			maxDistance = max(maxDistance, c.distanceKm)
+		}
+	}
+	maxWaiting := 0.0
+	for _, order := range orders {
+		maxWaiting = max(maxWaiting, waitingMinutes(order, now))
+	}
+
+	weights := m.cfg.Weights
+	for i := range candidates {
+		c := &candidates[i]
+		proximity, age := 1.0, 0.0
+		if maxDistance > 0 {
+			proximity = 1 - c.distanceKm/maxDistance
+		}
+		if maxWaiting > 0 {
+			age = waitingMinutes(c.order, now) / maxWaiting
+		}
+		rating := c.driver.Rating / models.MaxRating
+		heading := headingAlignment(c.driver, c.order.Pickup)
+		c.score = -(weights.Distance*proximity + weights.Rating*rating + weights.Age*age + weights.Heading*heading)
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].less(candidates[j])
+	})
+	return candidates
+}
+
+// headingAlignment returns the cosine of the angle between the driver's last
+// movement and the direction of pickup, from 1 when heading straight for it
+// down to 0 when moving perpendicular or away. Drivers without a known
+// heading, such as idle ones or those with too little location history, and
+// drivers already at the pickup score 0.
+func headingAlignment(driver *models.Driver, pickup models.Location) float64 {
+	heading, ok := driver.Heading()
+	if !ok || driver.Location == pickup {
+		return 0
+	}
+	angle := (models.Bearing(driver.Location, pickup) - heading) * math.Pi / 180
+	return max(math.Cos(angle), 0)
+}
+
+// waitingMinutes returns how long order has been ready to match. Scheduled
+// orders only start waiting once their time arrives.
+func waitingMinutes(order *models.Order, now int64) float64 {
+	waitingSince := max(order.CreatedAt, order.ScheduledFor)
+	return max(float64(now-waitingSince)/60, 0)
+}
+
+// scoreOrder scores order against every driver within MaxDistanceKm of the
+// pickup, penalizing each driver by their recent load
+func (m *Matcher) scoreOrder(order *models.Order, drivers []*models.Driver, loads map[string]int, now int64) []candidate {
+	boost := m.cfg.AgingWeight * waitingMinutes(order, now)
+
+	candidates := make([]candidate, 0, len(drivers))
+	for _, driver := range drivers {
+		distance := models.DistanceKm(driver.Location, order.Pickup)
+		if m.cfg.MaxDistanceKm > 0 && distance > m.cfg.MaxDistanceKm {
+			continue
+		}
+		candidates = append(candidates, candidate{
+			order:      order,
+			driver:     driver,
+			distanceKm: distance,
+			score:      distance - boost + m.cfg.BalanceToleranceKm*float64(loads[driver.ID]),
+		})
+	}
+	return candidates
+}
+
+// forEach calls fn for every index in [0, n) using up to cfg.Workers
+// goroutines and returns once all calls have finished
+func (m *Matcher) forEach(n int, fn func(i int)) {
+	workers := min(m.cfg.Workers, n)
+	if workers <= 1 {
+		for i := 0; i < n; i++ {
+			fn(i)
+		}
+		return
+	}
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				fn(i)
+			}
+		}()
+	}
+
+	for i := 0; i < n; i++ {
+		indexes <- i
 	}
+	close(indexes)
+	wg.Wait()
 }
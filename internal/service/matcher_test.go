@@ -0,0 +1,558 @@
+package service
+
+import (
+	"cmp"
+	"delivery-state-manager/internal/models"
+	"delivery-state-manager/internal/repository"
+	"delivery-state-manager/pkg/clock"
+	"fmt"
+	"maps"
+	"math/rand/v2"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// newTestMatcher wires a Matcher to a fresh store, both reading clk
+func newTestMatcher(t *testing.T, clk clock.Clock, cfg MatcherConfig) (repository.Store, *Matcher) {
+	t.Helper()
+	repo := repository.NewStateManager(repository.Config{Clock: clk, GeoIndexEnabled: true, DriverCapacity: 1})
+	cfg.Workers = max(cfg.Workers, 1)
+	cfg.Mode = cmp.Or(cfg.Mode, MatchNearest)
+	matcher := NewMatcher(repo, clk, NewAssignmentMetrics(clk), NewCircuitBreaker(clk, 5, 30*time.Second), cfg)
+	return repo, matcher
+}
+
+// testDriverAt is an available driver at lat, lon
+func testDriverAt(id string, lat, lon float64) *models.Driver {
+	return &models.Driver{ID: id, Name: "Driver " + id, Status: models.DriverAvailable, Location: models.Location{Lat: lat, Lon: lon}}
+}
+
+// testOrderAt is a pending order picked up at lat, lon
+func testOrderAt(id string, lat, lon float64) *models.Order {
+	return &models.Order{
+		ID:       id,
+		Customer: "customer-" + id,
+		Pickup:   models.Location{Lat: lat, Lon: lon},
+		Dropoff:  models.Location{Lat: lat + 0.01, Lon: lon},
+	}
+}
+
+func TestMatcherAgesOrdersByStoreClock(t *testing.T) {
+	clk := clock.NewFake(time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC))
+	repo, matcher := newTestMatcher(t, clk, MatcherConfig{AgingWeight: 0.5})
+	repo.CreateOrUpdateDriver(testDriverAt("d1", 37.77, -122.42))
+
+	// About 2km away, but waiting ten minutes longer: a 5km boost
+	repo.CreateOrder(testOrderAt("old", 37.788, -122.42))
+	clk.Advance(10 * time.Minute)
+	repo.CreateOrder(testOrderAt("new", 37.77, -122.42))
+
+	if order, _ := repo.GetOrder("old"); order.CreatedAt != clk.Now().Add(-10*time.Minute).Unix() {
+		t.Fatalf("CreatedAt = %d, want the store clock's %d", order.CreatedAt, clk.Now().Add(-10*time.Minute).Unix())
+	}
+
+	matcher.MatchOrders()
+	if order, _ := repo.GetOrder("old"); order.Status != models.OrderAssigned {
+		t.Errorf("older order is %s, want it to outrank the closer one and be assigned", order.Status)
+	}
+	if order, _ := repo.GetOrder("new"); order.Status != models.OrderPending {
+		t.Errorf("newer order is %s, want pending", order.Status)
+	}
+}
+
+func TestMatcherHoldsScheduledOrders(t *testing.T) {
+	clk := clock.NewFake(time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC))
+	repo, matcher := newTestMatcher(t, clk, MatcherConfig{})
+	repo.CreateOrUpdateDriver(testDriverAt("d1", 37.77, -122.42))
+	order := testOrderAt("o1", 37.77, -122.42)
+	order.ScheduledFor = clk.Now().Add(time.Hour).Unix()
+	repo.CreateOrder(order)
+
+	matcher.MatchOrders()
+	if order, _ := repo.GetOrder("o1"); order.Status != models.OrderPending {
+		t.Fatalf("order scheduled an hour out is %s, want pending", order.Status)
+	}
+
+	clk.Advance(time.Hour)
+	matcher.MatchOrders()
+	if order, _ := repo.GetOrder("o1"); order.Status != models.OrderAssigned {
+		t.Errorf("order at its scheduled time is %s, want assigned", order.Status)
+	}
+}
+
+// seedFleet fills repo with drivers and pending orders scattered over a city,
+// the same for every call
+func seedFleet(repo repository.Store, drivers, orders int) {
+	rng := rand.New(rand.NewPCG(5, 6))
+	for i := range drivers {
+		repo.CreateOrUpdateDriver(testDriverAt(fmt.Sprintf("d%04d", i), 37.7+rng.Float64()*0.2, -122.5+rng.Float64()*0.2))
+	}
+	for i := range orders {
+		repo.CreateOrder(testOrderAt(fmt.Sprintf("o%04d", i), 37.7+rng.Float64()*0.2, -122.5+rng.Float64()*0.2))
+	}
+}
+
+// assignmentsOf maps each assigned order to its driver
+func assignmentsOf(repo repository.Store) map[string]string {
+	assigned := make(map[string]string)
+	for _, order := range repo.GetOrdersByStatus(models.OrderAssigned) {
+		assigned[order.ID] = order.DriverID
+	}
+	return assigned
+}
+
+func TestMatcherResultsIndependentOfWorkers(t *testing.T) {
+	var want map[string]string
+	for _, workers := range []int{1, 2, 8} {
+		clk := clock.NewFake(time.Unix(1700000000, 0))
+		repo, matcher := newTestMatcher(t, clk, MatcherConfig{Workers: workers})
+		seedFleet(repo, 300, 200)
+		matcher.MatchOrders()
+
+		got := assignmentsOf(repo)
+		if workers == 1 {
+			want = got
+			if len(want) != 200 {
+				t.Fatalf("one worker assigned %d orders, want all 200", len(want))
+			}
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%d workers assigned differently from one", workers)
+		}
+	}
+}
+
+// BenchmarkMatchOrders compares a matching pass scored by one worker with
+// one scored by a pool
+func BenchmarkMatchOrders(b *testing.B) {
+	for _, workers := range []int{1, 8} {
+		b.Run(fmt.Sprintf("workers_%d", workers), func(b *testing.B) {
+			clk := clock.NewFake(time.Unix(1700000000, 0))
+			for range b.N {
+				b.StopTimer()
+				repo := repository.NewStateManager(repository.Config{Clock: clk, GeoIndexEnabled: true, DriverCapacity: 1})
+				matcher := NewMatcher(repo, clk, NewAssignmentMetrics(clk), NewCircuitBreaker(clk, 5, 30*time.Second), MatcherConfig{Workers: workers, Mode: MatchNearest})
+				seedFleet(repo, 1000, 500)
+				b.StartTimer()
+				matcher.MatchOrders()
+			}
+		})
+	}
+}
+
+func TestBalancedModeAlternatesNearbyDrivers(t *testing.T) {
+	for _, tc := range []struct {
+		mode string
+		want string
+	}{
+		{MatchNearest, "[d1 d1 d1 d1]"},
+		{MatchBalanced, "[d1 d2 d1 d2]"},
+	} {
+		clk := clock.NewFake(time.Unix(1700000000, 0))
+		repo, matcher := newTestMatcher(t, clk, MatcherConfig{Mode: tc.mode, BalanceToleranceKm: 1, BalanceWindow: time.Hour})
+		// d2 is about half a kilometer further from every pickup than d1
+		repo.CreateOrUpdateDriver(testDriverAt("d1", 37.77, -122.42))
+		repo.CreateOrUpdateDriver(testDriverAt("d2", 37.7655, -122.42))
+
+		var drivers []string
+		for i := range 4 {
+			id := fmt.Sprintf("o%d", i)
+			repo.CreateOrder(testOrderAt(id, 37.77, -122.42))
+			matcher.MatchOrders()
+			order, _ := repo.GetOrder(id)
+			drivers = append(drivers, order.DriverID)
+
+			// Deliver and free the driver, who stays where they were
+			repo.UpdateOrderStatus(id, models.OrderPickedUp)
+			repo.UpdateOrderStatus(id, models.OrderDelivered)
+			repo.UpdateDriverStatus(order.DriverID, models.DriverAvailable)
+			clk.Advance(time.Minute)
+		}
+		if got := fmt.Sprint(drivers); got != tc.want {
+			t.Errorf("%s mode assigned %s, want %s", tc.mode, got, tc.want)
+		}
+	}
+}
+
+func TestMatcherRespectsMaxDistance(t *testing.T) {
+	clk := clock.NewFake(time.Unix(1700000000, 0))
+	repo, matcher := newTestMatcher(t, clk, MatcherConfig{MaxDistanceKm: 5})
+	// About 11km north of the pickup
+	repo.CreateOrUpdateDriver(testDriverAt("far", 37.87, -122.42))
+	repo.CreateOrder(testOrderAt("o1", 37.77, -122.42))
+
+	matcher.MatchOrders()
+	if order, _ := repo.GetOrder("o1"); order.Status != models.OrderPending {
+		t.Fatalf("order with only a far driver is %s, want pending", order.Status)
+	}
+
+	// About 3.3km away
+	repo.CreateOrUpdateDriver(testDriverAt("near", 37.80, -122.42))
+	matcher.MatchOrders()
+	if order, _ := repo.GetOrder("o1"); order.Status != models.OrderAssigned || order.DriverID != "near" {
+		t.Errorf("order is %s with %q, want assigned to the driver within range", order.Status, order.DriverID)
+	}
+}
+
+func TestMatcherStatusReportsLastRun(t *testing.T) {
+	clk := clock.NewFake(time.Unix(1700000000, 0))
+	repo, matcher := newTestMatcher(t, clk, MatcherConfig{MaxDistanceKm: 5})
+	status := matcher.Status()
+	if status.LastRun != nil || status.MaxDistanceKm != 5 || status.Mode != MatchNearest || status.Breaker.State != BreakerClosed {
+		t.Fatalf("status before a pass = %+v, want the configuration, a closed breaker and no last run", status)
+	}
+
+	repo.CreateOrUpdateDriver(testDriverAt("d1", 37.77, -122.42))
+	repo.CreateOrder(testOrderAt("o1", 37.77, -122.42))
+	repo.CreateOrder(testOrderAt("o2", 37.77, -122.42))
+	matcher.MatchOrders()
+
+	run := matcher.Status().LastRun
+	if run == nil {
+		t.Fatal("status has no last run after MatchOrders")
+	}
+	want := models.MatcherRun{StartedAt: clk.Now().Unix(), PendingOrders: 2, AvailableDrivers: 1, Assigned: 1}
+	if *run != want {
+		t.Errorf("last run = %+v, want %+v", *run, want)
+	}
+}
+
+func TestFIFOModeServesOrdersInCreationOrder(t *testing.T) {
+	for _, tc := range []struct {
+		mode, want string
+	}{
+		// Nearest mode gives the one driver to the order next to them
+		{MatchNearest, "new"},
+		{MatchFIFO, "old"},
+	} {
+		clk := clock.NewFake(time.Unix(1700000000, 0))
+		repo, matcher := newTestMatcher(t, clk, MatcherConfig{Mode: tc.mode})
+		repo.CreateOrder(testOrderAt("old", 37.80, -122.42))
+		clk.Advance(time.Second)
+		repo.CreateOrder(testOrderAt("new", 37.77, -122.42))
+		clk.Advance(time.Second)
+		repo.CreateOrder(testOrderAt("newest", 37.77, -122.42))
+		repo.CreateOrUpdateDriver(testDriverAt("d1", 37.77, -122.42))
+
+		matcher.MatchOrders()
+		if got := assignmentsOf(repo); got[tc.want] != "d1" || len(got) != 1 {
+			t.Errorf("%s: assignments = %v, want only %s assigned", tc.mode, got, tc.want)
+		}
+
+		// Another driver serves the next order in line
+		if tc.mode == MatchFIFO {
+			repo.CreateOrUpdateDriver(testDriverAt("d2", 37.77, -122.42))
+			matcher.MatchOrders()
+			if got := assignmentsOf(repo); got["new"] != "d2" || got["newest"] != "" {
+				t.Errorf("second pass: assignments = %v, want new assigned before newest", got)
+			}
+		}
+	}
+}
+
+func TestMatcherRequeuesOrdersOfVanishedDrivers(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		vanish func(repo repository.Store)
+	}{
+		// Purging simulated drivers removes them outright, orders and all
+		{"hard deleted", func(repo repository.Store) { repo.PurgeSimulated() }},
+		// A restored snapshot can hold a soft-deleted driver with an order
+		{"soft deleted", func(repo repository.Store) {
+			snapshot := repo.GetSnapshot()
+			snapshot.Drivers["gone"].Deleted = true
+			repo.RestoreSnapshot(snapshot)
+		}},
+	} {
+		clk := clock.NewFake(time.Unix(1700000000, 0))
+		repo, matcher := newTestMatcher(t, clk, MatcherConfig{})
+		gone := testDriverAt("gone", 37.77, -122.42)
+		gone.Simulated = true
+		repo.CreateOrUpdateDriver(gone)
+		repo.CreateOrder(testOrderAt("o1", 37.77, -122.42))
+		matcher.MatchOrders()
+		tc.vanish(repo)
+
+		// The next pass releases the order before matching it again
+		repo.CreateOrUpdateDriver(testDriverAt("d2", 37.78, -122.42))
+		matcher.MatchOrders()
+		if got := assignmentsOf(repo); got["o1"] != "d2" {
+			t.Errorf("%s: assignments = %v, want o1 requeued and given to d2", tc.name, got)
+		}
+		if run := matcher.Status().LastRun; run.Released != 1 {
+			t.Errorf("%s: last run released %d orders, want 1", tc.name, run.Released)
+		}
+	}
+}
+
+func TestWeightedModeFollowsWeights(t *testing.T) {
+	// Two drivers compete for one order: near but poorly rated, or farther
+	// and top rated
+	seedDrivers := func(repo repository.Store, _ *clock.Fake) {
+		repo.CreateOrder(testOrderAt("o1", 37.77, -122.42))
+		near, rated := testDriverAt("near", 37.77, -122.42), testDriverAt("rated", 37.80, -122.42)
+		near.Rating, rated.Rating = 2, 5
+		repo.CreateOrUpdateDriver(near)
+		repo.CreateOrUpdateDriver(rated)
+	}
+	// Two orders compete for one driver: far but waiting, or next to them
+	// and new
+	seedOrders := func(repo repository.Store, clk *clock.Fake) {
+		repo.CreateOrder(testOrderAt("old", 37.80, -122.42))
+		clk.Advance(10 * time.Minute)
+		repo.CreateOrder(testOrderAt("new", 37.77, -122.42))
+		repo.CreateOrUpdateDriver(testDriverAt("d1", 37.77, -122.42))
+	}
+
+	for _, tc := range []struct {
+		name    string
+		seed    func(repo repository.Store, clk *clock.Fake)
+		weights models.ScoreWeights
+		want    map[string]string
+	}{
+		{"distance picks the near driver", seedDrivers, models.ScoreWeights{Distance: 1}, map[string]string{"o1": "near"}},
+		{"rating picks the rated driver", seedDrivers, models.ScoreWeights{Distance: 1, Rating: 3}, map[string]string{"o1": "rated"}},
+		{"distance picks the near order", seedOrders, models.ScoreWeights{Distance: 1}, map[string]string{"new": "d1"}},
+		{"age picks the old order", seedOrders, models.ScoreWeights{Distance: 1, Age: 3}, map[string]string{"old": "d1"}},
+	} {
+		clk := clock.NewFake(time.Unix(1700000000, 0))
+		repo, matcher := newTestMatcher(t, clk, MatcherConfig{Mode: MatchWeighted, Weights: tc.weights})
+		tc.seed(repo, clk)
+
+		matcher.MatchOrders()
+		if got := assignmentsOf(repo); !maps.Equal(got, tc.want) {
+			t.Errorf("%s: assignments = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestMatcherKeepsOrdersInTheirZone(t *testing.T) {
+	zones, err := models.ParseZones("north:37.78,-122.52,37.82,-122.35;south:37.70,-122.52,37.78,-122.35")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, overflow := range []bool{false, true} {
+		clk := clock.NewFake(time.Unix(1700000000, 0))
+		repo, matcher := newTestMatcher(t, clk, MatcherConfig{Zones: zones, ZoneOverflow: overflow})
+		// Each order is nearer the other zone's driver, yet takes its own
+		// zone's: one by where its pickup lies, one pinned to its zone
+		repo.CreateOrUpdateDriver(testDriverAt("south-driver", 37.775, -122.42))
+		repo.CreateOrUpdateDriver(testDriverAt("north-driver", 37.81, -122.42))
+		repo.CreateOrder(testOrderAt("north-order", 37.785, -122.42))
+		pinned := testOrderAt("south-order", 37.80, -122.42)
+		pinned.Zone = "south"
+		repo.CreateOrder(pinned)
+
+		matcher.MatchOrders()
+		want := map[string]string{"north-order": "north-driver", "south-order": "south-driver"}
+		if got := assignmentsOf(repo); !maps.Equal(got, want) {
+			t.Errorf("overflow %v: assignments = %v, want %v", overflow, got, want)
+		}
+
+		// A south order with no south driver left only crosses zones with
+		// overflow allowed
+		repo.CreateOrUpdateDriver(testDriverAt("north-spare", 37.81, -122.42))
+		repo.CreateOrder(testOrderAt("south-late", 37.75, -122.42))
+		matcher.MatchOrders()
+		if got := assignmentsOf(repo)["south-late"]; (got == "north-spare") != overflow {
+			t.Errorf("overflow %v: starved south order went to %q", overflow, got)
+		}
+	}
+}
+
+func TestEquidistantDriversTieBreak(t *testing.T) {
+	for run := range 20 {
+		clk := clock.NewFake(time.Unix(1700000000, 0))
+		repo, matcher := newTestMatcher(t, clk, MatcherConfig{})
+		// East and west of the pickup by the same distance, added in a
+		// different order each run
+		drivers := []*models.Driver{
+			testDriverAt("b", 37.77, -122.41),
+			testDriverAt("a", 37.77, -122.43),
+			testDriverAt("c", 37.77, -122.41),
+		}
+		// a was assigned most recently, so b and c, never assigned, go first
+		drivers[1].LastAssignedAt = clk.Now().Unix() - 60
+		for _, i := range rand.Perm(len(drivers)) {
+			repo.CreateOrUpdateDriver(drivers[i])
+		}
+		repo.CreateOrder(testOrderAt("o1", 37.77, -122.42))
+		repo.CreateOrder(testOrderAt("o2", 37.77, -122.42))
+
+		matcher.MatchOrders()
+		if got, want := assignmentsOf(repo), map[string]string{"o1": "b", "o2": "c"}; !maps.Equal(got, want) {
+			t.Fatalf("run %d: assignments = %v, want %v", run, got, want)
+		}
+	}
+}
+
+func TestWeightedModePrefersDriversHeadingToPickup(t *testing.T) {
+	for _, tc := range []struct {
+		weights models.ScoreWeights
+		want    string
+	}{
+		// Equally far, the tie goes to the lower ID
+		{models.ScoreWeights{Distance: 1}, "a-away"},
+		{models.ScoreWeights{Distance: 1, Heading: 1}, "b-toward"},
+	} {
+		clk := clock.NewFake(time.Unix(1700000000, 0))
+		repo := repository.NewStateManager(repository.Config{Clock: clk, GeoIndexEnabled: true, DriverCapacity: 1, LocationHistorySize: 10})
+		matcher := NewMatcher(repo, clk, NewAssignmentMetrics(clk), NewCircuitBreaker(clk, 5, 30*time.Second), MatcherConfig{
+			Workers: 1,
+			Mode:    MatchWeighted,
+			Weights: tc.weights,
+		})
+
+		// Both end up 0.02° from the pickup, one driving north toward it
+		// from the south and one driving north away from it
+		repo.CreateOrUpdateDriver(testDriverAt("b-toward", 37.74, -122.42))
+		repo.PatchDriver("b-toward", models.DriverPatch{Location: &models.Location{Lat: 37.75, Lon: -122.42}})
+		repo.CreateOrUpdateDriver(testDriverAt("a-away", 37.78, -122.42))
+		repo.PatchDriver("a-away", models.DriverPatch{Location: &models.Location{Lat: 37.79, Lon: -122.42}})
+		// Just one location gives no heading, which scores as idle
+		repo.CreateOrUpdateDriver(testDriverAt("c-idle", 37.79, -122.42))
+		repo.CreateOrder(testOrderAt("o1", 37.77, -122.42))
+
+		matcher.MatchOrders()
+		if got := assignmentsOf(repo)["o1"]; got != tc.want {
+			t.Errorf("weights %+v: o1 went to %q, want %q", tc.weights, got, tc.want)
+		}
+	}
+}
+
+func TestSweepOffersReoffersToNextReadyDriver(t *testing.T) {
+	clk := clock.NewFake(time.Unix(1700000000, 0))
+	repo, matcher := newTestMatcher(t, clk, MatcherConfig{OfferDrivers: 1, OfferTTL: 30 * time.Second})
+	for i, id := range []string{"d1", "d2", "d3"} {
+		repo.CreateOrUpdateDriver(testDriverAt(id, 37.77+float64(i)*0.01, -122.42))
+	}
+	repo.CreateOrder(testOrderAt("o1", 37.77, -122.42))
+	if _, err := matcher.OfferOrder("o1"); err != nil {
+		t.Fatalf("OfferOrder: %v", err)
+	}
+
+	// d2, next in line, goes offline while d1 sits on the offer
+	repo.UpdateDriverStatus("d2", models.DriverOffline)
+	clk.Advance(30 * time.Second)
+	matcher.SweepOffers()
+	order, _ := repo.GetOrder("o1")
+	if order.Status != models.OrderOffered || fmt.Sprint(order.OfferedTo) != "[d3]" || order.OfferExpiresAt != clk.Now().Add(30*time.Second).Unix() {
+		t.Errorf("after d1's offer lapsed: %s to %v until %d, want offered to d3 for a fresh 30s", order.Status, order.OfferedTo, order.OfferExpiresAt)
+	}
+	if d1, _ := repo.GetDriver("d1"); d1.OfferLapses != 1 {
+		t.Errorf("d1 has %v lapsed offers, want 1", d1.OfferLapses)
+	}
+
+	// Once the list is exhausted the order is dead-lettered
+	clk.Advance(30 * time.Second)
+	matcher.SweepOffers()
+	if order, _ = repo.GetOrder("o1"); order.Status != models.OrderUnmatchable {
+		t.Errorf("order after every candidate let the offer lapse is %s, want unmatchable", order.Status)
+	}
+}
+
+func TestMatchReportListsEachOrderOutcome(t *testing.T) {
+	clk := clock.NewFake(time.Unix(1700000000, 0))
+	repo, matcher := newTestMatcher(t, clk, MatcherConfig{MaxDistanceKm: 5})
+	repo.CreateOrUpdateDriver(testDriverAt("d1", 37.77, -122.42))
+	repo.CreateOrUpdateDriver(testDriverAt("d2", 37.78, -122.42))
+	// o1 and o2 want the same driver, far is out of everyone's range and
+	// the bundle is more than a driver of capacity 1 can carry
+	repo.CreateOrder(testOrderAt("o1", 37.77, -122.42))
+	repo.CreateOrder(testOrderAt("o2", 37.78, -122.42))
+	repo.CreateOrder(testOrderAt("o3", 37.78, -122.42))
+	repo.CreateOrder(testOrderAt("far", 38.5, -122.42))
+	repo.CreateOrder(testOrderAt("b1", 37.77, -122.42))
+	repo.CreateOrder(testOrderAt("b2", 37.77, -122.42))
+	if err := repo.BundleOrders("bundle", []string{"b1", "b2"}); err != nil {
+		t.Fatalf("BundleOrders: %v", err)
+	}
+
+	report := matcher.MatchOrders()
+	want := models.MatchReport{
+		Assigned: []models.MatchOutcome{
+			{OrderID: "o1", DriverID: "d1"},
+			{OrderID: "o2", DriverID: "d2"},
+		},
+		Failed: []models.MatchOutcome{
+			{OrderID: "b1", Reason: "BUNDLE_EXCEEDS_CAPACITY"},
+			{OrderID: "b2", Reason: "BUNDLE_EXCEEDS_CAPACITY"},
+			{OrderID: "far", Reason: "NO_ELIGIBLE_DRIVER"},
+			{OrderID: "o3", Reason: "NO_ELIGIBLE_DRIVER"},
+		},
+	}
+	if !reflect.DeepEqual(report, want) {
+		t.Errorf("report = %+v, want %+v", report, want)
+	}
+	if got := assignmentsOf(repo); !maps.Equal(got, map[string]string{"o1": "d1", "o2": "d2"}) {
+		t.Errorf("assignments = %v, want the ones reported", got)
+	}
+}
+
+func TestOfferRankingDemotesDriversWhoLetOffersLapse(t *testing.T) {
+	clk := clock.NewFake(time.Unix(1700000000, 0))
+	repo, matcher := newTestMatcher(t, clk, MatcherConfig{OfferDrivers: 1, OfferTTL: 30 * time.Second, OfferLapseHalfLife: time.Hour})
+	for i, id := range []string{"d1", "d2", "d3"} {
+		repo.CreateOrUpdateDriver(testDriverAt(id, 37.77+float64(i)*0.01, -122.42))
+	}
+	offer := func(id string) *models.Order {
+		t.Helper()
+		repo.CreateOrder(testOrderAt(id, 37.77, -122.42))
+		order, err := matcher.OfferOrder(id)
+		if err != nil {
+			t.Fatalf("OfferOrder(%s): %v", id, err)
+		}
+		return order
+	}
+
+	// d1, the nearest, lets the first offer lapse and d2 takes it over
+	offer("o1")
+	clk.Advance(30 * time.Second)
+	matcher.SweepOffers()
+	if err := repo.AcceptOffer("o1", "d2"); err != nil {
+		t.Fatalf("AcceptOffer: %v", err)
+	}
+
+	if order := offer("o2"); fmt.Sprint(order.OfferedTo, order.OfferQueue) != "[d3] [d1]" {
+		t.Errorf("right after the lapse: offered to %v then %v, want d3 ahead of d1", order.OfferedTo, order.OfferQueue)
+	}
+	repo.AcceptOffer("o2", "d3")
+	repo.CreateOrUpdateDriver(testDriverAt("d4", 37.80, -122.42))
+
+	// Two half-lives later the lapse no longer counts a whole offer
+	clk.Advance(2 * time.Hour)
+	if order := offer("o3"); fmt.Sprint(order.OfferedTo, order.OfferQueue) != "[d1] [d4]" {
+		t.Errorf("after the lapse decayed: offered to %v then %v, want d1 back ahead of d4", order.OfferedTo, order.OfferQueue)
+	}
+}
+
+func TestMatcherGivesUpAfterMaxAttempts(t *testing.T) {
+	clk := clock.NewFake(time.Unix(1700000000, 0))
+	repo, matcher := newTestMatcher(t, clk, MatcherConfig{MaxDistanceKm: 5, MaxMatchAttempts: 3})
+	// About 55km from the pickup, well out of range
+	repo.CreateOrUpdateDriver(testDriverAt("far", 38.27, -122.42))
+	repo.CreateOrder(testOrderAt("o1", 37.77, -122.42))
+
+	for pass := 1; pass <= 3; pass++ {
+		matcher.MatchOrders()
+		order, _ := repo.GetOrder("o1")
+		if pass < 3 && (order.Status != models.OrderPending || order.MatchAttempts != pass) {
+			t.Errorf("after pass %d the order is %s with %d attempts, want pending with %d", pass, order.Status, order.MatchAttempts, pass)
+		}
+		if pass == 3 && order.Status != models.OrderUnmatchable {
+			t.Errorf("after pass %d the order is %s, want unmatchable", pass, order.Status)
+		}
+	}
+	if pending := repo.GetPendingOrders(); len(pending) != 0 {
+		t.Errorf("pending orders = %v, want o1 out of the pool", pending)
+	}
+
+	// A driver in range arriving later no longer gets it
+	repo.CreateOrUpdateDriver(testDriverAt("near", 37.77, -122.42))
+	matcher.MatchOrders()
+	if order, _ := repo.GetOrder("o1"); order.Status != models.OrderUnmatchable || order.DriverID != "" {
+		t.Errorf("unmatchable order went to %q as %s, want it left alone", order.DriverID, order.Status)
+	}
+}
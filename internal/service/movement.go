@@ -0,0 +1,211 @@
+package service
+
+import (
+	"context"
+	"delivery-state-manager/internal/models"
+	"delivery-state-manager/pkg/clock"
+	"delivery-state-manager/pkg/logger"
+	"log"
+	"sync"
+	"time"
+)
+
+// MovementRepository defines the store operations the movement simulator uses
+type MovementRepository interface {
+	GetDriver(id string) (*models.Driver, error)
+	GetOrdersByStatus(status models.OrderStatus) []*models.Order
+	GetOrdersByDriver(driverID string) []*models.Order
+	PatchDriver(id string, patch models.DriverPatch) (*models.Driver, error)
+	UpdateOrderStatus(id string, status models.OrderStatus) error
+	CompareAndSetDriverStatus(id string, expected, status models.DriverStatus) error
+}
+
+// MovementSimulator moves simulated drivers along their orders' routes for
+// demos and load tests. Every tick each simulated driver with a simulated
+// order advances toward its pickup, or its dropoff once picked up, and the
+// order is marked picked up or delivered on arrival. Real drivers and orders
+// are never touched.
+type MovementSimulator struct {
+	repo  MovementRepository
+	clock clock.Clock
+	tick  time.Duration
+
+	// mu guards the fields of the current run
+	mu        sync.Mutex
+	cancel    context.CancelFunc
+	done      chan struct{}
+	speedKmh  float64
+	startedAt time.Time
+}
+
+// NewMovementSimulator creates a stopped MovementSimulator that moves
+// drivers once every tick
+func NewMovementSimulator(repo MovementRepository, clk clock.Clock, tick time.Duration) *MovementSimulator {
+	return &MovementSimulator{
+		repo:  repo,
+		clock: clk,
+		tick:  tick,
+	}
+}
+
+// Start moves simulated drivers at speedKmh in the background until Stop is
+// called. A run already in progress is stopped first.
+func (s *MovementSimulator) Start(speedKmh float64) models.MovementSimulation {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.stop()
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.done = make(chan struct{})
+	s.speedKmh = speedKmh
+	s.startedAt = s.clock.Now()
+	go s.run(ctx, speedKmh, s.done)
+
+	log.Printf("Movement simulation started at %.1f km/h", speedKmh)
+	return s.status()
+}
+
+// Stop halts the simulation and waits for the step in progress, if any, to
+// finish, so no driver moves once it returns
+func (s *MovementSimulator) Stop() models.MovementSimulation {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cancel != nil {
+		s.stop()
+		log.Printf("Movement simulation stopped")
+	}
+	return s.status()
+}
+
+// Status reports whether the simulation is running and at what speed
+func (s *MovementSimulator) Status() models.MovementSimulation {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.status()
+}
+
+// stop ends the current run, if any. The caller must hold mu.
+func (s *MovementSimulator) stop() {
+	if s.cancel == nil {
+		return
+	}
+	s.cancel()
+	<-s.done
+	s.cancel = nil
+	s.done = nil
+}
+
+// status describes the current run. The caller must hold mu.
+func (s *MovementSimulator) status() models.MovementSimulation {
+	if s.cancel == nil {
+		return models.MovementSimulation{}
+	}
+	return models.MovementSimulation{
+		Running:   true,
+		SpeedKmh:  s.speedKmh,
+		Tick:      s.tick.String(),
+		StartedAt: s.startedAt.Unix(),
+	}
+}
+
+// run steps the simulation every tick until ctx is canceled, then closes done
+func (s *MovementSimulator) run(ctx context.Context, speedKmh float64, done chan struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(s.tick)
+	defer ticker.Stop()
+
+	stepKm := speedKmh * s.tick.Hours()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.step(ctx, stepKm)
+		}
+	}
+}
+
+// step moves every simulated driver up to stepKm along their current order.
+// A driver works on one order at a time: one already picked up first, then
+// the assigned order with the lowest ID.
+func (s *MovementSimulator) step(ctx context.Context, stepKm float64) {
+	current := make(map[string]*models.Order)
+	for _, status := range []models.OrderStatus{models.OrderPickedUp, models.OrderAssigned} {
+		for _, order := range s.repo.GetOrdersByStatus(status) {
+			if order.Simulated && order.DriverID != "" && current[order.DriverID] == nil {
+				current[order.DriverID] = order
+			}
+		}
+	}
+
+	for driverID, order := range current {
+		if ctx.Err() != nil {
+			return
+		}
+		driver, err := s.repo.GetDriver(driverID)
+		if err != nil || !driver.Simulated {
+			continue
+		}
+		s.advance(driver, order, stepKm)
+	}
+}
+
+// advance moves driver up to stepKm toward order's next stop and moves the
+// order on when the driver arrives. A driver left without active orders
+// goes back to available so the matcher can use them again.
+func (s *MovementSimulator) advance(driver *models.Driver, order *models.Order, stepKm float64) {
+	stop, next := order.Pickup, models.OrderPickedUp
+	if order.Status == models.OrderPickedUp {
+		stop, next = order.Dropoff, models.OrderDelivered
+	}
+
+	location, arrived := stepToward(driver.Location, stop, stepKm)
+	if _, err := s.repo.PatchDriver(driver.ID, models.DriverPatch{Location: &location}); err != nil {
+		logger.Debugf("Simulated driver %s not moved: %v", driver.ID, err)
+		return
+	}
+	if !arrived {
+		return
+	}
+
+	// The order may have been canceled or handed off meanwhile
+	if err := s.repo.UpdateOrderStatus(order.ID, next); err != nil {
+		logger.Debugf("Simulated order %s not moved to %s: %v", order.ID, next, err)
+		return
+	}
+	logger.Debugf("Simulated order %s %s by driver %s", order.ID, next, driver.ID)
+
+	if next == models.OrderDelivered && !hasActiveOrder(s.repo.GetOrdersByDriver(driver.ID)) {
+		if err := s.repo.CompareAndSetDriverStatus(driver.ID, models.DriverBusy, models.DriverAvailable); err != nil {
+			logger.Debugf("Simulated driver %s left %s: %v", driver.ID, driver.Status, err)
+		}
+	}
+}
+
+// hasActiveOrder reports whether any of orders is assigned or picked up
+func hasActiveOrder(orders []*models.Order) bool {
+	for _, order := range orders {
+		if order.Status == models.OrderAssigned || order.Status == models.OrderPickedUp {
+			return true
+		}
+	}
+	return false
+}
+
+// stepToward returns the point stepKm from from on the way to to, and
+// whether that reaches to. Coordinates are interpolated linearly, which is
+// close enough over the short legs of a demo.
+func stepToward(from, to models.Location, stepKm float64) (models.Location, bool) {
+	remaining := models.DistanceKm(from, to)
+	if remaining <= stepKm {
+		return to, true
+	}
+	f := stepKm / remaining
+	return models.Location{
+		Lat: from.Lat + (to.Lat-from.Lat)*f,
+		Lon: from.Lon + (to.Lon-from.Lon)*f,
+	}, false
+}
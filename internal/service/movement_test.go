@@ -0,0 +1,88 @@
+package service
+
+import (
+	"context"
+	"delivery-state-manager/internal/models"
+	"delivery-state-manager/internal/repository"
+	"delivery-state-manager/pkg/clock"
+	"testing"
+	"time"
+)
+
+// newMovementFleet stores a simulated and a real driver, each half a
+// kilometer south of the pickup of an order assigned to them. The
+// simulated driver's order is simulated too.
+func newMovementFleet(t *testing.T) repository.Store {
+	t.Helper()
+	repo := repository.NewStateManager(repository.Config{GeoIndexEnabled: true, DriverCapacity: 1})
+	for _, id := range []string{"sim", "real"} {
+		driver := testDriverAt(id, 37.765, -122.42)
+		driver.Simulated = id == "sim"
+		repo.CreateOrUpdateDriver(driver)
+		order := testOrderAt("o-"+id, 37.77, -122.42)
+		order.Simulated = driver.Simulated
+		repo.CreateOrder(order)
+		if err := repo.AssignOrderToDriver(order.ID, id); err != nil {
+			t.Fatalf("AssignOrderToDriver(%s): %v", order.ID, err)
+		}
+	}
+	return repo
+}
+
+func TestMovementSimulatorDeliversSimulatedOrders(t *testing.T) {
+	repo := newMovementFleet(t)
+	sim := NewMovementSimulator(repo, clock.New(), time.Second)
+
+	// 0.56km to the pickup, then 1.11km to the dropoff, 0.4km at a time
+	for i, want := range []models.OrderStatus{
+		models.OrderAssigned,
+		models.OrderPickedUp,
+		models.OrderPickedUp,
+		models.OrderPickedUp,
+		models.OrderDelivered,
+	} {
+		sim.step(context.Background(), 0.4)
+		if order, _ := repo.GetOrder("o-sim"); order.Status != want {
+			t.Fatalf("after step %d the simulated order is %s, want %s", i+1, order.Status, want)
+		}
+	}
+	driver, _ := repo.GetDriver("sim")
+	if driver.Status != models.DriverAvailable || driver.Location != (models.Location{Lat: 37.78, Lon: -122.42}) {
+		t.Errorf("simulated driver is %s at %v, want available at the dropoff", driver.Status, driver.Location)
+	}
+
+	order, _ := repo.GetOrder("o-real")
+	realDriver, _ := repo.GetDriver("real")
+	if order.Status != models.OrderAssigned || realDriver.Location != (models.Location{Lat: 37.765, Lon: -122.42}) {
+		t.Errorf("real order is %s and its driver at %v, want both untouched", order.Status, realDriver.Location)
+	}
+}
+
+func TestMovementSimulatorStops(t *testing.T) {
+	repo := newMovementFleet(t)
+	sim := NewMovementSimulator(repo, clock.New(), time.Millisecond)
+	t.Cleanup(func() { sim.Stop() })
+
+	if status := sim.Start(60); !status.Running || status.SpeedKmh != 60 {
+		t.Fatalf("Start(60) = %+v, want running at 60 km/h", status)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if driver, _ := repo.GetDriver("sim"); driver.Location.Lat != 37.765 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("simulated driver never moved")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if status := sim.Stop(); status.Running {
+		t.Errorf("Stop() = %+v, want stopped", status)
+	}
+	stopped, _ := repo.GetDriver("sim")
+	time.Sleep(20 * time.Millisecond)
+	if driver, _ := repo.GetDriver("sim"); driver.Location != stopped.Location {
+		t.Errorf("driver moved from %v to %v after Stop", stopped.Location, driver.Location)
+	}
+}
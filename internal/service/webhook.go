@@ -0,0 +1,216 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"delivery-state-manager/internal/models"
+	"delivery-state-manager/pkg/ids"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// webhookQueueSize is how many events may wait for delivery before new ones
+// are dropped
+const webhookQueueSize = 1024
+
+// Headers sent with every webhook
+const (
+	// WebhookEventHeader names the event, such as "order.delivered"
+	WebhookEventHeader = "X-Webhook-Event"
+	// WebhookDeliveryHeader is a unique ID per event, repeated on retries so
+	// receivers can drop duplicates
+	WebhookDeliveryHeader = "X-Webhook-Delivery"
+	// WebhookSignatureHeader is "sha256=" followed by the hex HMAC-SHA256 of
+	// the body, keyed with the webhook secret
+	WebhookSignatureHeader = "X-Webhook-Signature"
+)
+
+// WebhookConfig holds the outbound webhook settings
+type WebhookConfig struct {
+	// URL receives a POST for every matching order status change
+	URL string
+	// Secret signs each body; empty sends no signature
+	Secret string
+	// Statuses are the order statuses that trigger a webhook. Empty means
+	// every status change.
+	Statuses []models.OrderStatus
+	// MaxAttempts is how many times an event is sent before it is given up
+	MaxAttempts int
+	// RetryBackoff is the wait before the first retry; it doubles for each
+	// further retry
+	RetryBackoff time.Duration
+	// Timeout bounds each delivery attempt
+	Timeout time.Duration
+	// Encode renders the body sent for an order, in the same shape the API
+	// returns orders in
+	Encode func(order *models.Order) ([]byte, error)
+}
+
+// webhookEvent is one order status change waiting for delivery
+type webhookEvent struct {
+	id    string
+	order *models.Order
+}
+
+// Webhooks posts order status changes to a configured URL. Events are queued
+// and delivered in order by a background worker, so Notify never blocks the
+// mutation that raised them; when the queue is full, new events are dropped
+// and counted.
+type Webhooks struct {
+	cfg    WebhookConfig
+	client *http.Client
+
+	mu      sync.Mutex
+	queue   chan webhookEvent
+	dropped int
+
+	// ctx is canceled by Close so the attempt in flight and pending retries
+	// are abandoned
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewWebhooks creates the webhook dispatcher and starts its worker
+func NewWebhooks(cfg WebhookConfig) *Webhooks {
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &Webhooks{
+		cfg:    cfg,
+		client: &http.Client{Timeout: cfg.Timeout},
+		queue:  make(chan webhookEvent, webhookQueueSize),
+		ctx:    ctx,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// Notify queues a webhook for order if its new status is one of the
+// configured statuses. It never blocks.
+func (w *Webhooks) Notify(order *models.Order) {
+	if len(w.cfg.Statuses) > 0 && !slices.Contains(w.cfg.Statuses, order.Status) {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.queue == nil {
+		return
+	}
+	select {
+	case w.queue <- webhookEvent{id: ids.New(), order: order}:
+	default:
+		w.dropped++
+		if w.dropped == 1 || w.dropped%1000 == 0 {
+			log.Printf("Webhook queue is full, %d events dropped", w.dropped)
+		}
+	}
+}
+
+// Close stops accepting events, cancels the delivery in flight and waits for
+// the worker to finish. Events still queued are dropped.
+func (w *Webhooks) Close() {
+	w.mu.Lock()
+	queue := w.queue
+	w.queue = nil
+	w.mu.Unlock()
+
+	if queue == nil {
+		return
+	}
+	w.cancel()
+	close(queue)
+	<-w.done
+}
+
+// run delivers queued events until the queue is closed, dropping those
+// left once Close has been called
+func (w *Webhooks) run() {
+	defer close(w.done)
+	abandoned := 0
+	for event := range w.queue {
+		if w.ctx.Err() != nil {
+			abandoned++
+			continue
+		}
+		w.deliver(event)
+	}
+	if abandoned > 0 {
+		log.Printf("Dropped %d queued webhooks on shutdown", abandoned)
+	}
+}
+
+// deliver sends event, retrying network errors, 429s and 5xx responses
+// with exponential backoff up to MaxAttempts times
+func (w *Webhooks) deliver(event webhookEvent) {
+	body, err := w.cfg.Encode(event.order)
+	if err != nil {
+		log.Printf("Failed to encode webhook for order %s: %v", event.order.ID, err)
+		return
+	}
+
+	backoff := w.cfg.RetryBackoff
+	for attempt := 1; ; attempt++ {
+		retry, err := w.send(event, body)
+		if err == nil {
+			return
+		}
+		if !retry || attempt >= w.cfg.MaxAttempts || w.ctx.Err() != nil {
+			log.Printf("Giving up on webhook %s for order %s after %d attempts: %v", event.id, event.order.ID, attempt, err)
+			return
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-w.ctx.Done():
+		}
+		backoff *= 2
+	}
+}
+
+// send makes one delivery attempt, reporting whether a failure is worth
+// retrying
+func (w *Webhooks) send(event webhookEvent, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(w.ctx, http.MethodPost, w.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookEventHeader, "order."+string(event.order.Status))
+	req.Header.Set(WebhookDeliveryHeader, event.id)
+	if w.cfg.Secret != "" {
+		req.Header.Set(WebhookSignatureHeader, "sha256="+SignWebhook(w.cfg.Secret, body))
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, fmt.Errorf("receiver answered %d", resp.StatusCode)
+	default:
+		return false, fmt.Errorf("receiver answered %d", resp.StatusCode)
+	}
+}
+
+// SignWebhook returns the hex HMAC-SHA256 of body keyed with secret, as sent
+// in the signature header
+func SignWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"delivery-state-manager/internal/models"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testWebhookEncode stands in for the handler's order encoder
+func testWebhookEncode(order *models.Order) ([]byte, error) {
+	return json.Marshal(map[string]any{"id": order.ID, "status": order.Status})
+}
+
+// receivedWebhook is one request seen by a test receiver
+type receivedWebhook struct {
+	header http.Header
+	body   []byte
+}
+
+func TestWebhookIsSignedAndRetried(t *testing.T) {
+	var mu sync.Mutex
+	var received []receivedWebhook
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		received = append(received, receivedWebhook{header: r.Header.Clone(), body: body})
+		first := len(received) == 1
+		mu.Unlock()
+		if first {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	w := NewWebhooks(WebhookConfig{
+		URL:          server.URL,
+		Secret:       "s3cret",
+		MaxAttempts:  3,
+		RetryBackoff: time.Millisecond,
+		Timeout:      time.Second,
+		Encode:       testWebhookEncode,
+	})
+	w.Notify(&models.Order{ID: "o1", Status: models.OrderDelivered})
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mu.Lock()
+		n := len(received)
+		mu.Unlock()
+		if n >= 2 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	w.Close()
+
+	if len(received) != 2 {
+		t.Fatalf("receiver got %d requests, want a failed attempt and its retry", len(received))
+	}
+	want, _ := testWebhookEncode(&models.Order{ID: "o1", Status: models.OrderDelivered})
+	for i, req := range received {
+		if string(req.body) != string(want) {
+			t.Errorf("request %d body = %s, want the encoded order %s", i, req.body, want)
+		}
+		if sig := req.header.Get(WebhookSignatureHeader); sig != "sha256="+SignWebhook("s3cret", req.body) {
+			t.Errorf("request %d signature = %q does not match its body", i, sig)
+		}
+		if event := req.header.Get(WebhookEventHeader); event != "order.delivered" {
+			t.Errorf("request %d event = %q, want order.delivered", i, event)
+		}
+	}
+	if a, b := received[0].header.Get(WebhookDeliveryHeader), received[1].header.Get(WebhookDeliveryHeader); a == "" || a != b {
+		t.Errorf("delivery IDs %q and %q, want one ID kept across the retry", a, b)
+	}
+}
+
+func TestWebhookCloseCancelsInFlightAttempt(t *testing.T) {
+	arrived, release := make(chan struct{}), make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(arrived)
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	w := NewWebhooks(WebhookConfig{URL: server.URL, MaxAttempts: 1, Timeout: time.Minute, Encode: testWebhookEncode})
+	w.Notify(&models.Order{ID: "o1", Status: models.OrderAssigned})
+	<-arrived
+
+	closed := make(chan struct{})
+	go func() {
+		w.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close waited for the hanging attempt instead of canceling it")
+	}
+}
@@ -0,0 +1,93 @@
+package usecase
+
+import (
+	"delivery-state-manager/internal/models"
+	"math"
+	"sync"
+	"time"
+)
+
+// Supported values for AdmissionConfig.Mode
+const (
+	// AdmissionOff never checks the backlog
+	AdmissionOff = "off"
+	// AdmissionAdvisory reports an overloaded backlog but still creates orders
+	AdmissionAdvisory = "advisory"
+	// AdmissionEnforce rejects new orders while the backlog is overloaded
+	AdmissionEnforce = "enforce"
+)
+
+// AdmissionConfig holds the order admission control settings
+type AdmissionConfig struct {
+	// Mode is AdmissionOff, AdmissionAdvisory or AdmissionEnforce
+	Mode string
+	// MaxBacklogRatio is the number of pending orders per on-shift driver
+	// above which the backlog counts as overloaded
+	MaxBacklogRatio float64
+	// Sustain is how long the ratio must stay above MaxBacklogRatio before
+	// admission control kicks in, so a short burst is not shed
+	Sustain time.Duration
+	// TripTime is the typical time a driver needs per order, used to
+	// estimate how long the backlog takes to clear
+	TripTime time.Duration
+}
+
+// Admission is the outcome of an admission check
+type Admission struct {
+	// Overloaded is set once the backlog has been over the limit for Sustain
+	Overloaded bool
+	// Reject is set when Overloaded and admission control is enforcing
+	Reject bool
+	// BacklogRatio is pending orders per available or busy driver
+	BacklogRatio float64
+	// EstimatedWait is roughly how long the current backlog takes to clear
+	EstimatedWait time.Duration
+}
+
+// admissionControl tracks how long the backlog has been over the limit.
+// The backlog is sampled on each check, so overSince is when the first
+// check that found it over the limit ran.
+type admissionControl struct {
+	cfg AdmissionConfig
+
+	mu        sync.Mutex
+	overSince time.Time
+}
+
+// CheckAdmission measures the backlog from the repository's status counts
+// and reports whether a new order should be warned about or rejected
+func (uc *OrderUseCase) CheckAdmission() Admission {
+	cfg := uc.admission.cfg
+	if cfg.Mode == AdmissionOff || cfg.Mode == "" {
+		return Admission{}
+	}
+
+	pending := uc.repo.CountOrders(models.OrderPending)
+	drivers := uc.repo.CountDrivers(models.DriverAvailable) + uc.repo.CountDrivers(models.DriverBusy)
+
+	var admission Admission
+	switch {
+	case pending == 0:
+	case drivers == 0:
+		admission.BacklogRatio = math.Inf(1)
+	default:
+		admission.BacklogRatio = float64(pending) / float64(drivers)
+	}
+	admission.EstimatedWait = time.Duration(math.Ceil(float64(pending)/float64(max(drivers, 1)))) * cfg.TripTime
+
+	now := uc.clock.Now()
+	a := uc.admission
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if admission.BacklogRatio <= cfg.MaxBacklogRatio {
+		a.overSince = time.Time{}
+		return admission
+	}
+	if a.overSince.IsZero() {
+		a.overSince = now
+	}
+
+	admission.Overloaded = now.Sub(a.overSince) >= cfg.Sustain
+	admission.Reject = admission.Overloaded && cfg.Mode == AdmissionEnforce
+	return admission
+}
@@ -0,0 +1,57 @@
+package usecase
+
+import (
+	"delivery-state-manager/internal/models"
+	"delivery-state-manager/pkg/clock"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestAdmissionControlFollowsBacklog(t *testing.T) {
+	clk := clock.NewFake(time.Unix(1700000000, 0))
+	repo, uc := newOrderUseCase(t, clk, func(cfg *OrderConfig) {
+		cfg.Admission = AdmissionConfig{Mode: AdmissionEnforce, MaxBacklogRatio: 2, Sustain: time.Minute, TripTime: 15 * time.Minute}
+	})
+	pickup, dropoff := models.Location{Lat: 37.77, Lon: -122.42}, models.Location{Lat: 37.78, Lon: -122.42}
+	repo.CreateOrUpdateDriver(testDriverAt("d1", pickup))
+	for i := range 3 {
+		repo.CreateOrder(testOrderFrom(fmt.Sprintf("o%d", i), pickup, dropoff))
+	}
+
+	// A backlog only counts once it has lasted Sustain
+	if admission := uc.CheckAdmission(); admission.Overloaded || admission.BacklogRatio != 3 {
+		t.Fatalf("fresh backlog: %+v, want a ratio of 3 not yet overloaded", admission)
+	}
+	clk.Advance(time.Minute)
+	want := Admission{Overloaded: true, Reject: true, BacklogRatio: 3, EstimatedWait: 45 * time.Minute}
+	if admission := uc.CheckAdmission(); admission != want {
+		t.Errorf("sustained backlog: %+v, want %+v", admission, want)
+	}
+
+	// A second driver brings the ratio back under the limit
+	repo.CreateOrUpdateDriver(testDriverAt("d2", pickup))
+	if admission := uc.CheckAdmission(); admission.Overloaded || admission.BacklogRatio != 1.5 {
+		t.Errorf("after a driver joined: %+v, want a ratio of 1.5 admitted", admission)
+	}
+
+	// Going over again starts the Sustain wait over
+	repo.UpdateDriverStatus("d2", models.DriverOffline)
+	if admission := uc.CheckAdmission(); admission.Overloaded {
+		t.Errorf("backlog back over the limit: %+v, want Sustain to start over", admission)
+	}
+}
+
+func TestAdmissionControlAdvisory(t *testing.T) {
+	clk := clock.NewFake(time.Unix(1700000000, 0))
+	repo, uc := newOrderUseCase(t, clk, func(cfg *OrderConfig) {
+		cfg.Admission = AdmissionConfig{Mode: AdmissionAdvisory, MaxBacklogRatio: 2, TripTime: 15 * time.Minute}
+	})
+	pickup, dropoff := models.Location{Lat: 37.77, Lon: -122.42}, models.Location{Lat: 37.78, Lon: -122.42}
+	repo.CreateOrder(testOrderFrom("o1", pickup, dropoff))
+
+	// With no drivers at all any backlog is infinitely over the limit
+	if admission := uc.CheckAdmission(); !admission.Overloaded || admission.Reject {
+		t.Errorf("advisory with no drivers: %+v, want overloaded without rejecting", admission)
+	}
+}
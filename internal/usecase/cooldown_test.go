@@ -0,0 +1,44 @@
+package usecase
+
+import (
+	"context"
+	"delivery-state-manager/internal/models"
+	"delivery-state-manager/internal/service"
+	"delivery-state-manager/pkg/clock"
+	"testing"
+	"time"
+)
+
+func TestDeliveredDriverSkippedDuringCooldown(t *testing.T) {
+	clk := clock.NewFake(time.Unix(1700000000, 0))
+	repo, uc := newOrderUseCase(t, clk, func(cfg *OrderConfig) { cfg.DriverCooldown = 5 * time.Minute })
+	matcher := service.NewMatcher(repo, clk, service.NewAssignmentMetrics(clk), service.NewCircuitBreaker(clk, 5, 30*time.Second), service.MatcherConfig{Workers: 1, Mode: service.MatchNearest})
+	pickup, dropoff := models.Location{Lat: 37.77, Lon: -122.42}, models.Location{Lat: 37.78, Lon: -122.42}
+	repo.CreateOrUpdateDriver(testDriverAt("d1", pickup))
+	repo.CreateOrder(testOrderFrom("o1", pickup, dropoff))
+	repo.AssignOrderToDriver("o1", "d1")
+
+	ctx := context.Background()
+	uc.UpdateOrderStatus(ctx, "o1", models.OrderPickedUp)
+	if err := uc.UpdateOrderStatus(ctx, "o1", models.OrderDelivered); err != nil {
+		t.Fatalf("UpdateOrderStatus: %v", err)
+	}
+	driver, _ := repo.GetDriver("d1")
+	if want := clk.Now().Add(5 * time.Minute).Unix(); driver.CooldownUntil != want {
+		t.Fatalf("CooldownUntil = %d, want %d", driver.CooldownUntil, want)
+	}
+	repo.UpdateDriverStatus("d1", models.DriverAvailable)
+	repo.CreateOrder(testOrderFrom("o2", pickup, dropoff))
+
+	clk.Advance(4 * time.Minute)
+	matcher.MatchOrders()
+	if order, _ := repo.GetOrder("o2"); order.Status != models.OrderPending {
+		t.Fatalf("order during the cooldown is %s, want pending", order.Status)
+	}
+
+	clk.Advance(time.Minute)
+	matcher.MatchOrders()
+	if order, _ := repo.GetOrder("o2"); order.Status != models.OrderAssigned || order.DriverID != "d1" {
+		t.Errorf("order after the cooldown is %s with %q, want assigned to d1", order.Status, order.DriverID)
+	}
+}
@@ -0,0 +1,93 @@
+package usecase
+
+import (
+	"context"
+	"delivery-state-manager/internal/models"
+	"delivery-state-manager/pkg/clock"
+	"delivery-state-manager/pkg/errs"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCreateOrderRejectsDropoffAtPickup(t *testing.T) {
+	_, uc := newOrderUseCase(t, clock.NewFake(time.Unix(1700000000, 0)), func(cfg *OrderConfig) {
+		cfg.PickupDropoffEpsilonKm = 0.01
+	})
+	pickup := models.Location{Lat: 37.77, Lon: -122.42}
+
+	for _, tc := range []struct {
+		name    string
+		dropoff models.Location
+		ok      bool
+	}{
+		{"identical", pickup, false},
+		// About 5.5m north, within the 10m epsilon
+		{"within epsilon", models.Location{Lat: 37.77005, Lon: -122.42}, false},
+		// About 110m north
+		{"distinct", models.Location{Lat: 37.771, Lon: -122.42}, true},
+	} {
+		err := uc.CreateOrder(context.Background(), testOrderFrom("o-"+tc.name, pickup, tc.dropoff))
+		var validationErr *errs.ValidationError
+		if tc.ok && err != nil {
+			t.Errorf("%s: CreateOrder: %v", tc.name, err)
+		} else if !tc.ok && (!errors.As(err, &validationErr) || validationErr.Fields["dropoff"] != errs.ErrPickupEqualsDropoff.Error()) {
+			t.Errorf("%s: err = %v, want dropoff rejected", tc.name, err)
+		}
+	}
+}
+
+func TestOrderPriceFollowsDistance(t *testing.T) {
+	_, uc := newOrderUseCase(t, clock.NewFake(time.Unix(1700000000, 0)))
+	pickup := models.Location{Lat: 37.77, Lon: -122.42}
+
+	// About 1.112km north: 2.50 + 1.20 * 1.112
+	order := testOrderFrom("o1", pickup, models.Location{Lat: 37.78, Lon: -122.42})
+	if err := uc.CreateOrder(context.Background(), order); err != nil {
+		t.Fatalf("CreateOrder: %v", err)
+	}
+	stored, _ := uc.GetOrder("o1")
+	if stored.Price != 3.83 {
+		t.Errorf("price = %v, want 3.83", stored.Price)
+	}
+
+	// A new dropoff about 11.12km north re-prices the order
+	patched, err := uc.PatchOrder(context.Background(), "o1", models.OrderPatch{Dropoff: &models.Location{Lat: 37.87, Lon: -122.42}})
+	if err != nil {
+		t.Fatalf("PatchOrder: %v", err)
+	}
+	if patched.Price != 15.84 {
+		t.Errorf("price after a new dropoff = %v, want 15.84", patched.Price)
+	}
+
+	if price := uc.estimatePrice(testOrderFrom("o2", pickup, pickup)); price != 2.5 {
+		t.Errorf("zero-distance price = %v, want the 2.50 base fare", price)
+	}
+}
+
+func TestCreateOrderRejectsBelowMinimumValue(t *testing.T) {
+	repo, uc := newOrderUseCase(t, clock.NewFake(time.Unix(1700000000, 0)), func(cfg *OrderConfig) { cfg.MinOrderValue = 3.83 })
+	pickup := models.Location{Lat: 37.77, Lon: -122.42}
+
+	for _, tc := range []struct {
+		name    string
+		dropoff models.Location
+		ok      bool
+	}{
+		// About 111m north, priced at 2.63
+		{"below", models.Location{Lat: 37.771, Lon: -122.42}, false},
+		// About 1.112km north, priced at exactly 3.83
+		{"at", models.Location{Lat: 37.78, Lon: -122.42}, true},
+		{"above", models.Location{Lat: 37.87, Lon: -122.42}, true},
+	} {
+		err := uc.CreateOrder(context.Background(), testOrderFrom("o-"+tc.name, pickup, tc.dropoff))
+		if tc.ok && err != nil {
+			t.Errorf("%s: CreateOrder: %v", tc.name, err)
+		} else if !tc.ok && !errors.Is(err, errs.ErrOrderBelowMinimum) {
+			t.Errorf("%s: err = %v, want ErrOrderBelowMinimum", tc.name, err)
+		}
+	}
+	if _, err := repo.GetOrder("o-below"); err == nil {
+		t.Error("order below the minimum was stored")
+	}
+}
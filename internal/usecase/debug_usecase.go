@@ -1,23 +1,100 @@
 package usecase
 
 import (
+	"cmp"
+	"context"
 	"delivery-state-manager/internal/models"
+	"delivery-state-manager/pkg/clock"
+	"delivery-state-manager/pkg/errs"
+	"fmt"
+	"time"
 )
 
 // DebugRepository defines the interface for debug operations
 type DebugRepository interface {
 	GetSnapshot() models.StateSnapshot
+	GetVersion() uint64
+	WaitForVersion(ctx context.Context, since uint64) (uint64, bool)
+	LockWaits() []models.LockWaitHistogram
+	Reset() (drivers, orders int)
+	PurgeSimulated() (drivers, orders int)
+	RestoreSnapshot(snapshot models.StateSnapshot) error
+	Seed(drivers []*models.Driver, orders []*models.Order) error
+	WithReadTx(fn func(view models.ReadView) error) error
+}
+
+// AssignmentMetricsSource provides aggregated assignment metrics
+type AssignmentMetricsSource interface {
+	AssignmentDistance() models.AssignmentDistanceStats
+	MatchRate() float64
+}
+
+// BreakerStatusSource provides the matcher's circuit breaker state
+type BreakerStatusSource interface {
+	Status() models.CircuitBreakerStatus
+}
+
+// MatchRunner runs a matcher pass on demand and reports on past passes
+type MatchRunner interface {
+	MatchOrders() models.MatchReport
+	Status() models.MatcherStatus
+	Heartbeat() (time.Time, time.Duration)
+}
+
+// MovementSimulator moves simulated drivers along their orders' routes in
+// the background
+type MovementSimulator interface {
+	Start(speedKmh float64) models.MovementSimulation
+	Stop() models.MovementSimulation
+	Status() models.MovementSimulation
+}
+
+// AuditLog records state-changing requests and returns the latest ones
+type AuditLog interface {
+	Record(event models.AuditEvent)
+	Recent(limit int) []models.AuditEvent
+}
+
+// DebugConfig holds the thresholds used by the debug summary
+type DebugConfig struct {
+	// StuckAssignedThreshold and StuckPickedUpThreshold are how long an order
+	// may stay assigned or picked up before it counts as stuck. Zero disables
+	// the count.
+	StuckAssignedThreshold time.Duration
+	StuckPickedUpThreshold time.Duration
+	// MatcherStallFactor is how many matcher intervals may pass without a
+	// heartbeat before the matcher is reported degraded
+	MatcherStallFactor int
+	// DriverSpeedKmh is the speed simulated drivers move at unless a start
+	// request sets its own
+	DriverSpeedKmh float64
+	// StateMaxWait caps how long a long-polling state request may block
+	StateMaxWait time.Duration
 }
 
 // DebugUseCase handles debug-related use cases
 type DebugUseCase struct {
-	repo DebugRepository
+	repo    DebugRepository
+	clock   clock.Clock
+	metrics AssignmentMetricsSource
+	breaker BreakerStatusSource
+	matcher MatchRunner
+	audit   AuditLog
+	sim     MovementSimulator
+	cfg     DebugConfig
 }
 
 // NewDebugUseCase creates a new DebugUseCase instance
-func NewDebugUseCase(repo DebugRepository) *DebugUseCase {
+func NewDebugUseCase(repo DebugRepository, clk clock.Clock, metrics AssignmentMetricsSource, breaker BreakerStatusSource, matcher MatchRunner, audit AuditLog, sim MovementSimulator, cfg DebugConfig) *DebugUseCase {
 	return &DebugUseCase{
-		repo: repo,
+		repo:    repo,
+		clock:   clk,
+		metrics: metrics,
+		breaker: breaker,
+		matcher: matcher,
+		audit:   audit,
+		sim:     sim,
+		cfg:     cfg,
 	}
 }
 
@@ -25,3 +102,290 @@ func NewDebugUseCase(repo DebugRepository) *DebugUseCase {
 func (uc *DebugUseCase) GetSnapshot() models.StateSnapshot {
 	return uc.repo.GetSnapshot()
 }
+
+// ViewState calls fn with a consistent view of the whole state under the
+// repository read lock, which blocks writes until fn returns
+func (uc *DebugUseCase) ViewState(fn func(view models.ReadView) error) error {
+	return uc.repo.WithReadTx(fn)
+}
+
+// RecordAudit adds a state-changing request to the audit log
+func (uc *DebugUseCase) RecordAudit(event models.AuditEvent) {
+	uc.audit.Record(event)
+}
+
+// GetAuditLog returns up to limit of the most recent audit events, oldest
+// first, or every retained event when limit is zero
+func (uc *DebugUseCase) GetAuditLog(limit int) []models.AuditEvent {
+	return uc.audit.Recent(limit)
+}
+
+// StartMovement starts moving simulated drivers at speedKmh, or at
+// DriverSpeedKmh when it is zero, restarting any simulation in progress
+func (uc *DebugUseCase) StartMovement(ctx context.Context, speedKmh float64) (models.MovementSimulation, error) {
+	v := newFieldValidator()
+	v.check(speedKmh >= 0, "speed_kmh", "must not be negative")
+	if err := v.err(); err != nil {
+		return models.MovementSimulation{}, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return models.MovementSimulation{}, err
+	}
+	if speedKmh == 0 {
+		speedKmh = uc.cfg.DriverSpeedKmh
+	}
+	return uc.sim.Start(speedKmh), nil
+}
+
+// StopMovement stops the movement simulation; no driver moves once it
+// returns
+func (uc *DebugUseCase) StopMovement() models.MovementSimulation {
+	return uc.sim.Stop()
+}
+
+// MovementStatus reports whether the movement simulation is running
+func (uc *DebugUseCase) MovementStatus() models.MovementSimulation {
+	return uc.sim.Status()
+}
+
+// LockWaits returns the store's lock wait histograms, or nil when lock
+// metrics are disabled
+func (uc *DebugUseCase) LockWaits() []models.LockWaitHistogram {
+	return uc.repo.LockWaits()
+}
+
+// GetStateVersion returns the current state version
+func (uc *DebugUseCase) GetStateVersion() uint64 {
+	return uc.repo.GetVersion()
+}
+
+// StateWait returns how long a long poll asking to wait for wait blocks at
+// most
+func (uc *DebugUseCase) StateWait(wait time.Duration) time.Duration {
+	return min(wait, uc.cfg.StateMaxWait)
+}
+
+// WaitForStateVersion blocks until the state version differs from since,
+// for at most wait capped at StateMaxWait. It returns the current version
+// and whether it changed.
+func (uc *DebugUseCase) WaitForStateVersion(ctx context.Context, since uint64, wait time.Duration) (uint64, bool) {
+	ctx, cancel := context.WithTimeout(ctx, uc.StateWait(wait))
+	defer cancel()
+	return uc.repo.WaitForVersion(ctx, since)
+}
+
+// ResetState removes every driver and order
+func (uc *DebugUseCase) ResetState(ctx context.Context) (*models.ResetResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	drivers, orders := uc.repo.Reset()
+	return &models.ResetResult{
+		DriversCleared: drivers,
+		OrdersCleared:  orders,
+		Timestamp:      models.GetCurrentTimestamp(),
+	}, nil
+}
+
+// PurgeSimulated removes every simulated driver and order
+func (uc *DebugUseCase) PurgeSimulated(ctx context.Context) (*models.ResetResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	drivers, orders := uc.repo.PurgeSimulated()
+	return &models.ResetResult{
+		DriversCleared: drivers,
+		OrdersCleared:  orders,
+		Timestamp:      models.GetCurrentTimestamp(),
+	}, nil
+}
+
+// RestoreState replaces all state with snapshot. Every driver and order is
+// validated first, so a single bad entry rejects the whole restore.
+func (uc *DebugUseCase) RestoreState(ctx context.Context, snapshot models.StateSnapshot) (*models.RestoreResult, error) {
+	if err := validateSnapshot(snapshot); err != nil {
+		return nil, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := uc.repo.RestoreSnapshot(snapshot); err != nil {
+		return nil, err
+	}
+	return &models.RestoreResult{
+		DriversRestored: len(snapshot.Drivers),
+		OrdersRestored:  len(snapshot.Orders),
+		Version:         uc.repo.GetVersion(),
+	}, nil
+}
+
+// validateSnapshot checks every driver and order in snapshot, reporting
+// errors under drivers.<key> and orders.<key>
+func validateSnapshot(snapshot models.StateSnapshot) error {
+	v := newFieldValidator()
+	for key, driver := range snapshot.Drivers {
+		prefix := "drivers." + key
+		if driver == nil {
+			v.check(false, prefix, "required")
+			continue
+		}
+		v.check(driver.ID == key, prefix+".id", "must match its key")
+		v.storedDriver(driver, prefix)
+	}
+	for key, order := range snapshot.Orders {
+		prefix := "orders." + key
+		if order == nil {
+			v.check(false, prefix, "required")
+			continue
+		}
+		v.check(order.ID == key, prefix+".id", "must match its key")
+		v.storedOrder(order, prefix)
+		if order.DriverID != "" {
+			_, ok := snapshot.Drivers[order.DriverID]
+			v.check(ok, prefix+".driver_id", errs.ErrDriverNotFound.Error())
+		}
+	}
+	return v.err()
+}
+
+// SeedState adds drivers and orders exactly as given, including their
+// statuses and assignments, for tests and demos. Fields are validated here
+// and the store checks that assignments are consistent.
+func (uc *DebugUseCase) SeedState(ctx context.Context, seed models.SeedRequest) (*models.SeedResult, error) {
+	v := newFieldValidator()
+	for i, driver := range seed.Drivers {
+		prefix := fmt.Sprintf("drivers[%d]", i)
+		if driver == nil {
+			v.check(false, prefix, "required")
+			continue
+		}
+		v.storedDriver(driver, prefix)
+	}
+	for i, order := range seed.Orders {
+		prefix := fmt.Sprintf("orders[%d]", i)
+		if order == nil {
+			v.check(false, prefix, "required")
+			continue
+		}
+		v.storedOrder(order, prefix)
+	}
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := uc.repo.Seed(seed.Drivers, seed.Orders); err != nil {
+		return nil, err
+	}
+	return &models.SeedResult{
+		DriversSeeded: len(seed.Drivers),
+		OrdersSeeded:  len(seed.Orders),
+	}, nil
+}
+
+// RunMatcher runs a matcher pass immediately, waiting for any pass already
+// in progress. An open circuit breaker still skips the pass.
+func (uc *DebugUseCase) RunMatcher(ctx context.Context) (*models.MatchResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	report := uc.matcher.MatchOrders()
+	return &models.MatchResult{
+		Assigned:       len(report.Assigned),
+		AssignedOrders: report.Assigned,
+		FailedOrders:   report.Failed,
+		BreakerState:   uc.breaker.Status().State,
+		Timestamp:      models.GetCurrentTimestamp(),
+	}, nil
+}
+
+// MatcherHealth reports whether the background matcher has ticked within
+// MatcherStallFactor intervals. A matcher that never started is degraded.
+func (uc *DebugUseCase) MatcherHealth() models.MatcherHealth {
+	heartbeat, interval := uc.matcher.Heartbeat()
+	if heartbeat.IsZero() {
+		return models.MatcherHealth{Status: models.HealthDegraded}
+	}
+
+	staleAfter := interval * time.Duration(uc.cfg.MatcherStallFactor)
+	health := models.MatcherHealth{
+		Status:        models.HealthOK,
+		LastHeartbeat: heartbeat.Unix(),
+		Interval:      interval.String(),
+		StaleAfter:    staleAfter.String(),
+	}
+	if uc.clock.Now().Sub(heartbeat) > staleAfter {
+		health.Status = models.HealthDegraded
+	}
+	return health
+}
+
+// GetMatcherStatus returns the matcher's configuration and last pass
+func (uc *DebugUseCase) GetMatcherStatus() models.MatcherStatus {
+	return uc.matcher.Status()
+}
+
+// GetSummary returns status counts, stuck orders, assignment metrics and
+// matcher health. With realOnly, simulated drivers and orders are left out
+// of the counts; assignment metrics never include them.
+func (uc *DebugUseCase) GetSummary(realOnly bool) models.DebugSummary {
+	summary := models.DebugSummary{
+		DriversByStatus:    make(map[models.DriverStatus]int),
+		OrdersByStatus:     make(map[models.OrderStatus]int),
+		AssignmentDistance: uc.metrics.AssignmentDistance(),
+		MatchRatePerMinute: uc.metrics.MatchRate(),
+		MatcherBreaker:     uc.breaker.Status(),
+		Timestamp:          models.GetCurrentTimestamp(),
+	}
+
+	// Count drivers and orders in one transaction so the totals agree
+	// without copying the whole state
+	now := uc.clock.Now().Unix()
+	uc.repo.WithReadTx(func(view models.ReadView) error {
+		view.EachDriver(func(driver *models.Driver) {
+			if driver.Deleted || (realOnly && driver.Simulated) {
+				return
+			}
+			summary.DriversByStatus[driver.Status]++
+		})
+		view.EachOrder(func(order *models.Order) {
+			if realOnly && order.Simulated {
+				return
+			}
+			summary.OrdersByStatus[order.Status]++
+
+			switch order.Status {
+			case models.OrderAssigned:
+				if isStuck(order, uc.cfg.StuckAssignedThreshold, now) {
+					summary.StuckOrders.Assigned++
+				}
+			case models.OrderPickedUp:
+				if isStuck(order, uc.cfg.StuckPickedUpThreshold, now) {
+					summary.StuckOrders.PickedUp++
+				}
+			}
+		})
+		return nil
+	})
+	return summary
+}
+
+// isStuck reports whether order has held its status for longer than
+// threshold. Orders saved before StatusChangedAt existed fall back to
+// UpdatedAt.
+func isStuck(order *models.Order, threshold time.Duration, now int64) bool {
+	if threshold <= 0 {
+		return false
+	}
+	since := cmp.Or(order.StatusChangedAt, order.UpdatedAt)
+	return now-since > int64(threshold/time.Second)
+}
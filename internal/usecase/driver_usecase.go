@@ -1,62 +1,348 @@
 package usecase
 
 import (
+	"context"
 	"delivery-state-manager/internal/models"
+	"delivery-state-manager/pkg/clock"
 	"delivery-state-manager/pkg/errs"
+	"delivery-state-manager/pkg/ids"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+)
+
+// Supported values for DriverConfig.DuplicateLocations
+const (
+	// DuplicateLocationsOff accepts any location
+	DuplicateLocationsOff = "off"
+	// DuplicateLocationsWarn logs a driver placed on top of another active
+	// driver but still accepts the update
+	DuplicateLocationsWarn = "warn"
+	// DuplicateLocationsReject rejects such an update
+	DuplicateLocationsReject = "reject"
 )
 
 // DriverRepository defines the interface for driver operations
 type DriverRepository interface {
-	CreateOrUpdateDriver(driver *models.Driver)
+	CreateOrUpdateDriver(driver *models.Driver) error
 	GetDriver(id string) (*models.Driver, error)
 	GetAllDrivers() []*models.Driver
 	UpdateDriverStatus(id string, status models.DriverStatus) error
+	PatchDriver(id string, patch models.DriverPatch) (*models.Driver, error)
+	ListDriversAfter(afterID string, limit int) []*models.Driver
+	CompareAndSetDriverStatus(id string, expected, status models.DriverStatus) error
+	SetDriverAvailability(id string, status models.DriverStatus) ([]string, error)
+	DeleteDriver(id string) ([]string, error)
+	GetOrdersByDriver(driverID string) []*models.Order
+	GetNearbyDrivers(center models.Location, radiusKm float64) []*models.Driver
+	GetAvailableDrivers() []*models.Driver
+	WithReadTx(fn func(view models.ReadView) error) error
+}
+
+// DriverConfig holds the limits for driver use cases
+type DriverConfig struct {
+	// MaxIDLength and MaxNameLength cap IDs and names in characters.
+	// Zero means unlimited.
+	MaxIDLength   int
+	MaxNameLength int
+	// GenerateIDs gives drivers created without an ID a random UUID
+	GenerateIDs bool
+	// DuplicateLocations is DuplicateLocationsOff, DuplicateLocationsWarn or
+	// DuplicateLocationsReject. It decides what happens when an update puts
+	// an active driver within DuplicateLocationEpsilonKm of another active
+	// driver, which usually means a stuck or spoofed GPS.
+	DuplicateLocations         string
+	DuplicateLocationEpsilonKm float64
+	// MaxBatchIDs caps the IDs of one batch fetch. Zero means unlimited.
+	MaxBatchIDs int
+	// OfferLapseHalfLife decays the lapsed offer count in driver stats
+	OfferLapseHalfLife time.Duration
 }
 
 // DriverUseCase handles driver-related use cases
 type DriverUseCase struct {
-	repo DriverRepository
+	repo  DriverRepository
+	clock clock.Clock
+	cfg   DriverConfig
 }
 
 // NewDriverUseCase creates a new DriverUseCase instance
-func NewDriverUseCase(repo DriverRepository) *DriverUseCase {
+func NewDriverUseCase(repo DriverRepository, clk clock.Clock, cfg DriverConfig) *DriverUseCase {
 	return &DriverUseCase{
-		repo: repo,
+		repo:  repo,
+		clock: clk,
+		cfg:   cfg,
 	}
 }
 
-// CreateOrUpdateDriver creates or updates a driver
-func (uc *DriverUseCase) CreateOrUpdateDriver(driver *models.Driver) error {
-	// Validate required fields
-	if driver.ID == "" || driver.Name == "" {
-		return errs.ErrMissingRequiredField
+// CreateOrUpdateDriver creates or updates a driver. Surrounding whitespace
+// is trimmed from its ID, name and zone, and a missing ID is generated when
+// GenerateIDs is set.
+func (uc *DriverUseCase) CreateOrUpdateDriver(ctx context.Context, driver *models.Driver) error {
+	driver.ID = strings.TrimSpace(driver.ID)
+	driver.Name = strings.TrimSpace(driver.Name)
+	driver.Zone = strings.TrimSpace(driver.Zone)
+	if driver.ID == "" && uc.cfg.GenerateIDs {
+		driver.ID = ids.New()
 	}
 
-	// Validate status if provided
-	if driver.Status != "" && !models.IsValidDriverStatus(driver.Status) {
-		return errs.ErrInvalidStatusUpdate
+	v := newFieldValidator()
+	v.schema(driver, "")
+	v.text(driver.ID, "id", uc.cfg.MaxIDLength)
+	v.text(driver.Name, "name", uc.cfg.MaxNameLength)
+	v.text(driver.Zone, "zone", uc.cfg.MaxIDLength)
+	v.check(driver.Status == "" || models.IsValidDriverStatus(driver.Status), "status", errs.ErrInvalidStatusUpdate.Error())
+	if err := v.err(); err != nil {
+		return err
 	}
 
 	// Set default status if not provided
 	if driver.Status == "" {
 		driver.Status = models.DriverAvailable
 	}
+	if driver.Status != models.DriverOffline {
+		if err := uc.checkDuplicateLocation(driver.ID, driver.Location); err != nil {
+			return err
+		}
+	}
+
+	// Don't mutate state for a request that has already been abandoned
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return uc.repo.CreateOrUpdateDriver(driver)
+}
+
+// PatchDriver updates only the fields present in patch
+func (uc *DriverUseCase) PatchDriver(ctx context.Context, id string, patch models.DriverPatch) (*models.Driver, error) {
+	v := newFieldValidator()
+	if patch.Name != nil {
+		name := strings.TrimSpace(*patch.Name)
+		patch.Name = &name
+		v.required(name, "name")
+		v.text(name, "name", uc.cfg.MaxNameLength)
+	}
+	if patch.Status != nil {
+		v.check(models.IsValidDriverStatus(*patch.Status), "status", errs.ErrInvalidStatusUpdate.Error())
+	}
+	if patch.Location != nil {
+		v.location(*patch.Location, "location")
+	}
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+
+	if patch.Location != nil && (patch.Status == nil || *patch.Status != models.DriverOffline) {
+		if err := uc.checkDuplicateLocation(id, *patch.Location); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return uc.repo.PatchDriver(id, patch)
+}
 
-	uc.repo.CreateOrUpdateDriver(driver)
+// checkDuplicateLocation looks for another active driver within the
+// duplicate location epsilon of location. A collision is logged, and with
+// DuplicateLocationsReject it is returned as ErrDuplicateLocation.
+func (uc *DriverUseCase) checkDuplicateLocation(id string, location models.Location) error {
+	if uc.cfg.DuplicateLocations != DuplicateLocationsWarn && uc.cfg.DuplicateLocations != DuplicateLocationsReject {
+		return nil
+	}
+
+	for _, other := range uc.repo.GetNearbyDrivers(location, uc.cfg.DuplicateLocationEpsilonKm) {
+		if other.ID == id || other.Status == models.DriverOffline {
+			continue
+		}
+		log.Printf("Driver %s reports the same location as driver %s (%.6f, %.6f)", id, other.ID, location.Lat, location.Lon)
+		if uc.cfg.DuplicateLocations == DuplicateLocationsReject {
+			return errs.ErrDuplicateLocation
+		}
+		return nil
+	}
 	return nil
 }
 
-// GetDriver retrieves a driver by ID
-func (uc *DriverUseCase) GetDriver(id string) (*models.Driver, error) {
-	return uc.repo.GetDriver(id)
+// GetDriver retrieves a driver by ID. Deleted drivers are reported as not
+// found unless includeDeleted is set.
+func (uc *DriverUseCase) GetDriver(id string, includeDeleted bool) (*models.Driver, error) {
+	driver, err := uc.repo.GetDriver(id)
+	if err != nil {
+		return nil, err
+	}
+	if driver.Deleted && !includeDeleted {
+		return nil, errs.ErrDriverNotFound
+	}
+	return driver, nil
 }
 
-// GetAllDrivers returns all drivers
-func (uc *DriverUseCase) GetAllDrivers() []*models.Driver {
-	return uc.repo.GetAllDrivers()
+// GetAllDrivers returns all drivers sorted by the given field
+func (uc *DriverUseCase) GetAllDrivers(sortBy string) ([]*models.Driver, error) {
+	drivers := uc.repo.GetAllDrivers()
+	if err := sortDrivers(drivers, sortBy); err != nil {
+		return nil, err
+	}
+	return drivers, nil
+}
+
+// GetDriversByIDs looks up each of ids, in order, reporting the ones that
+// do not exist, or are deleted unless includeDeleted is set, as not found.
+// All are read in one transaction so they reflect the same state.
+func (uc *DriverUseCase) GetDriversByIDs(ids []string, includeDeleted bool) ([]models.DriverLookup, error) {
+	v := newFieldValidator()
+	v.check(len(ids) > 0, "ids", "required")
+	v.check(uc.cfg.MaxBatchIDs <= 0 || len(ids) <= uc.cfg.MaxBatchIDs, "ids", fmt.Sprintf("at most %d IDs allowed", uc.cfg.MaxBatchIDs))
+	for i, id := range ids {
+		v.required(id, fmt.Sprintf("ids[%d]", i))
+	}
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+
+	lookups := make([]models.DriverLookup, len(ids))
+	uc.repo.WithReadTx(func(view models.ReadView) error {
+		for i, id := range ids {
+			lookups[i].ID = id
+			driver, err := view.Driver(id)
+			if err != nil || (driver.Deleted && !includeDeleted) {
+				continue
+			}
+			lookups[i].Found = true
+			lookups[i].Driver = driver
+		}
+		return nil
+	})
+	return lookups, nil
+}
+
+// ListDrivers returns the page of drivers that follows the cursor.
+// NextCursor is empty once the last page has been reached.
+func (uc *DriverUseCase) ListDrivers(cursor string, limit int) models.DriverPage {
+	// Fetch one extra driver to learn whether another page exists
+	drivers := uc.repo.ListDriversAfter(cursor, limit+1)
+
+	page := models.DriverPage{Drivers: drivers}
+	if len(drivers) > limit {
+		page.Drivers = drivers[:limit]
+		page.NextCursor = page.Drivers[limit-1].ID
+	}
+	return page
+}
+
+// GetNearbyDrivers returns drivers within radiusKm of center, nearest first.
+// A non-empty status keeps only drivers with that status.
+func (uc *DriverUseCase) GetNearbyDrivers(center models.Location, radiusKm float64, status models.DriverStatus) ([]*models.Driver, error) {
+	v := newFieldValidator()
+	v.location(center, "center")
+	v.check(radiusKm > 0, "radius_km", "must be positive")
+	v.check(status == "" || models.IsValidDriverStatus(status), "status", errs.ErrInvalidStatusUpdate.Error())
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+
+	drivers := uc.repo.GetNearbyDrivers(center, radiusKm)
+	if status == "" {
+		return drivers, nil
+	}
+
+	filtered := make([]*models.Driver, 0, len(drivers))
+	for _, driver := range drivers {
+		if driver.Status == status {
+			filtered = append(filtered, driver)
+		}
+	}
+	return filtered, nil
+}
+
+// GetAvailableDrivers returns the available drivers sorted by ID
+func (uc *DriverUseCase) GetAvailableDrivers() []*models.Driver {
+	return uc.repo.GetAvailableDrivers()
 }
 
 // UpdateDriverStatus updates the status of a driver
-func (uc *DriverUseCase) UpdateDriverStatus(id string, status models.DriverStatus) error {
+func (uc *DriverUseCase) UpdateDriverStatus(ctx context.Context, id string, status models.DriverStatus) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	return uc.repo.UpdateDriverStatus(id, status)
 }
+
+// CompareAndSetDriverStatus updates the status of a driver only if it is
+// currently expected, so concurrent dispatchers cannot overwrite each other
+func (uc *DriverUseCase) CompareAndSetDriverStatus(ctx context.Context, id string, expected, status models.DriverStatus) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return uc.repo.CompareAndSetDriverStatus(id, expected, status)
+}
+
+// GoAvailable marks a driver available, returning the blocking order IDs
+// with ErrDriverHasActiveOrder if the driver is still mid-delivery
+func (uc *DriverUseCase) GoAvailable(ctx context.Context, id string) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return uc.repo.SetDriverAvailability(id, models.DriverAvailable)
+}
+
+// GoOffline marks a driver offline, returning the blocking order IDs
+// with ErrDriverHasActiveOrder if the driver is still mid-delivery
+func (uc *DriverUseCase) GoOffline(ctx context.Context, id string) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return uc.repo.SetDriverAvailability(id, models.DriverOffline)
+}
+
+// DeleteDriver soft-deletes a driver, returning the blocking order IDs with
+// ErrDriverHasActiveOrder if the driver is still mid-delivery
+func (uc *DriverUseCase) DeleteDriver(ctx context.Context, id string) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return uc.repo.DeleteDriver(id)
+}
+
+// GetDriverTrack returns a driver's recent location updates, oldest first
+func (uc *DriverUseCase) GetDriverTrack(id string) (*models.DriverTrack, error) {
+	driver, err := uc.repo.GetDriver(id)
+	if err != nil {
+		return nil, err
+	}
+
+	track := &models.DriverTrack{
+		DriverID:  driver.ID,
+		Locations: driver.LocationHistory,
+	}
+	if track.Locations == nil {
+		track.Locations = []models.TimestampedLocation{}
+	}
+	return track, nil
+}
+
+// GetDriverStats aggregates the deliveries, post-assignment cancellations and
+// assigned distance of a driver's orders
+func (uc *DriverUseCase) GetDriverStats(id string) (*models.DriverStats, error) {
+	driver, err := uc.repo.GetDriver(id)
+	if err != nil {
+		return nil, err
+	}
+
+	lapses := driver.DecayedOfferLapses(uc.clock.Now().Unix(), uc.cfg.OfferLapseHalfLife)
+	stats := &models.DriverStats{DriverID: id, OfferLapses: math.Round(lapses*100) / 100}
+	for _, order := range uc.repo.GetOrdersByDriver(id) {
+		switch order.Status {
+		case models.OrderDelivered:
+			stats.DeliveriesCompleted++
+		case models.OrderCanceled:
+			stats.CanceledAfterAssignment++
+		}
+		stats.TotalAssignedDistanceKm += order.AssignmentDistanceKm
+	}
+	return stats, nil
+}
@@ -0,0 +1,114 @@
+package usecase
+
+import (
+	"bytes"
+	"context"
+	"delivery-state-manager/internal/models"
+	"delivery-state-manager/internal/repository"
+	"delivery-state-manager/pkg/clock"
+	"delivery-state-manager/pkg/errs"
+	"log"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newDriverUseCase wires a DriverUseCase with mode for duplicate locations
+// to a fresh store holding an available driver d1 and an offline driver d2,
+// both at the same spot
+func newDriverUseCase(t *testing.T, mode string) (repository.Store, *DriverUseCase) {
+	t.Helper()
+	repo := repository.NewStateManager(repository.Config{GeoIndexEnabled: true})
+	uc := NewDriverUseCase(repo, clock.New(), DriverConfig{DuplicateLocations: mode, DuplicateLocationEpsilonKm: 0.001})
+	repo.CreateOrUpdateDriver(testDriverAt("d1", models.Location{Lat: 37.77, Lon: -122.42}))
+	offline := testDriverAt("d2", models.Location{Lat: 37.77, Lon: -122.42})
+	offline.Status = models.DriverOffline
+	repo.CreateOrUpdateDriver(offline)
+	return repo, uc
+}
+
+// captureLog collects what the standard logger prints until the test ends
+func captureLog(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	previous := log.Writer()
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(previous) })
+	return &buf
+}
+
+func TestDuplicateLocationReject(t *testing.T) {
+	repo, uc := newDriverUseCase(t, DuplicateLocationsReject)
+	ctx := context.Background()
+	spot := models.Location{Lat: 37.77, Lon: -122.42}
+	// Half a meter away is still the same spot
+	nearlySpot := models.Location{Lat: 37.770004, Lon: -122.42}
+
+	if err := uc.CreateOrUpdateDriver(ctx, testDriverAt("d3", nearlySpot)); err != errs.ErrDuplicateLocation {
+		t.Errorf("new driver on top of d1: err = %v, want %v", err, errs.ErrDuplicateLocation)
+	}
+	if _, err := repo.GetDriver("d3"); err != errs.ErrDriverNotFound {
+		t.Errorf("rejected driver was stored: %v", err)
+	}
+	if _, err := uc.PatchDriver(ctx, "d2", models.DriverPatch{Location: &spot}); err != errs.ErrDuplicateLocation {
+		t.Errorf("moving d2 onto d1: err = %v, want %v", err, errs.ErrDuplicateLocation)
+	}
+
+	// A driver may report their own location again, offline drivers are
+	// ignored, and ten meters away is a different spot
+	if err := uc.CreateOrUpdateDriver(ctx, testDriverAt("d1", spot)); err != nil {
+		t.Errorf("d1 updating in place: %v", err)
+	}
+	offline := testDriverAt("d4", spot)
+	offline.Status = models.DriverOffline
+	if err := uc.CreateOrUpdateDriver(ctx, offline); err != nil {
+		t.Errorf("offline driver on top of d1: %v", err)
+	}
+	if err := uc.CreateOrUpdateDriver(ctx, testDriverAt("d5", models.Location{Lat: 37.7701, Lon: -122.42})); err != nil {
+		t.Errorf("driver ten meters from d1: %v", err)
+	}
+}
+
+func TestDuplicateLocationWarn(t *testing.T) {
+	for _, mode := range []string{DuplicateLocationsWarn, DuplicateLocationsOff} {
+		_, uc := newDriverUseCase(t, mode)
+		logs := captureLog(t)
+
+		if err := uc.CreateOrUpdateDriver(context.Background(), testDriverAt("d3", models.Location{Lat: 37.77, Lon: -122.42})); err != nil {
+			t.Errorf("%s: new driver on top of d1: %v", mode, err)
+		}
+		if warned := strings.Contains(logs.String(), "Driver d3 reports the same location as driver d1"); warned != (mode == DuplicateLocationsWarn) {
+			t.Errorf("%s: logged %q", mode, logs.String())
+		}
+	}
+}
+
+func TestDriverStatsDecayOfferLapses(t *testing.T) {
+	clk := clock.NewFake(time.Unix(1700000000, 0))
+	repo := repository.NewStateManager(repository.Config{Clock: clk, GeoIndexEnabled: true, DriverCapacity: 1, OfferLapseHalfLife: time.Hour})
+	uc := NewDriverUseCase(repo, clk, DriverConfig{OfferLapseHalfLife: time.Hour})
+	spot := models.Location{Lat: 37.77, Lon: -122.42}
+	repo.CreateOrUpdateDriver(testDriverAt("d1", spot))
+
+	// d1 lets two offers lapse
+	for _, id := range []string{"o1", "o2"} {
+		repo.CreateOrder(testOrderFrom(id, spot, models.Location{Lat: 37.78, Lon: -122.42}))
+		if _, err := repo.OfferOrder(id, []string{"d1"}, nil, clk.Now().Add(30*time.Second).Unix()); err != nil {
+			t.Fatalf("OfferOrder(%s): %v", id, err)
+		}
+		clk.Advance(30 * time.Second)
+		repo.ExpireOffers(clk.Now().Unix(), clk.Now().Add(30*time.Second).Unix(), 1)
+	}
+
+	// The first lapse had 30s to decay before the second, and each hour
+	// halves the count
+	for _, want := range []float64{1.99, 1, 0.5} {
+		stats, err := uc.GetDriverStats("d1")
+		if err != nil {
+			t.Fatalf("GetDriverStats: %v", err)
+		}
+		if stats.OfferLapses != want {
+			t.Errorf("offer lapses at %v = %v, want %v", clk.Now().Unix(), stats.OfferLapses, want)
+		}
+		clk.Advance(time.Hour)
+	}
+}
@@ -0,0 +1,82 @@
+package usecase
+
+import (
+	"delivery-state-manager/pkg/clock"
+	"sync"
+	"time"
+)
+
+// idempotencyEntry records the order created for an idempotency key
+type idempotencyEntry struct {
+	orderID     string
+	fingerprint string
+	createdAt   time.Time
+}
+
+// idempotencyStore is a bounded, TTL'd map of idempotency keys to orders
+type idempotencyStore struct {
+	entries map[string]idempotencyEntry
+	clock   clock.Clock
+	ttl     time.Duration
+	maxKeys int
+	mu      sync.Mutex
+}
+
+// newIdempotencyStore creates a new idempotencyStore instance
+func newIdempotencyStore(clk clock.Clock, ttl time.Duration, maxKeys int) *idempotencyStore {
+	return &idempotencyStore{
+		entries: make(map[string]idempotencyEntry),
+		clock:   clk,
+		ttl:     ttl,
+		maxKeys: maxKeys,
+	}
+}
+
+// lookup returns the live entry for a key, dropping it if it has expired.
+// The caller must hold s.mu.
+func (s *idempotencyStore) lookup(key string) (idempotencyEntry, bool) {
+	entry, ok := s.entries[key]
+	if !ok {
+		return idempotencyEntry{}, false
+	}
+	if s.clock.Now().Sub(entry.createdAt) >= s.ttl {
+		delete(s.entries, key)
+		return idempotencyEntry{}, false
+	}
+	return entry, true
+}
+
+// store records a key, evicting expired and then oldest entries when full.
+// The caller must hold s.mu.
+func (s *idempotencyStore) store(key, orderID, fingerprint string) {
+	if s.maxKeys <= 0 {
+		return
+	}
+
+	now := s.clock.Now()
+	if len(s.entries) >= s.maxKeys {
+		for k, entry := range s.entries {
+			if now.Sub(entry.createdAt) >= s.ttl {
+				delete(s.entries, k)
+			}
+		}
+	}
+
+	for len(s.entries) >= s.maxKeys {
+		var oldestKey string
+		var oldest time.Time
+		for k, entry := range s.entries {
+			if oldestKey == "" || entry.createdAt.Before(oldest) {
+				oldestKey = k
+				oldest = entry.createdAt
+			}
+		}
+		delete(s.entries, oldestKey)
+	}
+
+	s.entries[key] = idempotencyEntry{
+		orderID:     orderID,
+		fingerprint: fingerprint,
+		createdAt:   now,
+	}
+}
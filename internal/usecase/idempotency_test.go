@@ -0,0 +1,41 @@
+package usecase
+
+import (
+	"delivery-state-manager/pkg/clock"
+	"testing"
+	"time"
+)
+
+func TestIdempotencyKeysExpire(t *testing.T) {
+	clk := clock.NewFake(time.Unix(1700000000, 0))
+	s := newIdempotencyStore(clk, time.Hour, 10)
+	s.store("k1", "o1", "fp")
+
+	clk.Advance(59 * time.Minute)
+	if entry, ok := s.lookup("k1"); !ok || entry.orderID != "o1" {
+		t.Fatalf("lookup before the TTL = %+v, %v; want o1", entry, ok)
+	}
+	clk.Advance(time.Minute)
+	if _, ok := s.lookup("k1"); ok {
+		t.Error("key still found once its TTL passed")
+	}
+}
+
+func TestIdempotencyStoreEvictsOldestWhenFull(t *testing.T) {
+	clk := clock.NewFake(time.Unix(1700000000, 0))
+	s := newIdempotencyStore(clk, time.Hour, 2)
+	s.store("k1", "o1", "fp")
+	clk.Advance(time.Second)
+	s.store("k2", "o2", "fp")
+	clk.Advance(time.Second)
+	s.store("k3", "o3", "fp")
+
+	if _, ok := s.lookup("k1"); ok {
+		t.Error("oldest key kept past MaxKeys")
+	}
+	for _, key := range []string{"k2", "k3"} {
+		if _, ok := s.lookup(key); !ok {
+			t.Errorf("key %s evicted, want only the oldest gone", key)
+		}
+	}
+}
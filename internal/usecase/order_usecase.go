@@ -1,39 +1,275 @@
 package usecase
 
 import (
+	"context"
 	"delivery-state-manager/internal/models"
+	"delivery-state-manager/pkg/clock"
 	"delivery-state-manager/pkg/errs"
+	"delivery-state-manager/pkg/ids"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
 )
 
 // OrderRepository defines the interface for order operations
 type OrderRepository interface {
-	CreateOrder(order *models.Order)
+	CreateOrder(order *models.Order) error
 	GetOrder(id string) (*models.Order, error)
+	WithReadTx(fn func(view models.ReadView) error) error
 	GetAllOrders() []*models.Order
+	StreamOrders(fn func(order *models.Order) bool)
 	UpdateOrderStatus(id string, status models.OrderStatus) error
+	CancelOrder(id, reason string) error
+	PatchOrder(id string, patch models.OrderPatch, price func(order *models.Order) float64) (*models.Order, error)
+	GetDriver(id string) (*models.Driver, error)
+	GetOrdersByStatus(status models.OrderStatus) []*models.Order
+	RequeueOrder(id string) error
+	SetDriverCooldown(id string, until int64) error
+	AssignOrderToDriver(orderID, driverID string) error
+	AcceptOffer(orderID, driverID string) error
+	HandoffOrder(orderID, driverID string) (string, error)
+	BundleOrders(bundleID string, orderIDs []string) error
+	CountOrders(status models.OrderStatus) int
+	CountDrivers(status models.DriverStatus) int
+}
+
+// NearestAssigner assigns or offers an order to its best drivers on demand
+type NearestAssigner interface {
+	AssignNearest(orderID string) (*models.Driver, error)
+	OfferOrder(orderID string) (*models.Order, error)
+}
+
+// AssignmentRecorder receives the pickup distance of each successful
+// assignment and reports how many assignments are being made per minute
+type AssignmentRecorder interface {
+	RecordAssignment(distanceKm float64)
+	MatchRate() float64
+}
+
+// OrderConfig holds the tunable limits for order use cases
+type OrderConfig struct {
+	MaxNotesLength int
+	// MaxIDLength caps order, customer and driver IDs in characters.
+	// Zero means unlimited.
+	MaxIDLength int
+	// GenerateIDs gives orders created without an ID a random UUID
+	GenerateIDs        bool
+	IdempotencyTTL     time.Duration
+	IdempotencyMaxKeys int
+	DriverSpeedKmh     float64
+	// DriverCooldown is how long a driver rests after a delivery before the
+	// matcher considers them again. Zero disables it.
+	DriverCooldown time.Duration
+	// RequireCustomerToCancel restricts cancellation to the order's customer
+	RequireCustomerToCancel bool
+	// PickupDropoffEpsilonKm is the distance within which a dropoff counts as
+	// the same place as the pickup
+	PickupDropoffEpsilonKm float64
+	// BaseFare and PerKmRate price an order as BaseFare plus PerKmRate for
+	// every kilometer of its route
+	BaseFare  float64
+	PerKmRate float64
+	// MinOrderValue is the lowest price an order may be created with. Zero
+	// accepts any price.
+	MinOrderValue float64
+	// MaxClockSkew is how far in the past a client-supplied time such as
+	// ScheduledFor may be and still be accepted
+	MaxClockSkew time.Duration
+	// CancelReasons is the allow-list of cancel reason codes. Empty accepts
+	// any reason.
+	CancelReasons []string
+	// Zones resolves the zone of orders created without one
+	Zones models.ZoneMap
+	// Admission sheds or flags new orders while pending orders vastly
+	// outnumber drivers
+	Admission AdmissionConfig
 }
 
 // OrderUseCase handles order-related use cases
 type OrderUseCase struct {
-	repo OrderRepository
+	repo        OrderRepository
+	clock       clock.Clock
+	metrics     AssignmentRecorder
+	assigner    NearestAssigner
+	cfg         OrderConfig
+	idempotency *idempotencyStore
+	admission   *admissionControl
 }
 
 // NewOrderUseCase creates a new OrderUseCase instance
-func NewOrderUseCase(repo OrderRepository) *OrderUseCase {
+func NewOrderUseCase(repo OrderRepository, clk clock.Clock, metrics AssignmentRecorder, assigner NearestAssigner, cfg OrderConfig) *OrderUseCase {
 	return &OrderUseCase{
-		repo: repo,
+		repo:        repo,
+		clock:       clk,
+		metrics:     metrics,
+		assigner:    assigner,
+		cfg:         cfg,
+		idempotency: newIdempotencyStore(clk, cfg.IdempotencyTTL, cfg.IdempotencyMaxKeys),
+		admission:   &admissionControl{cfg: cfg.Admission},
 	}
 }
 
-// CreateOrder creates a new order
-func (uc *OrderUseCase) CreateOrder(order *models.Order) error {
-	// Validate required fields
-	if order.ID == "" || order.Customer == "" {
-		return errs.ErrMissingRequiredField
+// CreateOrder creates a new order. Surrounding whitespace is trimmed from
+// its ID, customer and zone, a missing ID is generated when GenerateIDs is
+// set, and a missing zone is resolved from the pickup.
+func (uc *OrderUseCase) CreateOrder(ctx context.Context, order *models.Order) error {
+	order.ID = strings.TrimSpace(order.ID)
+	order.Customer = strings.TrimSpace(order.Customer)
+	order.Zone = strings.TrimSpace(order.Zone)
+	if order.ID == "" && uc.cfg.GenerateIDs {
+		order.ID = ids.New()
 	}
 
-	uc.repo.CreateOrder(order)
-	return nil
+	v := newFieldValidator()
+	v.schema(order, "")
+	v.text(order.ID, "id", uc.cfg.MaxIDLength)
+	v.text(order.Customer, "customer", uc.cfg.MaxIDLength)
+	v.text(order.Zone, "zone", uc.cfg.MaxIDLength)
+	v.check(models.DistanceKm(order.Pickup, order.Dropoff) > uc.cfg.PickupDropoffEpsilonKm, "dropoff", errs.ErrPickupEqualsDropoff.Error())
+	v.tags(order.Tags, "tags")
+	// Notes length is counted in characters, not bytes
+	v.check(utf8.RuneCountInString(order.Notes) <= uc.cfg.MaxNotesLength, "notes", errs.ErrNotesTooLong.Error())
+	// Client clocks may run up to MaxClockSkew behind the server's
+	v.check(order.ScheduledFor == 0 || order.ScheduledFor >= uc.clock.Now().Add(-uc.cfg.MaxClockSkew).Unix(), "scheduled_for", errs.ErrScheduledInPast.Error())
+	if err := v.err(); err != nil {
+		return err
+	}
+
+	// Don't mutate state for a request that has already been abandoned
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if order.Zone == "" {
+		order.Zone = uc.cfg.Zones.Resolve(order.Pickup)
+	}
+	order.Price = uc.estimatePrice(order)
+	if order.Price < uc.cfg.MinOrderValue {
+		return errs.ErrOrderBelowMinimum
+	}
+	return uc.repo.CreateOrder(order)
+}
+
+// CreateOrderIdempotent creates a new order unless the idempotency key has
+// already been used, in which case the original order is returned. Reusing a
+// key with a different payload fails with ErrIdempotencyKeyConflict.
+// The returned bool reports whether a new order was created.
+func (uc *OrderUseCase) CreateOrderIdempotent(ctx context.Context, key string, order *models.Order) (*models.Order, bool, error) {
+	fingerprint, err := json.Marshal(order)
+	if err != nil {
+		return nil, false, err
+	}
+
+	uc.idempotency.mu.Lock()
+	defer uc.idempotency.mu.Unlock()
+
+	if original, ok, err := uc.replay(key, fingerprint); ok || err != nil {
+		return original, false, err
+	}
+
+	if err := uc.CreateOrder(ctx, order); err != nil {
+		return nil, false, err
+	}
+
+	uc.idempotency.store(key, order.ID, string(fingerprint))
+	return order, true, nil
+}
+
+// ReplayIdempotent returns the order already created for the idempotency
+// key, reporting false if the key is unused. Like CreateOrderIdempotent it
+// fails with ErrIdempotencyKeyConflict for a different payload. It lets a
+// retry be answered before checks that only apply to new orders.
+func (uc *OrderUseCase) ReplayIdempotent(key string, order *models.Order) (*models.Order, bool, error) {
+	fingerprint, err := json.Marshal(order)
+	if err != nil {
+		return nil, false, err
+	}
+
+	uc.idempotency.mu.Lock()
+	defer uc.idempotency.mu.Unlock()
+	return uc.replay(key, fingerprint)
+}
+
+// replay looks up the order created for key with the payload fingerprint.
+// The caller must hold uc.idempotency.mu.
+func (uc *OrderUseCase) replay(key string, fingerprint []byte) (*models.Order, bool, error) {
+	entry, ok := uc.idempotency.lookup(key)
+	if !ok {
+		return nil, false, nil
+	}
+	if entry.fingerprint != string(fingerprint) {
+		return nil, false, errs.ErrIdempotencyKeyConflict
+	}
+	original, err := uc.repo.GetOrder(entry.orderID)
+	if err != nil {
+		return nil, false, err
+	}
+	return original, true, nil
+}
+
+// estimatePrice returns the fare for an order's route from pickup through
+// its waypoints to the dropoff, rounded to cents
+func (uc *OrderUseCase) estimatePrice(order *models.Order) float64 {
+	stops := make([]models.Location, 0, len(order.Waypoints)+2)
+	stops = append(stops, order.Pickup)
+	stops = append(stops, order.Waypoints...)
+	stops = append(stops, order.Dropoff)
+
+	price := uc.cfg.BaseFare + uc.cfg.PerKmRate*models.RouteDistanceKm(stops...)
+	return math.Round(price*100) / 100
+}
+
+// PatchOrder changes an order's dropoff and/or notes before pickup. A new
+// dropoff re-prices the order; the ETA follows automatically since it is
+// computed from the stored route.
+func (uc *OrderUseCase) PatchOrder(ctx context.Context, id string, patch models.OrderPatch) (*models.Order, error) {
+	order, err := uc.repo.GetOrder(id)
+	if err != nil {
+		return nil, err
+	}
+
+	pickup, dropoff := order.Pickup, order.Dropoff
+	if patch.Pickup != nil {
+		pickup = *patch.Pickup
+	}
+	if patch.Dropoff != nil {
+		dropoff = *patch.Dropoff
+	}
+
+	v := newFieldValidator()
+	if patch.Pickup != nil {
+		v.location(pickup, "pickup")
+	}
+	if patch.Dropoff != nil {
+		v.location(dropoff, "dropoff")
+	}
+	if patch.Pickup != nil || patch.Dropoff != nil {
+		v.check(models.DistanceKm(pickup, dropoff) > uc.cfg.PickupDropoffEpsilonKm, "dropoff", errs.ErrPickupEqualsDropoff.Error())
+	}
+	if patch.Notes != nil {
+		v.check(utf8.RuneCountInString(*patch.Notes) <= uc.cfg.MaxNotesLength, "notes", errs.ErrNotesTooLong.Error())
+	}
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+
+	// A zone resolved from the old pickup follows the new one; an explicit
+	// zone is kept
+	if patch.Pickup != nil && order.Zone == uc.cfg.Zones.Resolve(order.Pickup) {
+		zone := uc.cfg.Zones.Resolve(pickup)
+		patch.Zone = &zone
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return uc.repo.PatchOrder(id, patch, uc.estimatePrice)
 }
 
 // GetOrder retrieves an order by ID
@@ -41,12 +277,385 @@ func (uc *OrderUseCase) GetOrder(id string) (*models.Order, error) {
 	return uc.repo.GetOrder(id)
 }
 
-// GetAllOrders returns all orders
-func (uc *OrderUseCase) GetAllOrders() []*models.Order {
-	return uc.repo.GetAllOrders()
+// GetOrdersWithin returns the orders whose pickup lies inside bounds, sorted
+// by ID and optionally limited to one status
+func (uc *OrderUseCase) GetOrdersWithin(bounds models.Bounds, status models.OrderStatus) ([]*models.Order, error) {
+	v := newFieldValidator()
+	v.check(bounds.MinLat >= -90 && bounds.MinLat <= 90, "min_lat", "out of range")
+	v.check(bounds.MaxLat >= -90 && bounds.MaxLat <= 90, "max_lat", "out of range")
+	v.check(bounds.MinLon >= -180 && bounds.MinLon <= 180, "min_lon", "out of range")
+	v.check(bounds.MaxLon >= -180 && bounds.MaxLon <= 180, "max_lon", "out of range")
+	v.check(bounds.MinLat <= bounds.MaxLat, "min_lat", "must not exceed max_lat")
+	v.check(status == "" || models.IsValidOrderStatus(status), "status", errs.ErrInvalidStatusUpdate.Error())
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+
+	// A status filter can use the status index instead of scanning everything
+	if status != "" {
+		orders := uc.repo.GetOrdersByStatus(status)
+		within := orders[:0]
+		for _, order := range orders {
+			if order.Pickup.InBounds(bounds) {
+				within = append(within, order)
+			}
+		}
+		return within, nil
+	}
+
+	var within []*models.Order
+	uc.repo.StreamOrders(func(order *models.Order) bool {
+		if order.Pickup.InBounds(bounds) {
+			within = append(within, order.Clone())
+		}
+		return true
+	})
+	sort.Slice(within, func(i, j int) bool {
+		return within[i].ID < within[j].ID
+	})
+	return within, nil
+}
+
+// GetOrderDriver retrieves the driver assigned to an order. Both are read
+// in one transaction so the driver is the one the order points to.
+func (uc *OrderUseCase) GetOrderDriver(orderID string) (*models.Driver, error) {
+	var driver *models.Driver
+	err := uc.repo.WithReadTx(func(view models.ReadView) error {
+		order, err := view.Order(orderID)
+		if err != nil {
+			return err
+		}
+		if order.DriverID == "" {
+			return errs.ErrOrderNotAssigned
+		}
+		driver, err = view.Driver(order.DriverID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return driver, nil
+}
+
+// GetAllOrders returns all orders passing filter, sorted by the given field
+func (uc *OrderUseCase) GetAllOrders(sortBy string, filter models.OrderFilter) ([]*models.Order, error) {
+	v := newFieldValidator()
+	v.check(filter.DeliveredAfter >= 0, "delivered_after", "must not be negative")
+	v.check(filter.DeliveredBefore >= 0, "delivered_before", "must not be negative")
+	v.check(filter.DeliveredBefore == 0 || filter.DeliveredAfter < filter.DeliveredBefore, "delivered_after", "must be before delivered_before")
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+
+	var orders []*models.Order
+	if filter.Delivered() {
+		// A delivery window can use the status index instead of scanning
+		// everything
+		orders = uc.repo.GetOrdersByStatus(models.OrderDelivered)
+	} else {
+		orders = uc.repo.GetAllOrders()
+	}
+
+	matching := orders[:0]
+	for _, order := range orders {
+		if filter.Matches(order) {
+			matching = append(matching, order)
+		}
+	}
+	orders = matching
+
+	if err := sortOrders(orders, sortBy); err != nil {
+		return nil, err
+	}
+	return orders, nil
+}
+
+// ListOrders returns a page of orders passing filter, sorted by the given
+// field
+func (uc *OrderUseCase) ListOrders(offset, limit int, sortBy string, filter models.OrderFilter) (models.OrderPage, error) {
+	orders, err := uc.GetAllOrders(sortBy, filter)
+	if err != nil {
+		return models.OrderPage{}, err
+	}
+
+	page := models.OrderPage{
+		Orders: []*models.Order{},
+		Offset: offset,
+		Total:  len(orders),
+	}
+	if offset < len(orders) {
+		end := min(offset+limit, len(orders))
+		page.Orders = orders[offset:end]
+	}
+	return page, nil
+}
+
+// GetUnmatchableOrders returns the orders that ran out of match attempts
+func (uc *OrderUseCase) GetUnmatchableOrders() []*models.Order {
+	return uc.repo.GetOrdersByStatus(models.OrderUnmatchable)
+}
+
+// RequeueOrder returns an unmatchable order to the pending pool
+func (uc *OrderUseCase) RequeueOrder(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return uc.repo.RequeueOrder(id)
 }
 
 // UpdateOrderStatus updates the status of an order
-func (uc *OrderUseCase) UpdateOrderStatus(id string, status models.OrderStatus) error {
-	return uc.repo.UpdateOrderStatus(id, status)
+func (uc *OrderUseCase) UpdateOrderStatus(ctx context.Context, id string, status models.OrderStatus) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if err := uc.repo.UpdateOrderStatus(id, status); err != nil {
+		return err
+	}
+
+	if status == models.OrderDelivered && uc.cfg.DriverCooldown > 0 {
+		uc.startDriverCooldown(id)
+	}
+	return nil
+}
+
+// CancelOrder cancels an order on behalf of customer, recording an optional
+// reason code. When ownership checks are enabled, a customer other than the
+// order's own gets ErrNotOrderOwner.
+func (uc *OrderUseCase) CancelOrder(ctx context.Context, id, customer, reason string) error {
+	reason = strings.TrimSpace(reason)
+
+	v := newFieldValidator()
+	v.text(reason, "reason", uc.cfg.MaxIDLength)
+	if len(uc.cfg.CancelReasons) > 0 && reason != "" {
+		v.check(slices.Contains(uc.cfg.CancelReasons, reason), "reason", "must be one of "+strings.Join(uc.cfg.CancelReasons, ", "))
+	}
+	if err := v.err(); err != nil {
+		return err
+	}
+
+	if uc.cfg.RequireCustomerToCancel {
+		order, err := uc.repo.GetOrder(id)
+		if err != nil {
+			return err
+		}
+		customer = strings.TrimSpace(customer)
+		if customer == "" || customer != order.Customer {
+			return errs.ErrNotOrderOwner
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return uc.repo.CancelOrder(id, reason)
+}
+
+// AssignOrder manually assigns a pending order to an available driver,
+// bypassing the matcher
+func (uc *OrderUseCase) AssignOrder(ctx context.Context, orderID, driverID string) (*models.Order, error) {
+	driverID = strings.TrimSpace(driverID)
+
+	v := newFieldValidator()
+	v.required(driverID, "driver_id")
+	v.text(driverID, "driver_id", uc.cfg.MaxIDLength)
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := uc.repo.AssignOrderToDriver(orderID, driverID); err != nil {
+		return nil, err
+	}
+
+	order, err := uc.repo.GetOrder(orderID)
+	if err != nil {
+		return nil, err
+	}
+	// Simulated orders and drivers are left out of the metrics
+	if driver, err := uc.repo.GetDriver(driverID); err == nil && !order.Simulated && !driver.Simulated {
+		uc.metrics.RecordAssignment(order.AssignmentDistanceKm)
+	}
+	return order, nil
+}
+
+// AutoAssignOrder assigns a pending order to the nearest eligible driver
+// right away, using the matcher's ranking, and returns the driver
+func (uc *OrderUseCase) AutoAssignOrder(ctx context.Context, orderID string) (*models.Driver, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return uc.assigner.AssignNearest(orderID)
+}
+
+// OfferOrder offers a pending order to the best-ranked ready drivers, using
+// the matcher's ranking, and returns the offered order
+func (uc *OrderUseCase) OfferOrder(ctx context.Context, orderID string) (*models.Order, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return uc.assigner.OfferOrder(orderID)
+}
+
+// AcceptOffer assigns an offered order to driverID if they hold an open
+// offer for it. Only the first accept succeeds.
+func (uc *OrderUseCase) AcceptOffer(ctx context.Context, orderID, driverID string) (*models.Order, error) {
+	driverID = strings.TrimSpace(driverID)
+
+	v := newFieldValidator()
+	v.required(driverID, "driver_id")
+	v.text(driverID, "driver_id", uc.cfg.MaxIDLength)
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := uc.repo.AcceptOffer(orderID, driverID); err != nil {
+		return nil, err
+	}
+
+	order, err := uc.repo.GetOrder(orderID)
+	if err != nil {
+		return nil, err
+	}
+	// Simulated orders and drivers are left out of the metrics
+	if driver, err := uc.repo.GetDriver(driverID); err == nil && !order.Simulated && !driver.Simulated {
+		uc.metrics.RecordAssignment(order.AssignmentDistanceKm)
+	}
+	return order, nil
+}
+
+// BundleOrders groups two or more pending orders into a new bundle that is
+// delivered on one trip by a single driver
+func (uc *OrderUseCase) BundleOrders(ctx context.Context, orderIDs []string) (*models.Bundle, error) {
+	v := newFieldValidator()
+	v.check(len(orderIDs) >= 2, "order_ids", "at least 2 orders required")
+	seen := make(map[string]bool, len(orderIDs))
+	for i, id := range orderIDs {
+		field := fmt.Sprintf("order_ids[%d]", i)
+		v.required(id, field)
+		v.check(!seen[id], field, "duplicate order")
+		seen[id] = true
+	}
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	bundle := &models.Bundle{ID: ids.New(), OrderIDs: orderIDs}
+	if err := uc.repo.BundleOrders(bundle.ID, bundle.OrderIDs); err != nil {
+		return nil, err
+	}
+	return bundle, nil
+}
+
+// HandoffOrder hands a picked-up order over to another available driver,
+// freeing the driver who held it, and returns the updated order
+func (uc *OrderUseCase) HandoffOrder(ctx context.Context, orderID, toDriverID string) (*models.Order, error) {
+	toDriverID = strings.TrimSpace(toDriverID)
+
+	v := newFieldValidator()
+	v.required(toDriverID, "to_driver_id")
+	v.text(toDriverID, "to_driver_id", uc.cfg.MaxIDLength)
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	from, err := uc.repo.HandoffOrder(orderID, toDriverID)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Order %s handed off: driver %s -> %s", orderID, from, toDriverID)
+	return uc.repo.GetOrder(orderID)
+}
+
+// startDriverCooldown puts the driver who delivered an order on cooldown.
+// Failures are logged rather than returned since the delivery has already
+// been recorded.
+func (uc *OrderUseCase) startDriverCooldown(orderID string) {
+	order, err := uc.repo.GetOrder(orderID)
+	if err != nil || order.DriverID == "" {
+		return
+	}
+
+	until := uc.clock.Now().Add(uc.cfg.DriverCooldown).Unix()
+	if err := uc.repo.SetDriverCooldown(order.DriverID, until); err != nil {
+		log.Printf("Failed to start cooldown for driver %s: %v", order.DriverID, err)
+	}
+}
+
+// GetOrderETA recomputes the remaining time for an order from its driver's
+// current location. Assigned orders include the leg to the pickup, and the
+// route passes through every waypoint before the dropoff.
+func (uc *OrderUseCase) GetOrderETA(id string) (*models.ETA, error) {
+	order, err := uc.repo.GetOrder(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if order.Status != models.OrderAssigned && order.Status != models.OrderPickedUp {
+		return nil, errs.ErrOrderNotInTransit
+	}
+
+	driver, err := uc.repo.GetDriver(order.DriverID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Route through every waypoint; progress between waypoints is not
+	// tracked, so picked-up orders still count all of them
+	stops := []models.Location{driver.Location}
+	if order.Status == models.OrderAssigned {
+		stops = append(stops, order.Pickup)
+	}
+	stops = append(stops, order.Waypoints...)
+	stops = append(stops, order.Dropoff)
+	distance := models.RouteDistanceKm(stops...)
+
+	return &models.ETA{
+		OrderID:          order.ID,
+		DriverID:         driver.ID,
+		Status:           order.Status,
+		DistanceKm:       distance,
+		RemainingMinutes: distance / uc.cfg.DriverSpeedKmh * 60,
+		ComputedAt:       uc.clock.Now().Unix(),
+	}, nil
+}
+
+// EstimateWait estimates how long a pending order waits for a driver: the
+// pending backlog divided by the recent match rate. Before any assignments
+// have been made it falls back to the admission estimate of pending orders
+// per driver times the trip time. A scheduled order waits at least until
+// it is due. Orders that are no longer pending report false.
+func (uc *OrderUseCase) EstimateWait(order *models.Order) (time.Duration, bool) {
+	if order.Status != models.OrderPending {
+		return 0, false
+	}
+
+	pending := uc.repo.CountOrders(models.OrderPending)
+	var wait time.Duration
+	if rate := uc.metrics.MatchRate(); rate > 0 {
+		wait = time.Duration(float64(pending) / rate * float64(time.Minute))
+	} else {
+		drivers := uc.repo.CountDrivers(models.DriverAvailable) + uc.repo.CountDrivers(models.DriverBusy)
+		wait = time.Duration(math.Ceil(float64(pending)/float64(max(drivers, 1)))) * uc.cfg.Admission.TripTime
+	}
+
+	if order.ScheduledFor != 0 {
+		wait = max(wait, time.Unix(order.ScheduledFor, 0).Sub(uc.clock.Now()))
+	}
+	return wait, true
 }
@@ -0,0 +1,83 @@
+package usecase
+
+import (
+	"delivery-state-manager/internal/models"
+	"delivery-state-manager/internal/repository"
+	"delivery-state-manager/internal/service"
+	"delivery-state-manager/pkg/clock"
+	"delivery-state-manager/pkg/errs"
+	"math"
+	"testing"
+	"time"
+)
+
+// newOrderUseCase wires an OrderUseCase to a fresh store and matcher reading
+// clk, with main's defaults unless configure changes them
+func newOrderUseCase(t *testing.T, clk clock.Clock, configure ...func(cfg *OrderConfig)) (repository.Store, *OrderUseCase) {
+	t.Helper()
+	cfg := OrderConfig{
+		MaxNotesLength:     500,
+		MaxIDLength:        128,
+		IdempotencyTTL:     24 * time.Hour,
+		IdempotencyMaxKeys: 10000,
+		DriverSpeedKmh:     30,
+		BaseFare:           2.5,
+		PerKmRate:          1.2,
+		Admission:          AdmissionConfig{Mode: AdmissionOff, TripTime: 15 * time.Minute},
+	}
+	for _, fn := range configure {
+		fn(&cfg)
+	}
+	repo := repository.NewStateManager(repository.Config{Clock: clk, GeoIndexEnabled: true, DriverCapacity: 1, LocationHistorySize: 50})
+	metrics := service.NewAssignmentMetrics(clk)
+	matcher := service.NewMatcher(repo, clk, metrics, service.NewCircuitBreaker(clk, 5, 30*time.Second), service.MatcherConfig{
+		Workers:      1,
+		Mode:         service.MatchNearest,
+		OfferDrivers: 3,
+		OfferTTL:     30 * time.Second,
+	})
+	return repo, NewOrderUseCase(repo, clk, metrics, matcher, cfg)
+}
+
+// testDriverAt is an available driver at loc
+func testDriverAt(id string, loc models.Location) *models.Driver {
+	return &models.Driver{ID: id, Name: "Driver " + id, Status: models.DriverAvailable, Location: loc}
+}
+
+// testOrderFrom is an order from pickup to dropoff
+func testOrderFrom(id string, pickup, dropoff models.Location) *models.Order {
+	return &models.Order{ID: id, Customer: "customer-" + id, Pickup: pickup, Dropoff: dropoff}
+}
+
+func TestOrderETAFollowsTheRoute(t *testing.T) {
+	clk := clock.NewFake(time.Unix(1700000000, 0))
+	repo, uc := newOrderUseCase(t, clk)
+	driverAt := models.Location{Lat: 37.75, Lon: -122.42}
+	pickup, dropoff := models.Location{Lat: 37.77, Lon: -122.42}, models.Location{Lat: 37.80, Lon: -122.42}
+	repo.CreateOrUpdateDriver(testDriverAt("d1", driverAt))
+	repo.CreateOrder(testOrderFrom("o1", pickup, dropoff))
+
+	if _, err := uc.GetOrderETA("o1"); err != errs.ErrOrderNotInTransit {
+		t.Fatalf("ETA of a pending order: err = %v, want %v", err, errs.ErrOrderNotInTransit)
+	}
+
+	repo.AssignOrderToDriver("o1", "d1")
+	eta, err := uc.GetOrderETA("o1")
+	if err != nil {
+		t.Fatalf("GetOrderETA: %v", err)
+	}
+	want := models.DistanceKm(driverAt, pickup) + models.DistanceKm(pickup, dropoff)
+	if math.Abs(eta.DistanceKm-want) > 1e-9 || math.Abs(eta.RemainingMinutes-want/30*60) > 1e-9 {
+		t.Errorf("assigned ETA = %.3fkm in %.2fmin, want %.3fkm at 30km/h", eta.DistanceKm, eta.RemainingMinutes, want)
+	}
+	if eta.ComputedAt != clk.Now().Unix() || eta.DriverID != "d1" {
+		t.Errorf("ETA = %+v, want d1 computed now", eta)
+	}
+
+	// Once picked up, the driver is routed straight to the dropoff
+	repo.UpdateOrderStatus("o1", models.OrderPickedUp)
+	eta, _ = uc.GetOrderETA("o1")
+	if want := models.DistanceKm(driverAt, dropoff); math.Abs(eta.DistanceKm-want) > 1e-9 {
+		t.Errorf("picked-up ETA distance = %.3fkm, want %.3fkm", eta.DistanceKm, want)
+	}
+}
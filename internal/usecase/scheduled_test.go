@@ -0,0 +1,59 @@
+package usecase
+
+import (
+	"context"
+	"delivery-state-manager/internal/models"
+	"delivery-state-manager/pkg/clock"
+	"delivery-state-manager/pkg/errs"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCreateOrderRejectsPastSchedule(t *testing.T) {
+	clk := clock.NewFake(time.Unix(1700000000, 0))
+	_, uc := newOrderUseCase(t, clk, func(cfg *OrderConfig) { cfg.MaxClockSkew = time.Minute })
+	pickup, dropoff := models.Location{Lat: 37.77, Lon: -122.42}, models.Location{Lat: 37.78, Lon: -122.42}
+
+	for _, tc := range []struct {
+		name      string
+		scheduled time.Duration
+		ok        bool
+	}{
+		{"an hour ahead", time.Hour, true},
+		{"within the skew", -30 * time.Second, true},
+		{"past the skew", -2 * time.Minute, false},
+	} {
+		order := testOrderFrom("o-"+tc.name, pickup, dropoff)
+		order.ScheduledFor = clk.Now().Add(tc.scheduled).Unix()
+		err := uc.CreateOrder(context.Background(), order)
+		var validationErr *errs.ValidationError
+		switch {
+		case tc.ok && err != nil:
+			t.Errorf("%s: CreateOrder: %v", tc.name, err)
+		case !tc.ok && (!errors.As(err, &validationErr) || validationErr.Fields["scheduled_for"] != errs.ErrScheduledInPast.Error()):
+			t.Errorf("%s: err = %v, want scheduled_for rejected", tc.name, err)
+		}
+	}
+}
+
+func TestReadyOrdersWaitForSchedule(t *testing.T) {
+	clk := clock.NewFake(time.Unix(1700000000, 0))
+	repo, uc := newOrderUseCase(t, clk)
+	pickup, dropoff := models.Location{Lat: 37.77, Lon: -122.42}, models.Location{Lat: 37.78, Lon: -122.42}
+	later := testOrderFrom("later", pickup, dropoff)
+	later.ScheduledFor = clk.Now().Add(time.Hour).Unix()
+	for _, order := range []*models.Order{testOrderFrom("now", pickup, dropoff), later} {
+		if err := uc.CreateOrder(context.Background(), order); err != nil {
+			t.Fatalf("CreateOrder %s: %v", order.ID, err)
+		}
+	}
+
+	if ready := repo.GetReadyOrders(clk.Now().Unix()); len(ready) != 1 || ready[0].ID != "now" {
+		t.Errorf("ready orders before the schedule = %v, want only now", ready)
+	}
+	clk.Advance(time.Hour)
+	if ready := repo.GetReadyOrders(clk.Now().Unix()); len(ready) != 2 {
+		t.Errorf("ready orders at the schedule = %d, want 2", len(ready))
+	}
+}
@@ -0,0 +1,56 @@
+package usecase
+
+import (
+	"delivery-state-manager/internal/models"
+	"delivery-state-manager/pkg/errs"
+	"sort"
+)
+
+// Supported values for the sort query parameter on list endpoints
+const (
+	SortByID        = "id"
+	SortByCreatedAt = "created_at"
+	SortByStatus    = "status"
+)
+
+// sortDrivers sorts drivers in place by the given field, breaking ties by ID.
+// An empty field keeps the repository's ID ordering.
+func sortDrivers(drivers []*models.Driver, field string) error {
+	var less func(a, b *models.Driver) bool
+	switch field {
+	case "", SortByID:
+		return nil
+	case SortByCreatedAt:
+		less = func(a, b *models.Driver) bool { return a.CreatedAt < b.CreatedAt }
+	case SortByStatus:
+		less = func(a, b *models.Driver) bool { return a.Status < b.Status }
+	default:
+		return errs.ErrInvalidSortField
+	}
+
+	sort.SliceStable(drivers, func(i, j int) bool {
+		return less(drivers[i], drivers[j])
+	})
+	return nil
+}
+
+// sortOrders sorts orders in place by the given field, breaking ties by ID.
+// An empty field keeps the repository's ID ordering.
+func sortOrders(orders []*models.Order, field string) error {
+	var less func(a, b *models.Order) bool
+	switch field {
+	case "", SortByID:
+		return nil
+	case SortByCreatedAt:
+		less = func(a, b *models.Order) bool { return a.CreatedAt < b.CreatedAt }
+	case SortByStatus:
+		less = func(a, b *models.Order) bool { return a.Status < b.Status }
+	default:
+		return errs.ErrInvalidSortField
+	}
+
+	sort.SliceStable(orders, func(i, j int) bool {
+		return less(orders[i], orders[j])
+	})
+	return nil
+}
@@ -0,0 +1,68 @@
+package usecase
+
+import (
+	"delivery-state-manager/internal/models"
+	"delivery-state-manager/pkg/clock"
+	"delivery-state-manager/pkg/errs"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// driverIDs lists the IDs of drivers in order
+func driverIDs(drivers []*models.Driver) []string {
+	ids := make([]string, 0, len(drivers))
+	for _, driver := range drivers {
+		ids = append(ids, driver.ID)
+	}
+	return ids
+}
+
+func TestSortDriversBreaksTiesByID(t *testing.T) {
+	// Already in ID order, as the repository returns them
+	drivers := []*models.Driver{
+		{ID: "a", Status: models.DriverBusy, CreatedAt: 30},
+		{ID: "b", Status: models.DriverAvailable, CreatedAt: 10},
+		{ID: "c", Status: models.DriverBusy, CreatedAt: 10},
+		{ID: "d", Status: models.DriverAvailable, CreatedAt: 20},
+	}
+
+	for field, want := range map[string]string{
+		SortByID:        "[a b c d]",
+		SortByCreatedAt: "[b c d a]",
+		SortByStatus:    "[b d a c]",
+	} {
+		sorted := append([]*models.Driver(nil), drivers...)
+		if err := sortDrivers(sorted, field); err != nil {
+			t.Fatalf("sortDrivers(%s): %v", field, err)
+		}
+		if got := fmt.Sprint(driverIDs(sorted)); got != want {
+			t.Errorf("sort=%s: %s, want %s", field, got, want)
+		}
+	}
+	if err := sortDrivers(drivers, "name"); err != errs.ErrInvalidSortField {
+		t.Errorf("unknown field: err = %v, want %v", err, errs.ErrInvalidSortField)
+	}
+}
+
+func TestGetAllOrdersIsOrderedByID(t *testing.T) {
+	repo, uc := newOrderUseCase(t, clock.NewFake(time.Unix(1700000000, 0)))
+	for _, id := range []string{"o3", "o1", "o2"} {
+		repo.CreateOrder(testOrderFrom(id, models.Location{Lat: 37.77, Lon: -122.42}, models.Location{Lat: 37.78, Lon: -122.42}))
+	}
+
+	// Repeated reads of the same state always agree
+	for range 5 {
+		orders, err := uc.GetAllOrders("", models.OrderFilter{})
+		if err != nil {
+			t.Fatalf("GetAllOrders: %v", err)
+		}
+		ids := make([]string, 0, len(orders))
+		for _, order := range orders {
+			ids = append(ids, order.ID)
+		}
+		if got := fmt.Sprint(ids); got != "[o1 o2 o3]" {
+			t.Fatalf("orders = %s, want [o1 o2 o3]", got)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package usecase
+
+import (
+	"delivery-state-manager/internal/models"
+	"delivery-state-manager/pkg/errs"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// Limits on order tags
+const (
+	maxOrderTags = 10
+	maxTagLength = 32
+)
+
+// tagPattern restricts tags to lowercase letters, digits, '-' and '_'
+var tagPattern = regexp.MustCompile(`^[a-z0-9_-]+$`)
+
+// schemaValidator checks the validate tags on the models. Fields are named
+// by their JSON keys so errors point at the request body, and the lat and
+// lon tags check coordinate ranges.
+var schemaValidator = newSchemaValidator()
+
+// newSchemaValidator creates the validator behind schemaValidator
+func newSchemaValidator() *validator.Validate {
+	validate := validator.New()
+	validate.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
+	validate.RegisterValidation("lat", func(fl validator.FieldLevel) bool {
+		lat := fl.Field().Float()
+		return lat >= -90 && lat <= 90
+	})
+	validate.RegisterValidation("lon", func(fl validator.FieldLevel) bool {
+		lon := fl.Field().Float()
+		return lon >= -180 && lon <= 180
+	})
+	return validate
+}
+
+// fieldValidator collects field errors so all of them can be reported together
+type fieldValidator struct {
+	fields map[string]string
+}
+
+// newFieldValidator creates an empty fieldValidator
+func newFieldValidator() *fieldValidator {
+	return &fieldValidator{fields: make(map[string]string)}
+}
+
+// check records message for field when ok is false, keeping the first message per field
+func (v *fieldValidator) check(ok bool, field, message string) {
+	if ok {
+		return
+	}
+	if _, exists := v.fields[field]; !exists {
+		v.fields[field] = message
+	}
+}
+
+// required records a "required" error for field when value is empty
+func (v *fieldValidator) required(value, field string) {
+	v.check(value != "", field, "required")
+}
+
+// text records errors for a free-form string that is longer than maxLength
+// characters or holds control characters such as line breaks, which could
+// forge log lines. A maxLength of zero disables the length check.
+func (v *fieldValidator) text(value, field string, maxLength int) {
+	v.check(maxLength <= 0 || utf8.RuneCountInString(value) <= maxLength, field, fmt.Sprintf("must be at most %d characters", maxLength))
+	v.check(!strings.ContainsFunc(value, unicode.IsControl), field, errs.ErrInvalidField.Error())
+}
+
+// schema records an error for every field of obj, a struct or pointer to
+// one, that breaks its validate tags. Field paths follow the JSON keys, such
+// as "pickup.lat" or "waypoints[1].lon", under the given prefix.
+func (v *fieldValidator) schema(obj any, prefix string) {
+	var fieldErrs validator.ValidationErrors
+	if !errors.As(schemaValidator.Struct(obj), &fieldErrs) {
+		return
+	}
+	for _, fe := range fieldErrs {
+		// The namespace starts with the struct's type name, such as
+		// "Order.pickup.lat"
+		_, path, _ := strings.Cut(fe.Namespace(), ".")
+		if prefix != "" {
+			path = prefix + "." + path
+		}
+		v.check(false, path, schemaMessage(fe))
+	}
+}
+
+// schemaMessage describes a failed validate tag
+func schemaMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "required"
+	case "lat", "lon":
+		return "out of range"
+	case "gte":
+		if fe.Param() == "0" {
+			return "must not be negative"
+		}
+		return "must be at least " + fe.Param()
+	case "lte":
+		return "must be at most " + fe.Param()
+	default:
+		return "is invalid"
+	}
+}
+
+// location records range errors for a coordinate under the given prefix
+func (v *fieldValidator) location(loc models.Location, prefix string) {
+	v.schema(loc, prefix)
+}
+
+// tags records errors for too many, malformed or duplicate tags
+func (v *fieldValidator) tags(tags []string, field string) {
+	v.check(len(tags) <= maxOrderTags, field, fmt.Sprintf("at most %d tags allowed", maxOrderTags))
+
+	seen := make(map[string]bool, len(tags))
+	for i, tag := range tags {
+		name := fmt.Sprintf("%s[%d]", field, i)
+		v.check(len(tag) > 0 && len(tag) <= maxTagLength, name, fmt.Sprintf("must be 1 to %d characters", maxTagLength))
+		v.check(tagPattern.MatchString(tag), name, "may only contain lowercase letters, digits, '-' and '_'")
+		v.check(!seen[tag], name, "duplicate tag")
+		seen[tag] = true
+	}
+}
+
+// storedDriver records errors for a driver loaded as-is rather than created
+// through the API
+func (v *fieldValidator) storedDriver(driver *models.Driver, prefix string) {
+	v.schema(driver, prefix)
+	v.check(models.IsValidDriverStatus(driver.Status), prefix+".status", errs.ErrInvalidStatusUpdate.Error())
+}
+
+// storedOrder records errors for an order loaded as-is rather than created
+// through the API
+func (v *fieldValidator) storedOrder(order *models.Order, prefix string) {
+	v.schema(order, prefix)
+	v.check(models.IsValidOrderStatus(order.Status), prefix+".status", errs.ErrInvalidStatusUpdate.Error())
+	v.tags(order.Tags, prefix+".tags")
+}
+
+// err returns a ValidationError if any field failed, or nil
+func (v *fieldValidator) err() error {
+	if len(v.fields) == 0 {
+		return nil
+	}
+	return &errs.ValidationError{Fields: v.fields}
+}
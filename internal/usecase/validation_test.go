@@ -0,0 +1,125 @@
+package usecase
+
+import (
+	"context"
+	"delivery-state-manager/internal/models"
+	"delivery-state-manager/internal/repository"
+	"delivery-state-manager/pkg/clock"
+	"delivery-state-manager/pkg/errs"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fieldErrors returns the invalid fields of a validation error, or nil
+func fieldErrors(err error) map[string]string {
+	var validationErr *errs.ValidationError
+	if !errors.As(err, &validationErr) {
+		return nil
+	}
+	return validationErr.Fields
+}
+
+func TestCreateDriverSanitizesText(t *testing.T) {
+	repo := repository.NewStateManager(repository.Config{GeoIndexEnabled: true})
+	uc := NewDriverUseCase(repo, clock.New(), DriverConfig{MaxIDLength: 8, MaxNameLength: 10})
+	newDriver := func(id, name string) *models.Driver {
+		return &models.Driver{ID: id, Name: name, Location: models.Location{Lat: 37.77, Lon: -122.42}}
+	}
+
+	if err := uc.CreateOrUpdateDriver(context.Background(), newDriver("  d1\t", " Ada  ")); err != nil {
+		t.Fatalf("CreateOrUpdateDriver: %v", err)
+	}
+	if driver, err := repo.GetDriver("d1"); err != nil || driver.Name != "Ada" {
+		t.Errorf("stored driver = %+v, %v; want d1 named Ada", driver, err)
+	}
+
+	for _, tc := range []struct {
+		name, id, driverName, field string
+	}{
+		{"overlong id", "driver-12", "Ada", "id"},
+		// Eight characters but more than eight bytes
+		{"multibyte id at the limit", "dríverüé", "Ada", ""},
+		{"overlong name", "d2", "Ada Lovelace", "name"},
+		{"newline in id", "d2\nd3", "Ada", "id"},
+		{"control character in name", "d2", "Ada\x1b[31m", "name"},
+	} {
+		fields := fieldErrors(uc.CreateOrUpdateDriver(context.Background(), newDriver(tc.id, tc.driverName)))
+		if tc.field == "" && fields != nil {
+			t.Errorf("%s: rejected with %v", tc.name, fields)
+		} else if tc.field != "" && fields[tc.field] == "" {
+			t.Errorf("%s: fields = %v, want %s rejected", tc.name, fields, tc.field)
+		}
+	}
+	if fields := fieldErrors(uc.CreateOrUpdateDriver(context.Background(), newDriver("d2\n", "Ada"))); fields != nil {
+		t.Errorf("trailing newline is trimmed, yet rejected with %v", fields)
+	}
+}
+
+func TestCreateOrderSanitizesText(t *testing.T) {
+	repo, uc := newOrderUseCase(t, clock.NewFake(time.Unix(1700000000, 0)), func(cfg *OrderConfig) { cfg.MaxIDLength = 8 })
+	pickup, dropoff := models.Location{Lat: 37.77, Lon: -122.42}, models.Location{Lat: 37.78, Lon: -122.42}
+
+	order := testOrderFrom(" o1 ", pickup, dropoff)
+	order.Customer = "\talice\n"
+	if err := uc.CreateOrder(context.Background(), order); err != nil {
+		t.Fatalf("CreateOrder: %v", err)
+	}
+	if stored, err := repo.GetOrder("o1"); err != nil || stored.Customer != "alice" {
+		t.Errorf("stored order = %+v, %v; want o1 for alice", stored, err)
+	}
+
+	for _, tc := range []struct {
+		name, id, customer, field string
+	}{
+		{"overlong id", "order-123", "alice", "id"},
+		{"overlong customer", "o2", strings.Repeat("a", 9), "customer"},
+		{"newline in customer", "o2", "alice\nbob", "customer"},
+		{"control character in id", "o\x002", "alice", "id"},
+	} {
+		order := testOrderFrom(tc.id, pickup, dropoff)
+		order.Customer = tc.customer
+		if fields := fieldErrors(uc.CreateOrder(context.Background(), order)); fields[tc.field] == "" {
+			t.Errorf("%s: fields = %v, want %s rejected", tc.name, fields, tc.field)
+		}
+	}
+}
+
+func TestSchemaReportsFieldPaths(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		obj    any
+		prefix string
+		want   map[string]string
+	}{
+		{"valid driver", &models.Driver{ID: "d1", Name: "Ada", Location: models.Location{Lat: 90, Lon: -180}}, "", map[string]string{}},
+		{"missing fields", &models.Driver{Location: models.Location{Lat: 37.77, Lon: -122.42}}, "", map[string]string{
+			"id":   "required",
+			"name": "required",
+		}},
+		{"bounds", &models.Driver{ID: "d1", Name: "Ada", Rating: 5.5, Capacity: -1, Location: models.Location{Lat: -90.5, Lon: 181}}, "", map[string]string{
+			"rating":       "must be at most 5",
+			"capacity":     "must not be negative",
+			"location.lat": "out of range",
+			"location.lon": "out of range",
+		}},
+		{"nested order locations", &models.Order{
+			ID:        "o1",
+			Customer:  "alice",
+			Pickup:    models.Location{Lat: 37.77, Lon: -122.42},
+			Dropoff:   models.Location{Lat: 100, Lon: -122.42},
+			Waypoints: []models.Location{{Lat: 37.78, Lon: -122.42}, {Lat: 37.78, Lon: -190}},
+		}, "orders[2]", map[string]string{
+			"orders[2].dropoff.lat":      "out of range",
+			"orders[2].waypoints[1].lon": "out of range",
+		}},
+	} {
+		v := newFieldValidator()
+		v.schema(tc.obj, tc.prefix)
+		if !reflect.DeepEqual(v.fields, tc.want) {
+			t.Errorf("%s: fields = %v, want %v", tc.name, v.fields, tc.want)
+		}
+	}
+}
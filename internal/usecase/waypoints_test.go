@@ -0,0 +1,71 @@
+package usecase
+
+import (
+	"context"
+	"delivery-state-manager/internal/models"
+	"delivery-state-manager/pkg/clock"
+	"delivery-state-manager/pkg/errs"
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestOrderETARoutesThroughWaypoints(t *testing.T) {
+	driverAt := models.Location{Lat: 37.75, Lon: -122.42}
+	pickup, dropoff := models.Location{Lat: 37.77, Lon: -122.42}, models.Location{Lat: 37.80, Lon: -122.42}
+	for _, waypoints := range [][]models.Location{
+		nil,
+		{{Lat: 37.78, Lon: -122.40}},
+		{{Lat: 37.78, Lon: -122.40}, {Lat: 37.79, Lon: -122.45}, {Lat: 37.79, Lon: -122.41}},
+	} {
+		repo, uc := newOrderUseCase(t, clock.NewFake(time.Unix(1700000000, 0)))
+		repo.CreateOrUpdateDriver(testDriverAt("d1", driverAt))
+		order := testOrderFrom("o1", pickup, dropoff)
+		order.Waypoints = waypoints
+		if err := uc.CreateOrder(context.Background(), order); err != nil {
+			t.Fatalf("CreateOrder with %d waypoints: %v", len(waypoints), err)
+		}
+		repo.AssignOrderToDriver("o1", "d1")
+
+		want := models.DistanceKm(driverAt, pickup)
+		prev := pickup
+		for _, stop := range append(waypoints, dropoff) {
+			want += models.DistanceKm(prev, stop)
+			prev = stop
+		}
+		eta, err := uc.GetOrderETA("o1")
+		if err != nil {
+			t.Fatalf("GetOrderETA: %v", err)
+		}
+		if math.Abs(eta.DistanceKm-want) > 1e-9 {
+			t.Errorf("%d waypoints: ETA distance = %.3fkm, want %.3fkm", len(waypoints), eta.DistanceKm, want)
+		}
+	}
+}
+
+func TestCreateOrderValidatesWaypoints(t *testing.T) {
+	_, uc := newOrderUseCase(t, clock.NewFake(time.Unix(1700000000, 0)))
+	order := testOrderFrom("o1", models.Location{Lat: 37.77, Lon: -122.42}, models.Location{Lat: 37.80, Lon: -122.42})
+	order.Waypoints = []models.Location{{Lat: 37.78, Lon: -122.42}, {Lat: 95, Lon: -122.42}}
+
+	var validationErr *errs.ValidationError
+	if err := uc.CreateOrder(context.Background(), order); !errors.As(err, &validationErr) || validationErr.Fields["waypoints[1].lat"] != "out of range" {
+		t.Errorf("err = %v, want waypoints[1].lat out of range", err)
+	}
+}
+
+func TestGetOrderCopiesWaypoints(t *testing.T) {
+	repo, uc := newOrderUseCase(t, clock.NewFake(time.Unix(1700000000, 0)))
+	order := testOrderFrom("o1", models.Location{Lat: 37.77, Lon: -122.42}, models.Location{Lat: 37.80, Lon: -122.42})
+	order.Waypoints = []models.Location{{Lat: 37.78, Lon: -122.42}}
+	if err := uc.CreateOrder(context.Background(), order); err != nil {
+		t.Fatalf("CreateOrder: %v", err)
+	}
+
+	read, _ := repo.GetOrder("o1")
+	read.Waypoints[0].Lat = 0
+	if again, _ := repo.GetOrder("o1"); again.Waypoints[0].Lat != 37.78 {
+		t.Errorf("changing a read order's waypoint changed the stored order: %v", again.Waypoints)
+	}
+}
@@ -3,11 +3,23 @@ package main
 import (
 	"delivery-state-manager/config"
 	"delivery-state-manager/internal/handler"
+	"delivery-state-manager/internal/models"
 	"delivery-state-manager/internal/repository"
 	"delivery-state-manager/internal/service"
 	"delivery-state-manager/internal/usecase"
+	"delivery-state-manager/pkg/clock"
+	"delivery-state-manager/pkg/logger"
 
+	"context"
+	"errors"
 	"log"
+	"net/http"
+	"os/signal"
+	"runtime"
+	"strings"
+	"syscall"
+
+	"github.com/gin-gonic/gin"
 )
 
 func main() {
@@ -15,29 +27,295 @@ func main() {
 	// Load config
 	config := config.LoadConfig()
 
+	// Configure log verbosity
+	logLevel, ok := logger.ParseLevel(config.LogLevel)
+	if !ok {
+		log.Printf("Unknown LOG_LEVEL %q, using info", config.LogLevel)
+	}
+	logger.SetLevel(logLevel)
+
+	switch config.GinMode {
+	case gin.DebugMode, gin.ReleaseMode, gin.TestMode:
+	default:
+		log.Fatalf("Unknown GIN_MODE %q (expected debug, release or test)", config.GinMode)
+	}
+
+	if config.APINaming != handler.NamingSnake && config.APINaming != handler.NamingCamel {
+		log.Fatalf("Unknown API_NAMING %q (expected snake or camel)", config.APINaming)
+	}
+
+	if config.DistanceUnit != models.UnitKilometers && config.DistanceUnit != models.UnitMiles {
+		log.Fatalf("Unknown DISTANCE_UNIT %q (expected km or mi)", config.DistanceUnit)
+	}
+
+	if config.APIErrorFormat != handler.ErrorFormatStructured && config.APIErrorFormat != handler.ErrorFormatLegacy {
+		log.Fatalf("Unknown API_ERROR_FORMAT %q (expected structured or legacy)", config.APIErrorFormat)
+	}
+
+	if p := config.APIVersionPrefix; p != "" && (!strings.HasPrefix(p, "/") || strings.HasSuffix(p, "/")) {
+		log.Fatalf("Invalid API_VERSION_PREFIX %q (expected a path such as /v1, or empty)", p)
+	}
+
+	featureFlags, err := handler.ParseFeatureFlags(config.FeatureFlags)
+	if err != nil {
+		log.Fatalf("Invalid FEATURE_FLAGS: %v", err)
+	}
+
+	switch config.MatcherMode {
+	case service.MatchNearest, service.MatchBalanced, service.MatchFIFO, service.MatchWeighted:
+	default:
+		log.Fatalf("Unknown MATCHER_MODE %q (expected nearest, balanced, fifo or weighted)", config.MatcherMode)
+	}
+
+	if config.WeightDistance < 0 || config.WeightRating < 0 || config.WeightAge < 0 || config.WeightHeading < 0 {
+		log.Fatalf("WEIGHT_DISTANCE, WEIGHT_RATING, WEIGHT_AGE and WEIGHT_HEADING must not be negative")
+	}
+
+	switch config.OrderAdmissionControl {
+	case usecase.AdmissionOff, usecase.AdmissionAdvisory, usecase.AdmissionEnforce:
+	default:
+		log.Fatalf("Unknown ORDER_ADMISSION_CONTROL %q (expected off, advisory or enforce)", config.OrderAdmissionControl)
+	}
+
+	switch config.RejectDuplicateLocations {
+	case usecase.DuplicateLocationsOff, usecase.DuplicateLocationsWarn, usecase.DuplicateLocationsReject:
+	default:
+		log.Fatalf("Unknown REJECT_DUPLICATE_LOCATIONS %q (expected off, warn or reject)", config.RejectDuplicateLocations)
+	}
+
+	if config.OfferDrivers < 1 {
+		log.Fatalf("OFFER_DRIVERS must be at least 1")
+	}
+
+	// ETAs divide by the speed, so zero or less would make every one
+	// infinite or negative
+	if config.DriverSpeedKmh <= 0 {
+		log.Fatalf("DRIVER_SPEED_KMH must be positive")
+	}
+
+	zones, err := models.ParseZones(config.Zones)
+	if err != nil {
+		log.Fatalf("Invalid ZONES: %v", err)
+	}
+
+	clk := clock.New()
+
 	// Initialize repository layer
-	repo := repository.NewStateManager()
+	storeConfig := repository.Config{
+		GeoIndexEnabled:      config.GeoIndexEnabled,
+		MaxDrivers:           config.MaxDrivers,
+		MaxOrders:            config.MaxOrders,
+		MaxOrdersPerCustomer: config.MaxOrdersPerCustomer,
+		LocationHistorySize:  config.LocationHistorySize,
+		CompactAfter:         config.StoreCompactAfter,
+		DriverCapacity:       config.DriverCapacity,
+		OfferLapseHalfLife:   config.OfferLapseHalfLife,
+		LockMetrics:          config.LockMetricsEnabled,
+		Clock:                clk,
+	}
+
+	// Order status changes are pushed to WEBHOOK_URL when it is set
+	var webhooks *service.Webhooks
+	if config.WebhookURL != "" {
+		statuses := make([]models.OrderStatus, 0, len(config.WebhookEvents))
+		for _, event := range config.WebhookEvents {
+			status := models.OrderStatus(event)
+			if !models.IsValidOrderStatus(status) {
+				log.Fatalf("Unknown order status %q in WEBHOOK_EVENTS", event)
+			}
+			statuses = append(statuses, status)
+		}
+		webhooks = service.NewWebhooks(service.WebhookConfig{
+			URL:          config.WebhookURL,
+			Secret:       config.WebhookSecret,
+			Statuses:     statuses,
+			MaxAttempts:  max(config.WebhookMaxAttempts, 1),
+			RetryBackoff: config.WebhookRetryBackoff,
+			Timeout:      config.WebhookTimeout,
+			Encode:       handler.OrderEncoder(config.APINaming, config.OmitZeroLocation, config.DistanceUnit, clk),
+		})
+		storeConfig.OnOrderStatus = webhooks.Notify
+	}
+
+	var repo repository.Store
+	switch config.StoreBackend {
+	case "file":
+		fileStore, err := repository.NewFileStore(config.StoreFilePath, storeConfig)
+		if err != nil {
+			log.Fatalf("Failed to open file store: %v", err)
+		}
+		repo = fileStore
+	case "memory":
+		repo = repository.NewStateManager(storeConfig)
+	default:
+		log.Fatalf("Unknown STORE_BACKEND %q (expected memory or file)", config.StoreBackend)
+	}
+
+	auditLog, err := repository.NewAuditLog(repository.AuditConfig{
+		Path:          config.AuditLogPath,
+		Size:          config.AuditLogSize,
+		FlushInterval: config.AuditFlushInterval,
+	})
+	if err != nil {
+		log.Fatalf("Failed to open audit log: %v", err)
+	}
+
+	assignmentMetrics := service.NewAssignmentMetrics(clk)
+	matcherBreaker := service.NewCircuitBreaker(clk, config.MatcherBreakerThreshold, config.MatcherBreakerCooldown)
 
 	// Initialize service layer
-	matcherService := service.NewMatcher(repo)
+	matcherService := service.NewMatcher(repo, clk, assignmentMetrics, matcherBreaker, service.MatcherConfig{
+		AgingWeight:        config.MatchAgingWeight,
+		MaxMatchAttempts:   config.MatchMaxAttempts,
+		Workers:            config.MatcherWorkers,
+		Mode:               config.MatcherMode,
+		BalanceToleranceKm: config.MatcherBalanceToleranceKm,
+		BalanceWindow:      config.MatcherBalanceWindow,
+		MaxDistanceKm:      config.MaxMatchDistanceKm,
+		Weights: models.ScoreWeights{
+			Distance: config.WeightDistance,
+			Rating:   config.WeightRating,
+			Age:      config.WeightAge,
+			Heading:  config.WeightHeading,
+		},
+		OfferDrivers:       config.OfferDrivers,
+		OfferTTL:           config.OfferTTL,
+		OfferLapseHalfLife: config.OfferLapseHalfLife,
+		Zones:              zones,
+		ZoneOverflow:       config.ZoneOverflow,
+	})
 
 	// Initialize use case layer
-	driverUC := usecase.NewDriverUseCase(repo)
-	orderUC := usecase.NewOrderUseCase(repo)
-	debugUC := usecase.NewDebugUseCase(repo)
+	driverUC := usecase.NewDriverUseCase(repo, clk, usecase.DriverConfig{
+		MaxIDLength:                config.MaxIDLength,
+		MaxNameLength:              config.MaxNameLength,
+		GenerateIDs:                config.GenerateDriverIDs,
+		DuplicateLocations:         config.RejectDuplicateLocations,
+		DuplicateLocationEpsilonKm: config.DuplicateLocationEpsilonM / 1000,
+		MaxBatchIDs:                config.MaxBatchIDs,
+		OfferLapseHalfLife:         config.OfferLapseHalfLife,
+	})
+	orderUC := usecase.NewOrderUseCase(repo, clk, assignmentMetrics, matcherService, usecase.OrderConfig{
+		MaxNotesLength:          config.MaxNotesLength,
+		MaxIDLength:             config.MaxIDLength,
+		GenerateIDs:             config.GenerateOrderIDs,
+		PickupDropoffEpsilonKm:  config.PickupDropoffEpsilonM / 1000,
+		IdempotencyTTL:          config.IdempotencyTTL,
+		IdempotencyMaxKeys:      config.IdempotencyMaxKeys,
+		DriverSpeedKmh:          config.DriverSpeedKmh,
+		BaseFare:                config.BaseFare,
+		PerKmRate:               config.PerKmRate,
+		MinOrderValue:           config.MinOrderValue,
+		MaxClockSkew:            config.MaxClockSkew,
+		DriverCooldown:          config.DriverCooldown,
+		RequireCustomerToCancel: config.CancelRequiresCustomer,
+		Zones:                   zones,
+		CancelReasons:           config.CancelReasons,
+		Admission: usecase.AdmissionConfig{
+			Mode:            config.OrderAdmissionControl,
+			MaxBacklogRatio: config.OrderAdmissionMaxRatio,
+			Sustain:         config.OrderAdmissionSustain,
+			TripTime:        config.OrderAdmissionTripTime,
+		},
+	})
+	movementSim := service.NewMovementSimulator(repo, clk, config.SimulationTick)
+	debugUC := usecase.NewDebugUseCase(repo, clk, assignmentMetrics, matcherBreaker, matcherService, auditLog, movementSim, usecase.DebugConfig{
+		StuckAssignedThreshold: config.StuckAssignedThreshold,
+		StuckPickedUpThreshold: config.StuckPickedUpThreshold,
+		MatcherStallFactor:     max(config.MatcherStallFactor, 1),
+		DriverSpeedKmh:         config.DriverSpeedKmh,
+		StateMaxWait:           config.DebugStateMaxWait,
+	})
+
+	// Sample lock contention so the mutex profile has something to show
+	if config.PprofEnabled {
+		runtime.SetMutexProfileFraction(100)
+	}
 
 	// Initialize handler layer
-	h := handler.NewHandler(driverUC, orderUC, debugUC)
+	h := handler.NewHandler(driverUC, orderUC, debugUC, clk, handler.Config{
+		DefaultPageSize:       config.DefaultPageSize,
+		MaxPageSize:           config.MaxPageSize,
+		GinMode:               config.GinMode,
+		Naming:                config.APINaming,
+		OmitZeroLocation:      config.OmitZeroLocation,
+		DistanceUnit:          config.DistanceUnit,
+		ResetEnabled:          config.DebugResetEnabled,
+		RestoreEnabled:        config.DebugRestoreEnabled,
+		MatchEnabled:          config.DebugMatchEnabled,
+		SeedEnabled:           config.DebugSeedEnabled,
+		PprofEnabled:          config.PprofEnabled,
+		SimulateEnabled:       config.DebugSimulateEnabled,
+		MetricsEnabled:        config.LockMetricsEnabled,
+		DebugToken:            config.DebugToken,
+		ErrorFormat:           config.APIErrorFormat,
+		VersionPrefix:         config.APIVersionPrefix,
+		UnversionedRoutes:     config.APIUnversionedRoutes,
+		FeatureFlags:          featureFlags,
+		StrictStatus:          config.StrictStatus,
+		MaxConcurrentRequests: config.MaxConcurrentRequests,
+		MaxConcurrentReads:    config.MaxConcurrentReads,
+		MaxConcurrentWrites:   config.MaxConcurrentWrites,
+		RequestTimeout:        config.RequestTimeout,
+		WriteTimeout:          config.WriteTimeout,
+		ListCacheTTL:          config.ListCacheTTL,
+		MaxStateBytes:         config.DebugStateMaxBytes,
+	})
+
+	// Stop the matcher and server on SIGINT or SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
 	// Start background matcher
-	go matcherService.StartMatcher(config.MatcherInterval)
+	matcherDone := make(chan struct{})
+	go func() {
+		matcherService.StartMatcher(ctx, config.MatcherInterval)
+		close(matcherDone)
+	}()
+	go matcherService.StartOfferSweeper(ctx, config.OfferSweepInterval)
 
 	// Setup HTTP router
 	router := h.SetupRouter()
 
 	// Start HTTP server
-	log.Printf("Server listening on %s", config.ServerPort)
-	if err := router.Run(config.ServerPort); err != nil {
-		log.Fatalf("Server failed to start: %v", err)
+	server := handler.NewServer(config.ServerPort, router, handler.ServerTimeouts{
+		Read:  config.ReadTimeout,
+		Write: config.WriteTimeout,
+		Idle:  config.IdleTimeout,
+	})
+
+	serverErr := make(chan error, 1)
+	go func() {
+		log.Printf("Server listening on %s", config.ServerPort)
+		serverErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serverErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Server failed to start: %v", err)
+		}
+	case <-ctx.Done():
+	}
+
+	// Stop accepting connections and let in-flight requests finish
+	log.Printf("Shutting down, draining requests for up to %v", config.ShutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), config.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Server shutdown did not complete: %v", err)
+	}
+	<-matcherDone
+	movementSim.Stop()
+	auditLog.Close()
+	if webhooks != nil {
+		webhooks.Close()
+	}
+
+	if flusher, ok := repo.(repository.Flusher); ok {
+		if err := flusher.Flush(); err != nil {
+			log.Printf("Failed to save state on shutdown: %v", err)
+		}
 	}
+	log.Println("Delivery State Manager stopped")
 }
@@ -0,0 +1,21 @@
+package clock
+
+import "time"
+
+// Clock provides the current time so time-dependent logic can be controlled
+type Clock interface {
+	Now() time.Time
+}
+
+// realClock reads the system wall clock
+type realClock struct{}
+
+// New returns a Clock backed by the system wall clock
+func New() Clock {
+	return realClock{}
+}
+
+// Now returns the current system time
+func (realClock) Now() time.Time {
+	return time.Now()
+}
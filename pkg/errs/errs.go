@@ -1,14 +1,98 @@
 package errs
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
 
+// Sentinel errors, each with a stable code clients can match on instead of
+// the message
 var (
-	ErrInvalidInput         = errors.New("invalid input")
-	ErrMissingRequiredField = errors.New("missing required field")
-	ErrInvalidStatusUpdate  = errors.New("invalid status update")
-	ErrInvalidTransition    = errors.New("invalid state transition")
-	ErrDriverNotAvailable   = errors.New("driver is not available")
-	ErrOrderAlreadyAssigned = errors.New("order is already assigned")
-	ErrDriverNotFound       = errors.New("driver not found")
-	ErrOrderNotFound        = errors.New("order not found")
+	ErrInvalidInput           = New("INVALID_INPUT", "invalid input")
+	ErrMissingRequiredField   = New("MISSING_REQUIRED_FIELD", "missing required field")
+	ErrInvalidStatusUpdate    = New("INVALID_STATUS", "invalid status update")
+	ErrInvalidField           = New("INVALID_FIELD", "must not contain control characters or line breaks")
+	ErrInvalidSortField       = New("INVALID_SORT_FIELD", "invalid sort field")
+	ErrInvalidTransition      = New("INVALID_TRANSITION", "invalid state transition")
+	ErrDriverNotAvailable     = New("DRIVER_NOT_AVAILABLE", "driver is not available")
+	ErrDriverDailyLimit       = New("DRIVER_DAILY_LIMIT", "driver has reached their daily order limit")
+	ErrNoEligibleDriver       = New("NO_ELIGIBLE_DRIVER", "no available driver within the matching radius")
+	ErrDriverStatusConflict   = New("DRIVER_STATUS_CONFLICT", "driver status does not match expected status")
+	ErrDriverHasActiveOrder   = New("DRIVER_HAS_ACTIVE_ORDER", "driver has active orders")
+	ErrOrderAlreadyAssigned   = New("ORDER_ALREADY_ASSIGNED", "order is already assigned")
+	ErrDriverNotFound         = New("DRIVER_NOT_FOUND", "driver not found")
+	ErrDriverDeleted          = New("DRIVER_DELETED", "driver was deleted and its ID cannot be reused")
+	ErrNotOrderOwner          = New("NOT_ORDER_OWNER", "order belongs to a different customer")
+	ErrOrderNotFound          = New("ORDER_NOT_FOUND", "order not found")
+	ErrOrderExists            = New("ORDER_EXISTS", "an order with this ID already exists")
+	ErrScheduledInPast        = New("SCHEDULED_IN_PAST", "scheduled time is in the past")
+	ErrNotesTooLong           = New("NOTES_TOO_LONG", "notes exceed maximum length")
+	ErrPickupEqualsDropoff    = New("PICKUP_EQUALS_DROPOFF", "dropoff must differ from pickup")
+	ErrOrderBelowMinimum      = New("ORDER_BELOW_MINIMUM", "order price is below the minimum order value")
+	ErrOrderNotInTransit      = New("ORDER_NOT_IN_TRANSIT", "order is not assigned to a driver or has already finished")
+	ErrOrderNotAssigned       = New("ORDER_NOT_ASSIGNED", "order has no assigned driver")
+	ErrPickupChanged          = New("PICKUP_CHANGED", "order pickup changed since it was read")
+	ErrOrderBundled           = New("ORDER_BUNDLED", "order belongs to a bundle")
+	ErrBundleExceedsCapacity  = New("BUNDLE_EXCEEDS_CAPACITY", "driver cannot carry every order of the bundle")
+	ErrOfferNotOpen           = New("OFFER_NOT_OPEN", "order has no open offer for this driver")
+	ErrDuplicateLocation      = New("DUPLICATE_LOCATION", "another active driver reports the same location")
+	ErrCapacityExceeded       = New("CAPACITY_EXCEEDED", "capacity exceeded")
+	ErrCustomerOrderLimit     = New("CUSTOMER_ORDER_LIMIT", "customer has too many active orders")
+	ErrIdempotencyKeyConflict = New("IDEMPOTENCY_KEY_CONFLICT", "idempotency key was already used with a different request")
 )
+
+// CodeValidationFailed is the code of every ValidationError
+const CodeValidationFailed = "VALIDATION_FAILED"
+
+// codedError is an error with a stable machine-readable code
+type codedError struct {
+	code    string
+	message string
+}
+
+// Error returns the human-readable message
+func (e *codedError) Error() string {
+	return e.message
+}
+
+// New creates an error that reports code through Code
+func New(code, message string) error {
+	return &codedError{code: code, message: message}
+}
+
+// Code returns the stable code of err, or "" if err carries none. Wrapped
+// errors report the code of the first coded error in their chain.
+func Code(err error) string {
+	var coded *codedError
+	if errors.As(err, &coded) {
+		return coded.code
+	}
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		return CodeValidationFailed
+	}
+	return ""
+}
+
+// ValidationError reports every invalid field of a request at once.
+// Fields maps a JSON field path (e.g. "pickup.lat") to what is wrong with it.
+type ValidationError struct {
+	Fields map[string]string
+}
+
+// Error returns a summary listing the invalid fields
+func (e *ValidationError) Error() string {
+	fields := make([]string, 0, len(e.Fields))
+	for field := range e.Fields {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fmt.Sprintf("validation failed: %s", strings.Join(fields, ", "))
+}
+
+// Is lets callers match validation failures against ErrInvalidInput
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrInvalidInput
+}
@@ -0,0 +1,56 @@
+package errs
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestSentinelCodes(t *testing.T) {
+	for err, want := range map[error]string{
+		ErrInvalidStatusUpdate:    "INVALID_STATUS",
+		ErrInvalidSortField:       "INVALID_SORT_FIELD",
+		ErrInvalidTransition:      "INVALID_TRANSITION",
+		ErrDriverNotAvailable:     "DRIVER_NOT_AVAILABLE",
+		ErrDriverDailyLimit:       "DRIVER_DAILY_LIMIT",
+		ErrNoEligibleDriver:       "NO_ELIGIBLE_DRIVER",
+		ErrDriverStatusConflict:   "DRIVER_STATUS_CONFLICT",
+		ErrDriverHasActiveOrder:   "DRIVER_HAS_ACTIVE_ORDER",
+		ErrOrderAlreadyAssigned:   "ORDER_ALREADY_ASSIGNED",
+		ErrDriverNotFound:         "DRIVER_NOT_FOUND",
+		ErrDriverDeleted:          "DRIVER_DELETED",
+		ErrNotOrderOwner:          "NOT_ORDER_OWNER",
+		ErrOrderNotFound:          "ORDER_NOT_FOUND",
+		ErrOrderExists:            "ORDER_EXISTS",
+		ErrOrderBelowMinimum:      "ORDER_BELOW_MINIMUM",
+		ErrOrderNotInTransit:      "ORDER_NOT_IN_TRANSIT",
+		ErrOrderNotAssigned:       "ORDER_NOT_ASSIGNED",
+		ErrOrderBundled:           "ORDER_BUNDLED",
+		ErrBundleExceedsCapacity:  "BUNDLE_EXCEEDS_CAPACITY",
+		ErrOfferNotOpen:           "OFFER_NOT_OPEN",
+		ErrDuplicateLocation:      "DUPLICATE_LOCATION",
+		ErrCapacityExceeded:       "CAPACITY_EXCEEDED",
+		ErrCustomerOrderLimit:     "CUSTOMER_ORDER_LIMIT",
+		ErrIdempotencyKeyConflict: "IDEMPOTENCY_KEY_CONFLICT",
+	} {
+		if got := Code(err); got != want {
+			t.Errorf("Code(%q) = %s, want %s", err, got, want)
+		}
+	}
+}
+
+func TestCodeOfWrappedAndPlainErrors(t *testing.T) {
+	if got := Code(fmt.Errorf("loading o1: %w", ErrOrderNotFound)); got != "ORDER_NOT_FOUND" {
+		t.Errorf("wrapped sentinel: code = %s, want ORDER_NOT_FOUND", got)
+	}
+	validationErr := &ValidationError{Fields: map[string]string{"name": "required"}}
+	if got := Code(validationErr); got != CodeValidationFailed {
+		t.Errorf("validation error: code = %s, want %s", got, CodeValidationFailed)
+	}
+	if !errors.Is(validationErr, ErrInvalidInput) {
+		t.Error("validation error does not match ErrInvalidInput")
+	}
+	if got := Code(errors.New("plain")); got != "" {
+		t.Errorf("plain error: code = %q, want none", got)
+	}
+}
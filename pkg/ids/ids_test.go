@@ -0,0 +1,22 @@
+package ids
+
+import (
+	"regexp"
+	"testing"
+)
+
+var uuidV4 = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+func TestNewIsUniqueUUIDv4(t *testing.T) {
+	seen := make(map[string]bool)
+	for range 1000 {
+		id := New()
+		if !uuidV4.MatchString(id) {
+			t.Fatalf("New() = %q, not a version 4 UUID", id)
+		}
+		if seen[id] {
+			t.Fatalf("New() returned %q twice", id)
+		}
+		seen[id] = true
+	}
+}
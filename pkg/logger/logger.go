@@ -0,0 +1,48 @@
+package logger
+
+import (
+	"log"
+	"sync/atomic"
+)
+
+// Level controls which messages are written
+type Level int32
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+)
+
+var level atomic.Int32
+
+func init() {
+	level.Store(int32(LevelInfo))
+}
+
+// ParseLevel converts a LOG_LEVEL value to a Level, reporting whether it was recognized
+func ParseLevel(value string) (Level, bool) {
+	switch value {
+	case "debug":
+		return LevelDebug, true
+	case "info":
+		return LevelInfo, true
+	}
+	return LevelInfo, false
+}
+
+// SetLevel sets the minimum level that is written
+func SetLevel(l Level) {
+	level.Store(int32(l))
+}
+
+// DebugEnabled reports whether debug messages are written
+func DebugEnabled() bool {
+	return Level(level.Load()) <= LevelDebug
+}
+
+// Debugf writes a debug message when the level allows it
+func Debugf(format string, args ...any) {
+	if DebugEnabled() {
+		log.Printf(format, args...)
+	}
+}